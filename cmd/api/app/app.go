@@ -3,16 +3,26 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/bryryann/mantel/backend/cmd/api/appcontext"
 	"github.com/bryryann/mantel/backend/cmd/api/config"
 	"github.com/bryryann/mantel/backend/cmd/api/database"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/jobs"
+	"github.com/bryryann/mantel/backend/internal/mailer"
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/bryryann/mantel/backend/internal/ranking"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/bryryann/mantel/backend/internal/webhook"
+	"github.com/bryryann/mantel/backend/internal/webpush"
 )
 
 // App is the application container that holds:
@@ -26,6 +36,15 @@ type App struct {
 	Models    *data.Models
 	Context   *appcontext.Context
 	Responses *responses.Responses
+	Ranker    ranking.Ranker     // Orders the ranked "For You" feed.
+	Hub       *realtime.Hub      // Delivers events to the clients connected to this instance.
+	Events    realtime.Publisher // Publishes events to the clients of every instance.
+	VAPID     *webpush.VAPID     // Identifies the API to push services. Nil when Web Push is disabled.
+	Push      *webpush.Worker    // Delivers Web Push messages. Nil when Web Push is disabled.
+	Mailer    mailer.Mailer      // Sends emails. Nil when emails are disabled.
+	Webhooks  *webhook.Worker    // Delivers events to the webhooks users register.
+	Outbox    *outbox.Relay      // Relays domain events to the consumers registered on it.
+	Jobs      *jobs.Worker       // Runs the background jobs of the handlers registered on it.
 	mu        sync.RWMutex
 }
 
@@ -41,6 +60,7 @@ func Get() *App {
 		instance = &App{
 			Context:   &appcontext.Context{},
 			Responses: responses.Get(),
+			Ranker:    ranking.NewScorer(ranking.DefaultWeights),
 		}
 	})
 
@@ -70,6 +90,231 @@ func (a *App) SetModels() {
 	}
 
 	a.Models = data.NewModels(a.Database.DB)
+
+	if a.Config != nil {
+		a.Models.Feed = data.NewFeed(a.Database.DB, a.Config.Feed.Strategy)
+	}
+}
+
+// SetRealtime creates the event hub and the Postgres bridge relaying events
+// between instances. The returned bridge must be started with Listen.
+func (a *App) SetRealtime() *realtime.Bridge {
+	a.Hub = realtime.NewHub(a.Config.Stream.Buffer)
+
+	bridge := realtime.NewBridge(a.Database.DB, a.Config.DSN, a.Hub, a.Logger)
+	a.Events = bridge
+
+	return bridge
+}
+
+// SetPush sets up Web Push delivery when a VAPID key is configured, pruning
+// the subscriptions push services report gone. The returned worker must be
+// started with Run; it is nil when Web Push is disabled.
+func (a *App) SetPush() (*webpush.Worker, error) {
+	cfg := a.Config.Push
+	if cfg.VAPIDPrivateKey == "" {
+		return nil, nil
+	}
+
+	vapid, err := webpush.NewVAPID(cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &webpush.Client{
+		HTTPClient: webpush.NewHTTPClient(10*time.Second, cfg.AllowPrivate),
+		VAPID:      vapid,
+		TTL:        cfg.TTL,
+	}
+
+	worker := webpush.NewWorker(client, webpush.WorkerOptions{
+		Queue:       cfg.Queue,
+		Concurrency: cfg.Workers,
+		Retries:     cfg.Retries,
+		Backoff:     cfg.Backoff,
+		OnGone: func(sub webpush.Subscription) {
+			if err := a.Models.Push.DeleteEndpoint(sub.Endpoint); err != nil {
+				a.Logger.Error("failed to prune push subscription", "error", err.Error())
+			}
+		},
+	}, a.Logger)
+
+	a.VAPID = vapid
+	a.Push = worker
+
+	return worker, nil
+}
+
+// webhookStore is the webhook.Store of the webhook_deliveries table.
+type webhookStore struct {
+	data.WebhookModel
+	disableAfter int
+}
+
+func (s webhookStore) Failed(d webhook.Delivery, attempt webhook.Attempt, retryAt *time.Time) error {
+	return s.WebhookModel.Failed(d, attempt, retryAt, s.disableAfter)
+}
+
+// SetWebhooks sets up the delivery of events to webhooks. The returned
+// worker must be started with Run.
+func (a *App) SetWebhooks() *webhook.Worker {
+	cfg := a.Config.Webhooks
+
+	client := &webhook.Client{
+		HTTPClient: webhook.NewHTTPClient(cfg.Timeout, cfg.AllowPrivate),
+		UserAgent:  "Mantel-Webhooks/1.0",
+	}
+
+	store := webhookStore{WebhookModel: a.Models.Webhooks, disableAfter: cfg.DisableAfter}
+
+	worker := webhook.NewWorker(client, store, webhook.WorkerOptions{
+		Interval:    cfg.Interval,
+		Batch:       cfg.Batch,
+		Concurrency: cfg.Workers,
+		MaxAttempts: cfg.MaxAttempts,
+		Backoff:     cfg.Backoff,
+		MaxBackoff:  cfg.MaxBackoff,
+		Timeout:     cfg.Timeout,
+	}, a.Logger)
+
+	a.Webhooks = worker
+
+	return worker
+}
+
+// SetOutbox sets up the relay of domain events from the outbox. Consumers
+// must be registered on the returned relay before it is started with Run.
+func (a *App) SetOutbox() *outbox.Relay {
+	cfg := a.Config.Outbox
+
+	relay := outbox.NewRelay(a.Models.Outbox, outbox.RelayOptions{
+		Interval:    cfg.Interval,
+		Batch:       cfg.Batch,
+		Lease:       cfg.Lease,
+		Backoff:     cfg.Backoff,
+		MaxBackoff:  cfg.MaxBackoff,
+		MaxAttempts: cfg.MaxAttempts,
+	}, a.Logger)
+
+	a.Outbox = relay
+
+	return relay
+}
+
+// SetJobs sets up the background jobs worker. Job handlers and schedules
+// must be registered on the returned worker before it is started with Run.
+func (a *App) SetJobs() *jobs.Worker {
+	cfg := a.Config.Jobs
+
+	worker := jobs.NewWorker(a.Database.DB, jobs.WorkerOptions{
+		Concurrency:  cfg.Concurrency,
+		Interval:     cfg.Interval,
+		Lease:        cfg.Lease,
+		Backoff:      cfg.Backoff,
+		MaxBackoff:   cfg.MaxBackoff,
+		Timeout:      cfg.Timeout,
+		DrainTimeout: cfg.DrainTimeout,
+	}, a.Logger)
+
+	a.Jobs = worker
+
+	return worker
+}
+
+// SetMailer sets up the configured mailer, if any.
+func (a *App) SetMailer() {
+	cfg := a.Config.Mail
+
+	switch cfg.Mailer {
+	case "smtp":
+		a.Mailer = mailer.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	case "dir":
+		a.Mailer = mailer.DirMailer{Dir: cfg.Dir}
+	}
+}
+
+// Publish publishes an event of type typ with data on topic, in the
+// background. It is a no-op when real-time events aren't set up.
+func (a *App) Publish(topic, typ string, data any) {
+	if a.Events == nil {
+		return
+	}
+
+	a.Background("publish "+typ, func() error {
+		e, err := realtime.NewEvent(topic, typ, data)
+		if err != nil {
+			return err
+		}
+		return a.Events.Publish(e)
+	})
+}
+
+// EnqueueWebhook queues event with data for the webhooks of userIDs
+// subscribed to it. It is a no-op when webhooks aren't set up.
+func (a *App) EnqueueWebhook(userIDs []int64, event string, data any) error {
+	if a.Webhooks == nil {
+		return nil
+	}
+
+	n, err := a.Models.Webhooks.Enqueue(userIDs, event, data)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		a.Webhooks.Notify()
+	}
+	return nil
+}
+
+// NotifyOutbox makes the outbox relay look for new domain events right away,
+// after a change recorded some. It is a no-op when the relay isn't set up.
+func (a *App) NotifyOutbox() {
+	if a.Outbox != nil {
+		a.Outbox.Notify()
+	}
+}
+
+// Enqueue adds a job of the given kind with payload to the background jobs
+// queue and wakes up the worker to run it.
+func (a *App) Enqueue(kind string, payload any, opts jobs.EnqueueOptions) (*jobs.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	job, err := jobs.Enqueue(ctx, a.Database.DB, kind, payload, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Jobs != nil {
+		a.Jobs.Notify()
+	}
+	return job, nil
+}
+
+// IsAdmin reports whether userID may use the admin endpoints.
+func (a *App) IsAdmin(userID int64) bool {
+	return slices.Contains(a.Config.Admins, userID)
+}
+
+// Background runs fn in its own goroutine, for work that must not hold up or
+// fail the request that triggered it. Errors and panics are logged.
+func (a *App) Background(name string, fn func() error) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				a.Logger.Error("background task panicked", "task", name, "panic", fmt.Sprint(err))
+			}
+		}()
+
+		if err := fn(); err != nil {
+			a.Logger.Error("background task failed", "task", name, "error", err.Error())
+		}
+	}()
 }
 
 // ConfigureLogger sets the global application logger.
@@ -3,10 +3,15 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/bryryann/mantel/backend/cmd/api/helpers"
+	"github.com/bryryann/mantel/backend/internal/data"
 )
 
 type JWT struct {
@@ -15,12 +20,165 @@ type JWT struct {
 	Audience string
 }
 
+// Reactions configures which reactions users can leave on posts.
+type Reactions struct {
+	Allowed       []string // Reactions users may pick from. Always contains data.LikeReaction.
+	SinglePerPost bool     // Whether a new reaction replaces the user's previous one on a post.
+}
+
+// Feed configures how home timelines are built.
+type Feed struct {
+	Strategy      data.FeedStrategy
+	PullThreshold int // Audience size from which an author's posts are pulled on read instead of fanned out.
+	Backfill      int // Number of recent posts copied into a timeline on follow or friend accept.
+}
+
+// Explore configures the trending posts shown on the explore page.
+type Explore struct {
+	Windows         []data.TrendingWindow // Windows posts trend over. The first one is the default.
+	RefreshInterval time.Duration         // How often trending posts are recomputed.
+	Trending        data.TrendingOptions
+}
+
+// Stream configures the real-time event stream.
+type Stream struct {
+	Buffer    int           // Events buffered per connection before a slow client is dropped.
+	Heartbeat time.Duration // Interval between keep-alive messages on idle connections.
+}
+
+// Messaging configures direct messages.
+type Messaging struct {
+	Policy          data.MessagingPolicy // Which users may message each other one-to-one, or add each other to groups.
+	MaxGroupMembers int                  // Maximum number of members of a group conversation.
+}
+
+// Push configures Web Push notifications. They are disabled when no VAPID
+// private key is set.
+type Push struct {
+	VAPIDPrivateKey string        // Base64url encoded P-256 private key identifying the API to push services.
+	VAPIDSubject    string        // mailto: or https: URL push services may contact the operator at.
+	TTL             time.Duration // How long push services keep messages for offline devices.
+	Queue           int           // Messages waiting to be sent before new ones are dropped.
+	Workers         int           // Messages sent at the same time.
+	Retries         int           // Attempts made after a temporary delivery failure.
+	Backoff         time.Duration // Wait before the first retry, doubled on each following one.
+	AllowPrivate    bool          // Whether subscriptions may point at loopback or private addresses.
+}
+
+// Mail configures how emails are sent. Emails are disabled when no mailer is
+// set.
+type Mail struct {
+	Mailer       string // "smtp" to send through SMTP, or "dir" to write emails to Dir.
+	From         string
+	Dir          string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Digest configures the activity digests emailed to inactive users.
+type Digest struct {
+	DefaultFrequency data.DigestFrequency // Frequency of users who never picked one.
+	InactiveAfter    time.Duration        // Time without logging in after which users get digests.
+	Interval         time.Duration        // How often due digests are looked for.
+	Batch            int                  // Digests sent per run, at most.
+	AppURL           string               // Web client URL the digests link to.
+	APIURL           string               // Public URL of the API, for unsubscribe links.
+	Secret           []byte               // Signs unsubscribe links.
+}
+
+// Suggestions configures follow suggestions.
+type Suggestions struct {
+	RefreshInterval time.Duration // How often stale suggestions are looked for.
+	MaxAge          time.Duration // Age from which a user's suggestions are recomputed.
+	ActiveWithin    time.Duration // Only users who logged in this recently get suggestions precomputed.
+	Batch           int           // Users whose suggestions are recomputed per run, at most.
+	Options         data.SuggestionOptions
+}
+
+// Imports configures bulk follow imports.
+type Imports struct {
+	MaxRows    int   // Usernames per import.
+	MaxBytes   int64 // Size of an uploaded file.
+	Limit      int   // Imports a user can start per Window.
+	Window     time.Duration
+	StaleAfter time.Duration // Time after which a running import whose worker went silent is resumed.
+}
+
+// Webhooks configures the delivery of events to the webhooks users register.
+type Webhooks struct {
+	MaxPerUser   int           // Webhooks a user can register.
+	Interval     time.Duration // How often due deliveries are looked for.
+	Batch        int           // Deliveries claimed at once.
+	Workers      int           // Deliveries sent at the same time.
+	MaxAttempts  int           // Attempts made at a delivery before giving up on it.
+	Backoff      time.Duration // Wait before the first retry, doubled on each following one.
+	MaxBackoff   time.Duration // Longest wait between two attempts.
+	Timeout      time.Duration // Time limit of each attempt.
+	DisableAfter int           // Failed attempts in a row after which a webhook is disabled.
+	AllowPrivate bool          // Whether webhooks may point at loopback or private addresses.
+}
+
+// Outbox configures the relay of domain events to their consumers.
+type Outbox struct {
+	Interval    time.Duration // How often new events are looked for.
+	Batch       int           // Events read at once.
+	Lease       time.Duration // How long a consumer stays with an instance after it last read events for it.
+	Backoff     time.Duration // Wait before handing a failed event over again, doubled on each following failure.
+	MaxBackoff  time.Duration // Longest wait between two attempts.
+	MaxAttempts int           // Attempts made at an event before a consumer skips it; 0 retries forever.
+	Retention   time.Duration // Time events handled by every consumer are kept.
+}
+
+// Jobs configures the background job workers.
+type Jobs struct {
+	Concurrency  int           // Jobs run at the same time by an instance.
+	Interval     time.Duration // How often due jobs are looked for.
+	Lease        time.Duration // How long a job stays claimed without news of its worker before it is run again.
+	Backoff      time.Duration // Wait before the first retry of a failed job, doubled on each following one.
+	MaxBackoff   time.Duration // Longest wait between two attempts.
+	Timeout      time.Duration // Time limit of each attempt.
+	DrainTimeout time.Duration // Time running jobs get to finish on shutdown before being put back.
+	Retention    time.Duration // Time succeeded jobs are kept.
+}
+
 // Configuration holds the values used to setup the application
 type Configuration struct {
-	Port int    // Port in which the API will be hosted.
-	Env  string // Current application environment (DEVELOPMENT, PRODUCTION, etc).
-	DSN  string
-	JWT  JWT
+	Port      int    // Port in which the API will be hosted.
+	Env       string // Current application environment (DEVELOPMENT, PRODUCTION, etc).
+	DSN       string
+	JWT       JWT
+	Reactions Reactions
+	MaxPins   int // Maximum number of posts a user can pin to their profile.
+
+	FriendRequestCooldown time.Duration // Wait before a user can ask someone who declined them again.
+
+	Feed      Feed
+	Explore   Explore
+	Stream    Stream
+	Messaging Messaging
+	Push      Push
+	Mail      Mail
+	Digest    Digest
+
+	Suggestions Suggestions
+
+	MaxListMembers int // Maximum number of accounts in a user list.
+
+	Imports Imports
+
+	Webhooks Webhooks
+
+	Outbox Outbox
+
+	Jobs Jobs
+
+	// Admins are the ids of the users allowed to use the admin endpoints.
+	Admins []int64
+
+	// CursorSecret signs pagination cursors. Defaults to the JWT secret.
+	CursorSecret []byte
 }
 
 var (
@@ -52,6 +210,373 @@ func Load() *Configuration {
 			log.Fatal("Missing jwt secret/issuer/audience\n")
 		}
 
+		// reactions
+		allowedReactions := helpers.GetEnvList("REACTIONS_ALLOWED", data.DefaultReactions)
+		if !slices.Contains(allowedReactions, data.LikeReaction) {
+			allowedReactions = append([]string{data.LikeReaction}, allowedReactions...)
+		}
+
+		singleReaction, err := helpers.GetEnvBool("REACTIONS_SINGLE_PER_POST", true)
+		if err != nil {
+			log.Fatalf("Invalid REACTIONS_SINGLE_PER_POST value: %v", err)
+		}
+
+		// pins
+		maxPins, err := helpers.GetEnvInt("PINNED_POSTS_MAX", 3)
+		if err != nil {
+			log.Fatalf("Invalid PINNED_POSTS_MAX value: %v", err)
+		}
+
+		// friendships
+		friendRequestCooldown, err := helpers.GetEnvDuration("FRIEND_REQUEST_COOLDOWN", 7*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid FRIEND_REQUEST_COOLDOWN value: %v", err)
+		}
+
+		// lists
+		maxListMembers, err := helpers.GetEnvInt("LISTS_MAX_MEMBERS", 5000)
+		if err != nil {
+			log.Fatalf("Invalid LISTS_MAX_MEMBERS value: %v", err)
+		}
+
+		// follow imports
+		importMaxRows, err := helpers.GetEnvInt("IMPORTS_MAX_ROWS", 5000)
+		if err != nil {
+			log.Fatalf("Invalid IMPORTS_MAX_ROWS value: %v", err)
+		}
+
+		importMaxBytes, err := helpers.GetEnvInt("IMPORTS_MAX_BYTES", 1<<20)
+		if err != nil {
+			log.Fatalf("Invalid IMPORTS_MAX_BYTES value: %v", err)
+		}
+
+		importLimit, err := helpers.GetEnvInt("IMPORTS_LIMIT", 5)
+		if err != nil {
+			log.Fatalf("Invalid IMPORTS_LIMIT value: %v", err)
+		}
+
+		importWindow, err := helpers.GetEnvDuration("IMPORTS_WINDOW", 24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid IMPORTS_WINDOW value: %v", err)
+		}
+
+		importStaleAfter, err := helpers.GetEnvDuration("IMPORTS_STALE_AFTER", 5*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid IMPORTS_STALE_AFTER value: %v", err)
+		}
+
+		// webhooks
+		webhooksMax, err := helpers.GetEnvInt("WEBHOOKS_MAX_PER_USER", 10)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_MAX_PER_USER value: %v", err)
+		}
+
+		webhooksInterval, err := helpers.GetEnvDuration("WEBHOOKS_INTERVAL", 5*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_INTERVAL value: %v", err)
+		}
+
+		webhooksBatch, err := helpers.GetEnvInt("WEBHOOKS_BATCH", 50)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_BATCH value: %v", err)
+		}
+
+		webhooksWorkers, err := helpers.GetEnvInt("WEBHOOKS_WORKERS", 8)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_WORKERS value: %v", err)
+		}
+
+		webhooksMaxAttempts, err := helpers.GetEnvInt("WEBHOOKS_MAX_ATTEMPTS", 8)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_MAX_ATTEMPTS value: %v", err)
+		}
+
+		webhooksBackoff, err := helpers.GetEnvDuration("WEBHOOKS_BACKOFF", 30*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_BACKOFF value: %v", err)
+		}
+
+		webhooksMaxBackoff, err := helpers.GetEnvDuration("WEBHOOKS_MAX_BACKOFF", 6*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_MAX_BACKOFF value: %v", err)
+		}
+
+		webhooksTimeout, err := helpers.GetEnvDuration("WEBHOOKS_TIMEOUT", 10*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_TIMEOUT value: %v", err)
+		}
+
+		webhooksDisableAfter, err := helpers.GetEnvInt("WEBHOOKS_DISABLE_AFTER", 20)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_DISABLE_AFTER value: %v", err)
+		}
+
+		webhooksAllowPrivate, err := helpers.GetEnvBool("WEBHOOKS_ALLOW_PRIVATE", false)
+		if err != nil {
+			log.Fatalf("Invalid WEBHOOKS_ALLOW_PRIVATE value: %v", err)
+		}
+
+		// outbox
+		outboxInterval, err := helpers.GetEnvDuration("OUTBOX_INTERVAL", time.Second)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_INTERVAL value: %v", err)
+		}
+
+		outboxBatch, err := helpers.GetEnvInt("OUTBOX_BATCH", 100)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_BATCH value: %v", err)
+		}
+
+		outboxLease, err := helpers.GetEnvDuration("OUTBOX_LEASE", 30*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_LEASE value: %v", err)
+		}
+
+		outboxBackoff, err := helpers.GetEnvDuration("OUTBOX_BACKOFF", time.Second)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_BACKOFF value: %v", err)
+		}
+
+		outboxMaxBackoff, err := helpers.GetEnvDuration("OUTBOX_MAX_BACKOFF", 5*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_MAX_BACKOFF value: %v", err)
+		}
+
+		outboxMaxAttempts, err := helpers.GetEnvInt("OUTBOX_MAX_ATTEMPTS", 10)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_MAX_ATTEMPTS value: %v", err)
+		}
+
+		outboxRetention, err := helpers.GetEnvDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid OUTBOX_RETENTION value: %v", err)
+		}
+
+		// jobs
+		jobsConcurrency, err := helpers.GetEnvInt("JOBS_CONCURRENCY", 10)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_CONCURRENCY value: %v", err)
+		}
+
+		jobsInterval, err := helpers.GetEnvDuration("JOBS_INTERVAL", time.Second)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_INTERVAL value: %v", err)
+		}
+
+		jobsLease, err := helpers.GetEnvDuration("JOBS_LEASE", time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_LEASE value: %v", err)
+		}
+
+		jobsBackoff, err := helpers.GetEnvDuration("JOBS_BACKOFF", 10*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_BACKOFF value: %v", err)
+		}
+
+		jobsMaxBackoff, err := helpers.GetEnvDuration("JOBS_MAX_BACKOFF", time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_MAX_BACKOFF value: %v", err)
+		}
+
+		jobsTimeout, err := helpers.GetEnvDuration("JOBS_TIMEOUT", 5*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_TIMEOUT value: %v", err)
+		}
+
+		jobsDrainTimeout, err := helpers.GetEnvDuration("JOBS_DRAIN_TIMEOUT", 30*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_DRAIN_TIMEOUT value: %v", err)
+		}
+
+		jobsRetention, err := helpers.GetEnvDuration("JOBS_RETENTION", 7*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid JOBS_RETENTION value: %v", err)
+		}
+
+		// admins
+		var admins []int64
+		for _, id := range helpers.GetEnvList("ADMIN_USER_IDS", nil) {
+			adminID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil || adminID < 1 {
+				log.Fatalf("Invalid ADMIN_USER_IDS value %q", id)
+			}
+			admins = append(admins, adminID)
+		}
+
+		// feed
+		feedStrategy := data.FeedStrategy(helpers.GetEnvString("FEED_STRATEGY", string(data.FeedFanOutOnWrite)))
+		if !feedStrategy.IsValid() {
+			log.Fatalf("Invalid FEED_STRATEGY value: %q", feedStrategy)
+		}
+
+		pullThreshold, err := helpers.GetEnvInt("FEED_PULL_THRESHOLD", 10000)
+		if err != nil {
+			log.Fatalf("Invalid FEED_PULL_THRESHOLD value: %v", err)
+		}
+
+		backfill, err := helpers.GetEnvInt("FEED_BACKFILL", 50)
+		if err != nil {
+			log.Fatalf("Invalid FEED_BACKFILL value: %v", err)
+		}
+
+		// explore
+		var windows []data.TrendingWindow
+		for _, name := range helpers.GetEnvList("EXPLORE_WINDOWS", []string{"24h", "6h", "7d"}) {
+			window, err := data.ParseTrendingWindow(name)
+			if err != nil {
+				log.Fatalf("Invalid EXPLORE_WINDOWS value %q: %v", name, err)
+			}
+			windows = append(windows, window)
+		}
+		if len(windows) == 0 {
+			log.Fatal("EXPLORE_WINDOWS must list at least one window\n")
+		}
+
+		refreshInterval, err := helpers.GetEnvDuration("EXPLORE_REFRESH_INTERVAL", 5*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid EXPLORE_REFRESH_INTERVAL value: %v", err)
+		}
+
+		halfLife, err := helpers.GetEnvDuration("EXPLORE_HALF_LIFE", 6*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid EXPLORE_HALF_LIFE value: %v", err)
+		}
+
+		replyWeight, err := helpers.GetEnvInt("EXPLORE_REPLY_WEIGHT", 2)
+		if err != nil {
+			log.Fatalf("Invalid EXPLORE_REPLY_WEIGHT value: %v", err)
+		}
+
+		trendingLimit, err := helpers.GetEnvInt("EXPLORE_MAX_POSTS", 200)
+		if err != nil {
+			log.Fatalf("Invalid EXPLORE_MAX_POSTS value: %v", err)
+		}
+
+		// stream
+		streamBuffer, err := helpers.GetEnvInt("STREAM_BUFFER", 64)
+		if err != nil {
+			log.Fatalf("Invalid STREAM_BUFFER value: %v", err)
+		}
+
+		heartbeat, err := helpers.GetEnvDuration("STREAM_HEARTBEAT", 25*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid STREAM_HEARTBEAT value: %v", err)
+		}
+
+		// messaging
+		messagingPolicy := data.MessagingPolicy(helpers.GetEnvString("MESSAGING_POLICY", string(data.MessagingFriendsOrMutuals)))
+		if !messagingPolicy.IsValid() {
+			log.Fatalf("Invalid MESSAGING_POLICY value: %q", messagingPolicy)
+		}
+
+		maxGroupMembers, err := helpers.GetEnvInt("GROUP_MAX_MEMBERS", 50)
+		if err != nil {
+			log.Fatalf("Invalid GROUP_MAX_MEMBERS value: %v", err)
+		}
+
+		// push
+		vapidPrivateKey := helpers.GetEnvString("VAPID_PRIVATE_KEY", "")
+		vapidSubject := helpers.GetEnvString("VAPID_SUBJECT", "")
+		if vapidPrivateKey != "" && vapidSubject == "" {
+			log.Fatal("VAPID_SUBJECT must be set along with VAPID_PRIVATE_KEY\n")
+		}
+
+		pushTTL, err := helpers.GetEnvDuration("PUSH_TTL", 24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_TTL value: %v", err)
+		}
+
+		pushQueue, err := helpers.GetEnvInt("PUSH_QUEUE", 1024)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_QUEUE value: %v", err)
+		}
+
+		pushWorkers, err := helpers.GetEnvInt("PUSH_WORKERS", 4)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_WORKERS value: %v", err)
+		}
+
+		pushRetries, err := helpers.GetEnvInt("PUSH_RETRIES", 3)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_RETRIES value: %v", err)
+		}
+
+		pushBackoff, err := helpers.GetEnvDuration("PUSH_BACKOFF", 2*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_BACKOFF value: %v", err)
+		}
+
+		pushAllowPrivate, err := helpers.GetEnvBool("PUSH_ALLOW_PRIVATE", false)
+		if err != nil {
+			log.Fatalf("Invalid PUSH_ALLOW_PRIVATE value: %v", err)
+		}
+
+		// mail
+		mailer := helpers.GetEnvString("MAILER", "")
+		if mailer != "" && mailer != "smtp" && mailer != "dir" {
+			log.Fatalf("Invalid MAILER value: %q", mailer)
+		}
+
+		smtpPort, err := helpers.GetEnvInt("SMTP_PORT", 587)
+		if err != nil {
+			log.Fatalf("Invalid SMTP_PORT value: %v", err)
+		}
+
+		// digest
+		digestFrequency := data.DigestFrequency(helpers.GetEnvString("DIGEST_DEFAULT_FREQUENCY", string(data.DigestWeekly)))
+		if !digestFrequency.IsValid() {
+			log.Fatalf("Invalid DIGEST_DEFAULT_FREQUENCY value: %q", digestFrequency)
+		}
+
+		digestInactiveAfter, err := helpers.GetEnvDuration("DIGEST_INACTIVE_AFTER", 72*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid DIGEST_INACTIVE_AFTER value: %v", err)
+		}
+
+		digestInterval, err := helpers.GetEnvDuration("DIGEST_INTERVAL", 15*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid DIGEST_INTERVAL value: %v", err)
+		}
+
+		digestBatch, err := helpers.GetEnvInt("DIGEST_BATCH", 100)
+		if err != nil {
+			log.Fatalf("Invalid DIGEST_BATCH value: %v", err)
+		}
+
+		// suggestions
+		suggestionsInterval, err := helpers.GetEnvDuration("SUGGESTIONS_REFRESH_INTERVAL", 10*time.Minute)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_REFRESH_INTERVAL value: %v", err)
+		}
+
+		suggestionsMaxAge, err := helpers.GetEnvDuration("SUGGESTIONS_MAX_AGE", 24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_MAX_AGE value: %v", err)
+		}
+
+		suggestionsActiveWithin, err := helpers.GetEnvDuration("SUGGESTIONS_ACTIVE_WITHIN", 30*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_ACTIVE_WITHIN value: %v", err)
+		}
+
+		suggestionsBatch, err := helpers.GetEnvInt("SUGGESTIONS_BATCH", 500)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_BATCH value: %v", err)
+		}
+
+		suggestionsLimit, err := helpers.GetEnvInt("SUGGESTIONS_MAX", 100)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_MAX value: %v", err)
+		}
+
+		suggestionsActivityWindow, err := helpers.GetEnvDuration("SUGGESTIONS_ACTIVITY_WINDOW", 14*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Invalid SUGGESTIONS_ACTIVITY_WINDOW value: %v", err)
+		}
+
+		// pagination
+		cursorSecret := helpers.GetEnvString("CURSOR_SECRET", secret)
+
 		instance = &Configuration{
 			Port: port,
 			Env:  helpers.GetEnvString("ENVIRONMENT", "DEVELOPMENT"),
@@ -61,6 +586,114 @@ func Load() *Configuration {
 				Issuer:   issuer,
 				Audience: audience,
 			},
+			Reactions: Reactions{
+				Allowed:       allowedReactions,
+				SinglePerPost: singleReaction,
+			},
+			MaxPins:               maxPins,
+			FriendRequestCooldown: friendRequestCooldown,
+			Feed: Feed{
+				Strategy:      feedStrategy,
+				PullThreshold: pullThreshold,
+				Backfill:      backfill,
+			},
+			Explore: Explore{
+				Windows:         windows,
+				RefreshInterval: refreshInterval,
+				Trending: data.TrendingOptions{
+					HalfLife:    halfLife,
+					ReplyWeight: float64(replyWeight),
+					Limit:       trendingLimit,
+				},
+			},
+			Stream: Stream{
+				Buffer:    streamBuffer,
+				Heartbeat: heartbeat,
+			},
+			Messaging: Messaging{
+				Policy:          messagingPolicy,
+				MaxGroupMembers: maxGroupMembers,
+			},
+			Push: Push{
+				VAPIDPrivateKey: vapidPrivateKey,
+				VAPIDSubject:    vapidSubject,
+				TTL:             pushTTL,
+				Queue:           pushQueue,
+				Workers:         pushWorkers,
+				Retries:         pushRetries,
+				Backoff:         pushBackoff,
+				AllowPrivate:    pushAllowPrivate,
+			},
+			Mail: Mail{
+				Mailer:       mailer,
+				From:         helpers.GetEnvString("MAIL_FROM", "Mantel <no-reply@localhost>"),
+				Dir:          helpers.GetEnvString("MAIL_DIR", "tmp/mail"),
+				SMTPHost:     helpers.GetEnvString("SMTP_HOST", "localhost"),
+				SMTPPort:     smtpPort,
+				SMTPUsername: helpers.GetEnvString("SMTP_USERNAME", ""),
+				SMTPPassword: helpers.GetEnvString("SMTP_PASSWORD", ""),
+			},
+			Digest: Digest{
+				DefaultFrequency: digestFrequency,
+				InactiveAfter:    digestInactiveAfter,
+				Interval:         digestInterval,
+				Batch:            digestBatch,
+				AppURL:           helpers.GetEnvString("CLIENT_API", "http://localhost:5173"),
+				APIURL:           helpers.GetEnvString("API_URL", fmt.Sprintf("http://localhost:%d", port)),
+				Secret:           []byte(helpers.GetEnvString("DIGEST_SECRET", secret)),
+			},
+			Suggestions: Suggestions{
+				RefreshInterval: suggestionsInterval,
+				MaxAge:          suggestionsMaxAge,
+				ActiveWithin:    suggestionsActiveWithin,
+				Batch:           suggestionsBatch,
+				Options: data.SuggestionOptions{
+					Limit:          suggestionsLimit,
+					ActivityWindow: suggestionsActivityWindow,
+					ActivityWeight: 0.5,
+				},
+			},
+			MaxListMembers: maxListMembers,
+			Imports: Imports{
+				MaxRows:    importMaxRows,
+				MaxBytes:   int64(importMaxBytes),
+				Limit:      importLimit,
+				Window:     importWindow,
+				StaleAfter: importStaleAfter,
+			},
+			Webhooks: Webhooks{
+				MaxPerUser:   webhooksMax,
+				Interval:     webhooksInterval,
+				Batch:        webhooksBatch,
+				Workers:      webhooksWorkers,
+				MaxAttempts:  webhooksMaxAttempts,
+				Backoff:      webhooksBackoff,
+				MaxBackoff:   webhooksMaxBackoff,
+				Timeout:      webhooksTimeout,
+				DisableAfter: webhooksDisableAfter,
+				AllowPrivate: webhooksAllowPrivate,
+			},
+			Outbox: Outbox{
+				Interval:    outboxInterval,
+				Batch:       outboxBatch,
+				Lease:       outboxLease,
+				Backoff:     outboxBackoff,
+				MaxBackoff:  outboxMaxBackoff,
+				MaxAttempts: outboxMaxAttempts,
+				Retention:   outboxRetention,
+			},
+			Jobs: Jobs{
+				Concurrency:  jobsConcurrency,
+				Interval:     jobsInterval,
+				Lease:        jobsLease,
+				Backoff:      jobsBackoff,
+				MaxBackoff:   jobsMaxBackoff,
+				Timeout:      jobsTimeout,
+				DrainTimeout: jobsDrainTimeout,
+				Retention:    jobsRetention,
+			},
+			Admins:       admins,
+			CursorSecret: []byte(cursorSecret),
 		}
 	})
 
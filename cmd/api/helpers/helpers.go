@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // GetEnvString returns the env variable with key. If
@@ -32,9 +34,61 @@ func GetEnvInt(key string, defaultValue int) (int, error) {
 	return i, nil
 }
 
+// GetEnvBool returns an env variable with key, and parses it as a bool.
+// Returns defaultValue if variable is not found.
+func GetEnvBool(key string, defaultValue bool) (bool, error) {
+	val, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("environment variable %s is not a valid boolean: %v", key, err)
+	}
+
+	return b, nil
+}
+
+// GetEnvList returns an env variable with key split on commas, with
+// surrounding whitespace and empty items removed.
+// Returns defaultValue if variable is not found.
+func GetEnvList(key string, defaultValue []string) []string {
+	val, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	var list []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
 func ParseIntOrDefault(s string, defaultVal int) int {
 	if v, err := strconv.Atoi(s); err == nil && v > 0 {
 		return v
 	}
 	return defaultVal
 }
+
+// GetEnvDuration returns an env variable with key, and parses it as a
+// time.Duration (e.g. "90s", "5m").
+// Returns defaultValue if variable is not found.
+func GetEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	val, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("environment variable %s is not a valid duration: %v", key, err)
+	}
+
+	return d, nil
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
@@ -45,16 +50,68 @@ func main() {
 	application.SetConfig(cfg)
 	application.SetDB(cfg.DSN)
 	application.SetModels()
+	bridge := application.SetRealtime()
+	application.SetMailer()
+
+	webhookWorker := application.SetWebhooks()
+
+	relay := application.SetOutbox()
+	router.RegisterConsumers(relay)
+
+	jobWorker := application.SetJobs()
+	if err := router.RegisterJobs(jobWorker); err != nil {
+		log.Fatalf("Invalid job schedule: %v", err)
+	}
+
+	pushWorker, err := application.SetPush()
+	if err != nil {
+		log.Fatalf("Invalid Web Push configuration: %v", err)
+	}
 
 	router.InitializeRouter(application.Context)
 
 	application.Logger.Info("all set up!")
 
-	startServer()
+	// Canceled on shutdown, for the server and workers to finish what they
+	// are doing.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := bridge.Listen(ctx); err != nil {
+			application.Logger.Error("realtime bridge stopped", "error", err.Error())
+		}
+	}()
+
+	go relay.Run(ctx)
+	go webhookWorker.Run(ctx)
+	if pushWorker != nil {
+		go pushWorker.Run(ctx)
+	}
+
+	jobsDone := make(chan struct{})
+	go func() {
+		jobWorker.Run(ctx)
+		close(jobsDone)
+	}()
+
+	err = startServer(ctx)
+
+	// Let running jobs finish, or put them back for another instance.
+	stop()
+	<-jobsDone
+
+	if err != nil {
+		application.Logger.Error("server failed", "error", err.Error())
+		os.Exit(1)
+	}
+	application.Logger.Info("shut down")
 }
 
-// startServer contains all code related to api initialization.
-func startServer() {
+// startServer contains all code related to api initialization. It serves
+// until ctx is canceled, then shuts the server down gracefully. It returns an
+// error if the server could not serve, e.g. because its port is taken.
+func startServer(ctx context.Context) error {
 	app := app.Get()
 	// router := router.SetupRouter(app.Context, app.Models)
 	baseRouter := router.SetupRouter(app.Context, app.Models)
@@ -89,8 +146,26 @@ func startServer() {
 		ErrorLog:     slog.NewLogLogger(app.Logger.Handler(), slog.LevelError),
 	}
 
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+
+		<-ctx.Done()
+		app.Logger.Info("shutting down")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			app.Logger.Error("failed to shut down the server gracefully", "error", err.Error())
+		}
+	}()
+
 	err := srv.ListenAndServe()
-	if err != nil {
-		app.Logger.Error(err.Error())
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+
+	<-shutdown
+	return nil
 }
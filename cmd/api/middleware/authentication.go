@@ -13,7 +13,8 @@ import (
 	"github.com/bryryann/mantel/backend/internal/data"
 )
 
-// authenticate is a middleware function that validates the JWT token from the Authorization header.
+// authenticate is a middleware function that validates the JWT token from the Authorization header,
+// or from the access_token query parameter on the event stream.
 // It sets the user in the request context and passes the request to the next handler.
 func authenticate(ctx *appcontext.Context, models *data.UserModel, next http.Handler) http.Handler {
 	res := responses.Get()
@@ -24,6 +25,13 @@ func authenticate(ctx *appcontext.Context, models *data.UserModel, next http.Han
 		w.Header().Add("Vary", "Authorization")
 
 		authHeader := r.Header.Get("Authorization")
+
+		// Browsers can't set headers on EventSource and WebSocket connections,
+		// so the stream also accepts the token as a query parameter.
+		if token := r.URL.Query().Get("access_token"); authHeader == "" && token != "" && strings.HasPrefix(r.URL.Path, "/v1/stream") {
+			authHeader = "Bearer " + token
+		}
+
 		if authHeader == "" {
 			r = ctx.SetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
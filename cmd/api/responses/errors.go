@@ -54,6 +54,11 @@ func (res *Responses) ConflictResponse(w http.ResponseWriter, r *http.Request, e
 	res.ErrorResponse(w, r, http.StatusConflict, err.Error())
 }
 
+// RateLimitExceededResponse sends a 429 Too Many Requests response with the provided error message.
+func (res *Responses) RateLimitExceededResponse(w http.ResponseWriter, r *http.Request, err error) {
+	res.ErrorResponse(w, r, http.StatusTooManyRequests, err.Error())
+}
+
 // FailedValidationResponse sends a 422 Unprocessable Entity response with the provided validation errors.
 func (res *Responses) FailedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	res.ErrorResponse(w, r, http.StatusUnprocessableEntity, errors)
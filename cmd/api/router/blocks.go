@@ -0,0 +1,120 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// blockUser blocks a user on behalf of the authenticated user, ending any
+// friendship or pending request between them and the follows in both
+// directions. Blocking someone already blocked does nothing.
+func blockUser(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = app.Models.Users.Exists(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	change, err := app.Models.Friendships.Transition(user.ID, input.UserID, data.FriendshipBlock, 0)
+	if err != nil {
+		friendshipErrorResponse(w, r, err)
+		return
+	}
+
+	if change.From != change.To {
+		app.NotifyOutbox()
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"user_id": input.UserID, "blocked": true}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// unblockUser lifts a block set by the authenticated user. The users are
+// left with no friendship and no follows.
+func unblockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	blockedID, err := strconv.ParseInt(ps.ByName("user_id"), 10, 64)
+	if err != nil || blockedID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.Models.Friendships.Transition(user.ID, blockedID, data.FriendshipUnblock, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidFriendshipTransition), errors.Is(err, data.ErrFriendshipBlocked):
+			res.NotFoundResponse(w, r)
+		default:
+			friendshipErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBlocks returns the users blocked by the authenticated user.
+func listBlocks(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	users, info, err := app.Models.Friendships.Blocked(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if users == nil {
+		users = []data.UserPublic{}
+	}
+
+	jsonResponse := envelope{
+		"users": users,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,206 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// bookmarkPost saves a post for the authenticated user. The optional JSON
+// body {"collection": "name"} files the bookmark into a named collection.
+func bookmarkPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		Collection string `json:"collection"`
+	}
+
+	if r.ContentLength != 0 {
+		err = jsonhttp.ReadJSON(w, r, &input)
+		if err != nil {
+			res.BadRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	input.Collection = strings.TrimSpace(input.Collection)
+
+	v := validator.New()
+	if data.ValidateBookmarkCollection(v, input.Collection); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	bookmark, err := app.Models.Bookmarks.Add(user.ID, int64(postID), input.Collection)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"bookmark": bookmark}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// removeBookmark deletes the authenticated user's bookmark of a post.
+func removeBookmark(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.Context.GetUser(r)
+
+	err = app.Models.Bookmarks.Remove(user.ID, int64(postID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBookmarks returns the authenticated user's bookmarks, newest first.
+// Bookmarks are private, so only /v1/users/me/bookmarks (or the user's own id)
+// is served. Supports ?collection= filtering and ?cursor= pagination.
+func listBookmarks(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	bookmarks, info, err := app.Models.Bookmarks.List(user.ID, query.Get("collection"), pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if bookmarks == nil {
+		bookmarks = []data.Bookmark{}
+	}
+
+	err = decorateBookmarks(bookmarks, user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse := envelope{
+		"bookmarks": bookmarks,
+		"meta":      paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listBookmarkCollections returns the authenticated user's bookmark collections.
+func listBookmarkCollections(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	collections, err := app.Models.Bookmarks.Collections(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if collections == nil {
+		collections = []data.BookmarkCollection{}
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"collections": collections}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteBookmarkCollection removes one of the authenticated user's
+// collections, keeping the bookmarks it contained.
+func deleteBookmarkCollection(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	collectionID, err := strconv.Atoi(ps.ByName("collection_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Bookmarks.DeleteCollection(user.ID, int64(collectionID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCollectionNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
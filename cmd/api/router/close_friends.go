@@ -0,0 +1,109 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// addCloseFriend lets one of the authenticated user's friends read their
+// close-friends posts.
+func addCloseFriend(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.CloseFriends.Add(user.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotFriends):
+			res.FailedValidationResponse(w, r, map[string]string{"user_id": "must be one of your friends"})
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"user_id": input.UserID, "close_friend": true}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// removeCloseFriend removes a user from the authenticated user's close
+// friends.
+func removeCloseFriend(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	friendID, err := strconv.ParseInt(ps.ByName("user_id"), 10, 64)
+	if err != nil || friendID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.CloseFriends.Remove(user.ID, friendID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listCloseFriends returns the authenticated user's close friends.
+func listCloseFriends(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	users, info, err := app.Models.CloseFriends.List(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if users == nil {
+		users = []data.UserPublic{}
+	}
+
+	jsonResponse := envelope{
+		"users": users,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
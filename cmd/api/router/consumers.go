@@ -0,0 +1,394 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/bryryann/mantel/backend/internal/webhook"
+)
+
+// RegisterConsumers registers the consumers of the domain events recorded in
+// the outbox on relay. Each may be handed an event more than once.
+func RegisterConsumers(relay *outbox.Relay) {
+	relay.Register("timelines", updateTimelines,
+		outbox.FollowCreated, outbox.FollowDeleted, outbox.PostCreated, outbox.FriendshipChanged)
+	relay.Register("notifications", sendNotifications,
+		outbox.FollowCreated, outbox.ReactionCreated, outbox.PostCreated, outbox.FriendshipChanged)
+	relay.Register("webhooks", enqueueWebhooks,
+		outbox.FollowCreated, outbox.ReactionCreated, outbox.PostCreated, outbox.FriendshipChanged)
+	relay.Register("realtime", publishEvents,
+		outbox.FollowCreated, outbox.ReactionCreated, outbox.PostCreated, outbox.FriendshipChanged)
+	relay.Register("counters", updateCounters,
+		outbox.FollowCreated, outbox.FollowDeleted, outbox.PostCreated, outbox.PostDeleted, outbox.FriendshipChanged)
+}
+
+// createdPost returns the post of a PostCreated event as its author sees it,
+// or nil if it was deleted since.
+func createdPost(e outbox.Event) (*data.Post, error) {
+	app := app.Get()
+
+	var created outbox.Post
+	if err := e.Decode(&created); err != nil {
+		return nil, err
+	}
+
+	post, err := app.Models.Posts.Get(created.PostID, created.AuthorID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := decoratePost(post, created.AuthorID); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// decodeFriendship returns the data of a FriendshipChanged event along with
+// the friendship it carries.
+func decodeFriendship(e outbox.Event) (outbox.Friendship, *data.Friendship, error) {
+	var change outbox.Friendship
+	if err := e.Decode(&change); err != nil {
+		return outbox.Friendship{}, nil, err
+	}
+
+	var friendship data.Friendship
+	if err := json.Unmarshal(change.Friendship, &friendship); err != nil {
+		return outbox.Friendship{}, nil, err
+	}
+
+	return change, &friendship, nil
+}
+
+// updateTimelines fans new posts out to their audience's timelines,
+// backfills timelines after a follow or a new friendship, and removes the
+// posts of users unfollowed, unfriended or blocked from them.
+func updateTimelines(ctx context.Context, e outbox.Event) error {
+	app := app.Get()
+	feed := app.Config.Feed
+
+	switch e.Type {
+	case outbox.FollowCreated, outbox.FollowDeleted:
+		var follow outbox.Follow
+		if err := e.Decode(&follow); err != nil {
+			return err
+		}
+
+		if e.Type == outbox.FollowDeleted {
+			return app.Models.Timelines.Remove(follow.FollowerID, follow.FolloweeID)
+		}
+		return app.Models.Timelines.Backfill(follow.FollowerID, follow.FolloweeID, feed.Backfill)
+
+	case outbox.PostCreated:
+		var created outbox.Post
+		if err := e.Decode(&created); err != nil {
+			return err
+		}
+
+		post, err := app.Models.Posts.Get(created.PostID, created.AuthorID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		return app.Models.Timelines.Publish(post, feed.PullThreshold, feed.Backfill)
+
+	case outbox.FriendshipChanged:
+		var change outbox.Friendship
+		if err := e.Decode(&change); err != nil {
+			return err
+		}
+
+		from, to := data.FriendshipState(change.From), data.FriendshipState(change.To)
+
+		if to == data.StateFriends {
+			err := app.Models.Timelines.Backfill(change.ActorID, change.OtherID, feed.Backfill)
+			if err != nil {
+				return err
+			}
+			return app.Models.Timelines.Backfill(change.OtherID, change.ActorID, feed.Backfill)
+		}
+
+		// Blocking also removes the follows between the users, so their posts
+		// leave each other's timelines whether they were friends or not.
+		if from == data.StateFriends || to == data.StateBlocking {
+			err := app.Models.Timelines.Remove(change.ActorID, change.OtherID)
+			if err != nil {
+				return err
+			}
+			return app.Models.Timelines.Remove(change.OtherID, change.ActorID)
+		}
+	}
+
+	return nil
+}
+
+// sendNotifications notifies followed users, the authors of posts reacted or
+// replied to, mentioned users, and the users friend requests are sent to or
+// accepted by.
+func sendNotifications(ctx context.Context, e outbox.Event) error {
+	app := app.Get()
+
+	switch e.Type {
+	case outbox.FollowCreated:
+		var follow outbox.Follow
+		if err := e.Decode(&follow); err != nil {
+			return err
+		}
+
+		return deliverNotification(&data.Notification{
+			UserID:  follow.FolloweeID,
+			Type:    data.NotificationFollow,
+			ActorID: follow.FollowerID,
+		})
+
+	case outbox.ReactionCreated:
+		var reaction outbox.Reaction
+		if err := e.Decode(&reaction); err != nil {
+			return err
+		}
+
+		if reaction.PostAuthorID == reaction.UserID {
+			return nil
+		}
+
+		return deliverNotification(&data.Notification{
+			UserID:  reaction.PostAuthorID,
+			Type:    data.NotificationReaction,
+			ActorID: reaction.UserID,
+			PostID:  &reaction.PostID,
+		})
+
+	case outbox.PostCreated:
+		var post outbox.Post
+		if err := e.Decode(&post); err != nil {
+			return err
+		}
+
+		err := app.Models.Notifications.NotifyMentions(post.PostID, post.AuthorID)
+		if err != nil || post.ReplyToID == nil {
+			return err
+		}
+
+		// Authors of the parent post only hear of replies they can read.
+		parent, err := app.Models.Posts.Get(*post.ReplyToID, post.AuthorID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		visible, err := app.Models.Posts.IsVisibleTo(post.PostID, parent.UserID)
+		if err != nil || !visible {
+			return err
+		}
+
+		return deliverNotification(&data.Notification{
+			UserID:  parent.UserID,
+			Type:    data.NotificationReply,
+			ActorID: post.AuthorID,
+			PostID:  &parent.ID,
+		})
+
+	case outbox.FriendshipChanged:
+		change, _, err := decodeFriendship(e)
+		if err != nil {
+			return err
+		}
+
+		var typ data.NotificationType
+		switch data.FriendshipState(change.To) {
+		case data.StateRequestSent:
+			typ = data.NotificationFriendRequest
+		case data.StateFriends:
+			typ = data.NotificationFriendAccept
+		default:
+			return nil
+		}
+
+		return deliverNotification(&data.Notification{
+			UserID:  change.OtherID,
+			Type:    typ,
+			ActorID: change.ActorID,
+		})
+	}
+
+	return nil
+}
+
+// enqueueWebhooks queues the follow.created, like.created, post.created and
+// friendship.accepted webhook events.
+func enqueueWebhooks(ctx context.Context, e outbox.Event) error {
+	app := app.Get()
+
+	switch e.Type {
+	case outbox.FollowCreated:
+		var follow outbox.Follow
+		if err := e.Decode(&follow); err != nil {
+			return err
+		}
+
+		return app.EnqueueWebhook([]int64{follow.FolloweeID}, webhook.EventFollowCreated, envelope{
+			"follower_id": follow.FollowerID,
+			"followee_id": follow.FolloweeID,
+		})
+
+	case outbox.ReactionCreated:
+		var reaction outbox.Reaction
+		if err := e.Decode(&reaction); err != nil {
+			return err
+		}
+
+		if reaction.Reaction != data.LikeReaction || reaction.PostAuthorID == reaction.UserID {
+			return nil
+		}
+
+		return app.EnqueueWebhook([]int64{reaction.PostAuthorID}, webhook.EventLikeCreated, envelope{
+			"post_id": reaction.PostID,
+			"user_id": reaction.UserID,
+		})
+
+	case outbox.PostCreated:
+		post, err := createdPost(e)
+		if err != nil || post == nil {
+			return err
+		}
+
+		return app.EnqueueWebhook([]int64{post.UserID}, webhook.EventPostCreated, envelope{"post": post.ToPublic()})
+
+	case outbox.FriendshipChanged:
+		change, friendship, err := decodeFriendship(e)
+		if err != nil || data.FriendshipState(change.To) != data.StateFriends {
+			return err
+		}
+
+		return app.EnqueueWebhook([]int64{change.ActorID, change.OtherID}, webhook.EventFriendshipAccepted, envelope{
+			"friendship": friendship,
+		})
+	}
+
+	return nil
+}
+
+// publishEvents streams follows, reactions, new posts and friendship changes
+// to the users they concern.
+func publishEvents(ctx context.Context, e outbox.Event) error {
+	app := app.Get()
+
+	switch e.Type {
+	case outbox.FollowCreated:
+		var follow outbox.Follow
+		if err := e.Decode(&follow); err != nil {
+			return err
+		}
+
+		app.Publish(realtime.UserTopic(follow.FolloweeID), realtime.EventFollow, envelope{
+			"follower_id": follow.FollowerID,
+		})
+
+	case outbox.ReactionCreated:
+		var reaction outbox.Reaction
+		if err := e.Decode(&reaction); err != nil {
+			return err
+		}
+
+		if reaction.PostAuthorID == reaction.UserID {
+			return nil
+		}
+
+		app.Publish(realtime.UserTopic(reaction.PostAuthorID), realtime.EventPostReaction, envelope{
+			"post_id":  reaction.PostID,
+			"user_id":  reaction.UserID,
+			"reaction": reaction.Reaction,
+		})
+
+	case outbox.PostCreated:
+		post, err := createdPost(e)
+		if err != nil || post == nil {
+			return err
+		}
+
+		return publishFeedPost(post)
+
+	case outbox.FriendshipChanged:
+		change, friendship, err := decodeFriendship(e)
+		if err != nil {
+			return err
+		}
+
+		topic := realtime.UserTopic(change.OtherID)
+
+		switch data.FriendshipEvent(change.Event) {
+		case data.FriendshipRequest, data.FriendshipAccept:
+			action := "accepted"
+			if data.FriendshipState(change.To) == data.StateRequestSent {
+				action = "received"
+			}
+
+			app.Publish(topic, realtime.EventFriendRequest, envelope{
+				"action":     action,
+				"friendship": friendship,
+			})
+
+		case data.FriendshipDecline, data.FriendshipCancel, data.FriendshipUnfriend:
+			action := map[data.FriendshipEvent]string{
+				data.FriendshipDecline:  "rejected",
+				data.FriendshipCancel:   "cancelled",
+				data.FriendshipUnfriend: "unfriended",
+			}[data.FriendshipEvent(change.Event)]
+
+			app.Publish(topic, realtime.EventFriendRequest, envelope{
+				"action":     action,
+				"request_id": friendship.ID,
+				"user_id":    change.ActorID,
+			})
+		}
+	}
+
+	return nil
+}
+
+// updateCounters recounts the follows, friends and posts of the users an
+// event changed them for.
+func updateCounters(ctx context.Context, e outbox.Event) error {
+	app := app.Get()
+
+	switch e.Type {
+	case outbox.FollowCreated, outbox.FollowDeleted:
+		var follow outbox.Follow
+		if err := e.Decode(&follow); err != nil {
+			return err
+		}
+
+		return app.Models.Counters.Refresh(follow.FollowerID, follow.FolloweeID)
+
+	case outbox.PostCreated, outbox.PostDeleted:
+		var post outbox.Post
+		if err := e.Decode(&post); err != nil {
+			return err
+		}
+
+		return app.Models.Counters.Refresh(post.AuthorID)
+
+	case outbox.FriendshipChanged:
+		var change outbox.Friendship
+		if err := e.Decode(&change); err != nil {
+			return err
+		}
+
+		return app.Models.Counters.Refresh(change.ActorID, change.OtherID)
+	}
+
+	return nil
+}
@@ -0,0 +1,386 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// canMessage reports whether the messaging policy lets userID and otherID
+// talk one-to-one.
+func canMessage(userID, otherID int64) (bool, error) {
+	app := app.Get()
+
+	status, err := app.Models.Friendships.GetFriendshipStatus(userID, otherID)
+	if err != nil {
+		return false, err
+	}
+
+	follows, err := app.Models.Follows.Exists(userID, otherID)
+	if err != nil {
+		return false, err
+	}
+
+	followedBack, err := app.Models.Follows.Exists(otherID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return app.Config.Messaging.Policy.Allows(status, follows && followedBack), nil
+}
+
+// publishToMembers publishes an event to every member of conversationID but
+// exceptID.
+func publishToMembers(conversationID, exceptID int64, typ string, data any) {
+	app := app.Get()
+
+	app.Background("publish "+typ, func() error {
+		members, err := app.Models.Conversations.MemberIDs(conversationID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range members {
+			if id != exceptID {
+				app.Publish(realtime.UserTopic(id), typ, data)
+			}
+		}
+		return nil
+	})
+}
+
+// messageEvent returns the event streamed for msg. It only points at the
+// message, for clients to fetch, as message bodies can be larger than the
+// events relayed between instances may be.
+func messageEvent(msg data.Message) envelope {
+	return envelope{
+		"conversation_id": msg.ConversationID,
+		"message_id":      msg.ID,
+		"sender_id":       msg.SenderID,
+	}
+}
+
+// readConversation reads the :conversation_id parameter and loads the
+// conversation as seen by the authenticated user. It writes the error
+// response and returns nil if that fails.
+func readConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *data.Conversation {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return nil
+	}
+
+	conversation, err := app.Models.Conversations.Get(int64(id), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return conversation
+}
+
+// startConversation returns the authenticated user's one-to-one conversation
+// with the given user_id, creating it if needed. A body with user_ids and a
+// title creates a group conversation instead.
+func startConversation(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		UserID       int64   `json:"user_id"`
+		UserIDs      []int64 `json:"user_ids"`
+		Title        string  `json:"title"`
+		ShareHistory bool    `json:"share_history"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.UserIDs != nil || input.Title != "" {
+		createGroup(w, r, input.Title, input.UserIDs, input.ShareHistory)
+		return
+	}
+
+	_, err = app.Models.Users.Exists(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := canMessage(user.ID, input.UserID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		res.ErrorResponse(w, r, http.StatusForbidden, "you are not allowed to message this user")
+		return
+	}
+
+	conversation, err := app.Models.Conversations.Direct(user.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrConversationWithSelf):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"conversation": conversation}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listConversations returns the authenticated user's conversations, most
+// recently active first, with their last message and unread count.
+func listConversations(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	conversations, info, err := app.Models.Conversations.List(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if conversations == nil {
+		conversations = []data.Conversation{}
+	}
+
+	jsonResponse := envelope{
+		"conversations": conversations,
+		"meta":          paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listMessages returns a conversation's history, newest message first.
+func listMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	conversation := readConversation(w, r, ps)
+	if conversation == nil {
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	messages, info, err := app.Models.Messages.List(conversation.ID, user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if messages == nil {
+		messages = []data.Message{}
+	}
+
+	jsonResponse := envelope{
+		"messages": messages,
+		"meta":     paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// sendMessage sends a message to a conversation. One-to-one conversations
+// are checked against the messaging policy on every message, so that
+// unfriending or blocking someone also stops their messages.
+func sendMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	conversation := readConversation(w, r, ps)
+	if conversation == nil {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	msg := &data.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.ID,
+		Body:           input.Body,
+	}
+
+	v := validator.New()
+	if data.ValidateMessage(v, msg); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if conversation.Direct && len(conversation.Members) > 0 {
+		allowed, err := canMessage(user.ID, conversation.Members[0].ID)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if !allowed {
+			res.ErrorResponse(w, r, http.StatusForbidden, "you are not allowed to message this user")
+			return
+		}
+	}
+
+	err = app.Models.Messages.Send(msg)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	publishToMembers(conversation.ID, user.ID, realtime.EventMessage, messageEvent(*msg))
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"message": msg}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// markConversationRead moves the authenticated user's read receipt in a
+// conversation up to message_id, or to the latest message when it is left
+// out.
+func markConversationRead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	conversationID, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		MessageID int64 `json:"message_id"`
+	}
+
+	// The body is optional.
+	if r.ContentLength != 0 {
+		err = jsonhttp.ReadJSON(w, r, &input)
+		if err != nil {
+			res.BadRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	lastRead, err := app.Models.Conversations.MarkRead(int64(conversationID), user.ID, input.MessageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	receipt := envelope{
+		"conversation_id":      conversationID,
+		"user_id":              user.ID,
+		"last_read_message_id": lastRead,
+	}
+
+	publishToMembers(int64(conversationID), user.ID, realtime.EventMessageRead, receipt)
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, receipt, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteMessage deletes a message from the authenticated user's view of a
+// conversation. Other members keep seeing it.
+func deleteMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	conversationID, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	messageID, err := strconv.Atoi(ps.ByName("message_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Messages.DeleteForSelf(int64(conversationID), int64(messageID), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
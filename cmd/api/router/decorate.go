@@ -0,0 +1,129 @@
+package router
+
+import (
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/internal/data"
+)
+
+// postExtras holds the viewer dependent data shown alongside posts, keyed by post id.
+type postExtras struct {
+	polls     map[int64]*data.Poll
+	reactions map[int64]*data.ReactionSummary
+}
+
+// loadPostExtras fetches polls and reaction counts for the given posts in bulk.
+func loadPostExtras(postIDs []int64, viewerID int64) (*postExtras, error) {
+	app := app.Get()
+
+	polls, err := app.Models.Polls.ForPosts(postIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := app.Models.Reactions.ForPosts(postIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postExtras{polls: polls, reactions: reactions}, nil
+}
+
+// decoratePosts attaches polls, reaction counts and close friends badges to a
+// list of posts.
+func decoratePosts(posts []data.PostPublic, viewerID int64) error {
+	ids := make([]int64, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	extras, err := loadPostExtras(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Poll = extras.polls[posts[i].ID]
+		posts[i].Reactions = extras.reactions[posts[i].ID]
+		posts[i].CloseFriends = posts[i].Visibility == data.VisibilityCloseFriends
+	}
+
+	return nil
+}
+
+// decoratePost attaches the poll, reaction counts and close friends badge to
+// a single post.
+func decoratePost(post *data.Post, viewerID int64) error {
+	extras, err := loadPostExtras([]int64{post.ID}, viewerID)
+	if err != nil {
+		return err
+	}
+
+	post.Poll = extras.polls[post.ID]
+	post.Reactions = extras.reactions[post.ID]
+	post.CloseFriends = post.Visibility == data.VisibilityCloseFriends
+
+	return nil
+}
+
+// decorateSearchResults attaches polls and reaction counts to search results.
+func decorateSearchResults(results []data.PostSearchResult, viewerID int64) error {
+	ids := make([]int64, len(results))
+	for i := range results {
+		ids[i] = results[i].ID
+	}
+
+	extras, err := loadPostExtras(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range results {
+		results[i].Poll = extras.polls[results[i].ID]
+		results[i].Reactions = extras.reactions[results[i].ID]
+		results[i].CloseFriends = results[i].Visibility == data.VisibilityCloseFriends
+	}
+
+	return nil
+}
+
+// decorateBookmarks attaches polls and reaction counts to bookmarked posts.
+func decorateBookmarks(bookmarks []data.Bookmark, viewerID int64) error {
+	ids := make([]int64, len(bookmarks))
+	for i := range bookmarks {
+		ids[i] = bookmarks[i].PostID
+	}
+
+	extras, err := loadPostExtras(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range bookmarks {
+		bookmarks[i].Post.Poll = extras.polls[bookmarks[i].PostID]
+		bookmarks[i].Post.Reactions = extras.reactions[bookmarks[i].PostID]
+		bookmarks[i].Post.CloseFriends = bookmarks[i].Post.Visibility == data.VisibilityCloseFriends
+	}
+
+	return nil
+}
+
+// decorateTrendingPosts attaches polls and reaction counts to trending posts.
+func decorateTrendingPosts(posts []data.TrendingPost, viewerID int64) error {
+	ids := make([]int64, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	extras, err := loadPostExtras(ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Poll = extras.polls[posts[i].ID]
+		posts[i].Reactions = extras.reactions[posts[i].ID]
+		posts[i].CloseFriends = posts[i].Visibility == data.VisibilityCloseFriends
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/digest"
+	"github.com/bryryann/mantel/backend/internal/jobs"
+	"github.com/bryryann/mantel/backend/internal/mailer"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getDigestSettings returns how often the authenticated user receives email
+// digests while inactive.
+func getDigestSettings(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	frequency, err := app.Models.Digests.Frequency(user.ID, app.Config.Digest.DefaultFrequency)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"frequency": frequency}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateDigestSettings sets how often the authenticated user receives email
+// digests: "daily", "weekly" or "off".
+func updateDigestSettings(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		Frequency data.DigestFrequency `json:"frequency"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Digests.SetFrequency(user.ID, input.Frequency)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidDigestFrequency):
+			res.FailedValidationResponse(w, r, map[string]string{"frequency": "must be daily, weekly or off"})
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"frequency": input.Frequency}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribeDigest turns email digests off for the user the signed token
+// of an unsubscribe link belongs to. It answers both the link itself and
+// one-click unsubscribe POSTs from mail clients.
+func unsubscribeDigest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	userID, err := digest.ParseUnsubscribeToken(r.URL.Query().Get("token"), app.Config.Digest.Secret)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Digests.SetFrequency(userID, data.DigestOff)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"message": "you will no longer receive email digests"}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// digestItems is how many entries each section of a digest lists.
+const digestItems = 5
+
+// sendDueDigests emails every digest currently due, a batch at a time.
+// Digests are claimed before being sent, so a failed one is skipped until
+// the next period rather than retried.
+func sendDueDigests(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+	cfg := app.Config.Digest
+
+	for {
+		recipients, err := app.Models.Digests.ClaimDue(cfg.DefaultFrequency, cfg.InactiveAfter, cfg.Batch)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range recipients {
+			if err := sendDigest(r); err != nil {
+				app.Logger.Error("failed to send digest", "user_id", r.UserID, "error", err.Error())
+			}
+		}
+
+		if len(recipients) < cfg.Batch {
+			return nil
+		}
+	}
+}
+
+// sendDigest gathers r's unread notifications, pending friend requests and
+// the top posts from their network over the last period, and emails them.
+// Nothing is sent when all of them are empty.
+func sendDigest(r data.DigestRecipient) error {
+	app := app.Get()
+	cfg := app.Config.Digest
+
+	groups, _, err := app.Models.Notifications.List(r.UserID, true, data.Pagination{PageSize: digestItems})
+	if err != nil {
+		return err
+	}
+
+	counts, err := app.Models.Notifications.UnreadCounts(r.UserID)
+	if err != nil {
+		return err
+	}
+
+	unread := 0
+	for _, count := range counts {
+		unread += count
+	}
+
+	requesters, requestCount, err := app.Models.Digests.PendingRequesters(r.UserID, digestItems)
+	if err != nil {
+		return err
+	}
+
+	posts, err := app.Models.Digests.TopPosts(r.UserID, time.Now().Add(-r.Frequency.Period()), digestItems)
+	if err != nil {
+		return err
+	}
+
+	unsubscribeURL := cfg.APIURL + "/v1/digest/unsubscribe?token=" + url.QueryEscape(digest.UnsubscribeToken(r.UserID, cfg.Secret))
+
+	d := digest.Digest{
+		Username:           r.Username,
+		Frequency:          r.Frequency,
+		Notifications:      groups,
+		UnreadCount:        unread,
+		FriendRequests:     requesters,
+		FriendRequestCount: requestCount,
+		TopPosts:           posts,
+		AppURL:             cfg.AppURL,
+		UnsubscribeURL:     unsubscribeURL,
+	}
+
+	if d.Empty() {
+		return nil
+	}
+
+	text, html, err := digest.Render(d)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	return app.Mailer.Send(ctx, &mailer.Message{
+		From:    app.Config.Mail.From,
+		To:      (&mail.Address{Name: r.Username, Address: r.Email}).String(),
+		Subject: d.Subject(),
+		Text:    text,
+		HTML:    html,
+		Headers: map[string]string{
+			// Lets mail clients offer one-click unsubscribing (RFC 8058).
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
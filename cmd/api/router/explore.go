@@ -0,0 +1,77 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getExplore returns the posts trending over ?window=, which must be one of
+// the configured explore windows. Anonymous users get the global ranking,
+// while signed in users don't see authors they blocked or muted.
+func getExplore(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+
+	windows := app.Config.Explore.Windows
+	window := windows[0].Name
+	if name := r.URL.Query().Get("window"); name != "" {
+		known := slices.ContainsFunc(windows, func(tw data.TrendingWindow) bool {
+			return tw.Name == name
+		})
+		if !known {
+			res.BadRequestResponse(w, r, fmt.Errorf("%w: %q", data.ErrInvalidTrendingWindow, name))
+			return
+		}
+		window = name
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	posts, info, err := app.Models.Trending.List(window, viewer.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if posts == nil {
+		posts = []data.TrendingPost{}
+	}
+
+	err = decorateTrendingPosts(posts, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	computedAt, err := app.Models.Trending.ComputedAt(window)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	meta := paginationMeta(pagination, info)
+	meta["window"] = window
+	meta["computed_at"] = computedAt
+
+	jsonResponse := envelope{
+		"posts": posts,
+		"meta":  meta,
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -1,31 +1,44 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
 )
 
+// getFeed returns the authenticated user's home feed. ?mode=ranked selects
+// the ranked "For You" feed instead of the chronological one.
 func getFeed(w http.ResponseWriter, r *http.Request) {
 	app := app.Get()
 	res := responses.Get()
 
 	user := app.Context.GetUser(r)
 
-	query := r.URL.Query()
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-		Sort:     "",
+	var (
+		posts []data.PostPublic
+		info  data.PageInfo
+	)
+
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "chronological":
+		posts, info, err = app.Models.Feed.Fetch(user.ID, pagination)
+	case "ranked":
+		posts, info, err = rankedFeed(user.ID, pagination)
+	default:
+		res.BadRequestResponse(w, r, fmt.Errorf("unknown feed mode %q", mode))
+		return
 	}
-	posts, err := app.Models.Feed.Fetch(user.ID, paginationData)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -35,15 +48,41 @@ func getFeed(w http.ResponseWriter, r *http.Request) {
 		posts = []data.PostPublic{}
 	}
 
+	err = decoratePosts(posts, user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
 	jsonResponse := envelope{
 		"feed": posts,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta": paginationMeta(pagination, info),
 	}
 	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 	}
 }
+
+// rankedFeed ranks the viewer's feed candidates with the app Ranker and
+// returns the requested page. Pages are ranked independently, so posts may
+// shift between pages as new reactions come in.
+func rankedFeed(viewerID int64, pagination data.Pagination) ([]data.PostPublic, data.PageInfo, error) {
+	app := app.Get()
+
+	candidates, err := app.Models.Candidates.List(viewerID, data.DefaultCandidateOptions)
+	if err != nil {
+		return nil, data.PageInfo{}, err
+	}
+
+	ranked := app.Ranker.Rank(candidates, time.Now())
+
+	page, info := data.PaginateSlice(ranked, pagination)
+
+	posts := make([]data.PostPublic, len(page))
+	for i, c := range page {
+		posts[i] = c.Post
+	}
+
+	return posts, info, nil
+}
@@ -6,7 +6,6 @@ import (
 	"strconv"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
@@ -70,6 +69,8 @@ func followUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	app.NotifyOutbox()
+
 	err = jsonhttp.WriteJSON(
 		w,
 		http.StatusCreated,
@@ -103,6 +104,8 @@ func unfollowUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
+	app.NotifyOutbox()
+
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -156,21 +159,13 @@ func listUserFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	query := r.URL.Query()
-
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
-	sort := query.Get("sort")
-	if sort == "" {
-		sort = "username_asc"
+	pagination, err := readPagination(w, r, "username_asc")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
 	}
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-		Sort:     sort,
-	}
-	followers, err := app.Models.Follows.GetFollowers(int64(id), paginationData)
+	followers, info, err := app.Models.Follows.GetFollowers(int64(id), pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -182,10 +177,7 @@ func listUserFollowers(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	jsonResponse := envelope{
 		"followers": followers,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":      paginationMeta(pagination, info),
 	}
 	jsonhttp.WriteJSON(w, http.StatusAccepted, jsonResponse, nil)
 }
@@ -211,21 +203,13 @@ func listUserFollowees(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	query := r.URL.Query()
-
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
-	sort := query.Get("sort")
-	if sort == "" {
-		sort = "username_asc"
+	pagination, err := readPagination(w, r, "username_asc")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
 	}
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-		Sort:     sort,
-	}
-	followees, err := app.Models.Follows.GetFollowees(int64(id), paginationData)
+	followees, info, err := app.Models.Follows.GetFollowees(int64(id), pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -237,10 +221,7 @@ func listUserFollowees(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	jsonResponse := envelope{
 		"followees": followees,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":      paginationMeta(pagination, info),
 	}
 	jsonhttp.WriteJSON(w, http.StatusAccepted, jsonResponse, nil)
 }
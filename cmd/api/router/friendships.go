@@ -6,7 +6,6 @@ import (
 	"strconv"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
@@ -24,10 +23,11 @@ func getFriendsById(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		return
 	}
 
-	query := r.URL.Query()
-
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
 
 	_, err = app.Models.Users.Exists(int64(id))
 	if err != nil {
@@ -40,12 +40,7 @@ func getFriendsById(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 		return
 	}
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-	}
-
-	friends, err := app.Models.Friendships.GetFriends(int64(id), paginationData)
+	friends, info, err := app.Models.Friendships.GetFriends(int64(id), pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -53,10 +48,7 @@ func getFriendsById(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 
 	jsonResponse := envelope{
 		"friends": friends,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":    paginationMeta(pagination, info),
 	}
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, jsonResponse, nil)
 	if err != nil {
@@ -64,6 +56,29 @@ func getFriendsById(w http.ResponseWriter, r *http.Request, ps httprouter.Params
 	}
 }
 
+func friendshipErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	res := responses.Get()
+
+	switch {
+	case errors.Is(err, data.ErrFriendshipRequestToSelf), errors.Is(err, data.ErrFriendshipWithSelf):
+		res.BadRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrNoSuchRequest):
+		res.NotFoundResponse(w, r)
+	case errors.Is(err, data.ErrFriendshipBlocked):
+		res.ErrorResponse(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, data.ErrFriendRequestCooldown):
+		res.RateLimitExceededResponse(w, r, err)
+	case errors.Is(err, data.ErrFriendRequestAlreadyExists),
+		errors.Is(err, data.ErrAlreadyFriends),
+		errors.Is(err, data.ErrInvalidFriendshipTransition):
+		res.ConflictResponse(w, r, err)
+	default:
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// sendFriendRequest asks another user to be friends. If they already asked
+// the authenticated user, their request is accepted instead.
 func sendFriendRequest(w http.ResponseWriter, r *http.Request) {
 	app := app.Get()
 	res := responses.Get()
@@ -80,35 +95,46 @@ func sendFriendRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fs := &data.Friendship{
-		SenderID:   user.ID,
-		ReceiverID: int64(input.ReceiverID),
-	}
+	receiverID := int64(input.ReceiverID)
 
-	err = app.Models.Friendships.SendRequest(fs)
+	_, err = app.Models.Users.Exists(receiverID)
 	if err != nil {
-		switch err {
-		case data.ErrFriendshipRequestToSelf:
-			res.BadRequestResponse(w, r, err)
-		case data.ErrFriendRequestAlreadyExists:
-			res.ConflictResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
 		default:
 			res.ServerErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	change, err := app.Models.Friendships.Transition(user.ID, receiverID, data.FriendshipRequest, app.Config.FriendRequestCooldown)
+	if err != nil {
+		friendshipErrorResponse(w, r, err)
+		return
+	}
+
+	app.NotifyOutbox()
+
+	status := http.StatusCreated
 	env := envelope{
 		"message":    "friend request sent",
-		"created_at": fs.CreatedAt,
-		"status":     fs.Status,
+		"created_at": change.Friendship.CreatedAt,
+		"status":     change.Friendship.Status,
+	}
+	if change.To == data.StateFriends {
+		status = http.StatusOK
+		env["message"] = "friend request accepted"
 	}
-	err = jsonhttp.WriteJSON(w, http.StatusCreated, env, nil)
+
+	err = jsonhttp.WriteJSON(w, status, env, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 	}
 }
 
+// patchPendingFriendRequest accepts a friend request, or blocks the user
+// involved in it.
 func patchPendingFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	app := app.Get()
 	res := responses.Get()
@@ -132,38 +158,38 @@ func patchPendingFriendRequest(w http.ResponseWriter, r *http.Request, ps httpro
 		return
 	}
 
-	switch input.Status {
-	case "accepted", "blocked", "pending":
-		// do nothing
+	var event data.FriendshipEvent
+	switch data.FriendshipStatus(input.Status) {
+	case data.StatusAccepted:
+		event = data.FriendshipAccept
+	case data.StatusBlocked:
+		event = data.FriendshipBlock
+	case data.StatusPending:
+		res.ConflictResponse(w, r, data.ErrInvalidFriendshipTransition)
+		return
 	default:
 		res.BadRequestResponse(w, r, data.ErrInvalidFriendshipStatus)
 		return
 	}
 
-	fs := &data.Friendship{
-		ID:         int64(id),
-		ReceiverID: user.ID,
-		Status:     data.FriendshipStatus(input.Status),
-	}
-
-	patched, err := app.Models.Friendships.PatchFriendship(fs)
+	change, err := app.Models.Friendships.TransitionRequest(int64(id), user.ID, event, app.Config.FriendRequestCooldown)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrNoSuchRequest):
-			res.NotFoundResponse(w, r)
-		default:
-			res.ServerErrorResponse(w, r, err)
-		}
+		friendshipErrorResponse(w, r, err)
 		return
 	}
 
-	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"friendship": patched}, nil)
+	app.NotifyOutbox()
+
+	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"friendship": change.Friendship}, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 	}
 }
 
-func rejectFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+// endFriendship applies event to the friendship named by the :request_id
+// parameter, answering {"status": 1} if it applied and {"status": 0} if
+// there was no such friendship to end.
+func endFriendship(w http.ResponseWriter, r *http.Request, ps httprouter.Params, event data.FriendshipEvent) {
 	app := app.Get()
 	res := responses.Get()
 
@@ -176,8 +202,17 @@ func rejectFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		return
 	}
 
-	status, err := app.Models.Friendships.DeleteRequest(int64(requestID), user.ID, "reject")
-	if err != nil {
+	status := 1
+
+	_, err = app.Models.Friendships.TransitionRequest(int64(requestID), user.ID, event, app.Config.FriendRequestCooldown)
+	switch {
+	case err == nil:
+		app.NotifyOutbox()
+	case errors.Is(err, data.ErrNoSuchRequest),
+		errors.Is(err, data.ErrInvalidFriendshipTransition),
+		errors.Is(err, data.ErrFriendshipBlocked):
+		status = 0
+	default:
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
@@ -189,26 +224,79 @@ func rejectFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	}
 }
 
+// rejectFriendRequest declines a friend request the authenticated user
+// received. Its sender can't ask again until the cooldown is over.
+func rejectFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	endFriendship(w, r, ps, data.FriendshipDecline)
+}
+
+// unfriend ends a friendship the authenticated user is part of.
 func unfriend(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	endFriendship(w, r, ps, data.FriendshipUnfriend)
+}
+
+// cancelFriendRequest withdraws a friend request the authenticated user sent.
+func cancelFriendRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	app := app.Get()
 	res := responses.Get()
 
 	user := app.Context.GetUser(r)
 
-	requestIDParam := ps.ByName("request_id")
-	requestID, err := strconv.Atoi(requestIDParam)
+	requestID, err := strconv.ParseInt(ps.ByName("request_id"), 10, 64)
+	if err != nil || requestID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.Models.Friendships.TransitionRequest(requestID, user.ID, data.FriendshipCancel, app.Config.FriendRequestCooldown)
+	if err != nil {
+		friendshipErrorResponse(w, r, err)
+		return
+	}
+
+	app.NotifyOutbox()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFriendshipHistory returns the transitions of the authenticated user's
+// friendship with another user, most recent first.
+func getFriendshipHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	friendID, err := strconv.ParseInt(ps.ByName("friend_id"), 10, 64)
+	if err != nil || friendID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
 	if err != nil {
 		res.BadRequestResponse(w, r, err)
 		return
 	}
 
-	status, err := app.Models.Friendships.Unfriend(int64(requestID), user.ID)
+	history, info, err := app.Models.Friendships.History(user.ID, friendID, pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	jsonResponse := envelope{"status": status}
+	if history == nil {
+		history = []data.FriendshipTransition{}
+	}
+
+	jsonResponse := envelope{
+		"history": history,
+		"meta":    paginationMeta(pagination, info),
+	}
 	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -296,24 +384,23 @@ func listPendingRequests(w http.ResponseWriter, r *http.Request) {
 		by = "sent"
 	}
 
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
 
 	user := app.Context.GetUser(r)
 
 	var (
 		reqs []data.Friendship
-		err  error
+		info data.PageInfo
 	)
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-	}
 	if by == "received" {
-		reqs, err = app.Models.Friendships.GetReceivedPendingRequests(user.ID, paginationData)
+		reqs, info, err = app.Models.Friendships.GetReceivedPendingRequests(user.ID, pagination)
 	} else {
-		reqs, err = app.Models.Friendships.GetSentPendingRequests(user.ID, paginationData)
+		reqs, info, err = app.Models.Friendships.GetSentPendingRequests(user.ID, pagination)
 	}
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -322,10 +409,7 @@ func listPendingRequests(w http.ResponseWriter, r *http.Request) {
 
 	jsonResponse := envelope{
 		"requests": reqs,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":     paginationMeta(pagination, info),
 	}
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, jsonResponse, nil)
 	if err != nil {
@@ -0,0 +1,345 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// groupErrorResponse writes the response for an error returned by one of the
+// group operations of ConversationModel.
+func groupErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	res := responses.Get()
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		res.NotFoundResponse(w, r)
+	case errors.Is(err, data.ErrNotGroup), errors.Is(err, data.ErrInvalidRole):
+		res.BadRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrInsufficientRole), errors.Is(err, data.ErrBlockedMember):
+		res.ErrorResponse(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, data.ErrGroupFull):
+		res.ConflictResponse(w, r, err)
+	default:
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// publishSystemMessages streams the system messages recording a change to a
+// group to its members.
+func publishSystemMessages(conversationID int64, messages []data.Message) {
+	for _, msg := range messages {
+		publishToMembers(conversationID, 0, realtime.EventMessage, messageEvent(msg))
+	}
+}
+
+// checkInvitees makes sure every user in userIDs exists and may be messaged
+// by userID. It writes the error response and returns false otherwise.
+func checkInvitees(w http.ResponseWriter, r *http.Request, userID int64, userIDs []int64) bool {
+	app := app.Get()
+	res := responses.Get()
+
+	for _, id := range userIDs {
+		_, err := app.Models.Users.Exists(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrUserNotFound):
+				res.FailedValidationResponse(w, r, map[string]string{"user_ids": "user " + strconv.FormatInt(id, 10) + " does not exist"})
+			default:
+				res.ServerErrorResponse(w, r, err)
+			}
+			return false
+		}
+
+		allowed, err := canMessage(userID, id)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return false
+		}
+
+		if !allowed {
+			res.ErrorResponse(w, r, http.StatusForbidden, "you are not allowed to message user "+strconv.FormatInt(id, 10))
+			return false
+		}
+	}
+
+	return true
+}
+
+// inviteeIDs returns userIDs without duplicates nor the inviting user.
+func inviteeIDs(userID int64, userIDs []int64) []int64 {
+	ids := slices.Clone(userIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	return slices.DeleteFunc(ids, func(id int64) bool { return id == userID })
+}
+
+// createGroup creates a group conversation owned by the authenticated user.
+// Every invited user must be someone the owner may message one-to-one.
+func createGroup(w http.ResponseWriter, r *http.Request, title string, userIDs []int64, shareHistory bool) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	maxMembers := app.Config.Messaging.MaxGroupMembers
+
+	userIDs = inviteeIDs(user.ID, userIDs)
+
+	v := validator.New()
+	if data.ValidateGroup(v, title, userIDs, maxMembers); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !checkInvitees(w, r, user.ID, userIDs) {
+		return
+	}
+
+	id, messages, err := app.Models.Conversations.CreateGroup(user.ID, title, shareHistory, userIDs, maxMembers)
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	publishSystemMessages(id, messages)
+
+	conversation, err := app.Models.Conversations.Get(id, user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"conversation": conversation}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateConversation changes a group's title or history sharing.
+func updateConversation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Title        *string `json:"title"`
+		ShareHistory *bool   `json:"share_history"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		v := validator.New()
+		if data.ValidateGroupTitle(v, *input.Title); !v.Valid() {
+			res.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	messages, err := app.Models.Conversations.UpdateGroup(int64(id), user.ID, input.Title, input.ShareHistory)
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	publishSystemMessages(int64(id), messages)
+
+	conversation, err := app.Models.Conversations.Get(int64(id), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"conversation": conversation}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listConversationMembers returns the members of a conversation along with
+// their roles.
+func listConversationMembers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	members, err := app.Models.Conversations.Members(int64(id), user.ID)
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// addConversationMembers adds users to a group. Only admins and the owner
+// can, and only users they may message one-to-one.
+func addConversationMembers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		UserIDs []int64 `json:"user_ids"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	userIDs := inviteeIDs(user.ID, input.UserIDs)
+	if len(userIDs) == 0 {
+		res.FailedValidationResponse(w, r, map[string]string{"user_ids": "must contain at least one user"})
+		return
+	}
+
+	if !checkInvitees(w, r, user.ID, userIDs) {
+		return
+	}
+
+	messages, err := app.Models.Conversations.AddMembers(int64(id), user.ID, userIDs, app.Config.Messaging.MaxGroupMembers)
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	publishSystemMessages(int64(id), messages)
+
+	members, err := app.Models.Conversations.Members(int64(id), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// removeConversationMember removes a member from a group. Members remove
+// themselves to leave it.
+func removeConversationMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	userID, err := strconv.Atoi(ps.ByName("user_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	messages, err := app.Models.Conversations.RemoveMember(int64(id), user.ID, int64(userID))
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	publishSystemMessages(int64(id), messages)
+
+	// The removed member no longer is one, but still hears about it.
+	if int64(userID) != user.ID {
+		for _, msg := range messages {
+			app.Publish(realtime.UserTopic(int64(userID)), realtime.EventMessage, messageEvent(msg))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setConversationMemberRole changes a member's role in a group. Only the
+// owner can; making someone else the owner transfers ownership.
+func setConversationMemberRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("conversation_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	userID, err := strconv.Atoi(ps.ByName("user_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Role data.ConversationRole `json:"role"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	messages, err := app.Models.Conversations.SetRole(int64(id), user.ID, int64(userID), input.Role)
+	if err != nil {
+		groupErrorResponse(w, r, err)
+		return
+	}
+
+	publishSystemMessages(int64(id), messages)
+
+	members, err := app.Models.Conversations.Members(int64(id), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,332 @@
+package router
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/jobs"
+	"github.com/julienschmidt/httprouter"
+)
+
+// importBatch is how many rows of a follow import are processed between two
+// heartbeats.
+const importBatch = 100
+
+// importFollows starts importing the follows listed in a CSV file of
+// usernames, sent either as the request body or as the "file" field of a
+// multipart form. Imports run in the background: the response holds the
+// import to poll at /v1/follow-imports/:import_id. Uploading a list that was
+// already imported returns the existing import instead of starting a new one.
+func importFollows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	// The route shares its wildcard with /v1/users/:follower_id/follow.
+	if param := ps.ByName("follower_id"); param != "me" && param != strconv.FormatInt(user.ID, 10) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	cfg := app.Config.Imports
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			res.BadRequestResponse(w, r, fmt.Errorf("the file field must hold a CSV file: %w", err))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	usernames, err := data.ParseFollowImport(body, cfg.MaxRows)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			res.BadRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", cfg.MaxBytes))
+		default:
+			res.BadRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	fi, created, err := app.Models.FollowImports.Create(user.ID, usernames, cfg.Limit, cfg.Window)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrImportRateLimited):
+			res.RateLimitExceededResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if fi.Status == data.ImportPending {
+		if err := enqueueFollowImport(fi.ID); err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusAccepted
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/follow-imports/%d", fi.ID))
+
+	err = jsonhttp.WriteJSON(w, status, envelope{"import": fi}, headers)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getFollowImport returns the status and progress of one of the
+// authenticated user's follow imports.
+func getFollowImport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("import_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	fi, err := app.Models.FollowImports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"import": fi}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listFollowImportRows returns the per-row results of one of the
+// authenticated user's follow imports, in file order. ?result= keeps only
+// rows with that result, e.g. not_found.
+func listFollowImportRows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("import_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	result := data.ImportResult(r.URL.Query().Get("result"))
+
+	// Tells a missing import apart from one without matching rows.
+	_, err = app.Models.FollowImports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rows, info, err := app.Models.FollowImports.Rows(id, user.ID, result, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if rows == nil {
+		rows = []data.FollowImportRow{}
+	}
+
+	jsonResponse := envelope{
+		"rows": rows,
+		"meta": paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// followImportJob is the payload of the jobs running follow imports.
+type followImportJob struct {
+	ImportID int64 `json:"import_id"`
+}
+
+// enqueueFollowImport queues a job running import id.
+func enqueueFollowImport(id int64) error {
+	_, err := app.Get().Enqueue(jobRunFollowImport, followImportJob{ImportID: id}, jobs.EnqueueOptions{})
+	return err
+}
+
+// runFollowImportJob runs the follow import of a job.
+func runFollowImportJob(ctx context.Context, job *jobs.Job) error {
+	var payload followImportJob
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	return runFollowImport(payload.ImportID)
+}
+
+// runFollowImport processes the rows of import id left unprocessed, unless
+// another worker holds it. Every user followed gets notified, as with
+// regular follows.
+func runFollowImport(id int64) error {
+	app := app.Get()
+
+	userID, ok, err := app.Models.FollowImports.Claim(id, app.Config.Imports.StaleAfter)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = processFollowImport(id, userID)
+	if err != nil {
+		if finishErr := app.Models.FollowImports.Finish(id, err); finishErr != nil {
+			return finishErr
+		}
+		return err
+	}
+
+	return app.Models.FollowImports.Finish(id, nil)
+}
+
+func processFollowImport(id, userID int64) error {
+	app := app.Get()
+
+	for {
+		rows, err := app.Models.FollowImports.PendingRows(id, importBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			_, err := app.Models.FollowImports.ProcessRow(id, userID, row)
+			if err != nil {
+				return err
+			}
+		}
+
+		app.NotifyOutbox()
+
+		if len(rows) < importBatch {
+			return nil
+		}
+	}
+}
+
+// resumeFollowImports queues the follow imports left pending, or whose
+// worker stopped sending heartbeats, e.g. because its instance went down.
+// Imports are claimed before running, so queuing one twice is harmless.
+func resumeFollowImports(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+
+	ids, err := app.Models.FollowImports.Unfinished(app.Config.Imports.StaleAfter)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := enqueueFollowImport(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportFollows returns the users the authenticated user follows as a CSV
+// file, which can be imported back.
+func exportFollows(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		responses.Get().NotFoundResponse(w, r)
+		return
+	}
+
+	writeCSVExport(w, r, "follows.csv", "followed_at", func(fn func(string, time.Time) error) error {
+		return app.Models.Follows.EachFollowee(user.ID, fn)
+	})
+}
+
+// exportFriends returns the authenticated user's friends as a CSV file.
+func exportFriends(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		responses.Get().NotFoundResponse(w, r)
+		return
+	}
+
+	writeCSVExport(w, r, "friends.csv", "friends_since", func(fn func(string, time.Time) error) error {
+		return app.Models.Friendships.EachFriend(user.ID, fn)
+	})
+}
+
+// writeCSVExport streams the users each yields as a CSV attachment named
+// filename, with a username column and a sinceColumn column. Errors past the
+// header can't change the response status anymore, so they are logged and
+// cut the file short.
+func writeCSVExport(w http.ResponseWriter, r *http.Request, filename, sinceColumn string, each func(func(string, time.Time) error) error) {
+	app := app.Get()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"username", sinceColumn})
+	if err == nil {
+		err = each(func(username string, since time.Time) error {
+			return cw.Write([]string{username, since.UTC().Format(time.RFC3339)})
+		})
+	}
+
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		app.Logger.Error("failed to export", "file", filename, "path", r.URL.Path, "error", err.Error())
+	}
+}
@@ -0,0 +1,266 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/jobs"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Kinds of the background jobs run by the API.
+const (
+	jobPruneJobs           = "jobs.prune"
+	jobPruneOutbox         = "outbox.prune"
+	jobRefreshTrending     = "trending.refresh"
+	jobRefreshSuggestions  = "suggestions.refresh"
+	jobSendDigests         = "digests.send"
+	jobRunFollowImport     = "follow_imports.run"
+	jobResumeFollowImports = "follow_imports.resume"
+)
+
+// RegisterJobs registers the handlers and schedules of the background jobs
+// on worker. Like outbox consumers, a job may run more than once.
+func RegisterJobs(worker *jobs.Worker) error {
+	app := app.Get()
+	cfg := app.Config
+
+	worker.Handle(jobPruneJobs, pruneJobs)
+	worker.Handle(jobPruneOutbox, pruneOutbox)
+	worker.Handle(jobRefreshTrending, refreshTrending)
+	worker.Handle(jobRefreshSuggestions, refreshSuggestions)
+	worker.Handle(jobRunFollowImport, runFollowImportJob)
+	worker.Handle(jobResumeFollowImports, resumeFollowImports)
+
+	schedules := []struct {
+		name, spec, kind string
+	}{
+		{"prune-jobs", "@hourly", jobPruneJobs},
+		{"prune-outbox", "@hourly", jobPruneOutbox},
+		{"refresh-trending", every(cfg.Explore.RefreshInterval), jobRefreshTrending},
+		{"refresh-suggestions", every(cfg.Suggestions.RefreshInterval), jobRefreshSuggestions},
+		{"resume-follow-imports", every(cfg.Imports.StaleAfter), jobResumeFollowImports},
+	}
+
+	for _, s := range schedules {
+		if err := worker.Schedule(s.name, s.spec, s.kind, nil, jobs.EnqueueOptions{}); err != nil {
+			return err
+		}
+	}
+
+	// Digests are only sent when there is a mailer to send them with.
+	if app.Mailer == nil {
+		return nil
+	}
+
+	worker.Handle(jobSendDigests, sendDueDigests)
+	return worker.Schedule("send-digests", every(cfg.Digest.Interval), jobSendDigests, nil, jobs.EnqueueOptions{})
+}
+
+// every returns the schedule running every d.
+func every(d time.Duration) string {
+	return "@every " + d.String()
+}
+
+// pruneJobs deletes the jobs which succeeded over Jobs.Retention ago.
+func pruneJobs(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+
+	_, err := app.Models.Jobs.Prune(time.Now().Add(-app.Config.Jobs.Retention))
+	return err
+}
+
+// pruneOutbox deletes the domain events every consumer handled over
+// Outbox.Retention ago.
+func pruneOutbox(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+
+	_, err := app.Models.Outbox.Prune(time.Now().Add(-app.Config.Outbox.Retention))
+	return err
+}
+
+// refreshTrending recomputes the trending posts of every explore window.
+func refreshTrending(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+
+	var errs []error
+	for _, window := range app.Config.Explore.Windows {
+		err := app.Models.Trending.Refresh(window, app.Config.Explore.Trending)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("window %s: %w", window.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// refreshSuggestions recomputes the follow suggestions of recently active
+// users whose suggestions went stale.
+func refreshSuggestions(ctx context.Context, job *jobs.Job) error {
+	app := app.Get()
+	cfg := app.Config.Suggestions
+
+	userIDs, err := app.Models.Suggestions.Stale(cfg.MaxAge, cfg.ActiveWithin, cfg.Batch)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		if err := app.Models.Suggestions.Refresh(id, cfg.Options); err != nil {
+			app.Logger.Error("failed to refresh follow suggestions", "user_id", id, "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// requireAdmin writes a forbidden response and returns false unless the
+// authenticated user is an administrator.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !app.IsAdmin(user.ID) {
+		res.NotAuthorizedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// readJobID returns the :job_id parameter. It writes a not found response
+// and returns 0 if it isn't a valid id.
+func readJobID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) int64 {
+	id, err := strconv.ParseInt(ps.ByName("job_id"), 10, 64)
+	if err != nil || id < 1 {
+		responses.Get().NotFoundResponse(w, r)
+		return 0
+	}
+
+	return id
+}
+
+// listJobs lists the background jobs, newest first, optionally of a given
+// state, kind or queue. Restricted to administrators.
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := data.JobFilter{
+		State: jobs.State(query.Get("state")),
+		Kind:  query.Get("kind"),
+		Queue: query.Get("queue"),
+	}
+	if filter.State != "" && !filter.State.IsValid() {
+		res.FailedValidationResponse(w, r, map[string]string{"state": "must be one of pending, running, succeeded or dead"})
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	list, info, err := app.Models.Jobs.List(filter, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if list == nil {
+		list = []jobs.Job{}
+	}
+
+	jsonResponse := envelope{
+		"jobs": list,
+		"meta": paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getJob returns a background job. Restricted to administrators.
+func getJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id := readJobID(w, r, ps)
+	if id == 0 {
+		return
+	}
+
+	job, err := app.Models.Jobs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"job": job}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// retryJob runs a pending or dead background job right away, giving a dead
+// one a fresh set of attempts. Restricted to administrators.
+func retryJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id := readJobID(w, r, ps)
+	if id == 0 {
+		return
+	}
+
+	job, err := app.Models.Jobs.Retry(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrJobNotRetryable):
+			res.ConflictResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.Jobs != nil {
+		app.Jobs.Notify()
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"job": job}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
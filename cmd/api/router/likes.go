@@ -7,7 +7,6 @@ import (
 	"strconv"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
@@ -27,18 +26,18 @@ func likePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	user := app.Context.GetUser(r)
 
-	exists, err := app.Models.Posts.Exists(int64(postID))
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	if !exists {
+	if !visible {
 		res.NotFoundResponse(w, r)
 		return
 	}
 
-	like, err := app.Models.Likes.Like(int64(user.ID), int64(postID))
+	like, err := app.Models.Likes.Like(int64(user.ID), int64(postID), app.Config.Reactions.SinglePerPost)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -57,6 +56,8 @@ func likePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	app.NotifyOutbox()
+
 	jsonResponse := envelope{
 		"message": nil,
 		"like":    like,
@@ -80,13 +81,13 @@ func dislikePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	user := app.Context.GetUser(r)
 
-	exists, err := app.Models.Posts.Exists(int64(postID))
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	if !exists {
+	if !visible {
 		res.NotFoundResponse(w, r)
 		return
 	}
@@ -102,6 +103,8 @@ func dislikePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	app.NotifyOutbox()
+
 	err = jsonhttp.WriteJSON(w, http.StatusNoContent, nil, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -126,6 +129,19 @@ func hasUserLiked(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
+	viewer := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
 	hasLiked, err := app.Models.Likes.IsLikedBy(int64(userID), int64(postID))
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -142,7 +158,6 @@ func hasUserLiked(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 func listLikesOnPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	app := app.Get()
 	res := responses.Get()
-	query := r.URL.Query()
 
 	postIDParam := ps.ByName("post_id")
 	postID, err := strconv.Atoi(postIDParam)
@@ -151,28 +166,26 @@ func listLikesOnPost(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
-	exists, err := app.Models.Posts.Exists(int64(postID))
+	user := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	if !exists {
+	if !visible {
 		res.NotFoundResponse(w, r)
 		return
 	}
 
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
-	sort := query.Get("sort")
-
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-		Sort:     sort,
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
 	}
 
-	likes, err := app.Models.Likes.ListLikesFromPost(int64(postID), paginationData)
+	likes, info, err := app.Models.Likes.ListLikesFromPost(int64(postID), pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -184,10 +197,7 @@ func listLikesOnPost(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 
 	jsonResponse := envelope{
 		"likes": likes,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":  paginationMeta(pagination, info),
 	}
 	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
 	if err != nil {
@@ -206,13 +216,15 @@ func countLikesFromPost(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
-	exists, err := app.Models.Posts.Exists(int64(postID))
+	user := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	if !exists {
+	if !visible {
 		res.NotFoundResponse(w, r)
 		return
 	}
@@ -0,0 +1,464 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+func listErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	res := responses.Get()
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		res.NotFoundResponse(w, r)
+	case errors.Is(err, data.ErrSubscribeOwnList):
+		res.BadRequestResponse(w, r, err)
+	case errors.Is(err, data.ErrBlockedListMember):
+		res.ErrorResponse(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, data.ErrListFull):
+		res.ConflictResponse(w, r, err)
+	default:
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readList returns the list named by the :list_id parameter, as seen by the
+// current user. It writes the error response and returns nil if the list
+// doesn't exist or is hidden from them, or if owned is set and they don't
+// own it.
+func readList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, owned bool) *data.List {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("list_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return nil
+	}
+
+	list, err := app.Models.Lists.Get(id, viewer.ID)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return nil
+	}
+
+	if owned && list.OwnerID != viewer.ID {
+		res.NotAuthorizedResponse(w, r)
+		return nil
+	}
+
+	return list
+}
+
+// createList creates a list owned by the authenticated user.
+func createList(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Private     bool   `json:"private"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		OwnerID:     user.ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Private:     input.Private,
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Lists.Insert(list)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"list": list}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getList returns a list. Private lists are only served to their owner.
+func getList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	res := responses.Get()
+
+	list := readList(w, r, ps, false)
+	if list == nil {
+		return
+	}
+
+	err := jsonhttp.WriteJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateList edits the name, description or privacy of one of the
+// authenticated user's lists. Making a list private unsubscribes everyone
+// from it.
+func updateList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	list := readList(w, r, ps, true)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Private     *bool   `json:"private"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Private != nil {
+		list.Private = *input.Private
+	}
+
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Lists.Update(list)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	if list.Private {
+		list.SubscribersCount = 0
+		list.Subscribed = false
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteList deletes one of the authenticated user's lists.
+func deleteList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+
+	list := readList(w, r, ps, true)
+	if list == nil {
+		return
+	}
+
+	err := app.Models.Lists.Delete(list.ID, list.OwnerID)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listListMembers returns the members of a list, most recently added first.
+func listListMembers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	list := readList(w, r, ps, false)
+	if list == nil {
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	members, info, err := app.Models.Lists.Members(list.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if members == nil {
+		members = []data.UserPublic{}
+	}
+
+	jsonResponse := envelope{
+		"members": members,
+		"meta":    paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// addListMember adds a user to one of the authenticated user's lists.
+func addListMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	list := readList(w, r, ps, true)
+	if list == nil {
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = app.Models.Users.Exists(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.FailedValidationResponse(w, r, map[string]string{"user_id": "must be an existing user"})
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Lists.AddMember(list.ID, list.OwnerID, input.UserID, app.Config.MaxListMembers)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeListMember removes a user from one of the authenticated user's
+// lists.
+func removeListMember(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	list := readList(w, r, ps, true)
+	if list == nil {
+		return
+	}
+
+	userID, err := strconv.ParseInt(ps.ByName("user_id"), 10, 64)
+	if err != nil || userID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Lists.RemoveMember(list.ID, list.OwnerID, userID)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getListTimeline returns the posts of a list's members that the current
+// user can read, newest first.
+func getListTimeline(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+
+	list := readList(w, r, ps, false)
+	if list == nil {
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	posts, info, err := app.Models.Lists.Timeline(list.ID, viewer.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if posts == nil {
+		posts = []data.PostPublic{}
+	}
+
+	err = decoratePosts(posts, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse := envelope{
+		"timeline": posts,
+		"meta":     paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// subscribeToList subscribes the authenticated user to someone else's
+// public list.
+func subscribeToList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+
+	user := app.Context.GetUser(r)
+
+	list := readList(w, r, ps, false)
+	if list == nil {
+		return
+	}
+
+	err := app.Models.Lists.Subscribe(list.ID, user.ID)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribeFromList unsubscribes the authenticated user from a list.
+func unsubscribeFromList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("list_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Lists.Unsubscribe(id, user.ID)
+	if err != nil {
+		listErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listUserLists returns the lists a user created, newest first. Their
+// private lists are only included for themselves.
+func listUserLists(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+
+	ownerID, err := strconv.ParseInt(ps.ByName("user_id"), 10, 64)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	lists, info, err := app.Models.Lists.ForOwner(ownerID, viewer.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if lists == nil {
+		lists = []data.List{}
+	}
+
+	jsonResponse := envelope{
+		"lists": lists,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listListSubscriptions returns the lists the authenticated user subscribes
+// to. Subscriptions are private, so only /v1/users/me/list-subscriptions (or
+// the user's own id) is served.
+func listListSubscriptions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	lists, info, err := app.Models.Lists.Subscriptions(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if lists == nil {
+		lists = []data.List{}
+	}
+
+	jsonResponse := envelope{
+		"lists": lists,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -25,6 +25,27 @@ func RegisterHandler(method, path string, handler httprouter.Handle) {
 	})
 }
 
+// Protect adapts a handler that requires an authenticated user into an
+// httprouter.Handle.
+func Protect(handler http.HandlerFunc, ctx *appcontext.Context) httprouter.Handle {
+	return helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+}
+
+// Static serves requests whose wildcard param equals segment with handler,
+// and all others with fallback. httprouter can't register a static segment
+// where a wildcard already is, so that paths such as
+// /v1/users/:user_id/follows/export are served through the route of
+// /v1/users/:user_id/follows/:followee_id.
+func Static(param, segment string, handler, fallback httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName(param) == segment {
+			handler(w, r, ps)
+			return
+		}
+		fallback(w, r, ps)
+	}
+}
+
 // Get register a handler for HTTP GET requests.
 // This is a convenience wrapper aruond RegisterHandler.
 func Get(path string, handler httprouter.Handle) {
@@ -33,7 +54,7 @@ func Get(path string, handler httprouter.Handle) {
 
 // ProtectedGet register a handler for HTTP GET requests that require an authenticated user.
 func ProtectedGet(path string, handler http.HandlerFunc, ctx *appcontext.Context) {
-	protectedHandler := helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+	protectedHandler := Protect(handler, ctx)
 	Get(path, protectedHandler)
 }
 
@@ -45,7 +66,7 @@ func Post(path string, handler httprouter.Handle) {
 
 // ProtectedPost register a handler for HTTP POST requests that require an authenticated user.
 func ProtectedPost(path string, handler http.HandlerFunc, ctx *appcontext.Context) {
-	protectedHandler := helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+	protectedHandler := Protect(handler, ctx)
 	Post(path, protectedHandler)
 }
 
@@ -57,7 +78,7 @@ func Put(path string, handler httprouter.Handle) {
 
 // ProtectedPut register a handler for HTTP PUT requests that require an authenticated user.
 func ProtectedPut(path string, handler http.HandlerFunc, ctx *appcontext.Context) {
-	protectedHandler := helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+	protectedHandler := Protect(handler, ctx)
 	Put(path, protectedHandler)
 }
 
@@ -66,7 +87,7 @@ func Patch(path string, handler httprouter.Handle) {
 }
 
 func ProtectedPatch(path string, handler http.HandlerFunc, ctx *appcontext.Context) {
-	protectedHandler := helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+	protectedHandler := Protect(handler, ctx)
 	Patch(path, protectedHandler)
 }
 
@@ -78,6 +99,6 @@ func Delete(path string, handler httprouter.Handle) {
 
 // ProtectedDelete register a handler for HTTP DELETE requests that require an authenticated user.
 func ProtectedDelete(path string, handler http.HandlerFunc, ctx *appcontext.Context) {
-	protectedHandler := helpers.AdaptHttpRouterHandle(ctx, middleware.RequireAuthenticatedUser(ctx, handler))
+	protectedHandler := Protect(handler, ctx)
 	Delete(path, protectedHandler)
 }
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// muteUser hides the given user's content from the authenticated user's
+// discovery surfaces, such as the explore page.
+func muteUser(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	_, err = app.Models.Users.Exists(input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Mutes.Mute(user.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMuteSelf):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"user_id": input.UserID, "muted": true}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// unmuteUser lifts a mute set by the authenticated user.
+func unmuteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	mutedID, err := strconv.Atoi(ps.ByName("user_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Mutes.Unmute(user.ID, int64(mutedID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listMutes returns the users muted by the authenticated user.
+func listMutes(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	users, info, err := app.Models.Mutes.List(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if users == nil {
+		users = []data.UserPublic{}
+	}
+
+	jsonResponse := envelope{
+		"users": users,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
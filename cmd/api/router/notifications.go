@@ -0,0 +1,205 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// deliverNotification records n, streams it to its recipient and pushes it
+// to their devices.
+func deliverNotification(n *data.Notification) error {
+	app := app.Get()
+
+	if err := app.Models.Notifications.Notify(n); err != nil {
+		return err
+	}
+
+	// A zero id means the recipient opted out of it.
+	if n.ID == 0 {
+		return nil
+	}
+
+	app.Publish(realtime.UserTopic(n.UserID), realtime.EventNotification, envelope{"notification": n})
+	return pushNotification(n)
+}
+
+// listNotifications returns the authenticated user's notifications, grouped,
+// along with their unread counts. ?unread=true lists unread groups only.
+func listNotifications(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	unreadOnly, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+
+	groups, info, err := app.Models.Notifications.List(user.ID, unreadOnly, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	counts, err := app.Models.Notifications.UnreadCounts(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if groups == nil {
+		groups = []data.NotificationGroup{}
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	meta := paginationMeta(pagination, info)
+	meta["unread"] = envelope{"total": total, "by_type": counts}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"notifications": groups, "meta": meta}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// patchNotification marks a notification, along with the rest of its group,
+// as read or unread.
+func patchNotification(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Read *bool `json:"read"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Read == nil {
+		res.FailedValidationResponse(w, r, map[string]string{"read": "must be provided"})
+		return
+	}
+
+	err = app.Models.Notifications.SetRead(user.ID, int64(id), *input.Read)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"id": id, "read": *input.Read}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// markAllNotificationsRead marks every notification of the authenticated
+// user as read.
+func markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	count, err := app.Models.Notifications.MarkAllRead(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"marked_read": count}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getNotificationPreferences returns which notification types the
+// authenticated user receives.
+func getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	prefs, err := app.Models.Notifications.Preferences(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"preferences": prefs}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationPreferences turns notification types on or off, from a
+// body such as {"reaction": false}. Types left out are unchanged.
+func updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input map[data.NotificationType]bool
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	for t := range input {
+		if !t.IsValid() {
+			res.FailedValidationResponse(w, r, map[string]string{string(t): "is not a notification type"})
+			return
+		}
+	}
+
+	err = app.Models.Notifications.SetPreferences(user.ID, input)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	prefs, err := app.Models.Notifications.Preferences(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"preferences": prefs}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
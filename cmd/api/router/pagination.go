@@ -0,0 +1,77 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/helpers"
+	"github.com/bryryann/mantel/backend/internal/data"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// readPagination reads the page_size, cursor and sort query parameters of a
+// list request. sort is used when the request doesn't set one.
+//
+// The page parameter selects the deprecated offset pagination, which is kept
+// for older clients and flagged through the Deprecation response header.
+func readPagination(w http.ResponseWriter, r *http.Request, sort string) (data.Pagination, error) {
+	query := r.URL.Query()
+
+	pagination := data.Pagination{
+		PageSize: helpers.ParseIntOrDefault(query.Get("page_size"), defaultPageSize),
+		Sort:     sort,
+	}
+
+	if s := query.Get("sort"); s != "" {
+		pagination.Sort = s
+	}
+
+	pagination.PageSize = min(pagination.PageSize, maxPageSize)
+
+	if token := query.Get("cursor"); token != "" {
+		cursor, err := data.DecodeCursor(token, app.Get().Config.CursorSecret)
+		if err != nil {
+			return data.Pagination{}, err
+		}
+		pagination.Cursor = cursor
+		return pagination, nil
+	}
+
+	if query.Has("page") {
+		pagination.Page = helpers.ParseIntOrDefault(query.Get("page"), 1)
+		w.Header().Set("Deprecation", "true")
+	}
+
+	return pagination, nil
+}
+
+// paginationMeta builds the "meta" object of a list response. Cursors are
+// signed so clients can pass them back untouched.
+func paginationMeta(pagination data.Pagination, info data.PageInfo) map[string]any {
+	meta := map[string]any{
+		"page_size": pagination.PageSize,
+	}
+
+	if pagination.UsesOffset() {
+		meta["page"] = pagination.Page
+		return meta
+	}
+
+	secret := app.Get().Config.CursorSecret
+
+	meta["next_cursor"] = nil
+	if info.Next != nil {
+		meta["next_cursor"] = data.EncodeCursor(*info.Next, secret)
+	}
+
+	meta["prev_cursor"] = nil
+	if info.Prev != nil {
+		meta["prev_cursor"] = data.EncodeCursor(*info.Prev, secret)
+	}
+
+	return meta
+}
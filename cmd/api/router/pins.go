@@ -0,0 +1,174 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// pinPost pins one of the authenticated user's public posts to their profile.
+func pinPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	exists, err := app.Models.Posts.Exists(int64(postID))
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !exists {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	owned, err := app.Models.Posts.CheckPostOwnership(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !owned {
+		res.NotAuthorizedResponse(w, r)
+		return
+	}
+
+	err = app.Models.Pins.Pin(user.ID, int64(postID), app.Config.MaxPins)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrPinLimitReached), errors.Is(err, data.ErrPostNotPinnable):
+			res.ConflictResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"post_id": postID, "pinned": true}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// unpinPost removes one of the authenticated user's posts from their profile pins.
+func unpinPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	exists, err := app.Models.Posts.Exists(int64(postID))
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !exists {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	owned, err := app.Models.Posts.CheckPostOwnership(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !owned {
+		res.NotAuthorizedResponse(w, r)
+		return
+	}
+
+	err = app.Models.Pins.Unpin(user.ID, int64(postID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reorderPins sets the order of the authenticated user's pinned posts.
+// The body must list every pinned post id exactly once.
+func reorderPins(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotAuthorizedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		PostIDs []int64 `json:"post_ids"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.Unique(input.PostIDs), "post_ids", "must not contain duplicate values")
+	if !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Pins.Reorder(user.ID, input.PostIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidPinsOrder):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	pinned, err := app.Models.Pins.ListPinned(user.ID, user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if pinned == nil {
+		pinned = []data.PostPublic{}
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"pinned_posts": pinned}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,124 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getPostPoll returns the poll attached to a post. Tallies are only included
+// once the viewer has voted or the poll has closed.
+func getPostPoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	poll, err := app.Models.Polls.ForPost(int64(postID), viewer.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPollNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"poll": poll}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// voteOnPoll records the authenticated user's vote on the poll of a post and
+// returns the poll with its now visible tallies.
+func voteOnPoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		OptionIDs []int64 `json:"option_ids"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateVote(v, input.OptionIDs); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Polls.Vote(int64(postID), user.ID, input.OptionIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPollNotFound):
+			res.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrAlreadyVoted), errors.Is(err, data.ErrPollClosed):
+			res.ConflictResponse(w, r, err)
+		case errors.Is(err, data.ErrInvalidPollOption), errors.Is(err, data.ErrSingleChoicePoll):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poll, err := app.Models.Polls.ForPost(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"poll": poll}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
@@ -29,7 +29,9 @@ func findPostByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
-	post, err := app.Models.Posts.Get(int64(postID))
+	user := app.Context.GetUser(r)
+
+	post, err := app.Models.Posts.Get(int64(postID), user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -42,6 +44,12 @@ func findPostByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 
 	post.ID = int64(postID)
 
+	err = decoratePost(post, user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"post": post}, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -64,7 +72,9 @@ func findPostByIDFromUser(w http.ResponseWriter, r *http.Request, ps httprouter.
 		return
 	}
 
-	post, err := app.Models.Posts.FindByIDFromUser(int64(postID), int64(userID))
+	viewer := app.Context.GetUser(r)
+
+	post, err := app.Models.Posts.FindByIDFromUser(int64(postID), int64(userID), viewer.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -76,6 +86,12 @@ func findPostByIDFromUser(w http.ResponseWriter, r *http.Request, ps httprouter.
 		return
 	}
 
+	err = decoratePost(post, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
 	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"post": post}, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -93,19 +109,15 @@ func getPostsFromUser(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		return
 	}
 
-	query := r.URL.Query()
-
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
-	sort := query.Get("sort")
-
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
-		Sort:     sort,
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
 	}
 
-	posts, err := app.Models.Posts.SelectAllFromUser(int64(userID), paginationData)
+	viewer := app.Context.GetUser(r)
+
+	posts, info, err := app.Models.Posts.SelectAllFromUser(int64(userID), viewer.ID, pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -115,13 +127,39 @@ func getPostsFromUser(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		posts = []data.PostPublic{}
 	}
 
+	err = decoratePosts(posts, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
 	jsonResponse := envelope{
 		"posts": posts,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":  paginationMeta(pagination, info),
 	}
+
+	// Keyset pages leave pinned posts out, so the first page lists them
+	// separately, keeping posts within page_size.
+	if !pagination.UsesOffset() && pagination.Cursor == nil {
+		pinned, err := app.Models.Pins.ListPinned(int64(userID), viewer.ID)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if pinned == nil {
+			pinned = []data.PostPublic{}
+		}
+
+		err = decoratePosts(pinned, viewer.ID)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		jsonResponse["pinned_posts"] = pinned
+	}
+
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, jsonResponse, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -135,7 +173,14 @@ func createNewPost(w http.ResponseWriter, r *http.Request) {
 	user := app.Context.GetUser(r)
 
 	var input struct {
-		Content string `json:"content"`
+		Content    string `json:"content"`
+		Visibility string `json:"visibility"`
+		ReplyToID  *int64 `json:"reply_to_id"`
+		Poll       *struct {
+			Options         []string `json:"options"`
+			MultipleChoice  bool     `json:"multiple_choice"`
+			DurationMinutes int      `json:"duration_minutes"`
+		} `json:"poll"`
 	}
 
 	err := jsonhttp.ReadJSON(w, r, &input)
@@ -144,13 +189,47 @@ func createNewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if input.Visibility == "" {
+		input.Visibility = string(data.VisibilityPublic)
+	}
+
 	post := &data.Post{
-		UserID:  user.ID,
-		Content: input.Content,
+		UserID:     user.ID,
+		Content:    input.Content,
+		Visibility: data.PostVisibility(input.Visibility),
+		ReplyToID:  input.ReplyToID,
 	}
 
 	v := validator.New()
-	if data.ValidatePost(v, post); !v.Valid() {
+	data.ValidatePost(v, post)
+
+	if post.ReplyToID != nil {
+		visible, err := app.Models.Posts.IsVisibleTo(*post.ReplyToID, user.ID)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+		v.Check(visible, "reply_to_id", "must reference an existing post")
+	}
+
+	if input.Poll != nil {
+		duration := time.Duration(input.Poll.DurationMinutes) * time.Minute
+		if input.Poll.DurationMinutes == 0 {
+			duration = 24 * time.Hour
+		}
+
+		post.Poll = &data.Poll{
+			MultipleChoice: input.Poll.MultipleChoice,
+			ExpiresAt:      time.Now().Add(duration),
+		}
+		for _, text := range input.Poll.Options {
+			post.Poll.Options = append(post.Poll.Options, data.PollOption{Text: strings.TrimSpace(text)})
+		}
+
+		data.ValidatePoll(v, post.Poll, duration)
+	}
+
+	if !v.Valid() {
 		res.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -161,6 +240,10 @@ func createNewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.NotifyOutbox()
+
+	post.CloseFriends = post.Visibility == data.VisibilityCloseFriends
+
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"post": post}, nil)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
@@ -197,6 +280,8 @@ func deletePostFromAuthUser(w http.ResponseWriter, r *http.Request, ps httproute
 		return
 	}
 
+	app.NotifyOutbox()
+
 	message := fmt.Sprintf("succesfully deleted post with id - %d", postID)
 	err = jsonhttp.WriteJSON(w, http.StatusAccepted, message, nil)
 	if err != nil {
@@ -217,7 +302,8 @@ func editPostContent(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}
 
 	var input struct {
-		Content string `json:"content"`
+		Content    *string `json:"content"`
+		Visibility *string `json:"visibility"`
 	}
 
 	err = jsonhttp.ReadJSON(w, r, &input)
@@ -226,7 +312,12 @@ func editPostContent(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
-	if strings.TrimSpace(input.Content) == "" {
+	if input.Content == nil && input.Visibility == nil {
+		res.BadRequestResponse(w, r, errors.New("no fields provided"))
+		return
+	}
+
+	if input.Content != nil && strings.TrimSpace(*input.Content) == "" {
 		res.BadRequestResponse(w, r, errors.New("content must not be empty"))
 		return
 	}
@@ -242,10 +333,29 @@ func editPostContent(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
-	patchedPost := &data.Post{
-		ID:      int64(postID),
-		UserID:  user.ID,
-		Content: input.Content,
+	patchedPost, err := app.Models.Posts.FindByIDFromUser(int64(postID), user.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Content != nil {
+		patchedPost.Content = *input.Content
+	}
+
+	if input.Visibility != nil {
+		patchedPost.Visibility = data.PostVisibility(*input.Visibility)
+	}
+
+	v := validator.New()
+	if data.ValidatePost(v, patchedPost); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
 	}
 
 	patchedPost, err = app.Models.Posts.PatchPost(patchedPost)
@@ -264,3 +374,59 @@ func editPostContent(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		res.ServerErrorResponse(w, r, err)
 	}
 }
+
+// listReplies returns the replies to a post, oldest first.
+func listReplies(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	replies, info, err := app.Models.Posts.ListReplies(int64(postID), viewer.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if replies == nil {
+		replies = []data.PostPublic{}
+	}
+
+	err = decoratePosts(replies, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse := envelope{
+		"replies": replies,
+		"meta":    paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
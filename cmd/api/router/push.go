@@ -0,0 +1,180 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/bryryann/mantel/backend/internal/webpush"
+	"github.com/julienschmidt/httprouter"
+)
+
+// pushNotification queues n for delivery to every device its recipient
+// subscribed to Web Push. Messages about the same subject share a topic, so
+// that a device coming back online only gets the latest one.
+func pushNotification(n *data.Notification) error {
+	app := app.Get()
+
+	if app.Push == nil {
+		return nil
+	}
+
+	subs, err := app.Models.Push.ForUser(n.UserID)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(envelope{"type": "notification", "notification": n})
+	if err != nil {
+		return err
+	}
+
+	subject := n.ActorID
+	if n.PostID != nil {
+		subject = *n.PostID
+	}
+
+	msg := webpush.Message{
+		Payload: payload,
+		Topic:   fmt.Sprintf("%s-%d", n.Type, subject),
+		Urgency: webpush.UrgencyNormal,
+	}
+
+	for _, sub := range subs {
+		ok := app.Push.Enqueue(webpush.Subscription{
+			Endpoint: sub.Endpoint,
+			Keys:     webpush.Keys{P256dh: sub.P256dh, Auth: sub.Auth},
+		}, msg)
+		if !ok {
+			app.Logger.Warn("push queue full, dropping message", "user_id", n.UserID)
+		}
+	}
+
+	return nil
+}
+
+// getVAPIDKey returns the public key clients subscribe to Web Push with.
+func getVAPIDKey(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	if app.VAPID == nil {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err := jsonhttp.WriteJSON(w, http.StatusOK, envelope{"public_key": app.VAPID.PublicKey()}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listPushSubscriptions returns the devices the authenticated user
+// subscribed to Web Push.
+func listPushSubscriptions(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	subs, err := app.Models.Push.ForUser(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if subs == nil {
+		subs = []data.PushSubscription{}
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"subscriptions": subs}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// createPushSubscription subscribes a device to Web Push, from the body
+// PushSubscription.toJSON() returns in the browser.
+func createPushSubscription(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	if app.Push == nil {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	var input webpush.Subscription
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	sub := &data.PushSubscription{
+		UserID:    user.ID,
+		Endpoint:  input.Endpoint,
+		P256dh:    input.Keys.P256dh,
+		Auth:      input.Keys.Auth,
+		UserAgent: r.UserAgent(),
+	}
+
+	v := validator.New()
+	if data.ValidatePushSubscription(v, sub); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := input.Keys.Validate(); err != nil {
+		res.FailedValidationResponse(w, r, map[string]string{"keys": err.Error()})
+		return
+	}
+
+	err = app.Models.Push.Save(sub)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"subscription": sub}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deletePushSubscription unsubscribes a device of the authenticated user.
+func deletePushSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Push.Delete(user.ID, int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// reactToPost leaves a reaction from the authenticated user on a post.
+// Depending on configuration, it replaces any previous reaction of the user.
+func reactToPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		Reaction string `json:"reaction"`
+	}
+
+	err = jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateReaction(v, input.Reaction, app.Config.Reactions.Allowed); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	reaction, err := app.Models.Reactions.React(user.ID, int64(postID), input.Reaction, app.Config.Reactions.SinglePerPost)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if reaction == nil {
+		jsonResponse := envelope{
+			"message":  "reaction already exists",
+			"reaction": nil,
+		}
+
+		err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.NotifyOutbox()
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"reaction": reaction}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// removeReaction removes the authenticated user's reaction from a post.
+// Without a ?type= parameter every reaction of the user on the post is removed.
+func removeReaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.Context.GetUser(r)
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Reactions.Unreact(user.ID, int64(postID), r.URL.Query().Get("type"))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.NotifyOutbox()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listReactionsOnPost lists who reacted to a post, optionally filtered by
+// reaction with ?type=, alongside the aggregated counts.
+func listReactionsOnPost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+	query := r.URL.Query()
+
+	postID, err := strconv.Atoi(ps.ByName("post_id"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	viewer := app.Context.GetUser(r)
+
+	reactionType := query.Get("type")
+	if reactionType != "" {
+		v := validator.New()
+		if data.ValidateReaction(v, reactionType, app.Config.Reactions.Allowed); !v.Valid() {
+			res.FailedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	visible, err := app.Models.Posts.IsVisibleTo(int64(postID), viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	reactions, info, err := app.Models.Reactions.List(int64(postID), reactionType, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if reactions == nil {
+		reactions = []data.ReactionPublic{}
+	}
+
+	summaries, err := app.Models.Reactions.ForPosts([]int64{int64(postID)}, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse := envelope{
+		"reactions": reactions,
+		"summary":   summaries[int64(postID)],
+		"meta":      paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
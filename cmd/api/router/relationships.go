@@ -0,0 +1,72 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultMutualsSample = 3
+	maxMutualsSample     = 20
+)
+
+// getRelationship returns how the authenticated user relates to another user:
+// follows in both directions, friendship status, blocks and mutes, and a
+// sample of the mutual followers and friends they share. The sample size is
+// set with ?sample=, 0 leaving only the counts.
+func getRelationship(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+
+	userID, err := strconv.ParseInt(ps.ByName("user_id"), 10, 64)
+	if err != nil || userID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	if userID == viewer.ID {
+		res.BadRequestResponse(w, r, errors.New("cannot get a relationship with yourself"))
+		return
+	}
+
+	sample := defaultMutualsSample
+	if param := r.URL.Query().Get("sample"); param != "" {
+		sample, err = strconv.Atoi(param)
+		if err != nil || sample < 0 {
+			res.BadRequestResponse(w, r, errors.New("sample must be a non-negative integer"))
+			return
+		}
+		sample = min(sample, maxMutualsSample)
+	}
+
+	_, err = app.Models.Users.Exists(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	relationship, err := app.Models.Relationships.Get(viewer.ID, userID, sample)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"relationship": relationship}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,39 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRelationshipEndpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID string
+		query  string
+		status int
+	}{
+		{"not a number", "abc", "", http.StatusNotFound},
+		{"not an id", "0", "", http.StatusNotFound},
+		{"self", "7", "", http.StatusBadRequest},
+		{"sample not a number", "8", "?sample=abc", http.StatusBadRequest},
+		{"negative sample", "8", "?sample=-1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/"+tt.userID+"/relationship"+tt.query, nil)
+			req = app.Get().Context.SetUser(req, &data.User{ID: 7})
+
+			rr := httptest.NewRecorder()
+			getRelationship(rr, req, httprouter.Params{{Key: "user_id", Value: tt.userID}})
+
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
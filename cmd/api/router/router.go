@@ -57,20 +57,40 @@ func InitializeRouter(ctx *appcontext.Context) {
 	// follows
 	Get("/v1/users/:user_id/followers", listUserFollowers)
 	Get("/v1/users/:user_id/followees", listUserFollowees)
-	Get("/v1/users/:user_id/follows/:followee_id", checkFollowStatus)
+	Get("/v1/users/:user_id/follows/:followee_id", Static("followee_id", "export", Protect(httpCompatible(ctx, exportFollows), ctx), checkFollowStatus))
 	ProtectedPost("/v1/users/:follower_id/follow", httpCompatible(ctx, followUser), ctx)
 	ProtectedPost("/v1/users/:follower_id/unfollow/:followee_id", httpCompatible(ctx, unfollowUser), ctx)
 
+	// follow imports
+	ProtectedPost("/v1/users/:follower_id/follows/import", httpCompatible(ctx, importFollows), ctx)
+	ProtectedGet("/v1/follow-imports/:import_id", httpCompatible(ctx, getFollowImport), ctx)
+	ProtectedGet("/v1/follow-imports/:import_id/rows", httpCompatible(ctx, listFollowImportRows), ctx)
+
+	// relationships
+	ProtectedGet("/v1/users/:user_id/relationship", httpCompatible(ctx, getRelationship), ctx)
+
 	// friendships
 	ProtectedGet("/v1/friend-requests", listPendingRequests, ctx)
 	ProtectedPost("/v1/friend-requests", sendFriendRequest, ctx)
 	ProtectedDelete("/v1/friend-requests/:request_id/reject", httpCompatible(ctx, rejectFriendRequest), ctx)
 	ProtectedDelete("/v1/friend-requests/:request_id/unfriend", httpCompatible(ctx, unfriend), ctx)
+	ProtectedDelete("/v1/friend-requests/:request_id", httpCompatible(ctx, cancelFriendRequest), ctx)
 	ProtectedPut("/v1/friend-requests/:id", httpCompatible(ctx, patchPendingFriendRequest), ctx)
 
 	Get("/v1/users/:user_id/friends", getFriendsById)
-	Get("/v1/users/:user_id/friends/:friend_id", getFriendship)
+	Get("/v1/users/:user_id/friends/:friend_id", Static("friend_id", "export", Protect(httpCompatible(ctx, exportFriends), ctx), getFriendship))
 	Get("/v1/users/:user_id/friends/:friend_id/status", getFriendshipStatus)
+	ProtectedGet("/v1/users/:user_id/friends/:friend_id/history", httpCompatible(ctx, getFriendshipHistory), ctx)
+
+	// close friends
+	ProtectedGet("/v1/close-friends", listCloseFriends, ctx)
+	ProtectedPost("/v1/close-friends", addCloseFriend, ctx)
+	ProtectedDelete("/v1/close-friends/:user_id", httpCompatible(ctx, removeCloseFriend), ctx)
+
+	// blocks
+	ProtectedGet("/v1/blocks", listBlocks, ctx)
+	ProtectedPost("/v1/blocks", blockUser, ctx)
+	ProtectedDelete("/v1/blocks/:user_id", httpCompatible(ctx, unblockUser), ctx)
 
 	// posts
 	Get("/v1/posts/:post_id", findPostByID)
@@ -79,6 +99,16 @@ func InitializeRouter(ctx *appcontext.Context) {
 	ProtectedPatch("/v1/posts/:post_id", httpCompatible(ctx, editPostContent), ctx)
 	Get("/v1/users/:user_id/posts", getPostsFromUser)
 	Get("/v1/users/:user_id/posts/:post_id", findPostByIDFromUser)
+	Get("/v1/posts/:post_id/replies", listReplies)
+
+	// pins
+	ProtectedPost("/v1/posts/:post_id/pin", httpCompatible(ctx, pinPost), ctx)
+	ProtectedDelete("/v1/posts/:post_id/pin", httpCompatible(ctx, unpinPost), ctx)
+	ProtectedPut("/v1/users/:user_id/pins", httpCompatible(ctx, reorderPins), ctx)
+
+	// polls
+	Get("/v1/posts/:post_id/poll", getPostPoll)
+	ProtectedPost("/v1/posts/:post_id/poll/votes", httpCompatible(ctx, voteOnPoll), ctx)
 
 	// likes
 	ProtectedPost("/v1/posts/:post_id/likes", httpCompatible(ctx, likePost), ctx)
@@ -87,6 +117,99 @@ func InitializeRouter(ctx *appcontext.Context) {
 	Get("/v1/posts/:post_id/likes/count", countLikesFromPost)
 	Get("/v1/users/:user_id/liked/:post_id", hasUserLiked)
 
+	// reactions
+	ProtectedPost("/v1/posts/:post_id/reactions", httpCompatible(ctx, reactToPost), ctx)
+	ProtectedDelete("/v1/posts/:post_id/reactions", httpCompatible(ctx, removeReaction), ctx)
+	Get("/v1/posts/:post_id/reactions", listReactionsOnPost)
+
+	// bookmarks
+	ProtectedPost("/v1/posts/:post_id/bookmark", httpCompatible(ctx, bookmarkPost), ctx)
+	ProtectedDelete("/v1/posts/:post_id/bookmark", httpCompatible(ctx, removeBookmark), ctx)
+	ProtectedGet("/v1/users/:user_id/bookmarks", httpCompatible(ctx, listBookmarks), ctx)
+	ProtectedGet("/v1/users/:user_id/bookmark-collections", httpCompatible(ctx, listBookmarkCollections), ctx)
+	ProtectedDelete("/v1/users/:user_id/bookmark-collections/:collection_id", httpCompatible(ctx, deleteBookmarkCollection), ctx)
+
+	// follow suggestions
+	ProtectedGet("/v1/users/:user_id/suggestions", httpCompatible(ctx, listSuggestions), ctx)
+	ProtectedDelete("/v1/users/:user_id/suggestions/:suggested_id", httpCompatible(ctx, dismissSuggestion), ctx)
+
 	// feed
 	ProtectedGet("/v1/feed", getFeed, ctx)
+
+	// lists
+	ProtectedPost("/v1/lists", createList, ctx)
+	Get("/v1/lists/:list_id", getList)
+	ProtectedPatch("/v1/lists/:list_id", httpCompatible(ctx, updateList), ctx)
+	ProtectedDelete("/v1/lists/:list_id", httpCompatible(ctx, deleteList), ctx)
+	Get("/v1/lists/:list_id/members", listListMembers)
+	ProtectedPost("/v1/lists/:list_id/members", httpCompatible(ctx, addListMember), ctx)
+	ProtectedDelete("/v1/lists/:list_id/members/:user_id", httpCompatible(ctx, removeListMember), ctx)
+	Get("/v1/lists/:list_id/timeline", getListTimeline)
+	ProtectedPut("/v1/lists/:list_id/subscription", httpCompatible(ctx, subscribeToList), ctx)
+	ProtectedDelete("/v1/lists/:list_id/subscription", httpCompatible(ctx, unsubscribeFromList), ctx)
+	Get("/v1/users/:user_id/lists", listUserLists)
+	ProtectedGet("/v1/users/:user_id/list-subscriptions", httpCompatible(ctx, listListSubscriptions), ctx)
+
+	// search
+	Get("/v1/search", searchAll)
+	Get("/v1/search/posts", searchPosts)
+
+	// explore
+	Get("/v1/explore", getExplore)
+
+	// notifications
+	ProtectedGet("/v1/notifications", listNotifications, ctx)
+	ProtectedPatch("/v1/notifications/:id", httpCompatible(ctx, patchNotification), ctx)
+	ProtectedPost("/v1/notifications/read-all", markAllNotificationsRead, ctx)
+	ProtectedGet("/v1/notifications/preferences", getNotificationPreferences, ctx)
+	ProtectedPut("/v1/notifications/preferences", updateNotificationPreferences, ctx)
+
+	// web push
+	ProtectedGet("/v1/push/vapid-key", getVAPIDKey, ctx)
+	ProtectedGet("/v1/push/subscriptions", listPushSubscriptions, ctx)
+	ProtectedPost("/v1/push/subscriptions", createPushSubscription, ctx)
+	ProtectedDelete("/v1/push/subscriptions/:id", httpCompatible(ctx, deletePushSubscription), ctx)
+
+	// email digests
+	ProtectedGet("/v1/digest/settings", getDigestSettings, ctx)
+	ProtectedPut("/v1/digest/settings", updateDigestSettings, ctx)
+	Get("/v1/digest/unsubscribe", unsubscribeDigest)
+	Post("/v1/digest/unsubscribe", unsubscribeDigest)
+
+	// conversations
+	ProtectedGet("/v1/conversations", listConversations, ctx)
+	ProtectedPost("/v1/conversations", startConversation, ctx)
+	ProtectedGet("/v1/conversations/:conversation_id/messages", httpCompatible(ctx, listMessages), ctx)
+	ProtectedPost("/v1/conversations/:conversation_id/messages", httpCompatible(ctx, sendMessage), ctx)
+	ProtectedPost("/v1/conversations/:conversation_id/read", httpCompatible(ctx, markConversationRead), ctx)
+	ProtectedDelete("/v1/conversations/:conversation_id/messages/:message_id", httpCompatible(ctx, deleteMessage), ctx)
+	ProtectedPatch("/v1/conversations/:conversation_id", httpCompatible(ctx, updateConversation), ctx)
+	ProtectedGet("/v1/conversations/:conversation_id/members", httpCompatible(ctx, listConversationMembers), ctx)
+	ProtectedPost("/v1/conversations/:conversation_id/members", httpCompatible(ctx, addConversationMembers), ctx)
+	ProtectedPut("/v1/conversations/:conversation_id/members/:user_id", httpCompatible(ctx, setConversationMemberRole), ctx)
+	ProtectedDelete("/v1/conversations/:conversation_id/members/:user_id", httpCompatible(ctx, removeConversationMember), ctx)
+
+	// real-time events
+	ProtectedGet("/v1/stream", streamEvents, ctx)
+	ProtectedGet("/v1/stream/ws", streamEventsWS, ctx)
+
+	// webhooks
+	ProtectedGet("/v1/webhooks", listWebhooks, ctx)
+	ProtectedPost("/v1/webhooks", createWebhook, ctx)
+	ProtectedGet("/v1/webhooks/:webhook_id", httpCompatible(ctx, getWebhook), ctx)
+	ProtectedPatch("/v1/webhooks/:webhook_id", httpCompatible(ctx, updateWebhook), ctx)
+	ProtectedDelete("/v1/webhooks/:webhook_id", httpCompatible(ctx, deleteWebhook), ctx)
+	ProtectedGet("/v1/webhooks/:webhook_id/deliveries", httpCompatible(ctx, listWebhookDeliveries), ctx)
+	ProtectedGet("/v1/webhooks/:webhook_id/deliveries/:delivery_id", httpCompatible(ctx, getWebhookDelivery), ctx)
+	ProtectedPost("/v1/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", httpCompatible(ctx, redeliverWebhook), ctx)
+
+	// admin
+	ProtectedGet("/v1/admin/jobs", listJobs, ctx)
+	ProtectedGet("/v1/admin/jobs/:job_id", httpCompatible(ctx, getJob), ctx)
+	ProtectedPost("/v1/admin/jobs/:job_id/retry", httpCompatible(ctx, retryJob), ctx)
+
+	// mutes
+	ProtectedGet("/v1/mutes", listMutes, ctx)
+	ProtectedPost("/v1/mutes", muteUser, ctx)
+	ProtectedDelete("/v1/mutes/:user_id", httpCompatible(ctx, unmuteUser), ctx)
 }
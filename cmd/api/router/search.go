@@ -0,0 +1,170 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/helpers"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// searchPosts handles full-text search over post content.
+// Supports "quoted phrases", prefix* terms, and author/since/until filters.
+func searchPosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+	query := r.URL.Query()
+
+	searchQuery := query.Get("q")
+	if searchQuery == "" {
+		res.BadRequestResponse(w, r, errors.New("must provide search query parameter"))
+		return
+	}
+
+	since, err := parseSearchDate(query.Get("since"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	until, err := parseSearchDate(query.Get("until"))
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	filters := data.PostSearchFilters{
+		Query:  searchQuery,
+		Author: query.Get("author"),
+		Since:  since,
+		Until:  until,
+	}
+
+	posts, info, err := app.Models.Search.SearchPosts(filters, viewer.ID, pagination)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEmptySearchQuery):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if posts == nil {
+		posts = []data.PostSearchResult{}
+	}
+
+	err = decorateSearchResults(posts, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse := envelope{
+		"posts": posts,
+		"meta":  paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// searchAll returns the top matching users, posts and hashtags for a query
+// in a single response.
+func searchAll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	viewer := app.Context.GetUser(r)
+	query := r.URL.Query()
+
+	searchQuery := query.Get("q")
+	if searchQuery == "" {
+		res.BadRequestResponse(w, r, errors.New("must provide search query parameter"))
+		return
+	}
+
+	limit := helpers.ParseIntOrDefault(query.Get("limit"), 5)
+
+	pagination := data.Pagination{
+		PageSize: limit,
+	}
+
+	users, _, err := app.Models.Users.SearchUsers(searchQuery, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if users == nil {
+		users = []data.UserPublic{}
+	}
+
+	posts, _, err := app.Models.Search.SearchPosts(data.PostSearchFilters{Query: searchQuery}, viewer.ID, pagination)
+	if err != nil && !errors.Is(err, data.ErrEmptySearchQuery) {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if posts == nil {
+		posts = []data.PostSearchResult{}
+	}
+
+	err = decorateSearchResults(posts, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	hashtags, err := app.Models.Search.SearchHashtags(searchQuery, viewer.ID, limit)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if hashtags == nil {
+		hashtags = []data.Hashtag{}
+	}
+
+	jsonResponse := envelope{
+		"users":    users,
+		"posts":    posts,
+		"hashtags": hashtags,
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// parseSearchDate parses a date filter given either as YYYY-MM-DD or RFC 3339.
+// An empty value means no filter and returns nil.
+func parseSearchDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+}
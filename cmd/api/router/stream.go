@@ -0,0 +1,224 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/realtime"
+	"github.com/gorilla/websocket"
+)
+
+// streamWriteTimeout bounds each write to a stream connection. It replaces
+// the server wide write timeout, which would cut long-lived streams short.
+const streamWriteTimeout = 10 * time.Second
+
+// Authentication is done with a bearer token rather than cookies, so
+// cross-origin connections can't act on a user's behalf.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// subscribeUser subscribes to every event userID should receive: their
+// personal events and the posts of the authors in their home feed. Follows
+// and friendships made after subscribing are picked up on reconnect.
+func subscribeUser(userID int64) (*realtime.Subscription, error) {
+	app := app.Get()
+
+	if app.Hub == nil {
+		return nil, errors.New("real-time events are not set up")
+	}
+
+	authors, friends, err := app.Models.Timelines.Sources(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authors read their own friends-only posts too.
+	topics := []string{realtime.UserTopic(userID), realtime.FriendsTopic(userID)}
+	for _, id := range authors {
+		topics = append(topics, realtime.AuthorTopic(id))
+	}
+	for _, id := range friends {
+		topics = append(topics, realtime.FriendsTopic(id))
+	}
+
+	return app.Hub.Subscribe(topics...), nil
+}
+
+// publishFeedPost notifies the users whose home feed post lands in. Posts
+// restricted to mentioned users aren't streamed, while close-friends posts go
+// to each close friend of the author, and the author, directly.
+func publishFeedPost(post *data.Post) error {
+	app := app.Get()
+
+	var topic string
+	switch post.Visibility {
+	case data.VisibilityPublic, data.VisibilityFollowers:
+		topic = realtime.AuthorTopic(post.UserID)
+	case data.VisibilityFriends:
+		topic = realtime.FriendsTopic(post.UserID)
+	case data.VisibilityCloseFriends:
+		ids, err := app.Models.CloseFriends.IDs(post.UserID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range append(ids, post.UserID) {
+			app.Publish(realtime.UserTopic(id), realtime.EventFeedPost, envelope{"post": post.ToPublic()})
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	app.Publish(topic, realtime.EventFeedPost, envelope{"post": post.ToPublic()})
+	return nil
+}
+
+// streamEvents streams the authenticated user's events as Server-Sent Events.
+// Idle connections receive a comment every Stream.Heartbeat. If the client
+// falls too far behind, an error event is sent and the stream is closed.
+func streamEvents(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	sub, err := subscribeUser(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	send := func(format string, args ...any) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := send(": connected\n\n"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.Config.Stream.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-sub.Done():
+			message, _ := json.Marshal(envelope{"error": sub.Err().Error()})
+			send("event: error\ndata: %s\n\n", message)
+			return
+
+		case e := <-sub.Events():
+			payload, err := json.Marshal(e)
+			if err != nil {
+				app.Logger.Error("failed to encode event", "type", e.Type, "error", err.Error())
+				continue
+			}
+
+			if err := send("event: %s\ndata: %s\n\n", e.Type, payload); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if err := send(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamEventsWS streams the same events as streamEvents over a WebSocket,
+// one JSON message per event. The connection is pinged every
+// Stream.Heartbeat, and closed if the client misses a pong.
+func streamEventsWS(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	sub, err := subscribeUser(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	// The upgrader writes its own error response.
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	heartbeat := app.Config.Stream.Heartbeat
+
+	// The client isn't expected to send anything, but reading is required
+	// to process pongs and notice when the connection is closed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(heartbeat)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+
+		case <-sub.Done():
+			message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, sub.Err().Error())
+			conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(streamWriteTimeout))
+			return
+
+		case e := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
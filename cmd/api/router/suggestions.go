@@ -0,0 +1,119 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listSuggestions returns the users suggested for the authenticated user to
+// follow, best first. Suggestions are private, so only
+// /v1/users/me/suggestions (or the user's own id) is served. They are
+// precomputed in the background, except for users who never had any, whose
+// suggestions are computed on the spot.
+func listSuggestions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	computedAt, err := app.Models.Suggestions.ComputedAt(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if computedAt == nil {
+		err = app.Models.Suggestions.Refresh(user.ID, app.Config.Suggestions.Options)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		computedAt, err = app.Models.Suggestions.ComputedAt(user.ID)
+		if err != nil {
+			res.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	suggestions, info, err := app.Models.Suggestions.List(user.ID, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if suggestions == nil {
+		suggestions = []data.Suggestion{}
+	}
+
+	meta := paginationMeta(pagination, info)
+	meta["computed_at"] = computedAt
+
+	jsonResponse := envelope{
+		"suggestions": suggestions,
+		"meta":        meta,
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// dismissSuggestion stops suggesting a user to the authenticated user.
+func dismissSuggestion(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+	if !isSelf(ps, user) {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	suggestedID, err := strconv.ParseInt(ps.ByName("suggested_id"), 10, 64)
+	if err != nil || suggestedID < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.Models.Users.Exists(suggestedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUserNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Suggestions.Dismiss(user.ID, suggestedID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSuggestSelf):
+			res.BadRequestResponse(w, r, err)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
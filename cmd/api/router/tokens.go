@@ -78,6 +78,10 @@ func authenticateToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.Background("record login", func() error {
+		return app.Models.Users.RecordLogin(user.ID)
+	})
+
 	jsonResponse := envelope{
 		"access_token": string(jwtBytes),
 		"user":         user,
@@ -6,7 +6,6 @@ import (
 	"strconv"
 
 	"github.com/bryryann/mantel/backend/cmd/api/app"
-	"github.com/bryryann/mantel/backend/cmd/api/helpers"
 	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
 	"github.com/bryryann/mantel/backend/cmd/api/responses"
 	"github.com/bryryann/mantel/backend/internal/data"
@@ -30,28 +29,38 @@ func getUserByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
-	followData, err := app.Models.Follows.GetFollowData(int64(id))
+	userData, err := app.Models.Counters.Get(int64(id))
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	friendsCount, err := app.Models.Friendships.CountFriends(int64(id))
+	viewer := app.Context.GetUser(r)
+
+	pinned, err := app.Models.Pins.ListPinned(int64(id), viewer.ID)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	userData := data.UserData{
-		FollowData: followData,
-		Friends:    friendsCount,
+	if pinned == nil {
+		pinned = []data.PostPublic{}
+	}
+
+	err = decoratePosts(pinned, viewer.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
 	}
 
-	env := envelope{"user": &data.UserPublic{
-		ID:       user.ID,
-		Username: user.Username,
-		UserData: userData,
-	}}
+	env := envelope{
+		"user": &data.UserPublic{
+			ID:       user.ID,
+			Username: user.Username,
+			UserData: userData,
+		},
+		"pinned_posts": pinned,
+	}
 
 	jsonhttp.WriteJSON(w, http.StatusAccepted, env, nil)
 }
@@ -63,20 +72,19 @@ func searchUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	query := r.URL.Query()
 
 	searchQuery := query.Get("q")
-	page := helpers.ParseIntOrDefault(query.Get("page"), 1)
-	pageSize := helpers.ParseIntOrDefault(query.Get("page_size"), 20)
 
 	if searchQuery == "" {
 		res.BadRequestResponse(w, r, errors.New("must provide search query parameter"))
 		return
 	}
 
-	paginationData := data.Pagination{
-		Page:     page,
-		PageSize: pageSize,
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
 	}
 
-	users, err := app.Models.Users.SearchUsers(searchQuery, paginationData)
+	users, info, err := app.Models.Users.SearchUsers(searchQuery, pagination)
 	if err != nil {
 		res.ServerErrorResponse(w, r, err)
 		return
@@ -87,28 +95,18 @@ func searchUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 
 	for idx := range users {
-		followData, err := app.Models.Follows.GetFollowData(users[idx].ID)
+		userData, err := app.Models.Counters.Get(users[idx].ID)
 		if err != nil {
 			res.ServerErrorResponse(w, r, err)
 			return
 		}
 
-		friendsCount, err := app.Models.Friendships.CountFriends(users[idx].ID)
-		if err != nil {
-			res.ServerErrorResponse(w, r, err)
-			return
-		}
-
-		users[idx].UserData.FollowData = followData
-		users[idx].UserData.Friends = friendsCount
+		users[idx].UserData = userData
 	}
 
 	jsonResponse := envelope{
 		"users": users,
-		"meta": map[string]any{
-			"page":      page,
-			"page_size": pageSize,
-		},
+		"meta":  paginationMeta(pagination, info),
 	}
 
 	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
@@ -234,3 +232,10 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		res.ServerErrorResponse(w, r, err)
 	}
 }
+
+// isSelf reports whether the :user_id parameter refers to the authenticated
+// user, either through the "me" alias or their numeric id.
+func isSelf(ps httprouter.Params, user *data.User) bool {
+	param := ps.ByName("user_id")
+	return param == "me" || param == strconv.FormatInt(user.ID, 10)
+}
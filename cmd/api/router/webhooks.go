@@ -0,0 +1,349 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bryryann/mantel/backend/cmd/api/app"
+	"github.com/bryryann/mantel/backend/cmd/api/jsonhttp"
+	"github.com/bryryann/mantel/backend/cmd/api/responses"
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// readWebhook returns the authenticated user's webhook named by the
+// :webhook_id parameter. It writes the error response and returns nil if
+// they have no such webhook.
+func readWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) *data.Webhook {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("webhook_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return nil
+	}
+
+	webhook, err := app.Models.Webhooks.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return webhook
+}
+
+// createWebhook registers an endpoint to receive some events concerning the
+// authenticated user. The response holds the secret deliveries are signed
+// with, which isn't shown again.
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	var input struct {
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		UserID:      user.ID,
+		URL:         input.URL,
+		Secret:      data.NewWebhookSecret(),
+		Events:      input.Events,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Webhooks.Insert(webhook, app.Config.Webhooks.MaxPerUser)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrWebhookLimit):
+			res.ConflictResponse(w, r, fmt.Errorf("%w: at most %d webhooks per user", err, app.Config.Webhooks.MaxPerUser))
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	err = jsonhttp.WriteJSON(w, http.StatusCreated, envelope{"webhook": webhook}, headers)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// listWebhooks returns the authenticated user's webhooks.
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	webhooks, err := app.Models.Webhooks.ForUser(user.ID)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []data.Webhook{}
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getWebhook returns one of the authenticated user's webhooks.
+func getWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	res := responses.Get()
+
+	webhook := readWebhook(w, r, ps)
+	if webhook == nil {
+		return
+	}
+
+	err := jsonhttp.WriteJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhook edits the URL, events or description of one of the
+// authenticated user's webhooks, or turns it on and off. Turning a webhook
+// disabled for failing back on resumes its pending deliveries.
+func updateWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	webhook := readWebhook(w, r, ps)
+	if webhook == nil {
+		return
+	}
+
+	var input struct {
+		URL         *string  `json:"url"`
+		Events      []string `json:"events"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+
+	err := jsonhttp.ReadJSON(w, r, &input)
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Description != nil {
+		webhook.Description = *input.Description
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		res.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Webhooks.Update(webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if webhook.Active && app.Webhooks != nil {
+		app.Webhooks.Notify()
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhook deletes one of the authenticated user's webhooks, dropping
+// its pending deliveries.
+func deleteWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	user := app.Context.GetUser(r)
+
+	id, err := strconv.ParseInt(ps.ByName("webhook_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.Models.Webhooks.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries returns the deliveries queued for one of the
+// authenticated user's webhooks, newest first. ?status= keeps only pending,
+// delivered or failed ones.
+func listWebhookDeliveries(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	webhook := readWebhook(w, r, ps)
+	if webhook == nil {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !validator.In(status, data.DeliveryPending, data.DeliveryDelivered, data.DeliveryFailed) {
+		res.FailedValidationResponse(w, r, map[string]string{"status": "must be one of pending, delivered or failed"})
+		return
+	}
+
+	pagination, err := readPagination(w, r, "")
+	if err != nil {
+		res.BadRequestResponse(w, r, err)
+		return
+	}
+
+	deliveries, info, err := app.Models.Webhooks.Deliveries(webhook.ID, status, pagination)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []data.WebhookDelivery{}
+	}
+
+	jsonResponse := envelope{
+		"deliveries": deliveries,
+		"meta":       paginationMeta(pagination, info),
+	}
+	err = jsonhttp.WriteJSON(w, http.StatusOK, jsonResponse, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// getWebhookDelivery returns a delivery of one of the authenticated user's
+// webhooks, with the log of its attempts.
+func getWebhookDelivery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	webhook := readWebhook(w, r, ps)
+	if webhook == nil {
+		return
+	}
+
+	id, err := strconv.ParseInt(ps.ByName("delivery_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.Models.Webhooks.Delivery(webhook.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonhttp.WriteJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhook queues a delivery again, as a new delivery with the same
+// event and payload.
+func redeliverWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	app := app.Get()
+	res := responses.Get()
+
+	webhook := readWebhook(w, r, ps)
+	if webhook == nil {
+		return
+	}
+
+	id, err := strconv.ParseInt(ps.ByName("delivery_id"), 10, 64)
+	if err != nil || id < 1 {
+		res.NotFoundResponse(w, r)
+		return
+	}
+
+	delivery, err := app.Models.Webhooks.Redeliver(webhook.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			res.NotFoundResponse(w, r)
+		default:
+			res.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if webhook.Active && app.Webhooks != nil {
+		app.Webhooks.Notify()
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d/deliveries/%d", webhook.ID, delivery.ID))
+
+	err = jsonhttp.WriteJSON(w, http.StatusAccepted, envelope{"delivery": delivery}, headers)
+	if err != nil {
+		res.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,244 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("bookmark collection not found")
+)
+
+// Bookmark is a post privately saved by a user, optionally filed into a
+// named collection.
+type Bookmark struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	PostID     int64      `json:"post_id"`
+	Collection *string    `json:"collection"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Post       PostPublic `json:"post"`
+}
+
+type BookmarkCollection struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	BookmarksCount int       `json:"bookmarks_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type BookmarkModel struct {
+	DB *sql.DB
+}
+
+// Add bookmarks postID for userID. If collection is not empty, the bookmark
+// is filed into the collection with that name, creating it if needed.
+// Bookmarking an already bookmarked post moves it to the given collection.
+func (m BookmarkModel) Add(userID, postID int64, collection string) (*Bookmark, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var collectionID *int64
+	if collection != "" {
+		var id int64
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO bookmark_collections (user_id, name)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+			RETURNING id`,
+			userID, collection,
+		).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		collectionID = &id
+	}
+
+	query := `
+		INSERT INTO bookmarks (user_id, post_id, collection_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+		RETURNING id, created_at`
+
+	bookmark := Bookmark{
+		UserID: userID,
+		PostID: postID,
+	}
+	if collection != "" {
+		bookmark.Collection = &collection
+	}
+
+	err = tx.QueryRowContext(ctx, query, userID, postID, collectionID).Scan(&bookmark.ID, &bookmark.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &bookmark, nil
+}
+
+// Remove deletes userID's bookmark of postID. Returns sql.ErrNoRows if the
+// post was not bookmarked.
+func (m BookmarkModel) Remove(userID, postID int64) error {
+	query := `
+		DELETE FROM bookmarks
+		WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// List returns userID's bookmarks, newest first. If collection is not empty,
+// only bookmarks in that collection are returned.
+//
+// Posts are checked against their current visibility and blocks on every
+// read, so bookmarks of posts the user can no longer see are left out.
+func (m BookmarkModel) List(userID int64, collection string, pagination Pagination) ([]Bookmark, PageInfo, error) {
+	args := []any{userID, collection}
+	where, orderBy, limit, args := pagination.clauses("b.created_at", "b.id", true, "b.created_at DESC, b.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT b.id, b.post_id, c.name, b.created_at,
+			p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		LEFT JOIN bookmark_collections c ON c.id = b.collection_id
+		WHERE b.user_id = $1
+			AND ($2 = '' OR c.name = $2)
+			AND %s
+			AND %s
+		ORDER BY %s
+		%s`, visibleTo("p", "$1"), where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		bookmarks []Bookmark
+		keys      []Cursor
+	)
+	for rows.Next() {
+		var b Bookmark
+
+		err := rows.Scan(
+			&b.ID, &b.PostID, &b.Collection, &b.CreatedAt,
+			&b.Post.ID, &b.Post.UserID, &b.Post.Content, &b.Post.Visibility, &b.Post.ReplyToID, &b.Post.CreatedAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		b.UserID = userID
+		bookmarks = append(bookmarks, b)
+		keys = append(keys, Cursor{CreatedAt: b.CreatedAt, ID: b.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	bookmarks, info := paginate(bookmarks, keys, pagination)
+	return bookmarks, info, nil
+}
+
+// Collections lists userID's bookmark collections by name.
+func (m BookmarkModel) Collections(userID int64) ([]BookmarkCollection, error) {
+	query := `
+		SELECT c.id, c.name, COUNT(b.id), c.created_at
+		FROM bookmark_collections c
+		LEFT JOIN bookmarks b ON b.collection_id = c.id
+		WHERE c.user_id = $1
+		GROUP BY c.id
+		ORDER BY c.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []BookmarkCollection
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.Name, &c.BookmarksCount, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// DeleteCollection removes one of userID's collections. Bookmarks filed in
+// it are kept, without a collection.
+func (m BookmarkModel) DeleteCollection(userID, collectionID int64) error {
+	query := `
+		DELETE FROM bookmark_collections
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, collectionID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+func ValidateBookmarkCollection(v *validator.Validator, name string) {
+	v.Check(len(name) <= 100, "collection", "must be no more than 100 bytes long")
+}
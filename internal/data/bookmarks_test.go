@@ -0,0 +1,185 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBookmarkCollection(t *testing.T) {
+	v := validator.New()
+	ValidateBookmarkCollection(v, string(make([]byte, 100)))
+	assert.True(t, v.Valid())
+
+	v = validator.New()
+	ValidateBookmarkCollection(v, string(make([]byte, 101)))
+	assert.Contains(t, v.Errors, "collection")
+}
+
+// bookmarkedPosts returns the ids of the posts listed by BookmarkModel.List.
+func bookmarkedPosts(t *testing.T, bookmarks BookmarkModel, userID int64, collection string) []int64 {
+	t.Helper()
+
+	list, _, err := bookmarks.List(userID, collection, Pagination{PageSize: 20})
+	require.NoError(t, err)
+
+	ids := []int64{}
+	for _, b := range list {
+		ids = append(ids, b.PostID)
+	}
+	return ids
+}
+
+func TestBookmarkCollectionsIntegration(t *testing.T) {
+	db := openTestDB(t)
+	bookmarks := BookmarkModel{DB: db}
+
+	author := createUser(t, db, "author")
+	user := createUser(t, db, "user")
+	other := createUser(t, db, "other")
+
+	first := createPost(t, db, author, VisibilityPublic)
+	second := createPost(t, db, author, VisibilityPublic)
+	third := createPost(t, db, author, VisibilityPublic)
+
+	b, err := bookmarks.Add(user, first.ID, "")
+	require.NoError(t, err)
+	assert.Nil(t, b.Collection)
+
+	b, err = bookmarks.Add(user, second.ID, "Recipes")
+	require.NoError(t, err)
+	require.NotNil(t, b.Collection)
+	assert.Equal(t, "Recipes", *b.Collection)
+
+	_, err = bookmarks.Add(user, third.ID, "Recipes")
+	require.NoError(t, err)
+
+	// Collections belong to their user.
+	_, err = bookmarks.Add(other, first.ID, "Recipes")
+	require.NoError(t, err)
+
+	collections, err := bookmarks.Collections(user)
+	require.NoError(t, err)
+	require.Len(t, collections, 1)
+	assert.Equal(t, "Recipes", collections[0].Name)
+	assert.Equal(t, 2, collections[0].BookmarksCount)
+
+	assert.Equal(t, []int64{third.ID, second.ID, first.ID}, bookmarkedPosts(t, bookmarks, user, ""))
+	assert.Equal(t, []int64{third.ID, second.ID}, bookmarkedPosts(t, bookmarks, user, "Recipes"))
+	assert.Empty(t, bookmarkedPosts(t, bookmarks, user, "Unknown"))
+
+	// Bookmarking again moves the bookmark to the given collection.
+	_, err = bookmarks.Add(user, second.ID, "Later")
+	require.NoError(t, err)
+
+	collections, err = bookmarks.Collections(user)
+	require.NoError(t, err)
+	require.Len(t, collections, 2)
+	assert.Equal(t, "Later", collections[0].Name)
+	assert.Equal(t, 1, collections[0].BookmarksCount)
+	assert.Equal(t, "Recipes", collections[1].Name)
+	assert.Equal(t, 1, collections[1].BookmarksCount)
+
+	// Deleting a collection keeps its bookmarks, and only works for its user.
+	recipes := collections[1].ID
+	assert.ErrorIs(t, bookmarks.DeleteCollection(other, recipes), ErrCollectionNotFound)
+	require.NoError(t, bookmarks.DeleteCollection(user, recipes))
+	assert.ErrorIs(t, bookmarks.DeleteCollection(user, recipes), ErrCollectionNotFound)
+
+	assert.Equal(t, []int64{third.ID, second.ID, first.ID}, bookmarkedPosts(t, bookmarks, user, ""))
+	assert.Empty(t, bookmarkedPosts(t, bookmarks, user, "Recipes"))
+
+	require.NoError(t, bookmarks.Remove(user, first.ID))
+	assert.ErrorIs(t, bookmarks.Remove(user, first.ID), sql.ErrNoRows)
+	assert.Equal(t, []int64{third.ID, second.ID}, bookmarkedPosts(t, bookmarks, user, ""))
+	assert.Equal(t, []int64{first.ID}, bookmarkedPosts(t, bookmarks, other, ""))
+}
+
+func TestBookmarkPaginationIntegration(t *testing.T) {
+	db := openTestDB(t)
+	bookmarks := BookmarkModel{DB: db}
+
+	author := createUser(t, db, "author")
+	user := createUser(t, db, "user")
+
+	var posts []int64
+	for range 5 {
+		post := createPost(t, db, author, VisibilityPublic)
+		_, err := bookmarks.Add(user, post.ID, "")
+		require.NoError(t, err)
+		posts = append([]int64{post.ID}, posts...)
+	}
+
+	var (
+		seen       []int64
+		pagination = Pagination{PageSize: 2}
+	)
+	for {
+		page, info, err := bookmarks.List(user, "", pagination)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 2)
+
+		for _, b := range page {
+			seen = append(seen, b.PostID)
+		}
+
+		if info.Next == nil {
+			break
+		}
+		pagination.Cursor = info.Next
+	}
+
+	assert.Equal(t, posts, seen)
+}
+
+func TestBookmarkVisibilityIntegration(t *testing.T) {
+	db := openTestDB(t)
+	bookmarks := BookmarkModel{DB: db}
+	posts := PostModel{DB: db}
+
+	author := createUser(t, db, "author")
+	blocker := createUser(t, db, "blocker")
+	user := createUser(t, db, "user")
+
+	public := createPost(t, db, author, VisibilityPublic)
+	followers := createPost(t, db, author, VisibilityFollowers)
+	friends := createPost(t, db, author, VisibilityFriends)
+	blocked := createPost(t, db, blocker, VisibilityPublic)
+	deleted := createPost(t, db, author, VisibilityPublic)
+
+	follow(t, db, user, author)
+
+	for _, post := range []*Post{public, followers, friends, blocked, deleted} {
+		_, err := bookmarks.Add(user, post.ID, "Saved")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t,
+		[]int64{deleted.ID, blocked.ID, followers.ID, public.ID},
+		bookmarkedPosts(t, bookmarks, user, ""),
+	)
+
+	// Deleted posts, blocks and visibility changes hide bookmarks when read.
+	require.NoError(t, posts.Delete(deleted.ID))
+	befriend(t, db, blocker, user, "blocked")
+
+	_, err := db.Exec(`UPDATE posts SET visibility = 'friends' WHERE id = $1`, public.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{followers.ID}, bookmarkedPosts(t, bookmarks, user, ""))
+	assert.Equal(t, []int64{followers.ID}, bookmarkedPosts(t, bookmarks, user, "Saved"))
+
+	// So does unfollowing, while becoming friends reveals them.
+	_, err = db.Exec(`DELETE FROM follows WHERE follower_id = $1`, user)
+	require.NoError(t, err)
+	assert.Empty(t, bookmarkedPosts(t, bookmarks, user, ""))
+
+	befriend(t, db, author, user, "accepted")
+	assert.Equal(t,
+		[]int64{friends.ID, followers.ID, public.ID},
+		bookmarkedPosts(t, bookmarks, user, ""),
+	)
+}
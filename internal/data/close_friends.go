@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotFriends = errors.New("only accepted friends can be close friends")
+)
+
+// CloseFriendModel stores the friends each user picked to read their
+// close-friends posts. Entries are removed when the friendship ends.
+type CloseFriendModel struct {
+	DB *sql.DB
+}
+
+// Add marks friendID as a close friend of userID. Fails with ErrNotFriends
+// unless they are accepted friends. Adding a close friend twice is a no-op.
+func (m CloseFriendModel) Add(userID, friendID int64) error {
+	// Locking the friendship keeps it from ending before the close friend is
+	// added, which would leave a stale entry behind.
+	query := `
+		WITH friend AS (
+			SELECT 1
+			FROM friendships
+			WHERE status = 'accepted'
+				AND LEAST(sender_id, receiver_id) = LEAST($1::int, $2::int)
+				AND GREATEST(sender_id, receiver_id) = GREATEST($1::int, $2::int)
+			FOR SHARE
+		), added AS (
+			INSERT INTO close_friends (user_id, friend_id)
+			SELECT $1, $2
+			WHERE EXISTS (SELECT 1 FROM friend)
+			ON CONFLICT (user_id, friend_id) DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM friend)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var friends bool
+	err := m.DB.QueryRowContext(ctx, query, userID, friendID).Scan(&friends)
+	if err != nil {
+		return err
+	}
+
+	if !friends {
+		return ErrNotFriends
+	}
+
+	return nil
+}
+
+// Remove unmarks friendID as a close friend of userID. Returns
+// ErrRecordNotFound if they weren't one.
+func (m CloseFriendModel) Remove(userID, friendID int64) error {
+	query := `
+		DELETE FROM close_friends
+		WHERE user_id = $1 AND friend_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, friendID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// List returns the close friends of userID, most recently added first.
+func (m CloseFriendModel) List(userID int64, pagination Pagination) ([]UserPublic, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("cf.created_at", "cf.id", true, "cf.created_at DESC, cf.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, cf.created_at, cf.id
+		FROM close_friends cf
+		JOIN users u ON u.id = cf.friend_id
+		WHERE cf.user_id = $1 AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		users []UserPublic
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var (
+			u   UserPublic
+			key Cursor
+		)
+		if err := rows.Scan(&u.ID, &u.Username, &key.CreatedAt, &key.ID); err != nil {
+			return nil, PageInfo{}, err
+		}
+		users = append(users, u)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	users, info := paginate(users, keys, pagination)
+	return users, info, nil
+}
+
+// IDs returns the ids of every close friend of userID.
+func (m CloseFriendModel) IDs(userID int64) ([]int64, error) {
+	query := `SELECT friend_id FROM close_friends WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
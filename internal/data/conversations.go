@@ -0,0 +1,364 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrConversationWithSelf = errors.New("cannot start a conversation with yourself")
+)
+
+// MessagingPolicy decides which users may start and keep a one-to-one
+// conversation with each other. Users involved in a block never can.
+type MessagingPolicy string
+
+const (
+	MessagingFriends          MessagingPolicy = "friends"            // Accepted friends only.
+	MessagingMutuals          MessagingPolicy = "mutuals"            // Users following each other only.
+	MessagingFriendsOrMutuals MessagingPolicy = "friends_or_mutuals" // Accepted friends or users following each other.
+	MessagingEveryone         MessagingPolicy = "everyone"           // Any two users.
+)
+
+func (p MessagingPolicy) IsValid() bool {
+	switch p {
+	case MessagingFriends, MessagingMutuals, MessagingFriendsOrMutuals, MessagingEveryone:
+		return true
+	default:
+		return false
+	}
+}
+
+// Allows reports whether two users may message each other, given their
+// friendship status as returned by FriendshipModel.GetFriendshipStatus and
+// whether they follow each other.
+func (p MessagingPolicy) Allows(friendshipStatus string, mutualFollow bool) bool {
+	friends := friendshipStatus == string(StatusAccepted)
+
+	switch {
+	case friendshipStatus == string(StatusBlocked):
+		return false
+	case p == MessagingFriends:
+		return friends
+	case p == MessagingMutuals:
+		return mutualFollow
+	case p == MessagingFriendsOrMutuals:
+		return friends || mutualFollow
+	default:
+		return p == MessagingEveryone
+	}
+}
+
+// Conversation is a message thread between its members, as seen by one of
+// them.
+type Conversation struct {
+	ID           int64            `json:"id"`
+	Direct       bool             `json:"direct"` // Whether this is a one-to-one conversation.
+	Title        *string          `json:"title,omitempty"`
+	ShareHistory bool             `json:"share_history"` // Whether new members see messages sent before they joined.
+	Role         ConversationRole `json:"role"`          // The viewer's role.
+	Members      []UserPublic     `json:"members"`       // Members other than the viewer.
+	LastMessage  *Message         `json:"last_message"`
+	UnreadCount  int              `json:"unread_count"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+type ConversationModel struct {
+	DB *sql.DB
+}
+
+// directKey identifies the one-to-one conversation between two users.
+func directKey(a, b int64) string {
+	return fmt.Sprintf("%d:%d", min(a, b), max(a, b))
+}
+
+// Direct returns the one-to-one conversation between userID and otherID,
+// creating it if they never talked before.
+func (m ConversationModel) Direct(userID, otherID int64) (*Conversation, error) {
+	if userID == otherID {
+		return nil, ErrConversationWithSelf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO conversations (direct_key)
+		VALUES ($1)
+		ON CONFLICT (direct_key) DO UPDATE SET direct_key = EXCLUDED.direct_key
+		RETURNING id`,
+		directKey(userID, otherID),
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		VALUES ($1, $2), ($1, $3)
+		ON CONFLICT (conversation_id, user_id) DO NOTHING`,
+		id, userID, otherID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return m.Get(id, userID)
+}
+
+// visibleMessage returns a SQL predicate that holds when the message aliased
+// as alias is part of the history of the member bound to $1, whose
+// conversation_members row is aliased me and conversation c. Members don't see
+// what was sent before they joined unless the conversation shares its
+// history, nor messages they deleted or sent by users they are involved in a
+// block with.
+func visibleMessage(alias string) string {
+	return fmt.Sprintf(`(%[1]s.created_at >= me.joined_at OR c.share_history)
+			AND NOT EXISTS (
+				SELECT 1 FROM message_deletions md
+				WHERE md.message_id = %[1]s.id AND md.user_id = $1
+			)
+			AND %[2]s`, alias, notBlocked(alias+".sender_id", "$1"))
+}
+
+// conversationColumns selects a conversation as seen by the member bound to
+// $1, from the conversation_members row aliased me joined with the
+// conversation aliased c. Only messages visible to the member count towards
+// the preview and the unread count.
+var conversationColumns = fmt.Sprintf(`
+	c.id, c.direct_key IS NOT NULL, c.title, c.share_history, me.role, c.created_at, c.updated_at,
+	ARRAY(
+		SELECT u.id FROM conversation_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.conversation_id = c.id AND om.user_id <> $1
+		ORDER BY om.joined_at, u.id
+	),
+	ARRAY(
+		SELECT u.username FROM conversation_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.conversation_id = c.id AND om.user_id <> $1
+		ORDER BY om.joined_at, u.id
+	),
+	(
+		SELECT COUNT(*) FROM messages um
+		WHERE um.conversation_id = c.id
+			AND um.id > me.last_read_message_id
+			AND um.sender_id <> $1
+			AND %s
+	),
+	lm.id, lm.sender_id, lm.kind, lm.body, lm.target_id, lm.created_at`, visibleMessage("um"))
+
+// lastMessageJoin joins the latest message of conversation c visible to the
+// member bound to $1, as lm.
+var lastMessageJoin = fmt.Sprintf(`
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.sender_id, m.kind, m.body, m.target_id, m.created_at
+		FROM messages m
+		WHERE m.conversation_id = c.id AND %s
+		ORDER BY m.id DESC
+		LIMIT 1
+	) lm ON TRUE`, visibleMessage("m"))
+
+func scanConversation(scan func(dest ...any) error) (Conversation, error) {
+	var (
+		c     Conversation
+		ids   []int64
+		names []string
+		last  struct {
+			ID        sql.NullInt64
+			SenderID  sql.NullInt64
+			Kind      sql.NullString
+			Body      sql.NullString
+			TargetID  *int64
+			CreatedAt sql.NullTime
+		}
+	)
+
+	err := scan(
+		&c.ID,
+		&c.Direct,
+		&c.Title,
+		&c.ShareHistory,
+		&c.Role,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		pq.Array(&ids),
+		pq.Array(&names),
+		&c.UnreadCount,
+		&last.ID,
+		&last.SenderID,
+		&last.Kind,
+		&last.Body,
+		&last.TargetID,
+		&last.CreatedAt,
+	)
+	if err != nil {
+		return Conversation{}, err
+	}
+
+	c.Members = []UserPublic{}
+	for i := range min(len(ids), len(names)) {
+		c.Members = append(c.Members, UserPublic{ID: ids[i], Username: names[i]})
+	}
+
+	if last.ID.Valid {
+		c.LastMessage = &Message{
+			ID:             last.ID.Int64,
+			ConversationID: c.ID,
+			SenderID:       last.SenderID.Int64,
+			Kind:           MessageKind(last.Kind.String),
+			Body:           last.Body.String,
+			TargetID:       last.TargetID,
+			CreatedAt:      last.CreatedAt.Time,
+		}
+	}
+
+	return c, nil
+}
+
+// Get returns conversation id as seen by userID. Returns ErrRecordNotFound if
+// userID isn't a member of it.
+func (m ConversationModel) Get(id, userID int64) (*Conversation, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM conversation_members me
+		JOIN conversations c ON c.id = me.conversation_id
+		%s
+		WHERE me.user_id = $1 AND me.conversation_id = $2`, conversationColumns, lastMessageJoin)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	c, err := scanConversation(m.DB.QueryRowContext(ctx, query, userID, id).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// List returns the conversations of userID, most recently active first.
+func (m ConversationModel) List(userID int64, pagination Pagination) ([]Conversation, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("c.updated_at", "c.id", true, "c.updated_at DESC, c.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM conversation_members me
+		JOIN conversations c ON c.id = me.conversation_id
+		%s
+		WHERE me.user_id = $1 AND %s
+		ORDER BY %s
+		%s`, conversationColumns, lastMessageJoin, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		conversations []Conversation
+		keys          []Cursor
+	)
+	for rows.Next() {
+		c, err := scanConversation(rows.Scan)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		conversations = append(conversations, c)
+		keys = append(keys, Cursor{CreatedAt: c.UpdatedAt, ID: c.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	conversations, info := paginate(conversations, keys, pagination)
+	return conversations, info, nil
+}
+
+// MemberIDs returns the ids of every member of conversation id.
+func (m ConversationModel) MemberIDs(id int64) ([]int64, error) {
+	query := `
+		SELECT user_id
+		FROM conversation_members
+		WHERE conversation_id = $1
+		ORDER BY user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// MarkRead records that userID read conversation id up to messageID, or up
+// to its latest message if messageID is 0. The read position never moves
+// backwards. Returns the resulting position, or ErrRecordNotFound if userID
+// isn't a member of the conversation.
+func (m ConversationModel) MarkRead(id, userID, messageID int64) (int64, error) {
+	query := `
+		UPDATE conversation_members me
+		SET last_read_message_id = GREATEST(me.last_read_message_id, LEAST(
+			COALESCE((SELECT MAX(m.id) FROM messages m WHERE m.conversation_id = $1), 0),
+			CASE WHEN $3 = 0 THEN 2147483647 ELSE $3 END
+		))
+		WHERE me.conversation_id = $1 AND me.user_id = $2
+		RETURNING me.last_read_message_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lastRead int64
+	err := m.DB.QueryRowContext(ctx, query, id, userID, messageID).Scan(&lastRead)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return lastRead, nil
+}
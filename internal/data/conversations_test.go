@@ -0,0 +1,36 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagingPolicyAllows(t *testing.T) {
+	tests := []struct {
+		policy       MessagingPolicy
+		status       string
+		mutualFollow bool
+		want         bool
+	}{
+		{MessagingFriends, "accepted", false, true},
+		{MessagingFriends, "pending", true, false},
+		{MessagingMutuals, "none", true, true},
+		{MessagingMutuals, "accepted", false, false},
+		{MessagingFriendsOrMutuals, "accepted", false, true},
+		{MessagingFriendsOrMutuals, "none", true, true},
+		{MessagingFriendsOrMutuals, "pending", false, false},
+		{MessagingEveryone, "none", false, true},
+		{MessagingEveryone, "blocked", true, false},
+		{MessagingFriendsOrMutuals, "blocked", true, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.policy.Allows(tt.status, tt.mutualFollow), "%s with %s, mutual follow %v", tt.policy, tt.status, tt.mutualFollow)
+	}
+}
+
+func TestDirectKey(t *testing.T) {
+	assert.Equal(t, "3:7", directKey(7, 3))
+	assert.Equal(t, directKey(3, 7), directKey(7, 3))
+}
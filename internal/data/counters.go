@@ -0,0 +1,69 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// CounterModel maintains the user_counters table, which caches the counts
+// shown on profiles.
+type CounterModel struct {
+	DB *sql.DB
+}
+
+// Refresh recounts the follows, friends and posts of userIDs. Counts are
+// recomputed rather than incremented, so refreshing more than once is
+// harmless.
+func (m CounterModel) Refresh(userIDs ...int64) error {
+	query := `
+		INSERT INTO user_counters (user_id, followers_count, following_count, friends_count, posts_count, updated_at)
+		SELECT
+			u.id,
+			(SELECT COUNT(*) FROM follows WHERE followee_id = u.id),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = u.id),
+			(SELECT COUNT(*) FROM friendships WHERE status = 'accepted' AND u.id IN (sender_id, receiver_id)),
+			(SELECT COUNT(*) FROM posts WHERE user_id = u.id),
+			NOW()
+		FROM users u
+		WHERE u.id = ANY($1)
+		ON CONFLICT (user_id) DO UPDATE
+		SET followers_count = EXCLUDED.followers_count,
+			following_count = EXCLUDED.following_count,
+			friends_count = EXCLUDED.friends_count,
+			posts_count = EXCLUDED.posts_count,
+			updated_at = EXCLUDED.updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(userIDs))
+	return err
+}
+
+// Get returns the counts of userID. Users who were never counted have none.
+func (m CounterModel) Get(userID int64) (UserData, error) {
+	query := `
+		SELECT followers_count, following_count, friends_count, posts_count
+		FROM user_counters
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var data UserData
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&data.FollowData.FollowersCount,
+		&data.FollowData.FollowingCount,
+		&data.Friends,
+		&data.Posts,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return UserData{}, err
+	}
+
+	return data, nil
+}
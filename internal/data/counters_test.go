@@ -0,0 +1,156 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsOf returns the outbox events of the given types, in order.
+func eventsOf(t *testing.T, db *sql.DB, types ...string) []outbox.Event {
+	t.Helper()
+
+	events, err := OutboxModel{DB: db}.Events(outbox.Position{}, 100)
+	require.NoError(t, err)
+
+	var matching []outbox.Event
+	for _, e := range events {
+		for _, typ := range types {
+			if e.Type == typ {
+				matching = append(matching, e)
+			}
+		}
+	}
+	return matching
+}
+
+func TestPostEventsIntegration(t *testing.T) {
+	db := openTestDB(t)
+	posts := PostModel{DB: db}
+
+	author := createUser(t, db, "author")
+	post := createPost(t, db, author, VisibilityPublic)
+
+	reply := &Post{UserID: author, Content: "reply", Visibility: VisibilityPublic, ReplyToID: &post.ID}
+	require.NoError(t, posts.Insert(reply))
+
+	require.NoError(t, posts.Delete(post.ID))
+	require.NoError(t, posts.Delete(post.ID), "deleting twice")
+
+	events := eventsOf(t, db, outbox.PostCreated, outbox.PostDeleted)
+	require.Len(t, events, 3)
+
+	want := []struct {
+		typ  string
+		post outbox.Post
+	}{
+		{outbox.PostCreated, outbox.Post{PostID: post.ID, AuthorID: author}},
+		{outbox.PostCreated, outbox.Post{PostID: reply.ID, AuthorID: author, ReplyToID: &post.ID}},
+		{outbox.PostDeleted, outbox.Post{PostID: post.ID, AuthorID: author}},
+	}
+	for i, e := range events {
+		var got outbox.Post
+		require.NoError(t, e.Decode(&got))
+		assert.Equal(t, want[i].typ, e.Type)
+		assert.Equal(t, want[i].post, got)
+		assert.Equal(t, author, e.ActorID)
+	}
+}
+
+func TestFriendshipEventsIntegration(t *testing.T) {
+	db := openTestDB(t)
+	friendships := FriendshipModel{DB: db}
+
+	alice := createUser(t, db, "alice")
+	bob := createUser(t, db, "bob")
+
+	_, err := friendships.Transition(alice, bob, FriendshipRequest, 0)
+	require.NoError(t, err)
+	_, err = friendships.Transition(bob, alice, FriendshipAccept, 0)
+	require.NoError(t, err)
+	_, err = friendships.Transition(alice, bob, FriendshipUnfriend, 0)
+	require.NoError(t, err)
+
+	// Blocking twice changes nothing the second time.
+	_, err = friendships.Transition(bob, alice, FriendshipBlock, 0)
+	require.NoError(t, err)
+	_, err = friendships.Transition(bob, alice, FriendshipBlock, 0)
+	require.NoError(t, err)
+
+	events := eventsOf(t, db, outbox.FriendshipChanged)
+	require.Len(t, events, 4)
+
+	want := []outbox.Friendship{
+		{ActorID: alice, OtherID: bob, Event: "request", From: "none", To: "request_sent"},
+		{ActorID: bob, OtherID: alice, Event: "accept", From: "request_received", To: "friends"},
+		{ActorID: alice, OtherID: bob, Event: "unfriend", From: "friends", To: "none"},
+		{ActorID: bob, OtherID: alice, Event: "block", From: "none", To: "blocking"},
+	}
+	for i, e := range events {
+		var got outbox.Friendship
+		require.NoError(t, e.Decode(&got))
+
+		var friendship Friendship
+		require.NoError(t, json.Unmarshal(got.Friendship, &friendship))
+		got.Friendship = nil
+
+		assert.Equal(t, want[i], got)
+		assert.Equal(t, want[i].ActorID, e.ActorID)
+		assert.ElementsMatch(t, []int64{alice, bob}, []int64{friendship.SenderID, friendship.ReceiverID})
+	}
+}
+
+func TestCountersIntegration(t *testing.T) {
+	db := openTestDB(t)
+	counters := CounterModel{DB: db}
+
+	user := createUser(t, db, "user")
+	follower := createUser(t, db, "follower")
+	friend := createUser(t, db, "friend")
+
+	// Users never counted have no counts.
+	counts, err := counters.Get(user)
+	require.NoError(t, err)
+	assert.Equal(t, UserData{}, counts)
+
+	follow(t, db, follower, user)
+	follow(t, db, user, friend)
+	befriend(t, db, user, friend, "accepted")
+	befriend(t, db, follower, user, "pending")
+	createPost(t, db, user, VisibilityPublic)
+	createPost(t, db, user, VisibilityFriends)
+
+	// Counts are cached until refreshed, and refreshing is idempotent.
+	counts, err = counters.Get(user)
+	require.NoError(t, err)
+	assert.Equal(t, UserData{}, counts)
+
+	for range 2 {
+		require.NoError(t, counters.Refresh(user, friend))
+	}
+
+	counts, err = counters.Get(user)
+	require.NoError(t, err)
+	assert.Equal(t, UserData{
+		FollowData: FollowData{FollowersCount: 1, FollowingCount: 1},
+		Friends:    1,
+		Posts:      2,
+	}, counts)
+
+	counts, err = counters.Get(friend)
+	require.NoError(t, err)
+	assert.Equal(t, UserData{FollowData: FollowData{FollowersCount: 1}, Friends: 1}, counts)
+
+	_, err = db.Exec(`DELETE FROM follows WHERE follower_id = $1`, follower)
+	require.NoError(t, err)
+	require.NoError(t, counters.Refresh(user))
+
+	counts, err = counters.Get(user)
+	require.NoError(t, err)
+	assert.Zero(t, counts.FollowData.FollowersCount)
+	assert.Equal(t, int64(1), counts.FollowData.FollowingCount)
+}
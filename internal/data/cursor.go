@@ -0,0 +1,270 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+)
+
+// Cursor is a position within a keyset paginated list. Lists are keyed on
+// (created_at, id), which stays stable while new rows are inserted. Lists
+// sorted by a text column, such as usernames, are keyed on (Key, id) instead.
+//
+// Relevance ranked lists, such as search results, have no stable key and
+// page by Offset instead.
+type Cursor struct {
+	CreatedAt time.Time `json:"t,omitzero"`
+	Key       string    `json:"k,omitempty"`
+	ID        int64     `json:"i,omitempty"`
+	Offset    int       `json:"o,omitempty"`
+	Backward  bool      `json:"b,omitempty"` // Points to the page before the key.
+}
+
+// PageInfo holds the cursors to the pages around a keyset paginated result.
+// A nil cursor means there is no page in that direction.
+type PageInfo struct {
+	Next *Cursor
+	Prev *Cursor
+}
+
+// EncodeCursor serializes c into an opaque token signed with secret, so
+// clients can't forge positions.
+func EncodeCursor(c Cursor, secret []byte) string {
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DecodeCursor verifies and parses a token produced by EncodeCursor.
+func DecodeCursor(token string, secret []byte) (*Cursor, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(payload, &c); err != nil || c.Offset < 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// clauses returns the SQL implementing pagination over the (createdAt, id)
+// key columns: a WHERE condition, an ORDER BY list and a LIMIT clause.
+// Cursor values are appended to args, which are numbered from len(args)+1.
+//
+// desc is the natural order of the list. offsetOrder is the ORDER BY list
+// used by the deprecated offset mode, where the key is not used at all.
+func (pp Pagination) clauses(
+	createdAt, id string,
+	desc bool,
+	offsetOrder string,
+	args []any,
+) (string, string, string, []any) {
+	return pp.keysetClauses(createdAt, id, desc, offsetOrder, args, func(c *Cursor) any { return c.CreatedAt })
+}
+
+// textClauses is like clauses for lists keyed on the (key, id) columns, where
+// key is a text column stored in Cursor.Key.
+func (pp Pagination) textClauses(
+	key, id string,
+	desc bool,
+	offsetOrder string,
+	args []any,
+) (string, string, string, []any) {
+	return pp.keysetClauses(key, id, desc, offsetOrder, args, func(c *Cursor) any { return c.Key })
+}
+
+// keysetClauses implements clauses over the (key, id) columns, reading the
+// key value of the cursor through keyOf.
+func (pp Pagination) keysetClauses(
+	key, id string,
+	desc bool,
+	offsetOrder string,
+	args []any,
+	keyOf func(*Cursor) any,
+) (string, string, string, []any) {
+	if pp.UsesOffset() {
+		limit := fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+		return "TRUE", offsetOrder, limit, append(args, pp.PageSize, pp.Offset())
+	}
+
+	// Walking backwards flips both the comparison and the order; rows are put
+	// back in natural order by paginate.
+	walkDesc := desc
+	if pp.Cursor != nil && pp.Cursor.Backward {
+		walkDesc = !desc
+	}
+
+	direction, comparison := "ASC", ">"
+	if walkDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	where := "TRUE"
+	if pp.Cursor != nil {
+		where = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", key, id, comparison, len(args)+1, len(args)+2)
+		args = append(args, keyOf(pp.Cursor), pp.Cursor.ID)
+	}
+
+	orderBy := fmt.Sprintf("%s %s, %s %s", key, direction, id, direction)
+	limit := fmt.Sprintf("LIMIT $%d", len(args)+1)
+
+	// One extra row tells whether there is another page.
+	return where, orderBy, limit, append(args, pp.PageSize+1)
+}
+
+// unionClauses returns the WHERE condition, ORDER BY list and LIMIT clause
+// of one branch of a UNION paginated as a whole through clauses. Each branch
+// is cut down to the rows the page may need: those after the cursor, or the
+// first Offset+PageSize rows in the deprecated offset mode.
+func (pp Pagination) unionClauses(createdAt, id string, desc bool, args []any) (string, string, string, []any) {
+	if !pp.UsesOffset() {
+		return pp.clauses(createdAt, id, desc, "", args)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	orderBy := fmt.Sprintf("%s %s, %s %s", createdAt, direction, id, direction)
+	limit := fmt.Sprintf("LIMIT $%d", len(args)+1)
+	return "TRUE", orderBy, limit, append(args, pp.Offset()+pp.PageSize)
+}
+
+// rankedClauses returns the LIMIT/OFFSET clause for relevance ranked lists,
+// appending its values to args.
+func (pp Pagination) rankedClauses(args []any) (string, []any) {
+	limit := fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+
+	if pp.UsesOffset() {
+		return limit, append(args, pp.PageSize, pp.Offset())
+	}
+
+	return limit, append(args, pp.PageSize+1, pp.rankedOffset())
+}
+
+func (pp Pagination) rankedOffset() int {
+	if pp.Cursor == nil {
+		return 0
+	}
+	return pp.Cursor.Offset
+}
+
+// paginate trims the extra row fetched by clauses, restores the natural order
+// of rows fetched backwards and computes the surrounding cursors. keys holds
+// the cursor key of every item.
+func paginate[T any](items []T, keys []Cursor, pp Pagination) ([]T, PageInfo) {
+	var info PageInfo
+	if pp.UsesOffset() {
+		return items, info
+	}
+
+	hasMore := len(items) > pp.PageSize
+	if hasMore {
+		items, keys = items[:pp.PageSize], keys[:pp.PageSize]
+	}
+
+	backward := pp.Cursor != nil && pp.Cursor.Backward
+	if backward {
+		slices.Reverse(items)
+		slices.Reverse(keys)
+	}
+
+	if len(items) == 0 {
+		if backward {
+			info.Next = &Cursor{CreatedAt: pp.Cursor.CreatedAt, Key: pp.Cursor.Key, ID: pp.Cursor.ID}
+		}
+		return items, info
+	}
+
+	first, last := keys[0], keys[len(keys)-1]
+	first.Backward = true
+
+	switch {
+	case backward:
+		info.Next = &last
+		if hasMore {
+			info.Prev = &first
+		}
+	default:
+		if hasMore {
+			info.Next = &last
+		}
+		if pp.Cursor != nil {
+			info.Prev = &first
+		}
+	}
+
+	return items, info
+}
+
+// paginateRanked trims the extra row fetched by rankedClauses and computes
+// the offset cursors around the page.
+func paginateRanked[T any](items []T, pp Pagination) ([]T, PageInfo) {
+	var info PageInfo
+	if pp.UsesOffset() {
+		return items, info
+	}
+
+	offset := pp.rankedOffset()
+
+	if len(items) > pp.PageSize {
+		items = items[:pp.PageSize]
+		info.Next = &Cursor{Offset: offset + pp.PageSize}
+	}
+
+	if offset > 0 {
+		info.Prev = &Cursor{Offset: max(offset-pp.PageSize, 0)}
+	}
+
+	return items, info
+}
+
+// PaginateSlice pages through items already fully loaded and ordered in
+// memory, such as ranked feed candidates, with offset cursors.
+func PaginateSlice[T any](items []T, pp Pagination) ([]T, PageInfo) {
+	offset := pp.rankedOffset()
+	if pp.UsesOffset() {
+		offset = pp.Offset()
+	}
+	offset = min(offset, len(items))
+
+	if pp.UsesOffset() {
+		return items[offset:min(offset+pp.PageSize, len(items))], PageInfo{}
+	}
+
+	return paginateRanked(items[offset:min(offset+pp.PageSize+1, len(items))], pp)
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	c := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ID: 42, Backward: true}
+
+	token := EncodeCursor(c, secret)
+
+	got, err := DecodeCursor(token, secret)
+	require.NoError(t, err)
+	assert.True(t, c.CreatedAt.Equal(got.CreatedAt))
+	assert.Equal(t, c.ID, got.ID)
+	assert.True(t, got.Backward)
+
+	_, err = DecodeCursor(token, []byte("other secret"))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = DecodeCursor("not-a-cursor", secret)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestPaginate(t *testing.T) {
+	keys := func(ids ...int64) []Cursor {
+		var cs []Cursor
+		for _, id := range ids {
+			cs = append(cs, Cursor{ID: id})
+		}
+		return cs
+	}
+
+	t.Run("first page with more rows", func(t *testing.T) {
+		items, info := paginate([]int64{5, 4, 3}, keys(5, 4, 3), Pagination{PageSize: 2})
+		assert.Equal(t, []int64{5, 4}, items)
+		require.NotNil(t, info.Next)
+		assert.Equal(t, int64(4), info.Next.ID)
+		assert.Nil(t, info.Prev)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		pp := Pagination{PageSize: 2, Cursor: &Cursor{ID: 3}}
+		items, info := paginate([]int64{2}, keys(2), pp)
+		assert.Equal(t, []int64{2}, items)
+		assert.Nil(t, info.Next)
+		require.NotNil(t, info.Prev)
+		assert.Equal(t, int64(2), info.Prev.ID)
+		assert.True(t, info.Prev.Backward)
+	})
+
+	t.Run("backward page is restored to natural order", func(t *testing.T) {
+		pp := Pagination{PageSize: 2, Cursor: &Cursor{ID: 2, Backward: true}}
+		items, info := paginate([]int64{3, 4, 5}, keys(3, 4, 5), pp)
+		assert.Equal(t, []int64{4, 3}, items)
+		require.NotNil(t, info.Next)
+		assert.Equal(t, int64(3), info.Next.ID)
+		require.NotNil(t, info.Prev)
+		assert.Equal(t, int64(4), info.Prev.ID)
+	})
+
+	t.Run("offset mode is left untouched", func(t *testing.T) {
+		items, info := paginate([]int64{5, 4}, keys(5, 4), Pagination{Page: 1, PageSize: 2})
+		assert.Equal(t, []int64{5, 4}, items)
+		assert.Equal(t, PageInfo{}, info)
+	})
+}
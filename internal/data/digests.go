@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidDigestFrequency = errors.New("invalid digest frequency")
+)
+
+// DigestFrequency is how often a user who stopped logging in receives an
+// email digest of their activity.
+type DigestFrequency string
+
+const (
+	DigestOff    DigestFrequency = "off"
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+func (f DigestFrequency) IsValid() bool {
+	switch f {
+	case DigestOff, DigestDaily, DigestWeekly:
+		return true
+	default:
+		return false
+	}
+}
+
+// Period returns the time between two digests, or 0 when they are off.
+func (f DigestFrequency) Period() time.Duration {
+	switch f {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// DigestRecipient is a user due for a digest.
+type DigestRecipient struct {
+	UserID    int64
+	Username  string
+	Email     string
+	Frequency DigestFrequency
+}
+
+// DigestPost is a post from a recipient's network listed in their digest.
+type DigestPost struct {
+	ID        int64
+	Author    string
+	Content   string
+	Reactions int
+	Replies   int
+	CreatedAt time.Time
+}
+
+type DigestModel struct {
+	DB *sql.DB
+}
+
+// Frequency returns the digest frequency userID chose, or def if they never
+// did.
+func (m DigestModel) Frequency(userID int64, def DigestFrequency) (DigestFrequency, error) {
+	query := `SELECT frequency FROM digest_settings WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var f sql.NullString
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&f)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	if !f.Valid {
+		return def, nil
+	}
+	return DigestFrequency(f.String), nil
+}
+
+// SetFrequency sets how often userID receives digests.
+func (m DigestModel) SetFrequency(userID int64, f DigestFrequency) error {
+	if !f.IsValid() {
+		return ErrInvalidDigestFrequency
+	}
+
+	query := `
+		INSERT INTO digest_settings (user_id, frequency)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, f)
+	return err
+}
+
+// ClaimDue returns up to limit users due for a digest and records it as sent
+// to them, so that every digest is claimed by a single instance. Users are
+// due when they haven't logged in for inactiveAfter and their last digest is
+// older than their frequency's period. Users who never chose a frequency get
+// def.
+//
+// A digest is due an hour early, so that runs of the scheduler drifting past
+// the exact period don't push it back by a whole interval.
+func (m DigestModel) ClaimDue(def DigestFrequency, inactiveAfter time.Duration, limit int) ([]DigestRecipient, error) {
+	query := `
+		WITH due AS (
+			SELECT u.id, COALESCE(ds.frequency, $1) AS frequency
+			FROM users u
+			LEFT JOIN digest_settings ds ON ds.user_id = u.id
+			WHERE COALESCE(ds.frequency, $1) <> 'off'
+				AND COALESCE(u.last_login_at, u.created_at) < NOW() - $2 * INTERVAL '1 second'
+				AND (
+					ds.last_sent_at IS NULL
+					OR ds.last_sent_at < NOW() + INTERVAL '1 hour' - CASE COALESCE(ds.frequency, $1)
+						WHEN 'daily' THEN INTERVAL '1 day'
+						ELSE INTERVAL '7 days'
+					END
+				)
+			ORDER BY u.id
+			LIMIT $3
+			FOR UPDATE OF u SKIP LOCKED
+		), claimed AS (
+			INSERT INTO digest_settings (user_id, last_sent_at)
+			SELECT id, NOW() FROM due
+			ON CONFLICT (user_id) DO UPDATE SET last_sent_at = EXCLUDED.last_sent_at
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.email, d.frequency
+		FROM claimed c
+		JOIN due d ON d.id = c.user_id
+		JOIN users u ON u.id = c.user_id
+		ORDER BY u.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, def, int(inactiveAfter.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []DigestRecipient
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email, &r.Frequency); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return recipients, nil
+}
+
+// TopPosts returns the posts published since by the users userID follows or
+// is friends with that drew the most reactions and replies, up to limit.
+// Replies, posts userID can't read and posts from muted users are left out.
+func (m DigestModel) TopPosts(userID int64, since time.Time, limit int) ([]DigestPost, error) {
+	query := fmt.Sprintf(`
+		SELECT p.id, u.username, p.content, p.created_at, s.reactions, s.replies
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN LATERAL (
+			SELECT
+				(SELECT COUNT(*) FROM reactions r WHERE r.post_id = p.id) AS reactions,
+				(SELECT COUNT(*) FROM posts rp WHERE rp.reply_to_id = p.id) AS replies
+		) s
+		WHERE p.created_at > $2
+			AND p.reply_to_id IS NULL
+			AND p.user_id <> $1
+			AND (
+				EXISTS (
+					SELECT 1 FROM follows f
+					WHERE f.follower_id = $1 AND f.followee_id = p.user_id
+				)
+				OR EXISTS (
+					SELECT 1 FROM friendships fs
+					WHERE fs.status = 'accepted'
+						AND LEAST(fs.sender_id, fs.receiver_id) = LEAST(p.user_id, $1)
+						AND GREATEST(fs.sender_id, fs.receiver_id) = GREATEST(p.user_id, $1)
+				)
+			)
+			AND %s
+			AND %s
+		ORDER BY s.reactions + 2 * s.replies DESC, p.id DESC
+		LIMIT $3`, visibleTo("p", "$1"), notMuted("p.user_id", "$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []DigestPost
+	for rows.Next() {
+		var p DigestPost
+		if err := rows.Scan(&p.ID, &p.Author, &p.Content, &p.CreatedAt, &p.Reactions, &p.Replies); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// PendingRequesters returns the users with a pending friend request to
+// userID, most recent first and up to limit, along with how many there are
+// in total.
+func (m DigestModel) PendingRequesters(userID int64, limit int) ([]UserPublic, int, error) {
+	query := `
+		SELECT u.id, u.username, COUNT(*) OVER ()
+		FROM friendships f
+		JOIN users u ON u.id = f.sender_id
+		WHERE f.receiver_id = $1 AND f.status = 'pending'
+		ORDER BY f.created_at DESC, f.id DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var (
+		users []UserPublic
+		total int
+	)
+	for rows.Next() {
+		var u UserPublic
+		if err := rows.Scan(&u.ID, &u.Username, &total); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
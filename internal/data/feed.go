@@ -3,19 +3,45 @@ package data
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 )
 
+// Feed builds users' home timelines: their own posts and those of the users
+// they follow or are friends with, newest first.
+type Feed interface {
+	Fetch(userID int64, pagination Pagination) ([]PostPublic, PageInfo, error)
+}
+
+// FeedStrategy selects how home timelines are built.
+type FeedStrategy string
+
+const (
+	FeedFanOutOnRead  FeedStrategy = "pull"   // Computed on every read, by FeedModel.
+	FeedFanOutOnWrite FeedStrategy = "fanout" // Materialized on publish, by TimelineModel.
+)
+
+func (s FeedStrategy) IsValid() bool {
+	return s == FeedFanOutOnRead || s == FeedFanOutOnWrite
+}
+
+// NewFeed returns the Feed implementing strategy.
+func NewFeed(db *sql.DB, strategy FeedStrategy) Feed {
+	if strategy == FeedFanOutOnRead {
+		return FeedModel{DB: db}
+	}
+	return TimelineModel{DB: db}
+}
+
+// FeedModel computes home timelines on read (fan-out-on-read), gathering the
+// posts of the user's whole audience on every request.
 type FeedModel struct {
 	DB *sql.DB
 }
 
-func (m FeedModel) Fetch(
-	userID int64,
-	pagination Pagination,
-) ([]PostPublic, error) {
-	query := `
-		WITH audience AS (
+// homeAudience selects the authors of the home timeline of the user bound to
+// $1: themselves, the users they follow and their friends.
+const homeAudience = `
 			SELECT $1 AS user_id
 			
 			UNION
@@ -33,30 +59,68 @@ func (m FeedModel) Fetch(
 				END
 			FROM friendships
 			WHERE status = 'accepted'
-				AND ($1 IN (sender_id, receiver_id))
+				AND ($1 IN (sender_id, receiver_id))`
+
+func (m FeedModel) Fetch(
+	userID int64,
+	pagination Pagination,
+) ([]PostPublic, PageInfo, error) {
+	return m.fetch(homeAudience, []any{userID}, pagination)
+}
+
+// FetchList returns the timeline of list listID as seen by viewerID: the
+// posts of the list's members, newest first.
+func (m FeedModel) FetchList(
+	viewerID, listID int64,
+	pagination Pagination,
+) ([]PostPublic, PageInfo, error) {
+	audience := `
+			SELECT user_id
+			FROM list_members
+			WHERE list_id = $2`
+
+	return m.fetch(audience, []any{viewerID, listID}, pagination)
+}
+
+// fetch returns the posts readable by the viewer bound to $1 whose authors
+// are selected by the SQL query audience, newest first. args holds the
+// viewer's ID followed by any other values audience refers to.
+func (m FeedModel) fetch(
+	audience string,
+	args []any,
+	pagination Pagination,
+) ([]PostPublic, PageInfo, error) {
+	where, orderBy, limit, args := pagination.clauses("p.created_at", "p.id", true, "p.created_at DESC", args)
+
+	query := fmt.Sprintf(`
+		WITH audience AS (%s
 		)
 		SELECT
 			p.id,
 			p.user_id,
 			p.content,
+			p.visibility,
+			p.reply_to_id,
 			p.created_at
 		FROM posts p
 		JOIN audience a ON a.user_id = p.user_id
-		ORDER BY p.created_at DESC
-		LIMIT $2 OFFSET $3`
+		WHERE %s AND %s
+		ORDER BY %s
+		%s`, audience, visibleTo("p", "$1"), where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var posts []PostPublic
+	var (
+		posts []PostPublic
+		keys  []Cursor
+	)
 
 	for rows.Next() {
 		var p PostPublic
@@ -64,17 +128,23 @@ func (m FeedModel) Fetch(
 		err := rows.Scan(
 			&p.ID,
 			&p.UserID,
-			&p.Content, &p.CreatedAt,
+			&p.Content,
+			&p.Visibility,
+			&p.ReplyToID,
+			&p.CreatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
 
 		posts = append(posts, p)
+		keys = append(keys, Cursor{CreatedAt: p.CreatedAt, ID: p.ID})
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
-	return posts, nil
+
+	posts, info := paginate(posts, keys, pagination)
+	return posts, info, nil
 }
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// BenchmarkFeedFetch compares both feed strategies on the first page of a
+// user's feed. It needs a seeded database, given through FEED_BENCH_DATABASE_URL
+// and FEED_BENCH_USER_ID, and is skipped otherwise:
+//
+//	FEED_BENCH_DATABASE_URL=postgres://... FEED_BENCH_USER_ID=1 \
+//		go test ./internal/data -run '^$' -bench FeedFetch
+func BenchmarkFeedFetch(b *testing.B) {
+	dsn := os.Getenv("FEED_BENCH_DATABASE_URL")
+	userID, err := strconv.ParseInt(os.Getenv("FEED_BENCH_USER_ID"), 10, 64)
+	if dsn == "" || err != nil {
+		b.Skip("FEED_BENCH_DATABASE_URL and FEED_BENCH_USER_ID are not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, strategy := range []FeedStrategy{FeedFanOutOnRead, FeedFanOutOnWrite} {
+		b.Run(string(strategy), func(b *testing.B) {
+			feed := NewFeed(db, strategy)
+
+			for b.Loop() {
+				if _, _, err := feed.Fetch(userID, Pagination{PageSize: 20}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FeedCandidate is a post considered for the ranked feed, along with the
+// signals rankers score it on.
+type FeedCandidate struct {
+	Post           PostPublic
+	LikeVelocity   float64 // Reactions per hour over CandidateOptions.VelocityWindow.
+	Affinity       int     // Number of times the viewer reacted to the author's posts.
+	FriendOfFriend bool    // Whether the author was reached through a friend, outside the viewer's audience.
+}
+
+// CandidateOptions bounds the candidate set of the ranked feed.
+type CandidateOptions struct {
+	Window         time.Duration // Only posts newer than this are considered.
+	VelocityWindow time.Duration // Recent period over which reactions count towards velocity.
+	Limit          int           // Maximum number of candidates, newest first.
+}
+
+var DefaultCandidateOptions = CandidateOptions{
+	Window:         72 * time.Hour,
+	VelocityWindow: 6 * time.Hour,
+	Limit:          500,
+}
+
+type FeedCandidateModel struct {
+	DB *sql.DB
+}
+
+// List gathers the ranked feed candidates of viewerID: recent posts from the
+// users they follow or are friends with, plus posts from friends of their
+// friends. The viewer's own posts are left out.
+func (m FeedCandidateModel) List(viewerID int64, opts CandidateOptions) ([]FeedCandidate, error) {
+	query := fmt.Sprintf(`
+		WITH friends AS (
+			SELECT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END AS user_id
+			FROM friendships
+			WHERE status = 'accepted' AND $1 IN (sender_id, receiver_id)
+		),
+		audience AS (
+			SELECT followee_id AS user_id FROM follows WHERE follower_id = $1
+			UNION
+			SELECT user_id FROM friends
+		),
+		friends_of_friends AS (
+			SELECT CASE WHEN f.sender_id = fr.user_id THEN f.receiver_id ELSE f.sender_id END AS user_id
+			FROM friendships f
+			JOIN friends fr ON fr.user_id IN (f.sender_id, f.receiver_id)
+			WHERE f.status = 'accepted'
+
+			EXCEPT
+
+			SELECT user_id FROM audience
+		),
+		authors AS (
+			SELECT user_id, FALSE AS friend_of_friend FROM audience
+			UNION ALL
+			SELECT user_id, TRUE FROM friends_of_friends
+		)
+		SELECT
+			p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at,
+			(
+				SELECT COUNT(*) FROM reactions r
+				WHERE r.post_id = p.id AND r.created_at > NOW() - $3 * INTERVAL '1 second'
+			),
+			(
+				SELECT COUNT(*) FROM reactions r
+				JOIN posts ap ON ap.id = r.post_id
+				WHERE r.user_id = $1 AND ap.user_id = p.user_id
+			),
+			a.friend_of_friend
+		FROM posts p
+		JOIN authors a ON a.user_id = p.user_id
+		WHERE p.user_id <> $1
+			AND p.created_at > NOW() - $2 * INTERVAL '1 second'
+			AND %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $4`, visibleTo("p", "$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{
+		viewerID,
+		int(opts.Window.Seconds()),
+		int(opts.VelocityWindow.Seconds()),
+		opts.Limit,
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []FeedCandidate
+	for rows.Next() {
+		var (
+			c           FeedCandidate
+			recentLikes int
+		)
+
+		err := rows.Scan(
+			&c.Post.ID,
+			&c.Post.UserID,
+			&c.Post.Content,
+			&c.Post.Visibility,
+			&c.Post.ReplyToID,
+			&c.Post.CreatedAt,
+			&recentLikes,
+			&c.Affinity,
+			&c.FriendOfFriend,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		c.LikeVelocity = float64(recentLikes) / opts.VelocityWindow.Hours()
+		candidates = append(candidates, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,511 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrImportEmpty       = errors.New("import contains no usernames")
+	ErrImportTooLarge    = errors.New("import contains too many usernames")
+	ErrImportRateLimited = errors.New("too many follow imports, try again later")
+)
+
+// ImportStatus is the state of a follow import job.
+type ImportStatus string
+
+const (
+	ImportPending   ImportStatus = "pending"
+	ImportRunning   ImportStatus = "running"
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportResult is the outcome of importing a single username.
+type ImportResult string
+
+const (
+	ImportFollowed         ImportResult = "followed"
+	ImportAlreadyFollowing ImportResult = "already_following"
+	ImportNotFound         ImportResult = "not_found"
+	ImportBlocked          ImportResult = "blocked" // Either user blocked the other.
+	ImportSelf             ImportResult = "self"
+)
+
+// FollowImport is a job following every user listed in an uploaded CSV file.
+type FollowImport struct {
+	ID          int64                `json:"id"`
+	UserID      int64                `json:"-"`
+	Status      ImportStatus         `json:"status"`
+	Total       int                  `json:"total"`
+	Processed   int                  `json:"processed"`
+	Results     map[ImportResult]int `json:"results"` // Processed rows by result.
+	Error       *string              `json:"error,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	CompletedAt *time.Time           `json:"completed_at"`
+}
+
+// FollowImportRow is a username of a follow import, along with the result of
+// importing it once processed.
+type FollowImportRow struct {
+	Row        int           `json:"row"`
+	Username   string        `json:"username"`
+	Result     *ImportResult `json:"result"`
+	FolloweeID *int64        `json:"user_id"`
+}
+
+// ParseFollowImport reads the usernames listed in the first column of a CSV
+// file, up to maxRows of them. A leading "username" header, @ prefixes,
+// blank lines and duplicates are skipped.
+func ParseFollowImport(r io.Reader, maxRows int) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var (
+		usernames []string
+		seen      = make(map[string]bool)
+	)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		username := strings.TrimPrefix(strings.TrimSpace(record[0]), "@")
+		if first && strings.EqualFold(username, "username") {
+			continue
+		}
+		if username == "" || seen[username] {
+			continue
+		}
+
+		if len(usernames) == maxRows {
+			return nil, fmt.Errorf("%w: the limit is %d", ErrImportTooLarge, maxRows)
+		}
+
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+
+	if len(usernames) == 0 {
+		return nil, ErrImportEmpty
+	}
+
+	return usernames, nil
+}
+
+// importChecksum identifies the usernames of an import, so that importing
+// the same list twice is detected.
+func importChecksum(usernames []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(usernames, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+type FollowImportModel struct {
+	DB *sql.DB
+}
+
+// Create records an import of usernames by userID, unless the same usernames
+// were already imported by them, in which case that import is returned and
+// created is false. A failed import is reset to pending, so that it resumes
+// where it stopped.
+//
+// Users can create up to limit imports per window, past which
+// ErrImportRateLimited is returned.
+func (m FollowImportModel) Create(userID int64, usernames []string, limit int, window time.Duration) (fi *FollowImport, created bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent uploads can't exceed the rate limit.
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	checksum := importChecksum(usernames)
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE follow_imports
+		SET status = CASE WHEN status = 'failed' THEN 'pending' ELSE status END,
+			error = CASE WHEN status = 'failed' THEN NULL ELSE error END
+		WHERE user_id = $1 AND checksum = $2
+		RETURNING id`,
+		userID, checksum,
+	).Scan(&id)
+
+	switch {
+	case err == nil:
+		// Already imported.
+	case errors.Is(err, sql.ErrNoRows):
+		var recent int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COUNT(*)
+			FROM follow_imports
+			WHERE user_id = $1 AND created_at > NOW() - $2 * INTERVAL '1 second'`,
+			userID, int(window.Seconds()),
+		).Scan(&recent)
+		if err != nil {
+			return nil, false, err
+		}
+		if recent >= limit {
+			return nil, false, ErrImportRateLimited
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO follow_imports (user_id, checksum, total)
+			VALUES ($1, $2, $3)
+			RETURNING id`,
+			userID, checksum, len(usernames),
+		).Scan(&id)
+		if err != nil {
+			return nil, false, err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO follow_import_rows (import_id, row_number, username)
+			SELECT $1, u.row_number, u.username
+			FROM UNNEST($2::text[]) WITH ORDINALITY AS u(username, row_number)`,
+			id, pq.Array(usernames),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		created = true
+	default:
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	fi, err = m.Get(id, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return fi, created, nil
+}
+
+// Get returns import id of userID along with its progress, or
+// ErrRecordNotFound if they have no such import.
+func (m FollowImportModel) Get(id, userID int64) (*FollowImport, error) {
+	query := `
+		SELECT i.id, i.user_id, i.status, i.total, i.error, i.created_at, i.completed_at,
+			COUNT(r.result),
+			COUNT(*) FILTER (WHERE r.result = 'followed'),
+			COUNT(*) FILTER (WHERE r.result = 'already_following'),
+			COUNT(*) FILTER (WHERE r.result = 'not_found'),
+			COUNT(*) FILTER (WHERE r.result = 'blocked'),
+			COUNT(*) FILTER (WHERE r.result = 'self')
+		FROM follow_imports i
+		LEFT JOIN follow_import_rows r ON r.import_id = i.id
+		WHERE i.id = $1 AND i.user_id = $2
+		GROUP BY i.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var (
+		fi                                                  FollowImport
+		followed, alreadyFollowing, notFound, blocked, self int
+	)
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&fi.ID, &fi.UserID, &fi.Status, &fi.Total, &fi.Error, &fi.CreatedAt, &fi.CompletedAt,
+		&fi.Processed, &followed, &alreadyFollowing, &notFound, &blocked, &self,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	fi.Results = map[ImportResult]int{
+		ImportFollowed:         followed,
+		ImportAlreadyFollowing: alreadyFollowing,
+		ImportNotFound:         notFound,
+		ImportBlocked:          blocked,
+		ImportSelf:             self,
+	}
+
+	return &fi, nil
+}
+
+// Rows returns the rows of import id of userID in file order, optionally
+// only those with the given result. Returns ErrRecordNotFound if they have
+// no such import.
+func (m FollowImportModel) Rows(id, userID int64, result ImportResult, pagination Pagination) ([]FollowImportRow, PageInfo, error) {
+	args := []any{id, userID, result}
+	limit, args := pagination.rankedClauses(args)
+
+	query := fmt.Sprintf(`
+		SELECT r.row_number, r.username, r.result, r.followee_id
+		FROM follow_import_rows r
+		JOIN follow_imports i ON i.id = r.import_id
+		WHERE i.id = $1 AND i.user_id = $2 AND ($3 = '' OR r.result = $3)
+		ORDER BY r.row_number
+		%s`, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var importRows []FollowImportRow
+	for rows.Next() {
+		var row FollowImportRow
+		if err := rows.Scan(&row.Row, &row.Username, &row.Result, &row.FolloweeID); err != nil {
+			return nil, PageInfo{}, err
+		}
+		importRows = append(importRows, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	importRows, info := paginateRanked(importRows, pagination)
+	return importRows, info, nil
+}
+
+// Claim marks import id as running and returns the user it belongs to.
+// Imports can be claimed while pending, or while running if their worker
+// hasn't sent a heartbeat for staleAfter. ok is false if the import can't be
+// claimed.
+func (m FollowImportModel) Claim(id int64, staleAfter time.Duration) (userID int64, ok bool, err error) {
+	query := `
+		UPDATE follow_imports
+		SET status = 'running', heartbeat_at = NOW()
+		WHERE id = $1
+			AND (
+				status = 'pending'
+				OR (status = 'running' AND heartbeat_at < NOW() - $2 * INTERVAL '1 second')
+			)
+		RETURNING user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, id, int(staleAfter.Seconds())).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return userID, true, nil
+}
+
+// Unfinished returns the imports that can be claimed, oldest first.
+func (m FollowImportModel) Unfinished(staleAfter time.Duration) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM follow_imports
+		WHERE status = 'pending'
+			OR (status = 'running' AND heartbeat_at < NOW() - $1 * INTERVAL '1 second')
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, int(staleAfter.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// PendingRows returns up to limit unprocessed rows of import id in file
+// order, and refreshes the import's heartbeat.
+func (m FollowImportModel) PendingRows(id int64, limit int) ([]FollowImportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE follow_imports SET heartbeat_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT row_number, username
+		FROM follow_import_rows
+		WHERE import_id = $1 AND result IS NULL
+		ORDER BY row_number
+		LIMIT $2`,
+		id, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []FollowImportRow
+	for rows.Next() {
+		var row FollowImportRow
+		if err := rows.Scan(&row.Row, &row.Username); err != nil {
+			return nil, err
+		}
+		pending = append(pending, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// ProcessRow follows the user named by row of import id on behalf of
+// userID, and records the result. The result is empty if the row had
+// already been processed.
+func (m FollowImportModel) ProcessRow(id, userID int64, row FollowImportRow) (ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		result     ImportResult
+		followeeID sql.NullInt64
+		following  bool
+		blocked    bool
+	)
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT u.id,
+			EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = $2 AND f.followee_id = u.id),
+			NOT %s
+		FROM users u
+		WHERE u.username = $1`, notBlocked("u.id", "$2")),
+		row.Username, userID,
+	).Scan(&followeeID, &following, &blocked)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		result = ImportNotFound
+	case err != nil:
+		return "", err
+	case followeeID.Int64 == userID:
+		result = ImportSelf
+	case blocked:
+		result = ImportBlocked
+	case following:
+		result = ImportAlreadyFollowing
+	default:
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO follows (follower_id, followee_id)
+			VALUES ($1, $2)
+			ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+			userID, followeeID.Int64,
+		)
+		if err != nil {
+			return "", err
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return "", err
+		}
+
+		result = ImportFollowed
+		if inserted == 0 {
+			result = ImportAlreadyFollowing
+		} else {
+			err := recordEvent(ctx, tx, outbox.FollowCreated, userID, outbox.Follow{FollowerID: userID, FolloweeID: followeeID.Int64})
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE follow_import_rows
+		SET result = $3, followee_id = $4
+		WHERE import_id = $1 AND row_number = $2 AND result IS NULL`,
+		id, row.Row, result, followeeID,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if updated == 0 {
+		return "", nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// Finish marks import id as completed, or as failed with cause if it isn't
+// nil.
+func (m FollowImportModel) Finish(id int64, cause error) error {
+	status, message := ImportCompleted, sql.NullString{}
+	if cause != nil {
+		status, message = ImportFailed, sql.NullString{String: cause.Error(), Valid: true}
+	}
+
+	query := `
+		UPDATE follow_imports
+		SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, status, message)
+	return err
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFollowImport(t *testing.T) {
+	csv := "Username,Display name\n@alice,Alice\n\nbob\n alice \ncarol,\"Carol, C.\"\n"
+
+	usernames, err := ParseFollowImport(strings.NewReader(csv), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, usernames)
+}
+
+func TestParseFollowImportWithoutHeader(t *testing.T) {
+	usernames, err := ParseFollowImport(strings.NewReader("alice\nbob"), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, usernames)
+}
+
+func TestParseFollowImportErrors(t *testing.T) {
+	_, err := ParseFollowImport(strings.NewReader("username\n\n"), 10)
+	assert.ErrorIs(t, err, ErrImportEmpty)
+
+	_, err = ParseFollowImport(strings.NewReader("a\nb\nc\na\n"), 2)
+	assert.ErrorIs(t, err, ErrImportTooLarge)
+
+	_, err = ParseFollowImport(strings.NewReader("a\n\"b\n"), 10)
+	assert.Error(t, err)
+}
+
+func TestImportChecksum(t *testing.T) {
+	assert.Equal(t, importChecksum([]string{"alice", "bob"}), importChecksum([]string{"alice", "bob"}))
+	assert.NotEqual(t, importChecksum([]string{"alice", "bob"}), importChecksum([]string{"bob", "alice"}))
+	assert.NotEqual(t, importChecksum([]string{"ab", "c"}), importChecksum([]string{"a", "bc"}))
+}
@@ -3,8 +3,11 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
 )
 
 type Follows struct {
@@ -23,94 +26,116 @@ type FollowsModel struct {
 	DB *sql.DB
 }
 
-// Insert adds a new follow record to the database.
+// Insert adds a new follow record to the database, recording an
+// outbox.FollowCreated event unless followerID already followed followeeID.
 func (m FollowsModel) Insert(followerID, followeeID int64) error {
 	query := `
 		INSERT INTO follows (follower_id, followee_id)
 		VALUES ($1, $2)
-		ON CONFLICT (follower_id, followee_id) DO NOTHING`
-
-	args := []any{followerID, followeeID}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+		ON CONFLICT (follower_id, followee_id) DO NOTHING
+		RETURNING id`
 
-	err := m.DB.QueryRowContext(ctx, query, args...)
-	if err != nil {
-		// TODO: Add clearer error messages
-		return err.Err()
-	}
-
-	return nil
+	return m.change(query, outbox.FollowCreated, followerID, followeeID)
 }
 
-// Delete removes a follow record from the follow table.
+// Delete removes a follow record from the follow table, recording an
+// outbox.FollowDeleted event if there was one.
 func (m FollowsModel) Delete(followerID, followeeID int64) error {
 	query := `
 		DELETE FROM follows
-		WHERE follower_id = $1 AND followee_id = $2`
+		WHERE follower_id = $1 AND followee_id = $2
+		RETURNING id`
 
-	args := []any{followerID, followeeID}
+	return m.change(query, outbox.FollowDeleted, followerID, followeeID)
+}
 
+// change runs query, which inserts or deletes the follow of followeeID by
+// followerID, and records an event of type typ if it did.
+func (m FollowsModel) change(query, typ string, followerID, followeeID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err.Err()
+		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	var id int64
+	err = tx.QueryRowContext(ctx, query, followerID, followeeID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	err = recordEvent(ctx, tx, typ, followerID, outbox.Follow{FollowerID: followerID, FolloweeID: followeeID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // GetFollowers returns a slice with every follower that user with related id has.
+//
+// Users are sorted by username, ascending unless pagination.Sort is
+// "username_desc", in both keyset and offset modes.
 func (m FollowsModel) GetFollowers(
 	userID int64,
 	pagination Pagination,
-) ([]UserPublic, error) {
-	var sortColumn string
-	switch pagination.Sort {
-	case "username_asc":
-		sortColumn = "u.username ASC"
-	case "username_desc":
-		sortColumn = "u.username DESC"
-	default:
-		sortColumn = "u.username ASC"
+) ([]UserPublic, PageInfo, error) {
+	desc := pagination.Sort == "username_desc"
+
+	sortColumn := "u.username ASC, u.id ASC"
+	if desc {
+		sortColumn = "u.username DESC, u.id DESC"
 	}
 
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.textClauses("u.username", "u.id", desc, sortColumn, args)
+
 	query := fmt.Sprintf(`
 		SELECT u.id, u.username
 		FROM follows f
 		JOIN users u ON f.follower_id = u.id
-		WHERE f.followee_id = $1
+		WHERE f.followee_id = $1 AND %s
 		ORDER BY %s
-		LIMIT $2 OFFSET $3`, sortColumn)
+		%s`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var followers []UserPublic
+	var (
+		followers []UserPublic
+		keys      []Cursor
+	)
 	for rows.Next() {
-		var u UserPublic
+		var (
+			u   UserPublic
+			key Cursor
+		)
 		if err := rows.Scan(&u.ID, &u.Username); err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
+		key.Key, key.ID = u.Username, u.ID
 		followers = append(followers, u)
+		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	return followers, nil
+	followers, info := paginate(followers, keys, pagination)
+	return followers, info, nil
 }
 
 func (m FollowsModel) GetFollowData(userID int64) (FollowData, error) {
@@ -154,52 +179,98 @@ func (m FollowsModel) Exists(followerID, followeeID int64) (bool, error) {
 	return exists, nil
 }
 
-// GetFollowers returns a slice with every follow by the user with given id.
+// GetFollowees returns a slice with every follow by the user with given id.
+//
+// Users are sorted by username, ascending unless pagination.Sort is
+// "username_desc", in both keyset and offset modes.
 func (m FollowsModel) GetFollowees(
 	userID int64,
 	pagination Pagination,
-) ([]UserPublic, error) {
-	var sortColumn string
-	switch pagination.Sort {
-	case "username_asc":
-		sortColumn = "u.username ASC"
-	case "username_desc":
-		sortColumn = "u.username DESC"
-	default:
-		sortColumn = "u.username ASC"
+) ([]UserPublic, PageInfo, error) {
+	desc := pagination.Sort == "username_desc"
+
+	sortColumn := "u.username ASC, u.id ASC"
+	if desc {
+		sortColumn = "u.username DESC, u.id DESC"
 	}
 
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.textClauses("u.username", "u.id", desc, sortColumn, args)
+
 	query := fmt.Sprintf(`
 		SELECT u.id, u.username
 		FROM follows f
 		JOIN users u ON f.followee_id = u.id
-		WHERE f.follower_id = $1
+		WHERE f.follower_id = $1 AND %s
 		ORDER BY %s
-		LIMIT $2 OFFSET $3`, sortColumn)
+		%s`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var followees []UserPublic
+	var (
+		followees []UserPublic
+		keys      []Cursor
+	)
 	for rows.Next() {
-		var u UserPublic
+		var (
+			u   UserPublic
+			key Cursor
+		)
 		if err := rows.Scan(&u.ID, &u.Username); err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
+		key.Key, key.ID = u.Username, u.ID
 		followees = append(followees, u)
+		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
+	}
+
+	followees, info := paginate(followees, keys, pagination)
+	return followees, info, nil
+}
+
+// EachFollowee calls fn with the username of every user followerID follows
+// and when they started following them, oldest first. It stops at the first
+// error fn returns.
+func (m FollowsModel) EachFollowee(followerID int64, fn func(username string, since time.Time) error) error {
+	query := `
+		SELECT u.username, f.created_at
+		FROM follows f
+		JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = $1
+		ORDER BY f.created_at, f.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, followerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			username string
+			since    time.Time
+		)
+		if err := rows.Scan(&username, &since); err != nil {
+			return err
+		}
+		if err := fn(username, since); err != nil {
+			return err
+		}
 	}
 
-	return followees, nil
+	return rows.Err()
 }
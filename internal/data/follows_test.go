@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFollowersSortIntegration(t *testing.T) {
+	db := openTestDB(t)
+	follows := FollowsModel{DB: db}
+
+	user := createUser(t, db, "user")
+
+	// Followed in an order unrelated to their usernames.
+	for _, name := range []string{"carol", "alice", "erin", "bob", "dave"} {
+		follow(t, db, createUser(t, db, name), user)
+	}
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"", []string{"alice", "bob", "carol", "dave", "erin"}},
+		{"username_asc", []string{"alice", "bob", "carol", "dave", "erin"}},
+		{"username_desc", []string{"erin", "dave", "carol", "bob", "alice"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			pagination := Pagination{PageSize: 2, Sort: tt.sort}
+
+			var (
+				seen []string
+				prev *Cursor
+			)
+			for {
+				page, info, err := follows.GetFollowers(user, pagination)
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(page), 2)
+
+				for _, u := range page {
+					seen = append(seen, u.Username)
+				}
+
+				if info.Next == nil {
+					prev = info.Prev
+					break
+				}
+				pagination.Cursor = info.Next
+			}
+
+			assert.Equal(t, tt.want, seen)
+
+			// Walking back from the last page returns the one before it.
+			require.NotNil(t, prev)
+			pagination.Cursor = prev
+			page, _, err := follows.GetFollowers(user, pagination)
+			require.NoError(t, err)
+
+			var usernames []string
+			for _, u := range page {
+				usernames = append(usernames, u.Username)
+			}
+			assert.Equal(t, tt.want[2:4], usernames)
+		})
+	}
+}
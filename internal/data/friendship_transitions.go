@@ -0,0 +1,443 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+)
+
+var (
+	ErrFriendshipWithSelf          = errors.New("cannot change a friendship with yourself")
+	ErrInvalidFriendshipTransition = errors.New("friendship transition not allowed")
+	ErrFriendshipBlocked           = errors.New("a block exists between the users")
+	ErrAlreadyFriends              = errors.New("users are already friends")
+	ErrFriendRequestCooldown       = errors.New("the user declined a recent friend request")
+)
+
+// FriendshipEvent is something a user does to their friendship with another
+// user.
+type FriendshipEvent string
+
+const (
+	FriendshipRequest  FriendshipEvent = "request"
+	FriendshipAccept   FriendshipEvent = "accept"
+	FriendshipDecline  FriendshipEvent = "decline"
+	FriendshipCancel   FriendshipEvent = "cancel"
+	FriendshipUnfriend FriendshipEvent = "unfriend"
+	FriendshipBlock    FriendshipEvent = "block"
+	FriendshipUnblock  FriendshipEvent = "unblock"
+)
+
+// FriendshipState is where a friendship stands, as seen by one of its users.
+type FriendshipState string
+
+const (
+	StateNone            FriendshipState = "none"
+	StateRequestSent     FriendshipState = "request_sent"
+	StateRequestReceived FriendshipState = "request_received"
+	StateFriends         FriendshipState = "friends"
+	StateBlocking        FriendshipState = "blocking"   // The user blocked the other one.
+	StateBlockedBy       FriendshipState = "blocked_by" // The other user blocked the user.
+)
+
+// status returns the friendships row status of s, or "none" when the users
+// have no row.
+func (s FriendshipState) status() string {
+	switch s {
+	case StateRequestSent, StateRequestReceived:
+		return string(StatusPending)
+	case StateFriends:
+		return string(StatusAccepted)
+	case StateBlocking, StateBlockedBy:
+		return string(StatusBlocked)
+	default:
+		return "none"
+	}
+}
+
+// friendshipTransitions lists the events a user may apply in each state and
+// the state they lead to. Requesting someone whose request is pending accepts
+// it. Nothing can be done while blocked by the other user.
+var friendshipTransitions = map[FriendshipState]map[FriendshipEvent]FriendshipState{
+	StateNone: {
+		FriendshipRequest: StateRequestSent,
+		FriendshipBlock:   StateBlocking,
+	},
+	StateRequestSent: {
+		FriendshipCancel: StateNone,
+		FriendshipBlock:  StateBlocking,
+	},
+	StateRequestReceived: {
+		FriendshipRequest: StateFriends,
+		FriendshipAccept:  StateFriends,
+		FriendshipDecline: StateNone,
+		FriendshipBlock:   StateBlocking,
+	},
+	StateFriends: {
+		FriendshipUnfriend: StateNone,
+		FriendshipBlock:    StateBlocking,
+	},
+	StateBlocking: {
+		FriendshipBlock:   StateBlocking,
+		FriendshipUnblock: StateNone,
+	},
+}
+
+// nextFriendshipState returns the state event leads to from state.
+func nextFriendshipState(state FriendshipState, event FriendshipEvent) (FriendshipState, error) {
+	if next, ok := friendshipTransitions[state][event]; ok {
+		return next, nil
+	}
+
+	switch {
+	case state == StateBlockedBy:
+		return state, ErrFriendshipBlocked
+	case state == StateRequestSent && event == FriendshipRequest:
+		return state, ErrFriendRequestAlreadyExists
+	case state == StateFriends && event == FriendshipRequest:
+		return state, ErrAlreadyFriends
+	default:
+		return state, fmt.Errorf("%w: cannot %s from %s", ErrInvalidFriendshipTransition, event, state)
+	}
+}
+
+// friendshipState returns the state of fs as seen by userID. The receiver of
+// a blocked friendship is the user who blocked the other one.
+func friendshipState(fs *Friendship, userID int64) FriendshipState {
+	if fs == nil {
+		return StateNone
+	}
+
+	switch fs.Status {
+	case StatusPending:
+		if fs.SenderID == userID {
+			return StateRequestSent
+		}
+		return StateRequestReceived
+	case StatusAccepted:
+		return StateFriends
+	case StatusBlocked:
+		if fs.ReceiverID == userID {
+			return StateBlocking
+		}
+		return StateBlockedBy
+	default:
+		return StateNone
+	}
+}
+
+// friendshipLockKey returns the advisory lock key serializing transitions
+// between two users, whatever their order.
+func friendshipLockKey(a, b int64) int64 {
+	return min(a, b)<<32 | max(a, b)&0xffffffff
+}
+
+// FriendshipChange is the outcome of a transition.
+type FriendshipChange struct {
+	Event      FriendshipEvent
+	From       FriendshipState
+	To         FriendshipState
+	OtherID    int64       // The user the transition was applied to.
+	Friendship *Friendship // The friendship after the transition, or before it when it ended.
+}
+
+// FriendshipTransition is an entry of the history of a friendship.
+type FriendshipTransition struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id"`
+	SubjectID  int64           `json:"subject_id"`
+	Event      FriendshipEvent `json:"event"`
+	FromStatus string          `json:"from_status"`
+	ToStatus   string          `json:"to_status"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Transition applies event to the friendship of actorID with otherID and
+// records it in their history. Friend requests to a user who declined one
+// from actorID less than cooldown ago fail with ErrFriendRequestCooldown.
+// Ending a friendship also removes the users from each other's close friends,
+// and blocking removes the follows between them. Every change is recorded as
+// an outbox.FriendshipChanged event.
+func (m FriendshipModel) Transition(actorID, otherID int64, event FriendshipEvent, cooldown time.Duration) (*FriendshipChange, error) {
+	return m.transition(actorID, otherID, 0, event, cooldown)
+}
+
+// TransitionRequest applies event to the friendship with the given id, which
+// actorID must be part of. Fails with ErrNoSuchRequest otherwise.
+func (m FriendshipModel) TransitionRequest(requestID, actorID int64, event FriendshipEvent, cooldown time.Duration) (*FriendshipChange, error) {
+	query := `
+		SELECT CASE WHEN sender_id = $2 THEN receiver_id ELSE sender_id END
+		FROM friendships
+		WHERE id = $1 AND $2 IN (sender_id, receiver_id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var otherID int64
+	err := m.DB.QueryRowContext(ctx, query, requestID, actorID).Scan(&otherID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoSuchRequest
+		}
+		return nil, err
+	}
+
+	return m.transition(actorID, otherID, requestID, event, cooldown)
+}
+
+// transition applies event as described by Transition. A non-zero requestID
+// must still identify the friendship once it's locked.
+func (m FriendshipModel) transition(actorID, otherID, requestID int64, event FriendshipEvent, cooldown time.Duration) (*FriendshipChange, error) {
+	if actorID == otherID {
+		if event == FriendshipRequest {
+			return nil, ErrFriendshipRequestToSelf
+		}
+		return nil, ErrFriendshipWithSelf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Users without a friendship have no row to lock, so serialize on the
+	// pair instead. Two crossed requests then see each other.
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1::bigint)`, friendshipLockKey(actorID, otherID))
+	if err != nil {
+		return nil, err
+	}
+
+	var current *Friendship
+
+	fs := Friendship{}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, sender_id, receiver_id, created_at, updated_at, status, version
+		FROM friendships
+		WHERE LEAST(sender_id, receiver_id) = LEAST($1::int, $2::int)
+			AND GREATEST(sender_id, receiver_id) = GREATEST($1::int, $2::int)
+		FOR UPDATE`, actorID, otherID,
+	).Scan(&fs.ID, &fs.SenderID, &fs.ReceiverID, &fs.CreatedAt, &fs.UpdatedAt, &fs.Status, &fs.Version)
+	switch {
+	case err == nil:
+		current = &fs
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	if requestID != 0 && (current == nil || current.ID != requestID) {
+		return nil, ErrNoSuchRequest
+	}
+
+	from := friendshipState(current, actorID)
+	to, err := nextFriendshipState(from, event)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &FriendshipChange{Event: event, From: from, To: to, OtherID: otherID, Friendship: current}
+	if from == to {
+		return change, nil
+	}
+
+	if event == FriendshipRequest && from == StateNone && cooldown > 0 {
+		var declined bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM friendship_events
+				WHERE actor_id = $1 AND subject_id = $2 AND event = 'decline'
+					AND created_at > NOW() - $3 * INTERVAL '1 second'
+			)`, otherID, actorID, cooldown.Seconds(),
+		).Scan(&declined)
+		if err != nil {
+			return nil, err
+		}
+		if declined {
+			return nil, ErrFriendRequestCooldown
+		}
+	}
+
+	returning := `RETURNING id, sender_id, receiver_id, created_at, updated_at, status, version`
+	next := Friendship{}
+	scan := []any{&next.ID, &next.SenderID, &next.ReceiverID, &next.CreatedAt, &next.UpdatedAt, &next.Status, &next.Version}
+
+	switch to {
+	case StateNone:
+		_, err = tx.ExecContext(ctx, `DELETE FROM friendships WHERE id = $1`, current.ID)
+	case StateRequestSent:
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO friendships (sender_id, receiver_id, status)
+			VALUES ($1, $2, 'pending') `+returning, actorID, otherID,
+		).Scan(scan...)
+	case StateFriends:
+		err = tx.QueryRowContext(ctx, `
+			UPDATE friendships SET status = 'accepted'
+			WHERE id = $1 `+returning, current.ID,
+		).Scan(scan...)
+	case StateBlocking:
+		if current == nil {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO friendships (sender_id, receiver_id, status)
+				VALUES ($1, $2, 'blocked') `+returning, otherID, actorID,
+			).Scan(scan...)
+		} else {
+			err = tx.QueryRowContext(ctx, `
+				UPDATE friendships SET sender_id = $2, receiver_id = $3, status = 'blocked'
+				WHERE id = $1 `+returning, current.ID, otherID, actorID,
+			).Scan(scan...)
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+				DELETE FROM follows
+				WHERE (follower_id = $1 AND followee_id = $2)
+					OR (follower_id = $2 AND followee_id = $1)`, actorID, otherID)
+		}
+	}
+	if err == nil && from == StateFriends {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM close_friends
+			WHERE (user_id = $1 AND friend_id = $2)
+				OR (user_id = $2 AND friend_id = $1)`, actorID, otherID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if to != StateNone {
+		change.Friendship = &next
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO friendship_events (friendship_id, actor_id, subject_id, event, from_status, to_status)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		change.Friendship.ID, actorID, otherID, event, from.status(), to.status(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	friendship, err := json.Marshal(change.Friendship)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordEvent(ctx, tx, outbox.FriendshipChanged, actorID, outbox.Friendship{
+		ActorID:    actorID,
+		OtherID:    otherID,
+		Event:      string(event),
+		From:       string(from),
+		To:         string(to),
+		Friendship: friendship,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// History returns the transitions of the friendship between userID and
+// otherID, most recent first.
+func (m FriendshipModel) History(userID, otherID int64, pagination Pagination) ([]FriendshipTransition, PageInfo, error) {
+	args := []any{userID, otherID}
+	where, orderBy, limit, args := pagination.clauses("created_at", "id", true, "created_at DESC, id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT id, actor_id, subject_id, event, from_status, to_status, created_at
+		FROM friendship_events
+		WHERE LEAST(actor_id, subject_id) = LEAST($1::int, $2::int)
+			AND GREATEST(actor_id, subject_id) = GREATEST($1::int, $2::int)
+			AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		transitions []FriendshipTransition
+		keys        []Cursor
+	)
+	for rows.Next() {
+		var t FriendshipTransition
+		err := rows.Scan(&t.ID, &t.ActorID, &t.SubjectID, &t.Event, &t.FromStatus, &t.ToStatus, &t.CreatedAt)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		transitions = append(transitions, t)
+		keys = append(keys, Cursor{CreatedAt: t.CreatedAt, ID: t.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	transitions, info := paginate(transitions, keys, pagination)
+	return transitions, info, nil
+}
+
+// Blocked returns the users blocked by userID, most recently blocked first.
+func (m FriendshipModel) Blocked(userID int64, pagination Pagination) ([]UserPublic, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("f.updated_at", "f.id", true, "f.updated_at DESC, f.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, f.updated_at, f.id
+		FROM friendships f
+		JOIN users u ON u.id = f.sender_id
+		WHERE f.receiver_id = $1 AND f.status = 'blocked' AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		users []UserPublic
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var (
+			u   UserPublic
+			key Cursor
+		)
+		if err := rows.Scan(&u.ID, &u.Username, &key.CreatedAt, &key.ID); err != nil {
+			return nil, PageInfo{}, err
+		}
+		users = append(users, u)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	users, info := paginate(users, keys, pagination)
+	return users, info, nil
+}
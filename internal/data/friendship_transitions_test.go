@@ -0,0 +1,56 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextFriendshipState(t *testing.T) {
+	tests := []struct {
+		state FriendshipState
+		event FriendshipEvent
+		want  FriendshipState
+		err   error
+	}{
+		{StateNone, FriendshipRequest, StateRequestSent, nil},
+		{StateNone, FriendshipAccept, StateNone, ErrInvalidFriendshipTransition},
+		{StateRequestSent, FriendshipRequest, StateRequestSent, ErrFriendRequestAlreadyExists},
+		{StateRequestSent, FriendshipCancel, StateNone, nil},
+		{StateRequestSent, FriendshipAccept, StateRequestSent, ErrInvalidFriendshipTransition},
+		{StateRequestReceived, FriendshipRequest, StateFriends, nil},
+		{StateRequestReceived, FriendshipAccept, StateFriends, nil},
+		{StateRequestReceived, FriendshipDecline, StateNone, nil},
+		{StateRequestReceived, FriendshipCancel, StateRequestReceived, ErrInvalidFriendshipTransition},
+		{StateFriends, FriendshipRequest, StateFriends, ErrAlreadyFriends},
+		{StateFriends, FriendshipUnfriend, StateNone, nil},
+		{StateFriends, FriendshipBlock, StateBlocking, nil},
+		{StateBlocking, FriendshipBlock, StateBlocking, nil},
+		{StateBlocking, FriendshipRequest, StateBlocking, ErrInvalidFriendshipTransition},
+		{StateBlocking, FriendshipUnblock, StateNone, nil},
+		{StateBlockedBy, FriendshipRequest, StateBlockedBy, ErrFriendshipBlocked},
+		{StateBlockedBy, FriendshipBlock, StateBlockedBy, ErrFriendshipBlocked},
+	}
+
+	for _, tt := range tests {
+		got, err := nextFriendshipState(tt.state, tt.event)
+		assert.ErrorIs(t, err, tt.err, "%s from %s", tt.event, tt.state)
+		assert.Equal(t, tt.want, got, "%s from %s", tt.event, tt.state)
+	}
+}
+
+func TestFriendshipState(t *testing.T) {
+	pending := &Friendship{SenderID: 1, ReceiverID: 2, Status: StatusPending}
+	blocked := &Friendship{SenderID: 1, ReceiverID: 2, Status: StatusBlocked}
+
+	assert.Equal(t, StateNone, friendshipState(nil, 1))
+	assert.Equal(t, StateRequestSent, friendshipState(pending, 1))
+	assert.Equal(t, StateRequestReceived, friendshipState(pending, 2))
+	assert.Equal(t, StateBlockedBy, friendshipState(blocked, 1))
+	assert.Equal(t, StateBlocking, friendshipState(blocked, 2))
+}
+
+func TestFriendshipLockKey(t *testing.T) {
+	assert.Equal(t, friendshipLockKey(3, 7), friendshipLockKey(7, 3))
+	assert.NotEqual(t, friendshipLockKey(3, 7), friendshipLockKey(3, 8))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -45,12 +46,16 @@ type FriendshipModel struct {
 	DB *sql.DB
 }
 
+// GetFriends lists userID's accepted friends, most recent friendships first.
 func (m FriendshipModel) GetFriends(
 	userID int64,
 	pagination Pagination,
-) ([]UserPublic, error) {
-	query := `
-		SELECT u.id, u.username
+) ([]UserPublic, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("f.created_at", "f.id", true, "f.created_at DESC, f.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, f.created_at, f.id
 		FROM friendships f
 		JOIN users u ON u.id =
 			CASE
@@ -59,127 +64,42 @@ func (m FriendshipModel) GetFriends(
 			END
 		WHERE (f.sender_id = $1 OR f.receiver_id = $1)
 			AND f.status = 'accepted'
-		LIMIT $2 OFFSET $3
-	`
+			AND %s
+		ORDER BY %s
+		%s
+	`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var friends []UserPublic
+	var (
+		friends []UserPublic
+		keys    []Cursor
+	)
 	for rows.Next() {
-		var f UserPublic
-		if err := rows.Scan(&f.ID, &f.Username); err != nil {
-			return nil, err
-
+		var (
+			f   UserPublic
+			key Cursor
+		)
+		if err := rows.Scan(&f.ID, &f.Username, &key.CreatedAt, &key.ID); err != nil {
+			return nil, PageInfo{}, err
 		}
 		friends = append(friends, f)
+		keys = append(keys, key)
 	}
 
-	return friends, nil
-}
-
-func (m FriendshipModel) SendRequest(fs *Friendship) error {
-	if fs.SenderID == fs.ReceiverID {
-		return ErrFriendshipRequestToSelf
-	}
-
-	query := `
-		INSERT INTO friendships (sender_id, receiver_id)
-		VALUES ($1, $2)
-		ON CONFLICT (sender_id, receiver_id) DO NOTHING
-		RETURNING created_at, status
-	`
-
-	args := []any{fs.SenderID, fs.ReceiverID}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&fs.CreatedAt, &fs.Status)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrFriendRequestAlreadyExists
-		}
-		return err
-	}
-
-	return nil
-}
-
-func (m FriendshipModel) DeleteRequest(requestID, userID int64, operation string) (int, error) {
-	var query string
-	if operation == "reject" {
-		query = `
-		DELETE FROM friendships
-		WHERE id = $1
-		  AND receiver_id = $2
-		  AND status = 'pending';
-		`
-	} else {
-		query = `
-		DELETE FROM friendships
-		WHERE id = $1
-		  AND sender_id = $2
-		  AND status = 'pending';
-		`
-	}
-
-	args := []any{requestID, userID}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-
-	if rowsAffected > 0 {
-		return 1, nil
-	}
-	return 0, nil
-}
-
-func (m FriendshipModel) Unfriend(requestID, userID int64) (int, error) {
-	query := `
-		DELETE FROM friendships
-		WHERE id = $1
-			AND status = 'accepted'
-			AND ($2 = sender_id OR $2 = receiver_id);
-	`
-
-	args := []any{requestID, userID}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return 0, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
 	}
 
-	if rowsAffected > 0 {
-		return 1, nil
-	}
-	return 0, nil
+	friends, info := paginate(friends, keys, pagination)
+	return friends, info, nil
 }
 
 func (m FriendshipModel) GetFriendship(userID, friendID int64) (*Friendship, error) {
@@ -268,116 +188,132 @@ func (m FriendshipModel) GetFriendshipStatus(userID, friendID int64) (string, er
 	return status, nil
 }
 
-func (m FriendshipModel) PatchFriendship(fs *Friendship) (*Friendship, error) {
-	query := `
-		UPDATE friendships
-		SET status = $1, updated_at = $3
-		WHERE id = $2 AND receiver_id = $4
-		RETURNING sender_id, updated_at, created_at
-	`
-	args := []any{
-		fs.Status,
-		fs.ID,
-		time.Now(),
-		fs.ReceiverID,
-	}
-
-	patched := *fs
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
-		&patched.SenderID,
-		&patched.UpdatedAt,
-		&patched.CreatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrNoSuchRequest
-		}
-		return nil, err
-	}
-
-	return &patched, nil
-
-}
-
 func (m FriendshipModel) GetSentPendingRequests(
 	senderID int64,
 	pagination Pagination,
-) ([]Friendship, error) {
-	query := `
+) ([]Friendship, PageInfo, error) {
+	args := []any{senderID}
+	where, orderBy, limit, args := pagination.clauses("created_at", "id", true, "created_at DESC, id DESC", args)
+
+	query := fmt.Sprintf(`
 		SELECT id, sender_id, receiver_id, created_at, status
 		FROM friendships
-		WHERE sender_id = $1 AND status = 'pending'
-		LIMIT $2 OFFSET $3`
+		WHERE sender_id = $1 AND status = 'pending' AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{senderID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var requests []Friendship
+	var (
+		requests []Friendship
+		keys     []Cursor
+	)
 	for rows.Next() {
 		var f Friendship
 
 		err = rows.Scan(&f.ID, &f.SenderID, &f.ReceiverID, &f.CreatedAt, &f.Status)
 		if err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
 
 		requests = append(requests, f)
+		keys = append(keys, Cursor{CreatedAt: f.CreatedAt, ID: f.ID})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	return requests, nil
+	requests, info := paginate(requests, keys, pagination)
+	return requests, info, nil
 }
 
 func (m FriendshipModel) GetReceivedPendingRequests(
 	receiverID int64,
 	pagination Pagination,
-) ([]Friendship, error) {
-	query := `
+) ([]Friendship, PageInfo, error) {
+	args := []any{receiverID}
+	where, orderBy, limit, args := pagination.clauses("created_at", "id", true, "created_at DESC, id DESC", args)
+
+	query := fmt.Sprintf(`
 		SELECT id, sender_id, receiver_id, created_at, status
 		FROM friendships
-		WHERE receiver_id = $1 AND status = 'pending'
-		LIMIT $2 OFFSET $3`
+		WHERE receiver_id = $1 AND status = 'pending' AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{receiverID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var requests []Friendship
+	var (
+		requests []Friendship
+		keys     []Cursor
+	)
 	for rows.Next() {
 		var f Friendship
 
 		err = rows.Scan(&f.ID, &f.SenderID, &f.ReceiverID, &f.CreatedAt, &f.Status)
 		if err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
 
 		requests = append(requests, f)
+		keys = append(keys, Cursor{CreatedAt: f.CreatedAt, ID: f.ID})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
+	}
+
+	requests, info := paginate(requests, keys, pagination)
+	return requests, info, nil
+}
+
+// EachFriend calls fn with the username of every friend of userID and when
+// their friendship was accepted, oldest first. It stops at the first error fn
+// returns.
+func (m FriendshipModel) EachFriend(userID int64, fn func(username string, since time.Time) error) error {
+	query := `
+		SELECT u.username, f.updated_at
+		FROM friendships f
+		JOIN users u ON u.id = CASE WHEN f.sender_id = $1 THEN f.receiver_id ELSE f.sender_id END
+		WHERE f.status = 'accepted' AND $1 IN (f.sender_id, f.receiver_id)
+		ORDER BY f.updated_at, f.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			username string
+			since    time.Time
+		)
+		if err := rows.Scan(&username, &since); err != nil {
+			return err
+		}
+		if err := fn(username, since); err != nil {
+			return err
+		}
 	}
 
-	return requests, nil
+	return rows.Err()
 }
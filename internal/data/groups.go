@@ -0,0 +1,530 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+)
+
+var (
+	ErrNotGroup         = errors.New("conversation is not a group")
+	ErrInsufficientRole = errors.New("your role in this conversation doesn't allow this")
+	ErrGroupFull        = errors.New("group has reached its maximum number of members")
+	ErrInvalidRole      = errors.New("invalid conversation role")
+	ErrBlockedMember    = errors.New("user is involved in a block with a member of the group")
+)
+
+// ConversationRole is a member's role in a group. Members of one-to-one
+// conversations are plain members.
+type ConversationRole string
+
+const (
+	RoleOwner  ConversationRole = "owner"  // Manages admins. Every group has exactly one.
+	RoleAdmin  ConversationRole = "admin"  // Adds and removes members, and edits the group.
+	RoleMember ConversationRole = "member" // Sends messages.
+)
+
+func (r ConversationRole) rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// CanManage reports whether a member with role r may remove a member with
+// role target: only admins and the owner can, and only members ranking
+// below them.
+func (r ConversationRole) CanManage(target ConversationRole) bool {
+	return r.rank() >= RoleAdmin.rank() && r.rank() > target.rank()
+}
+
+// ConversationMember is a member of a conversation.
+type ConversationMember struct {
+	ID       int64            `json:"id"`
+	Username string           `json:"username"`
+	Role     ConversationRole `json:"role"`
+	JoinedAt time.Time        `json:"joined_at"`
+}
+
+// lockGroup locks group id for a membership change by actorID, so that
+// concurrent changes to the same group apply one after the other. Returns the
+// actor's role, ErrRecordNotFound if they aren't a member, or ErrNotGroup for
+// one-to-one conversations.
+func lockGroup(ctx context.Context, tx *sql.Tx, id, actorID int64) (ConversationRole, error) {
+	var (
+		direct bool
+		role   sql.NullString
+	)
+	err := tx.QueryRowContext(ctx, `
+		SELECT c.direct_key IS NOT NULL, me.role
+		FROM conversations c
+		LEFT JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $2
+		WHERE c.id = $1
+		FOR UPDATE OF c`,
+		id, actorID,
+	).Scan(&direct, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	switch {
+	case !role.Valid:
+		return "", ErrRecordNotFound
+	case direct:
+		return "", ErrNotGroup
+	}
+
+	return ConversationRole(role.String), nil
+}
+
+// memberRole returns userID's role in conversation id, or ErrRecordNotFound
+// if they aren't a member.
+func memberRole(ctx context.Context, tx *sql.Tx, id, userID int64) (ConversationRole, error) {
+	var role ConversationRole
+	err := tx.QueryRowContext(ctx, `
+		SELECT role
+		FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2`,
+		id, userID,
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrRecordNotFound
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+// systemMessage records a change made to group id by actorID.
+func systemMessage(ctx context.Context, tx *sql.Tx, id, actorID int64, event string, targetID *int64) (Message, error) {
+	msg := Message{
+		ConversationID: id,
+		SenderID:       actorID,
+		Kind:           MessageSystem,
+		Body:           event,
+		TargetID:       targetID,
+	}
+
+	err := insertMessage(ctx, tx, &msg)
+	return msg, err
+}
+
+// addMembers adds userIDs to group id as plain members, recording a system
+// message for each user who wasn't a member yet.
+func addMembers(ctx context.Context, tx *sql.Tx, id, actorID int64, userIDs []int64, maxMembers int) ([]Message, error) {
+	var messages []Message
+
+	for _, userID := range userIDs {
+		var blocked bool
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`
+			SELECT EXISTS (
+				SELECT 1 FROM conversation_members cm
+				WHERE cm.conversation_id = $1 AND NOT %s
+			)`, notBlocked("cm.user_id", "$2::int")),
+			id, userID,
+		).Scan(&blocked)
+		if err != nil {
+			return nil, err
+		}
+
+		if blocked {
+			return nil, ErrBlockedMember
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO conversation_members (conversation_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (conversation_id, user_id) DO NOTHING`,
+			id, userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		added, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if added == 0 {
+			continue
+		}
+
+		msg, err := systemMessage(ctx, tx, id, actorID, SystemMemberAdded, &userID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM conversation_members WHERE conversation_id = $1`, id).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > maxMembers {
+		return nil, ErrGroupFull
+	}
+
+	return messages, nil
+}
+
+// CreateGroup creates a group owned by ownerID with memberIDs as its first
+// members. Returns the id of the group and the system messages recording its
+// creation.
+func (m ConversationModel) CreateGroup(ownerID int64, title string, shareHistory bool, memberIDs []int64, maxMembers int) (int64, []Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO conversations (title, share_history)
+		VALUES ($1, $2)
+		RETURNING id`,
+		title, shareHistory,
+	).Scan(&id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO conversation_members (conversation_id, user_id, role)
+		VALUES ($1, $2, $3)`,
+		id, ownerID, RoleOwner,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	created, err := systemMessage(ctx, tx, id, ownerID, SystemGroupCreated, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	added, err := addMembers(ctx, tx, id, ownerID, memberIDs, maxMembers)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	return id, append([]Message{created}, added...), nil
+}
+
+// AddMembers adds userIDs to group id on behalf of actorID, who must be an
+// admin or its owner. Users who already are members are skipped. Returns the
+// system messages recording the additions.
+func (m ConversationModel) AddMembers(id, actorID int64, userIDs []int64, maxMembers int) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role, err := lockGroup(ctx, tx, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.rank() < RoleAdmin.rank() {
+		return nil, ErrInsufficientRole
+	}
+
+	messages, err := addMembers(ctx, tx, id, actorID, userIDs, maxMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, tx.Commit()
+}
+
+// RemoveMember removes userID from group id on behalf of actorID. Members
+// may always leave; removing someone else requires outranking them. When the
+// owner leaves, ownership passes to the longest standing admin, or member if
+// there are no admins. Returns the system messages recording the change.
+func (m ConversationModel) RemoveMember(id, actorID, userID int64) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role, err := lockGroup(ctx, tx, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []Message
+
+	if userID == actorID {
+		if role == RoleOwner {
+			var successorID int64
+			err := tx.QueryRowContext(ctx, `
+				UPDATE conversation_members
+				SET role = 'owner'
+				WHERE conversation_id = $1 AND user_id = (
+					SELECT user_id FROM conversation_members
+					WHERE conversation_id = $1 AND user_id <> $2
+					ORDER BY role = 'admin' DESC, joined_at, user_id
+					LIMIT 1
+				)
+				RETURNING user_id`,
+				id, actorID,
+			).Scan(&successorID)
+
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				// The owner was the last member.
+			case err != nil:
+				return nil, err
+			default:
+				msg, err := systemMessage(ctx, tx, id, actorID, SystemOwnershipTransferred, &successorID)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, msg)
+			}
+		}
+	} else {
+		target, err := memberRole(ctx, tx, id, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !role.CanManage(target) {
+			return nil, ErrInsufficientRole
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2`,
+		id, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	event := SystemMemberRemoved
+	if userID == actorID {
+		event = SystemMemberLeft
+	}
+
+	msg, err := systemMessage(ctx, tx, id, actorID, event, &userID)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, msg)
+
+	return messages, tx.Commit()
+}
+
+// SetRole changes userID's role in group id on behalf of actorID, who must be
+// its owner. Making someone the owner transfers ownership, leaving actorID an
+// admin. Returns the system messages recording the change, if any.
+func (m ConversationModel) SetRole(id, actorID, userID int64, role ConversationRole) ([]Message, error) {
+	if role.rank() == 0 {
+		return nil, ErrInvalidRole
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	actorRole, err := lockGroup(ctx, tx, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actorRole != RoleOwner || userID == actorID {
+		return nil, ErrInsufficientRole
+	}
+
+	current, err := memberRole(ctx, tx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == role {
+		return nil, tx.Commit()
+	}
+
+	var event string
+	switch role {
+	case RoleOwner:
+		event = SystemOwnershipTransferred
+	case RoleAdmin:
+		event = SystemAdminGranted
+	default:
+		event = SystemAdminRevoked
+	}
+
+	setRole := `
+		UPDATE conversation_members
+		SET role = $3
+		WHERE conversation_id = $1 AND user_id = $2`
+
+	if role == RoleOwner {
+		if _, err := tx.ExecContext(ctx, setRole, id, actorID, RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, setRole, id, userID, role); err != nil {
+		return nil, err
+	}
+
+	msg, err := systemMessage(ctx, tx, id, actorID, event, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Message{msg}, tx.Commit()
+}
+
+// UpdateGroup changes the title and history sharing of group id on behalf of
+// actorID, who must be an admin or its owner. Nil fields are left unchanged.
+// Returns the system message recording the change.
+func (m ConversationModel) UpdateGroup(id, actorID int64, title *string, shareHistory *bool) ([]Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role, err := lockGroup(ctx, tx, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.rank() < RoleAdmin.rank() {
+		return nil, ErrInsufficientRole
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversations
+		SET title = COALESCE($2, title), share_history = COALESCE($3, share_history)
+		WHERE id = $1`,
+		id, title, shareHistory,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := systemMessage(ctx, tx, id, actorID, SystemGroupUpdated, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Message{msg}, tx.Commit()
+}
+
+// Members returns the members of conversation id, owner first, then admins,
+// then members, each by join date. Returns ErrRecordNotFound if viewerID
+// isn't a member.
+func (m ConversationModel) Members(id, viewerID int64) ([]ConversationMember, error) {
+	query := `
+		SELECT u.id, u.username, cm.role, cm.joined_at
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = $1
+			AND EXISTS (
+				SELECT 1 FROM conversation_members me
+				WHERE me.conversation_id = $1 AND me.user_id = $2
+			)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []ConversationMember
+	for rows.Next() {
+		var member ConversationMember
+		if err := rows.Scan(&member.ID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(members) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	sortMembers(members)
+	return members, nil
+}
+
+// sortMembers orders members by descending role, then by join date.
+func sortMembers(members []ConversationMember) {
+	slices.SortStableFunc(members, func(a, b ConversationMember) int {
+		if c := cmp.Compare(b.Role.rank(), a.Role.rank()); c != 0 {
+			return c
+		}
+		if c := a.JoinedAt.Compare(b.JoinedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func ValidateGroupTitle(v *validator.Validator, title string) {
+	v.Check(strings.TrimSpace(title) != "", "title", "must be provided")
+	v.Check(utf8.RuneCountInString(title) <= 100, "title", "must be no more than 100 characters long")
+}
+
+func ValidateGroup(v *validator.Validator, title string, memberIDs []int64, maxMembers int) {
+	ValidateGroupTitle(v, title)
+	v.Check(len(memberIDs) > 0, "user_ids", "must contain at least one user")
+	v.Check(len(memberIDs) < maxMembers, "user_ids", fmt.Sprintf("must contain fewer than %d users", maxMembers))
+}
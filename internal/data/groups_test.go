@@ -0,0 +1,37 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversationRoleCanManage(t *testing.T) {
+	assert.True(t, RoleOwner.CanManage(RoleAdmin))
+	assert.True(t, RoleOwner.CanManage(RoleMember))
+	assert.True(t, RoleAdmin.CanManage(RoleMember))
+	assert.False(t, RoleAdmin.CanManage(RoleAdmin))
+	assert.False(t, RoleAdmin.CanManage(RoleOwner))
+	assert.False(t, RoleMember.CanManage(RoleMember))
+	assert.False(t, ConversationRole("").CanManage(RoleMember))
+}
+
+func TestSortMembers(t *testing.T) {
+	now := time.Now()
+	members := []ConversationMember{
+		{ID: 1, Role: RoleMember, JoinedAt: now},
+		{ID: 2, Role: RoleAdmin, JoinedAt: now.Add(time.Minute)},
+		{ID: 3, Role: RoleOwner, JoinedAt: now.Add(time.Hour)},
+		{ID: 4, Role: RoleAdmin, JoinedAt: now},
+		{ID: 5, Role: RoleMember, JoinedAt: now},
+	}
+
+	sortMembers(members)
+
+	var ids []int64
+	for _, m := range members {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []int64{3, 4, 2, 1, 5}, ids)
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/jobs"
+)
+
+var (
+	ErrJobNotRetryable = errors.New("only pending and dead jobs can be retried")
+)
+
+// JobModel inspects and manages the background jobs queue for
+// administrators. Jobs are enqueued and run through the jobs package.
+type JobModel struct {
+	DB *sql.DB
+}
+
+// JobFilter narrows down listed jobs. Empty fields match every job.
+type JobFilter struct {
+	State jobs.State
+	Kind  string
+	Queue string
+}
+
+const jobColumns = `j.id, j.queue, j.kind, j.payload, j.state, j.attempts, j.max_attempts, j.run_at, j.last_error,
+	j.unique_key, j.locked_by, j.created_at, j.started_at, j.finished_at`
+
+func scanJob(row interface{ Scan(...any) error }, j *jobs.Job) error {
+	return row.Scan(
+		&j.ID,
+		&j.Queue,
+		&j.Kind,
+		(*[]byte)(&j.Payload),
+		&j.State,
+		&j.Attempts,
+		&j.MaxAttempts,
+		&j.RunAt,
+		&j.LastError,
+		&j.UniqueKey,
+		&j.LockedBy,
+		&j.CreatedAt,
+		&j.StartedAt,
+		&j.FinishedAt,
+	)
+}
+
+// List returns the jobs matching filter, newest first.
+func (m JobModel) List(filter JobFilter, pagination Pagination) ([]jobs.Job, PageInfo, error) {
+	args := []any{filter.State, filter.Kind, filter.Queue}
+	where, orderBy, limit, args := pagination.clauses("j.created_at", "j.id", true, "j.created_at DESC, j.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM jobs j
+		WHERE ($1 = '' OR j.state = $1)
+			AND ($2 = '' OR j.kind = $2)
+			AND ($3 = '' OR j.queue = $3)
+			AND %s
+		ORDER BY %s
+		%s`, jobColumns, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		list []jobs.Job
+		keys []Cursor
+	)
+	for rows.Next() {
+		var j jobs.Job
+		if err := scanJob(rows, &j); err != nil {
+			return nil, PageInfo{}, err
+		}
+		list = append(list, j)
+		keys = append(keys, Cursor{CreatedAt: j.CreatedAt, ID: j.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	list, info := paginate(list, keys, pagination)
+	return list, info, nil
+}
+
+// Get returns job id.
+func (m JobModel) Get(id int64) (*jobs.Job, error) {
+	query := fmt.Sprintf(`SELECT %s FROM jobs j WHERE j.id = $1`, jobColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var j jobs.Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &j)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// Retry makes job id due right away. A dead job gets a fresh set of
+// attempts; its last error is kept until it runs again. Running and
+// succeeded jobs can't be retried and fail with ErrJobNotRetryable.
+func (m JobModel) Retry(id int64) (*jobs.Job, error) {
+	query := fmt.Sprintf(`
+		UPDATE jobs j
+		SET state = 'pending',
+			run_at = NOW(),
+			attempts = CASE WHEN j.state = 'dead' THEN 0 ELSE j.attempts END,
+			finished_at = NULL
+		WHERE j.id = $1 AND j.state IN ('pending', 'dead')
+		RETURNING %s`, jobColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var j jobs.Job
+	err := scanJob(m.DB.QueryRowContext(ctx, query, id), &j)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		if _, err := m.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotRetryable
+	}
+
+	return &j, nil
+}
+
+// Prune deletes the jobs which succeeded before before.
+func (m JobModel) Prune(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM jobs
+		WHERE state = 'succeeded' AND finished_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -3,7 +3,6 @@ package data
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -21,65 +20,35 @@ type LikePublic struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// LikeModel keeps the original likes API working on top of reactions.
+// A like is a reaction of type LikeReaction.
 type LikeModel struct {
 	DB *sql.DB
 }
 
-func (m *LikeModel) Like(userID, postID int64) (*Like, error) {
-	query := `
-		INSERT INTO likes (user_id, post_id)
-		VALUES ($1, $2)
-		ON CONFLICT (user_id, post_id) DO NOTHING
-		RETURNING id, created_at
-	`
-
-	args := []any{userID, postID}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// Like records userID liking postID. When exclusive is set, any other
+// reaction the user left on the post is replaced by the like.
+// A nil like is returned if the post was already liked.
+func (m *LikeModel) Like(userID, postID int64, exclusive bool) (*Like, error) {
+	reaction, err := ReactionModel{DB: m.DB}.React(userID, postID, LikeReaction, exclusive)
+	if err != nil || reaction == nil {
+		return nil, err
+	}
 
 	like := Like{
-		UserID: userID,
-		PostID: postID,
-	}
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&like.ID, &like.CreatedAt)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, nil
-		}
-		return nil, err
+		ID:        reaction.ID,
+		UserID:    reaction.UserID,
+		PostID:    reaction.PostID,
+		CreatedAt: reaction.CreatedAt,
 	}
 
 	return &like, nil
 }
 
+// Dislike removes userID's like from postID. Returns sql.ErrNoRows if the
+// post wasn't liked.
 func (m *LikeModel) Dislike(userID, postID int64) error {
-	query := `
-		DELETE FROM likes
-		WHERE user_id = $1 AND post_id = $2
-	`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	args := []any{userID, postID}
-
-	res, err := m.DB.ExecContext(ctx, query, args...)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
-
-	return nil
+	return ReactionModel{DB: m.DB}.Unreact(userID, postID, LikeReaction)
 }
 
 func (m *LikeModel) IsLikedBy(userID, postID int64) (bool, error) {
@@ -87,15 +56,15 @@ func (m *LikeModel) IsLikedBy(userID, postID int64) (bool, error) {
 	query := `
 	SELECT EXISTS (
 		SELECT 1
-		FROM likes
-		WHERE user_id = $1 AND post_id = $2
+		FROM reactions
+		WHERE user_id = $1 AND post_id = $2 AND reaction = $3
 	) as has_liked;
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, postID}
+	args := []any{userID, postID, LikeReaction}
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&hasLiked)
 	if err != nil {
@@ -108,64 +77,78 @@ func (m *LikeModel) IsLikedBy(userID, postID int64) (bool, error) {
 func (m *LikeModel) ListLikesFromPost(
 	postID int64,
 	pagination Pagination,
-) ([]LikePublic, error) {
-	var sortColumn string
+) ([]LikePublic, PageInfo, error) {
+	var desc bool
 	switch strings.ToLower(pagination.Sort) {
 	case "asc", "oldest", "old":
-		sortColumn = "created_at ASC"
+		desc = false
 	case "desc", "newest", "new":
-		sortColumn = "created_at DESC"
+		desc = true
 	default:
-		sortColumn = "created_at DESC"
+		desc = true
+	}
+
+	offsetOrder := "created_at DESC"
+	if !desc {
+		offsetOrder = "created_at ASC"
 	}
 
+	args := []any{postID, LikeReaction}
+	where, orderBy, limit, args := pagination.clauses("created_at", "id", desc, offsetOrder, args)
+
 	query := fmt.Sprintf(`
-		SELECT user_id, created_at
-		FROM likes
-		WHERE post_id = $1
+		SELECT id, user_id, created_at
+		FROM reactions
+		WHERE post_id = $1 AND reaction = $2 AND %s
 		ORDER BY %s
-		LIMIT $2 OFFSET $3
-	`, sortColumn)
+		%s
+	`, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{postID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var likes []LikePublic
+	var (
+		likes []LikePublic
+		keys  []Cursor
+	)
 	for rows.Next() {
-		var l LikePublic
-		if err := rows.Scan(&l.UserID, &l.CreatedAt); err != nil {
-			return nil, err
+		var (
+			l  LikePublic
+			id int64
+		)
+		if err := rows.Scan(&id, &l.UserID, &l.CreatedAt); err != nil {
+			return nil, PageInfo{}, err
 		}
 		likes = append(likes, l)
+		keys = append(keys, Cursor{CreatedAt: l.CreatedAt, ID: id})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	return likes, err
+	likes, info := paginate(likes, keys, pagination)
+	return likes, info, nil
 }
 
 func (m *LikeModel) CountLikes(postID int64) (int, error) {
 	query := `
 		SELECT COUNT(*)
-		FROM likes
-		WHERE post_id = $1
+		FROM reactions
+		WHERE post_id = $1 AND reaction = $2
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var count int
-	err := m.DB.QueryRowContext(ctx, query, postID).Scan(&count)
+	err := m.DB.QueryRowContext(ctx, query, postID, LikeReaction).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,492 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+)
+
+var (
+	ErrListFull          = errors.New("list has reached its maximum number of members")
+	ErrBlockedListMember = errors.New("user is involved in a block with the list owner")
+	ErrSubscribeOwnList  = errors.New("cannot subscribe to your own list")
+)
+
+// List is a user-curated list of accounts. Its timeline gathers the posts of
+// its members. Private lists are only visible to their owner, while public
+// ones can be subscribed to by anyone.
+type List struct {
+	ID               int64     `json:"id"`
+	OwnerID          int64     `json:"owner_id"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	Private          bool      `json:"private"`
+	MembersCount     int       `json:"members_count"`
+	SubscribersCount int       `json:"subscribers_count"`
+	Subscribed       bool      `json:"subscribed"` // Whether the viewer subscribes to the list.
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(list.Name) <= 50, "name", "must be no more than 50 characters long")
+	v.Check(utf8.RuneCountInString(list.Description) <= 280, "description", "must be no more than 280 characters long")
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+// listVisibleTo returns a SQL predicate that holds when the list aliased as
+// alias can be seen by the viewer bound to the placeholder viewer.
+func listVisibleTo(alias, viewer string) string {
+	return fmt.Sprintf("(NOT %[1]s.private OR %[1]s.owner_id = %[2]s)", alias, viewer)
+}
+
+// listColumns returns the columns scanned by scanList for the list aliased
+// as alias, as seen by the viewer bound to the placeholder viewer.
+func listColumns(alias, viewer string) string {
+	return fmt.Sprintf(`%[1]s.id, %[1]s.owner_id, %[1]s.name, %[1]s.description, %[1]s.private,
+			(SELECT COUNT(*) FROM list_members lm WHERE lm.list_id = %[1]s.id),
+			(SELECT COUNT(*) FROM list_subscriptions ls WHERE ls.list_id = %[1]s.id),
+			EXISTS (
+				SELECT 1 FROM list_subscriptions ls
+				WHERE ls.list_id = %[1]s.id AND ls.user_id = %[2]s
+			),
+			%[1]s.created_at, %[1]s.updated_at`, alias, viewer)
+}
+
+func scanList(row interface{ Scan(...any) error }, list *List) error {
+	return row.Scan(
+		&list.ID,
+		&list.OwnerID,
+		&list.Name,
+		&list.Description,
+		&list.Private,
+		&list.MembersCount,
+		&list.SubscribersCount,
+		&list.Subscribed,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+	)
+}
+
+// Insert creates list, setting its ID and timestamps.
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (owner_id, name, description, private)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{list.OwnerID, list.Name, list.Description, list.Private}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt)
+}
+
+// Get returns list id as seen by viewerID, or ErrRecordNotFound if it
+// doesn't exist or is someone else's private list.
+func (m ListModel) Get(id, viewerID int64) (*List, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM lists l
+		WHERE l.id = $1 AND %s`, listColumns("l", "$2"), listVisibleTo("l", "$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list List
+	err := scanList(m.DB.QueryRowContext(ctx, query, id, viewerID), &list)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// Update saves the name, description and privacy of list, which must belong
+// to list.OwnerID. Making a list private drops its subscriptions. Returns
+// ErrRecordNotFound if the owner has no such list.
+func (m ListModel) Update(list *List) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE lists
+		SET name = $3, description = $4, private = $5, updated_at = NOW()
+		WHERE id = $1 AND owner_id = $2
+		RETURNING updated_at`,
+		list.ID, list.OwnerID, list.Name, list.Description, list.Private,
+	).Scan(&list.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if list.Private {
+		_, err = tx.ExecContext(ctx, `DELETE FROM list_subscriptions WHERE list_id = $1`, list.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes list id of ownerID, along with its members and
+// subscriptions. Returns ErrRecordNotFound if the owner has no such list.
+func (m ListModel) Delete(id, ownerID int64) error {
+	query := `DELETE FROM lists WHERE id = $1 AND owner_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, ownerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ForOwner returns the lists of ownerID that viewerID can see, newest first.
+func (m ListModel) ForOwner(ownerID, viewerID int64, pagination Pagination) ([]List, PageInfo, error) {
+	args := []any{ownerID, viewerID}
+	where, orderBy, limit, args := pagination.clauses("l.created_at", "l.id", true, "l.created_at DESC, l.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM lists l
+		WHERE l.owner_id = $1 AND %s AND %s
+		ORDER BY %s
+		%s`, listColumns("l", "$2"), listVisibleTo("l", "$2"), where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		lists []List
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var l List
+		if err := scanList(rows, &l); err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		lists = append(lists, l)
+		keys = append(keys, Cursor{CreatedAt: l.CreatedAt, ID: l.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	lists, info := paginate(lists, keys, pagination)
+	return lists, info, nil
+}
+
+// Subscriptions returns the lists userID subscribes to, most recently
+// subscribed first.
+func (m ListModel) Subscriptions(userID int64, pagination Pagination) ([]List, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("s.subscribed_at", "s.list_id", true, "s.subscribed_at DESC, s.list_id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT %s, s.subscribed_at
+		FROM list_subscriptions s
+		JOIN lists l ON l.id = s.list_id
+		WHERE s.user_id = $1 AND %s AND %s
+		ORDER BY %s
+		%s`, listColumns("l", "$1"), listVisibleTo("l", "$1"), where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		lists []List
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var (
+			l            List
+			subscribedAt time.Time
+		)
+
+		err := rows.Scan(
+			&l.ID, &l.OwnerID, &l.Name, &l.Description, &l.Private,
+			&l.MembersCount, &l.SubscribersCount, &l.Subscribed,
+			&l.CreatedAt, &l.UpdatedAt,
+			&subscribedAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		lists = append(lists, l)
+		keys = append(keys, Cursor{CreatedAt: subscribedAt, ID: l.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	lists, info := paginate(lists, keys, pagination)
+	return lists, info, nil
+}
+
+// AddMember adds userID to list id of ownerID, which can hold up to max
+// members. Adding a member twice is a no-op. Returns ErrRecordNotFound if
+// the owner has no such list.
+func (m ListModel) AddMember(id, ownerID, userID int64, max int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the list so concurrent additions can't exceed max.
+	var (
+		count   int
+		member  bool
+		blocked bool
+	)
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT
+			(SELECT COUNT(*) FROM list_members WHERE list_id = l.id),
+			EXISTS (SELECT 1 FROM list_members WHERE list_id = l.id AND user_id = $3),
+			NOT %s
+		FROM lists l
+		WHERE l.id = $1 AND l.owner_id = $2
+		FOR UPDATE`, notBlocked("$2", "$3")),
+		id, ownerID, userID,
+	).Scan(&count, &member, &blocked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	switch {
+	case member:
+		return nil
+	case blocked:
+		return ErrBlockedListMember
+	case count >= max:
+		return ErrListFull
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO list_members (list_id, user_id)
+		VALUES ($1, $2)`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMember removes userID from list id of ownerID. Returns
+// ErrRecordNotFound if the owner has no such list or userID isn't a member.
+func (m ListModel) RemoveMember(id, ownerID, userID int64) error {
+	query := `
+		DELETE FROM list_members lm
+		USING lists l
+		WHERE l.id = lm.list_id AND lm.list_id = $1 AND l.owner_id = $2 AND lm.user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, ownerID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Members returns the members of list id, most recently added first.
+func (m ListModel) Members(id int64, pagination Pagination) ([]UserPublic, PageInfo, error) {
+	args := []any{id}
+	where, orderBy, limit, args := pagination.clauses("lm.added_at", "lm.user_id", true, "lm.added_at DESC, lm.user_id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, lm.added_at
+		FROM list_members lm
+		JOIN users u ON u.id = lm.user_id
+		WHERE lm.list_id = $1 AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		users []UserPublic
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var (
+			u       UserPublic
+			addedAt time.Time
+		)
+		if err := rows.Scan(&u.ID, &u.Username, &addedAt); err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		users = append(users, u)
+		keys = append(keys, Cursor{CreatedAt: addedAt, ID: u.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	users, info := paginate(users, keys, pagination)
+	return users, info, nil
+}
+
+// Subscribe subscribes userID to public list id. Subscribing twice is a
+// no-op. Returns ErrRecordNotFound if the list doesn't exist or is private.
+func (m ListModel) Subscribe(id, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the list so it can't turn private before the subscription is
+	// saved.
+	var (
+		ownerID int64
+		private bool
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT owner_id, private
+		FROM lists
+		WHERE id = $1
+		FOR SHARE`,
+		id,
+	).Scan(&ownerID, &private)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	switch {
+	case ownerID == userID:
+		return ErrSubscribeOwnList
+	case private:
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO list_subscriptions (list_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (list_id, user_id) DO NOTHING`,
+		id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Unsubscribe unsubscribes userID from list id. Returns ErrRecordNotFound if
+// they weren't subscribed.
+func (m ListModel) Unsubscribe(id, userID int64) error {
+	query := `DELETE FROM list_subscriptions WHERE list_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Timeline returns the timeline of list id as seen by viewerID, built like
+// fan-out-on-read home timelines. The caller checks that the viewer can see
+// the list.
+func (m ListModel) Timeline(id, viewerID int64, pagination Pagination) ([]PostPublic, PageInfo, error) {
+	return FeedModel{DB: m.DB}.FetchList(viewerID, id, pagination)
+}
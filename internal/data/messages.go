@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/lib/pq"
+)
+
+// MessageKind tells messages written by members from the system messages
+// recording changes to a group.
+type MessageKind string
+
+const (
+	MessageText   MessageKind = "text"
+	MessageSystem MessageKind = "system"
+)
+
+// Changes recorded by system messages, stored as their body. The member
+// performing the change is the sender, and the member it applies to, if any,
+// the target.
+const (
+	SystemGroupCreated         = "group_created"
+	SystemMemberAdded          = "member_added"
+	SystemMemberRemoved        = "member_removed"
+	SystemMemberLeft           = "member_left"
+	SystemAdminGranted         = "admin_granted"
+	SystemAdminRevoked         = "admin_revoked"
+	SystemOwnershipTransferred = "ownership_transferred"
+	SystemGroupUpdated         = "group_updated"
+)
+
+// Message is a message sent to a conversation.
+type Message struct {
+	ID             int64       `json:"id"`
+	ConversationID int64       `json:"conversation_id"`
+	SenderID       int64       `json:"sender_id"`
+	Kind           MessageKind `json:"kind"`
+	Body           string      `json:"body"`
+	TargetID       *int64      `json:"target_id,omitempty"`
+	ReadBy         []int64     `json:"read_by,omitempty"` // Members other than the sender who read the message.
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+type MessageModel struct {
+	DB *sql.DB
+}
+
+// Send adds msg to its conversation, which the sender reads up to it.
+// Returns ErrRecordNotFound if the sender isn't a member of it.
+func (m MessageModel) Send(msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the sender's membership keeps them from being removed while
+	// the message is sent.
+	var role ConversationRole
+	err = tx.QueryRowContext(ctx, `
+		SELECT role
+		FROM conversation_members
+		WHERE conversation_id = $1 AND user_id = $2
+		FOR SHARE`,
+		msg.ConversationID, msg.SenderID,
+	).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	msg.Kind = MessageText
+	if err := insertMessage(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_members
+		SET last_read_message_id = $3
+		WHERE conversation_id = $1 AND user_id = $2`,
+		msg.ConversationID, msg.SenderID, msg.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertMessage inserts msg and bumps its conversation to the top of its
+// members' conversation lists.
+func insertMessage(ctx context.Context, tx *sql.Tx, msg *Message) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO messages (conversation_id, sender_id, kind, body, target_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		msg.ConversationID, msg.SenderID, msg.Kind, msg.Body, msg.TargetID,
+	).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE conversations SET updated_at = $2 WHERE id = $1`, msg.ConversationID, msg.CreatedAt)
+	return err
+}
+
+// List returns the history of conversationID as seen by userID, newest
+// message first. Only messages visible to userID are listed: see
+// visibleMessage.
+func (m MessageModel) List(conversationID, userID int64, pagination Pagination) ([]Message, PageInfo, error) {
+	args := []any{userID, conversationID}
+	where, orderBy, limit, args := pagination.clauses("m.created_at", "m.id", true, "m.created_at DESC, m.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT m.id, m.conversation_id, m.sender_id, m.kind, m.body, m.target_id, m.created_at,
+			ARRAY(
+				SELECT rm.user_id FROM conversation_members rm
+				WHERE rm.conversation_id = m.conversation_id
+					AND rm.user_id <> m.sender_id
+					AND rm.last_read_message_id >= m.id
+				ORDER BY rm.user_id
+			)
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1
+		WHERE m.conversation_id = $2 AND %s AND %s
+		ORDER BY %s
+		%s`, visibleMessage("m"), where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		messages []Message
+		keys     []Cursor
+	)
+	for rows.Next() {
+		var msg Message
+
+		err := rows.Scan(
+			&msg.ID,
+			&msg.ConversationID,
+			&msg.SenderID,
+			&msg.Kind,
+			&msg.Body,
+			&msg.TargetID,
+			&msg.CreatedAt,
+			pq.Array(&msg.ReadBy),
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		messages = append(messages, msg)
+		keys = append(keys, Cursor{CreatedAt: msg.CreatedAt, ID: msg.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	messages, info := paginate(messages, keys, pagination)
+	return messages, info, nil
+}
+
+// DeleteForSelf hides messageID from userID's view of conversationID. Other
+// members still see it. Returns ErrRecordNotFound if the message isn't part
+// of a conversation userID is a member of, or was already deleted.
+func (m MessageModel) DeleteForSelf(conversationID, messageID, userID int64) error {
+	query := `
+		INSERT INTO message_deletions (message_id, user_id)
+		SELECT m.id, $3
+		FROM messages m
+		JOIN conversation_members me ON me.conversation_id = m.conversation_id AND me.user_id = $3
+		WHERE m.id = $2 AND m.conversation_id = $1
+		ON CONFLICT (message_id, user_id) DO NOTHING
+		RETURNING message_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, conversationID, messageID, userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func ValidateMessage(v *validator.Validator, msg *Message) {
+	v.Check(msg.Body != "", "body", "must be provided")
+	v.Check(utf8.RuneCountInString(msg.Body) <= 2000, "body", "must be no more than 2000 characters long")
+}
@@ -10,10 +10,21 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 )
 
+// Pagination describes which page of a list to return.
+//
+// Lists are keyset paginated through Cursor by default. Setting Page selects
+// the deprecated offset pagination instead, which is slow on deep pages and
+// skips or repeats rows when new ones are inserted.
 type Pagination struct {
-	Page     int
+	Page     int // Deprecated: use Cursor. 1-indexed page for offset pagination.
 	PageSize int
 	Sort     string
+	Cursor   *Cursor // Position to continue from; nil for the first page.
+}
+
+// UsesOffset reports whether the deprecated offset pagination is requested.
+func (pp Pagination) UsesOffset() bool {
+	return pp.Page > 0
 }
 
 func (pp *Pagination) Offset() int {
@@ -26,24 +37,70 @@ func (pp *Pagination) Offset() int {
 // Models is a container struct that holds all the individual
 // database models used throughout the application.
 type Models struct {
-	Users       UserModel
-	Follows     FollowsModel
-	Friendships FriendshipModel
-	Posts       PostModel
-	Likes       LikeModel
-	Feed        FeedModel
+	Users         UserModel
+	Follows       FollowsModel
+	Friendships   FriendshipModel
+	CloseFriends  CloseFriendModel
+	Posts         PostModel
+	Likes         LikeModel
+	Feed          Feed
+	Timelines     TimelineModel
+	Candidates    FeedCandidateModel
+	Mutes         MuteModel
+	Trending      TrendingModel
+	Notifications NotificationModel
+	Push          PushSubscriptionModel
+	Digests       DigestModel
+	Suggestions   SuggestionModel
+	Relationships RelationshipModel
+	Lists         ListModel
+	FollowImports FollowImportModel
+	Conversations ConversationModel
+	Messages      MessageModel
+	Search        SearchModel
+	Polls         PollModel
+	Reactions     ReactionModel
+	Bookmarks     BookmarkModel
+	Pins          PinModel
+	Webhooks      WebhookModel
+	Outbox        OutboxModel
+	Jobs          JobModel
+	Counters      CounterModel
 }
 
 // NewModels initializes and returns a new Models struct,
 // wiring up the database connection to each model.
 func NewModels(db *sql.DB) *Models {
 	return &Models{
-		Users:       UserModel{DB: db},
-		Follows:     FollowsModel{DB: db},
-		Friendships: FriendshipModel{DB: db},
-		Posts:       PostModel{DB: db},
-		Likes:       LikeModel{DB: db},
-		Feed:        FeedModel{DB: db},
+		Users:         UserModel{DB: db},
+		Follows:       FollowsModel{DB: db},
+		Friendships:   FriendshipModel{DB: db},
+		CloseFriends:  CloseFriendModel{DB: db},
+		Posts:         PostModel{DB: db},
+		Likes:         LikeModel{DB: db},
+		Feed:          TimelineModel{DB: db},
+		Timelines:     TimelineModel{DB: db},
+		Candidates:    FeedCandidateModel{DB: db},
+		Mutes:         MuteModel{DB: db},
+		Trending:      TrendingModel{DB: db},
+		Notifications: NotificationModel{DB: db},
+		Push:          PushSubscriptionModel{DB: db},
+		Digests:       DigestModel{DB: db},
+		Suggestions:   SuggestionModel{DB: db},
+		Relationships: RelationshipModel{DB: db},
+		Lists:         ListModel{DB: db},
+		FollowImports: FollowImportModel{DB: db},
+		Conversations: ConversationModel{DB: db},
+		Messages:      MessageModel{DB: db},
+		Search:        SearchModel{DB: db},
+		Polls:         PollModel{DB: db},
+		Reactions:     ReactionModel{DB: db},
+		Bookmarks:     BookmarkModel{DB: db},
+		Pins:          PinModel{DB: db},
+		Webhooks:      WebhookModel{DB: db},
+		Outbox:        OutboxModel{DB: db},
+		Jobs:          JobModel{DB: db},
+		Counters:      CounterModel{DB: db},
 	}
 }
 
@@ -60,13 +117,82 @@ func MockModels() *Models {
 		Friendships: FriendshipModel{
 			DB: nil,
 		},
+		CloseFriends: CloseFriendModel{
+			DB: nil,
+		},
 		Posts: PostModel{
 			DB: nil,
 		},
 		Likes: LikeModel{
 			DB: nil,
 		},
-		Feed: FeedModel{
+		Feed: TimelineModel{
+			DB: nil,
+		},
+		Timelines: TimelineModel{
+			DB: nil,
+		},
+		Candidates: FeedCandidateModel{
+			DB: nil,
+		},
+		Mutes: MuteModel{
+			DB: nil,
+		},
+		Trending: TrendingModel{
+			DB: nil,
+		},
+		Notifications: NotificationModel{
+			DB: nil,
+		},
+		Push: PushSubscriptionModel{
+			DB: nil,
+		},
+		Digests: DigestModel{
+			DB: nil,
+		},
+		Suggestions: SuggestionModel{
+			DB: nil,
+		},
+		Relationships: RelationshipModel{
+			DB: nil,
+		},
+		Lists: ListModel{
+			DB: nil,
+		},
+		FollowImports: FollowImportModel{
+			DB: nil,
+		},
+		Conversations: ConversationModel{
+			DB: nil,
+		},
+		Messages: MessageModel{
+			DB: nil,
+		},
+		Search: SearchModel{
+			DB: nil,
+		},
+		Polls: PollModel{
+			DB: nil,
+		},
+		Reactions: ReactionModel{
+			DB: nil,
+		},
+		Bookmarks: BookmarkModel{
+			DB: nil,
+		},
+		Pins: PinModel{
+			DB: nil,
+		},
+		Webhooks: WebhookModel{
+			DB: nil,
+		},
+		Outbox: OutboxModel{
+			DB: nil,
+		},
+		Jobs: JobModel{
+			DB: nil,
+		},
+		Counters: CounterModel{
 			DB: nil,
 		},
 	}
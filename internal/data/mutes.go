@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMuteSelf = errors.New("cannot mute yourself")
+)
+
+// notMuted returns a SQL predicate that holds when the viewer bound to the
+// placeholder viewer has not muted the user given as the SQL expression author.
+// Unlike blocks, mutes are one-sided and only hide content from the muter.
+func notMuted(author, viewer string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+				SELECT 1 FROM mutes vm
+				WHERE vm.user_id = %[2]s AND vm.muted_id = %[1]s
+			)`, author, viewer)
+}
+
+type MuteModel struct {
+	DB *sql.DB
+}
+
+// Mute hides mutedID's content from userID's discovery surfaces. Muting an
+// already muted user is a no-op.
+func (m MuteModel) Mute(userID, mutedID int64) error {
+	if userID == mutedID {
+		return ErrMuteSelf
+	}
+
+	query := `
+		INSERT INTO mutes (user_id, muted_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, muted_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, mutedID)
+	return err
+}
+
+// Unmute removes a mute. Returns sql.ErrNoRows if userID had not muted mutedID.
+func (m MuteModel) Unmute(userID, mutedID int64) error {
+	query := `
+		DELETE FROM mutes
+		WHERE user_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// List returns the users muted by userID, most recently muted first.
+func (m MuteModel) List(userID int64, pagination Pagination) ([]UserPublic, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("mu.created_at", "mu.id", true, "mu.created_at DESC, mu.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, mu.created_at, mu.id
+		FROM mutes mu
+		JOIN users u ON u.id = mu.muted_id
+		WHERE mu.user_id = $1 AND %s
+		ORDER BY %s
+		%s`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		users []UserPublic
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var (
+			u   UserPublic
+			key Cursor
+		)
+		if err := rows.Scan(&u.ID, &u.Username, &key.CreatedAt, &key.ID); err != nil {
+			return nil, PageInfo{}, err
+		}
+		users = append(users, u)
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	users, info := paginate(users, keys, pagination)
+	return users, info, nil
+}
@@ -0,0 +1,428 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidNotificationType = errors.New("invalid notification type")
+)
+
+// NotificationType is the kind of activity a notification reports.
+type NotificationType string
+
+const (
+	NotificationFollow        NotificationType = "follow"         // Someone followed the user.
+	NotificationReaction      NotificationType = "reaction"       // Someone reacted to one of the user's posts.
+	NotificationReply         NotificationType = "reply"          // Someone replied to one of the user's posts.
+	NotificationMention       NotificationType = "mention"        // Someone mentioned the user in a post.
+	NotificationFriendRequest NotificationType = "friend_request" // Someone sent the user a friend request.
+	NotificationFriendAccept  NotificationType = "friend_accept"  // Someone accepted the user's friend request.
+)
+
+// NotificationTypes lists every notification type.
+var NotificationTypes = []NotificationType{
+	NotificationFollow,
+	NotificationReaction,
+	NotificationReply,
+	NotificationMention,
+	NotificationFriendRequest,
+	NotificationFriendAccept,
+}
+
+func (t NotificationType) IsValid() bool {
+	return slices.Contains(NotificationTypes, t)
+}
+
+// Notification records a single actor's activity towards a user.
+type Notification struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	ActorID   int64            `json:"actor_id"`
+	PostID    *int64           `json:"post_id,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// groupKey returns the key of the group n is listed under. Reactions and
+// replies group per post and follows per day, while every mention and friend
+// request is listed on its own.
+func (n Notification) groupKey() string {
+	switch n.Type {
+	case NotificationFollow:
+		return fmt.Sprintf("follow:%s", n.CreatedAt.UTC().Format(time.DateOnly))
+	case NotificationReaction, NotificationReply, NotificationMention:
+		var postID int64
+		if n.PostID != nil {
+			postID = *n.PostID
+		}
+		return fmt.Sprintf("%s:%d", n.Type, postID)
+	default:
+		return fmt.Sprintf("%s:%d", n.Type, n.ActorID)
+	}
+}
+
+// NotificationGroup is an entry of the notifications list, gathering the
+// notifications of the same kind about the same subject.
+type NotificationGroup struct {
+	ID         int64            `json:"id"` // ID of the group's most recent notification.
+	Type       NotificationType `json:"type"`
+	PostID     *int64           `json:"post_id,omitempty"`
+	Actors     []UserPublic     `json:"actors"` // Up to the 3 most recent actors.
+	ActorCount int              `json:"actor_count"`
+	Summary    string           `json:"summary"`
+	Unread     bool             `json:"unread"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// summarize describes the group in a sentence, such as "alice and 4 others
+// reacted to your post".
+func (g NotificationGroup) summarize() string {
+	if len(g.Actors) == 0 {
+		return ""
+	}
+
+	var who string
+	switch {
+	case g.ActorCount == 1:
+		who = g.Actors[0].Username
+	case g.ActorCount == 2 && len(g.Actors) > 1:
+		who = g.Actors[0].Username + " and " + g.Actors[1].Username
+	case g.ActorCount == 2:
+		who = g.Actors[0].Username + " and 1 other"
+	default:
+		who = fmt.Sprintf("%s and %d others", g.Actors[0].Username, g.ActorCount-1)
+	}
+
+	var what string
+	switch g.Type {
+	case NotificationFollow:
+		what = "followed you"
+	case NotificationReaction:
+		what = "reacted to your post"
+	case NotificationReply:
+		what = "replied to your post"
+	case NotificationMention:
+		what = "mentioned you in a post"
+	case NotificationFriendRequest:
+		what = "sent you a friend request"
+	case NotificationFriendAccept:
+		what = "accepted your friend request"
+	}
+
+	return who + " " + what
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// notifiable returns a SQL predicate that holds when the user bound to the
+// placeholder user should be notified of type typ by actor: they aren't the
+// actor, haven't turned the type off, and haven't blocked or muted the actor.
+func notifiable(user, typ, actor string) string {
+	return fmt.Sprintf(`%[1]s <> %[3]s
+			AND NOT EXISTS (
+				SELECT 1 FROM notification_preferences np
+				WHERE np.user_id = %[1]s AND np.type = %[2]s AND NOT np.enabled
+			)
+			AND %[4]s
+			AND %[5]s`, user, typ, actor, notBlocked(user, actor), notMuted(actor, user))
+}
+
+// Notify records n, unless its recipient shouldn't be notified of it. When
+// the same actor already notified the user of the same thing, that
+// notification is brought back up as unread instead.
+func (m NotificationModel) Notify(n *Notification) error {
+	n.CreatedAt = time.Now()
+
+	query := fmt.Sprintf(`
+		INSERT INTO notifications (user_id, type, actor_id, post_id, group_key, created_at)
+		SELECT $1::int, $2::text, $3::int, $4::int, $5, $6
+		WHERE %s
+		ON CONFLICT (user_id, type, actor_id, (COALESCE(post_id, 0)))
+		DO UPDATE SET created_at = EXCLUDED.created_at, group_key = EXCLUDED.group_key, read_at = NULL
+		RETURNING id`, notifiable("$1::int", "$2::text", "$3::int"))
+
+	args := []any{n.UserID, n.Type, n.ActorID, n.PostID, n.groupKey(), n.CreatedAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&n.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// NotifyMentions notifies the users mentioned in postID, written by actorID,
+// who can read the post.
+func (m NotificationModel) NotifyMentions(postID, actorID int64) error {
+	query := fmt.Sprintf(`
+		INSERT INTO notifications (user_id, type, actor_id, post_id, group_key)
+		SELECT pm.user_id, 'mention', $2, $1, 'mention:' || $1
+		FROM post_mentions pm
+		JOIN posts p ON p.id = pm.post_id
+		WHERE pm.post_id = $1 AND %s AND %s
+		ON CONFLICT (user_id, type, actor_id, (COALESCE(post_id, 0))) DO NOTHING`,
+		visibleTo("p", "pm.user_id"), notifiable("pm.user_id", "'mention'", "$2::int"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, postID, actorID)
+	return err
+}
+
+// List returns userID's notifications grouped, most recently active group
+// first. With unreadOnly set, only groups holding unread notifications are
+// returned.
+func (m NotificationModel) List(userID int64, unreadOnly bool, pagination Pagination) ([]NotificationGroup, PageInfo, error) {
+	args := []any{userID}
+	where, orderBy, limit, args := pagination.clauses("g.created_at", "g.id", true, "g.created_at DESC, g.id DESC", args)
+
+	unread := "TRUE"
+	if unreadOnly {
+		unread = "g.unread"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT g.id, g.type, g.post_id, g.actor_ids, g.actor_names, g.actor_count, g.unread, g.created_at
+		FROM (
+			SELECT
+				MAX(n.id) AS id,
+				n.type,
+				n.post_id,
+				(ARRAY_AGG(n.actor_id ORDER BY n.created_at DESC, n.id DESC))[1:3] AS actor_ids,
+				(ARRAY_AGG(u.username ORDER BY n.created_at DESC, n.id DESC))[1:3] AS actor_names,
+				COUNT(*) AS actor_count,
+				BOOL_OR(n.read_at IS NULL) AS unread,
+				MAX(n.created_at) AS created_at
+			FROM notifications n
+			JOIN users u ON u.id = n.actor_id
+			WHERE n.user_id = $1
+			GROUP BY n.group_key, n.type, n.post_id
+		) g
+		WHERE %s AND %s
+		ORDER BY %s
+		%s`, unread, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		groups []NotificationGroup
+		keys   []Cursor
+	)
+	for rows.Next() {
+		var (
+			g     NotificationGroup
+			ids   []int64
+			names []string
+		)
+
+		err := rows.Scan(
+			&g.ID,
+			&g.Type,
+			&g.PostID,
+			pq.Array(&ids),
+			pq.Array(&names),
+			&g.ActorCount,
+			&g.Unread,
+			&g.CreatedAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		for i := range min(len(ids), len(names)) {
+			g.Actors = append(g.Actors, UserPublic{ID: ids[i], Username: names[i]})
+		}
+		g.Summary = g.summarize()
+
+		groups = append(groups, g)
+		keys = append(keys, Cursor{CreatedAt: g.CreatedAt, ID: g.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	groups, info := paginate(groups, keys, pagination)
+	return groups, info, nil
+}
+
+// UnreadCounts returns the number of groups holding unread notifications of
+// userID, per type. Types without any are left out.
+func (m NotificationModel) UnreadCounts(userID int64) (map[NotificationType]int, error) {
+	query := `
+		SELECT type, COUNT(DISTINCT group_key)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+		GROUP BY type`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[NotificationType]int)
+	for rows.Next() {
+		var (
+			t     NotificationType
+			count int
+		)
+		if err := rows.Scan(&t, &count); err != nil {
+			return nil, err
+		}
+		counts[t] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// SetRead marks the group of notification id as read, or as unread if read
+// is false. Returns ErrRecordNotFound if userID has no such notification.
+func (m NotificationModel) SetRead(userID, id int64, read bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var groupKey string
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT group_key
+		FROM notifications
+		WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	).Scan(&groupKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	readAt := sql.NullTime{Time: time.Now(), Valid: read}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE notifications
+		SET read_at = $3
+		WHERE user_id = $1 AND group_key = $2 AND (read_at IS NULL) = $4`,
+		userID, groupKey, readAt, read,
+	)
+	return err
+}
+
+// MarkAllRead marks every notification of userID as read, returning how many
+// were unread.
+func (m NotificationModel) MarkAllRead(userID int64) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// Preferences returns which notification types userID receives. Types are
+// enabled unless turned off.
+func (m NotificationModel) Preferences(userID int64) (map[NotificationType]bool, error) {
+	query := `
+		SELECT type, enabled
+		FROM notification_preferences
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prefs := make(map[NotificationType]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t] = true
+	}
+
+	for rows.Next() {
+		var (
+			t       NotificationType
+			enabled bool
+		)
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		if t.IsValid() {
+			prefs[t] = enabled
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences turns the given notification types on or off for userID.
+// Types left out keep their current setting.
+func (m NotificationModel) SetPreferences(userID int64, prefs map[NotificationType]bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for t, enabled := range prefs {
+		if !t.IsValid() {
+			return ErrInvalidNotificationType
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, enabled)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled`,
+			userID, t, enabled,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
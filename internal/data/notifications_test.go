@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationGroupKey(t *testing.T) {
+	postID := int64(42)
+	at := time.Date(2024, 6, 1, 23, 30, 0, 0, time.FixedZone("UTC-3", -3*3600))
+
+	tests := []struct {
+		n    Notification
+		want string
+	}{
+		{Notification{Type: NotificationFollow, ActorID: 7, CreatedAt: at}, "follow:2024-06-02"},
+		{Notification{Type: NotificationReaction, ActorID: 7, PostID: &postID}, "reaction:42"},
+		{Notification{Type: NotificationReply, ActorID: 7, PostID: &postID}, "reply:42"},
+		{Notification{Type: NotificationFriendRequest, ActorID: 7}, "friend_request:7"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.n.groupKey())
+	}
+}
+
+func TestNotificationGroupSummary(t *testing.T) {
+	alice := UserPublic{ID: 1, Username: "alice"}
+	bob := UserPublic{ID: 2, Username: "bob"}
+	carol := UserPublic{ID: 3, Username: "carol"}
+
+	tests := []struct {
+		g    NotificationGroup
+		want string
+	}{
+		{NotificationGroup{Type: NotificationFollow, Actors: []UserPublic{alice}, ActorCount: 1}, "alice followed you"},
+		{NotificationGroup{Type: NotificationReply, Actors: []UserPublic{alice, bob}, ActorCount: 2}, "alice and bob replied to your post"},
+		{NotificationGroup{Type: NotificationReaction, Actors: []UserPublic{alice, bob, carol}, ActorCount: 5}, "alice and 4 others reacted to your post"},
+		{NotificationGroup{Type: NotificationFriendAccept, Actors: []UserPublic{bob}, ActorCount: 1}, "bob accepted your friend request"},
+		{NotificationGroup{Type: NotificationFollow}, ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.g.summarize())
+	}
+}
@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+)
+
+// OutboxModel is the outbox.Store of the outbox_events table.
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// recordEvent writes an event of type typ with data to the outbox as part of
+// tx, so that it is relayed if and only if tx commits.
+func recordEvent(ctx context.Context, tx *sql.Tx, typ string, actorID int64, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox_events (type, actor_id, data)
+		VALUES ($1, $2, $3)`,
+		typ, actorID, js,
+	)
+	return err
+}
+
+// recordReactionEvents records an event of type typ for each of the
+// reactions userID left on, or removed from, postID.
+func recordReactionEvents(ctx context.Context, tx *sql.Tx, typ string, userID, postID int64, reactions []string) error {
+	if len(reactions) == 0 {
+		return nil
+	}
+
+	var authorID int64
+	err := tx.QueryRowContext(ctx, `SELECT user_id FROM posts WHERE id = $1`, postID).Scan(&authorID)
+	if err != nil {
+		return err
+	}
+
+	for _, reaction := range reactions {
+		err := recordEvent(ctx, tx, typ, userID, outbox.Reaction{
+			PostID:       postID,
+			PostAuthorID: authorID,
+			UserID:       userID,
+			Reaction:     reaction,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Acquire implements outbox.Store. A new consumer starts at the oldest
+// transaction still in progress, which the events of every transaction
+// committed later come after.
+func (m OutboxModel) Acquire(consumer, owner string, lease time.Duration) (outbox.Position, bool, error) {
+	query := `
+		INSERT INTO outbox_offsets (consumer, last_txid, last_id, owner, locked_until)
+		VALUES ($1, txid_snapshot_xmin(txid_current_snapshot()), 0, $2, NOW() + $3 * INTERVAL '1 second')
+		ON CONFLICT (consumer) DO UPDATE
+		SET owner = EXCLUDED.owner, locked_until = EXCLUDED.locked_until
+		WHERE outbox_offsets.owner = EXCLUDED.owner OR outbox_offsets.locked_until < NOW()
+		RETURNING last_txid, last_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var pos outbox.Position
+	err := m.DB.QueryRowContext(ctx, query, consumer, owner, lease.Seconds()).Scan(&pos.TxID, &pos.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return outbox.Position{}, false, nil
+		}
+		return outbox.Position{}, false, err
+	}
+
+	return pos, true, nil
+}
+
+// Events implements outbox.Store. Only events written by transactions older
+// than the oldest one still in progress are returned: any event written from
+// then on belongs to a later transaction, so sorts after them.
+func (m OutboxModel) Events(after outbox.Position, limit int) ([]outbox.Event, error) {
+	query := `
+		SELECT id, txid, type, actor_id, data, created_at
+		FROM outbox_events
+		WHERE (txid, id) > ($1, $2)
+			AND txid < txid_snapshot_xmin(txid_current_snapshot())
+		ORDER BY txid, id
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, after.TxID, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outbox.Event
+	for rows.Next() {
+		var e outbox.Event
+		err := rows.Scan(&e.ID, &e.Position.TxID, &e.Type, &e.ActorID, (*[]byte)(&e.Data), &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Position.ID = e.ID
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Commit implements outbox.Store.
+func (m OutboxModel) Commit(consumer, owner string, pos outbox.Position) error {
+	query := `
+		UPDATE outbox_offsets
+		SET last_txid = $3, last_id = $4, updated_at = NOW()
+		WHERE consumer = $1 AND owner = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, consumer, owner, pos.TxID, pos.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return outbox.ErrLeaseLost
+	}
+
+	return nil
+}
+
+// Prune deletes the events written before before which every consumer
+// handled. Consumers whose lease ran out before then are considered retired
+// and don't hold events back.
+func (m OutboxModel) Prune(before time.Time) (int64, error) {
+	query := `
+		DELETE FROM outbox_events e
+		WHERE e.created_at < $1
+			AND NOT EXISTS (
+				SELECT 1
+				FROM outbox_offsets o
+				WHERE o.locked_until >= $1 AND (e.txid, e.id) > (o.last_txid, o.last_id)
+			)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPinLimitReached  = errors.New("maximum number of pinned posts reached")
+	ErrPostNotPinnable  = errors.New("only public posts can be pinned")
+	ErrInvalidPinsOrder = errors.New("order must list every pinned post exactly once")
+)
+
+type PinModel struct {
+	DB *sql.DB
+}
+
+// Pin pins one of userID's own posts to their profile, after the posts
+// already pinned. Pinning an already pinned post is a no-op. Ownership must be
+// checked by the caller through PostModel.CheckPostOwnership.
+func (m PinModel) Pin(userID, postID int64, max int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent pins can't exceed the limit.
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		visibility PostVisibility
+		pinned     bool
+		count      int
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			p.visibility,
+			EXISTS (SELECT 1 FROM pinned_posts WHERE post_id = p.id),
+			(SELECT COUNT(*) FROM pinned_posts WHERE user_id = $1)
+		FROM posts p
+		WHERE p.id = $2 AND p.user_id = $1`,
+		userID, postID,
+	).Scan(&visibility, &pinned, &count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	switch {
+	case pinned:
+		return nil
+	case visibility != VisibilityPublic:
+		return ErrPostNotPinnable
+	case count >= max:
+		return ErrPinLimitReached
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO pinned_posts (user_id, post_id, position)
+		SELECT $1, $2, COALESCE(MAX(position) + 1, 0)
+		FROM pinned_posts
+		WHERE user_id = $1`,
+		userID, postID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Unpin removes a post from userID's pinned posts. Returns sql.ErrNoRows if
+// the post was not pinned.
+func (m PinModel) Unpin(userID, postID int64) error {
+	query := `
+		DELETE FROM pinned_posts
+		WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Reorder sets the order of userID's pinned posts. postIDs must contain
+// every pinned post exactly once, in the desired order.
+func (m PinModel) Reorder(userID int64, postIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT post_id FROM pinned_posts WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	var current []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ordered := slices.Clone(postIDs)
+	slices.Sort(ordered)
+	slices.Sort(current)
+	if !slices.Equal(ordered, current) {
+		return ErrInvalidPinsOrder
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE pinned_posts pp
+		SET position = o.position - 1
+		FROM unnest($2::int[]) WITH ORDINALITY AS o(post_id, position)
+		WHERE pp.user_id = $1 AND pp.post_id = o.post_id`,
+		userID, pq.Array(postIDs),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListPinned returns userID's pinned posts in pinned order, as long as
+// viewerID is allowed to read them.
+func (m PinModel) ListPinned(userID, viewerID int64) ([]PostPublic, error) {
+	query := fmt.Sprintf(`
+		SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at
+		FROM pinned_posts pp
+		JOIN posts p ON p.id = pp.post_id
+		WHERE pp.user_id = $1 AND %s
+		ORDER BY pp.position`, visibleTo("p", "$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []PostPublic
+	for rows.Next() {
+		p := PostPublic{Pinned: true}
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Content, &p.Visibility, &p.ReplyToID, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pinnedPosts returns the ids of userID's pinned posts as seen by viewerID,
+// in pinned order.
+func pinnedPosts(t *testing.T, pins PinModel, userID, viewerID int64) []int64 {
+	t.Helper()
+
+	posts, err := pins.ListPinned(userID, viewerID)
+	require.NoError(t, err)
+
+	ids := []int64{}
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestPinIntegration(t *testing.T) {
+	db := openTestDB(t)
+	pins := PinModel{DB: db}
+
+	user := createUser(t, db, "user")
+	other := createUser(t, db, "other")
+
+	first := createPost(t, db, user, VisibilityPublic)
+	second := createPost(t, db, user, VisibilityPublic)
+	third := createPost(t, db, user, VisibilityPublic)
+	private := createPost(t, db, user, VisibilityFollowers)
+	foreign := createPost(t, db, other, VisibilityPublic)
+
+	require.NoError(t, pins.Pin(user, first.ID, 2))
+	require.NoError(t, pins.Pin(user, second.ID, 2))
+
+	// Pinning again is a no-op, even at the limit.
+	require.NoError(t, pins.Pin(user, first.ID, 2))
+	assert.ErrorIs(t, pins.Pin(user, third.ID, 2), ErrPinLimitReached)
+
+	assert.ErrorIs(t, pins.Pin(user, private.ID, 3), ErrPostNotPinnable)
+	assert.ErrorIs(t, pins.Pin(user, foreign.ID, 3), ErrRecordNotFound)
+	assert.ErrorIs(t, pins.Pin(user, 0, 3), ErrRecordNotFound)
+
+	assert.Equal(t, []int64{first.ID, second.ID}, pinnedPosts(t, pins, user, other))
+
+	// Unpinning makes room for another pin, placed last.
+	require.NoError(t, pins.Unpin(user, first.ID))
+	assert.ErrorIs(t, pins.Unpin(user, first.ID), sql.ErrNoRows)
+	assert.ErrorIs(t, pins.Unpin(other, second.ID), sql.ErrNoRows)
+
+	require.NoError(t, pins.Pin(user, third.ID, 2))
+	assert.Equal(t, []int64{second.ID, third.ID}, pinnedPosts(t, pins, user, other))
+}
+
+func TestPinReorderIntegration(t *testing.T) {
+	db := openTestDB(t)
+	pins := PinModel{DB: db}
+
+	user := createUser(t, db, "user")
+
+	var ids []int64
+	for range 3 {
+		post := createPost(t, db, user, VisibilityPublic)
+		require.NoError(t, pins.Pin(user, post.ID, 3))
+		ids = append(ids, post.ID)
+	}
+
+	reordered := []int64{ids[2], ids[0], ids[1]}
+	require.NoError(t, pins.Reorder(user, reordered))
+	assert.Equal(t, reordered, pinnedPosts(t, pins, user, user))
+
+	// The order must list every pinned post, and nothing else.
+	for _, order := range [][]int64{
+		{ids[0], ids[1]},
+		{ids[0], ids[1], ids[2], ids[2] + 1},
+		{ids[0], ids[1], ids[2] + 1},
+		nil,
+	} {
+		assert.ErrorIs(t, pins.Reorder(user, order), ErrInvalidPinsOrder, "order %v", order)
+	}
+	assert.Equal(t, reordered, pinnedPosts(t, pins, user, user))
+
+	// Pins placed after a reorder still go last.
+	post := createPost(t, db, user, VisibilityPublic)
+	require.NoError(t, pins.Pin(user, post.ID, 4))
+	assert.Equal(t, append(reordered, post.ID), pinnedPosts(t, pins, user, user))
+}
+
+func TestPinnedPostMadePrivateIntegration(t *testing.T) {
+	db := openTestDB(t)
+	pins := PinModel{DB: db}
+	posts := PostModel{DB: db}
+
+	user := createUser(t, db, "user")
+
+	kept := createPost(t, db, user, VisibilityPublic)
+	hidden := createPost(t, db, user, VisibilityPublic)
+	require.NoError(t, pins.Pin(user, kept.ID, 3))
+	require.NoError(t, pins.Pin(user, hidden.ID, 3))
+
+	// Editing a post while keeping it public leaves it pinned.
+	kept.Content = "edited"
+	_, err := posts.PatchPost(kept)
+	require.NoError(t, err)
+
+	hidden.Visibility = VisibilityFriends
+	_, err = posts.PatchPost(hidden)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{kept.ID}, pinnedPosts(t, pins, user, user))
+	assert.ErrorIs(t, pins.Unpin(user, hidden.ID), sql.ErrNoRows)
+
+	// Made public again, it has to be pinned anew.
+	hidden.Visibility = VisibilityPublic
+	_, err = posts.PatchPost(hidden)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{kept.ID}, pinnedPosts(t, pins, user, user))
+}
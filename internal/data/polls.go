@@ -0,0 +1,343 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollNotFound      = errors.New("poll not found")
+	ErrPollClosed        = errors.New("poll is closed")
+	ErrAlreadyVoted      = errors.New("user has already voted on this poll")
+	ErrInvalidPollOption = errors.New("one or more options do not belong to this poll")
+	ErrSingleChoicePoll  = errors.New("poll only accepts a single option")
+)
+
+const (
+	PollMinOptions      = 2
+	PollMaxOptions      = 4
+	PollMinDuration     = 5 * time.Minute
+	PollMaxDuration     = 7 * 24 * time.Hour
+	pollOptionMaxLength = 80
+)
+
+// Poll is a set of options attached to a post that users can vote on.
+//
+// Vote tallies are only exposed once the viewer has voted or the poll has
+// closed; until then VotersCount and every option's VotesCount are nil.
+type Poll struct {
+	ID             int64        `json:"id"`
+	PostID         int64        `json:"-"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	Closed         bool         `json:"closed"`
+	HasVoted       bool         `json:"has_voted"`
+	Votes          []int64      `json:"votes,omitempty"` // Option ids chosen by the viewer.
+	VotersCount    *int         `json:"voters_count,omitempty"`
+	Options        []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	ID         int64  `json:"id"`
+	Position   int    `json:"position"`
+	Text       string `json:"text"`
+	VotesCount *int   `json:"votes_count,omitempty"`
+}
+
+type PollModel struct {
+	DB *sql.DB
+}
+
+// insertPoll stores the poll of a freshly inserted post, filling in the ids
+// of the poll and its options.
+func insertPoll(ctx context.Context, tx *sql.Tx, postID int64, poll *Poll) error {
+	query := `
+		INSERT INTO polls (post_id, multiple_choice, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`
+
+	poll.PostID = postID
+	err := tx.QueryRowContext(ctx, query, postID, poll.MultipleChoice, poll.ExpiresAt).Scan(&poll.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range poll.Options {
+		poll.Options[i].Position = i
+		err = tx.QueryRowContext(
+			ctx,
+			`INSERT INTO poll_options (poll_id, position, text) VALUES ($1, $2, $3) RETURNING id`,
+			poll.ID, i, poll.Options[i].Text,
+		).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForPosts returns the polls attached to the given posts, keyed by post id,
+// as seen by viewerID. Posts without a poll are absent from the map.
+func (m PollModel) ForPosts(postIDs []int64, viewerID int64) (map[int64]*Poll, error) {
+	polls := make(map[int64]*Poll)
+	if len(postIDs) == 0 {
+		return polls, nil
+	}
+
+	query := `
+		SELECT
+			pl.id, pl.post_id, pl.multiple_choice, pl.expires_at,
+			pl.expires_at <= NOW() AS closed,
+			pl.voters_count,
+			EXISTS (
+				SELECT 1 FROM poll_voters pv
+				WHERE pv.poll_id = pl.id AND pv.user_id = $2
+			) AS has_voted,
+			o.id, o.position, o.text, o.votes_count
+		FROM polls pl
+		JOIN poll_options o ON o.poll_id = pl.id
+		WHERE pl.post_id = ANY($1)
+		ORDER BY pl.id, o.position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Poll)
+	for rows.Next() {
+		var (
+			p           Poll
+			o           PollOption
+			votersCount int
+			votesCount  int
+		)
+
+		err := rows.Scan(
+			&p.ID, &p.PostID, &p.MultipleChoice, &p.ExpiresAt,
+			&p.Closed, &votersCount, &p.HasVoted,
+			&o.ID, &o.Position, &o.Text, &votesCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		poll, ok := byID[p.ID]
+		if !ok {
+			poll = &p
+			if poll.resultsVisible() {
+				poll.VotersCount = &votersCount
+			}
+			byID[p.ID] = poll
+			polls[p.PostID] = poll
+		}
+
+		if poll.resultsVisible() {
+			o.VotesCount = &votesCount
+		}
+		poll.Options = append(poll.Options, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if viewerID == 0 || len(byID) == 0 {
+		return polls, nil
+	}
+
+	pollIDs := make([]int64, 0, len(byID))
+	for id := range byID {
+		pollIDs = append(pollIDs, id)
+	}
+
+	votes, err := m.DB.QueryContext(
+		ctx,
+		`SELECT poll_id, option_id FROM poll_votes WHERE poll_id = ANY($1) AND user_id = $2`,
+		pq.Array(pollIDs), viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer votes.Close()
+
+	for votes.Next() {
+		var pollID, optionID int64
+		if err := votes.Scan(&pollID, &optionID); err != nil {
+			return nil, err
+		}
+		byID[pollID].Votes = append(byID[pollID].Votes, optionID)
+	}
+
+	if err := votes.Err(); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+// ForPost returns the poll attached to a post as seen by viewerID, or
+// ErrPollNotFound if the post has none.
+func (m PollModel) ForPost(postID, viewerID int64) (*Poll, error) {
+	polls, err := m.ForPosts([]int64{postID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	poll, ok := polls[postID]
+	if !ok {
+		return nil, ErrPollNotFound
+	}
+
+	return poll, nil
+}
+
+// Vote records userID's choice on the poll attached to postID. A user can
+// only vote once; multiple options are accepted only on multiple choice polls.
+//
+// Tallies are kept as counters on the poll and its options and updated in the
+// same transaction as the vote, so concurrent voters never lose increments.
+func (m PollModel) Vote(postID, userID int64, optionIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		pollID         int64
+		multipleChoice bool
+	)
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT id, multiple_choice FROM polls WHERE post_id = $1`,
+		postID,
+	).Scan(&pollID, &multipleChoice)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPollNotFound
+		}
+		return err
+	}
+
+	if !multipleChoice && len(optionIDs) > 1 {
+		return ErrSingleChoicePoll
+	}
+
+	var matching int
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM poll_options WHERE poll_id = $1 AND id = ANY($2)`,
+		pollID, pq.Array(optionIDs),
+	).Scan(&matching)
+	if err != nil {
+		return err
+	}
+
+	if matching != len(optionIDs) {
+		return ErrInvalidPollOption
+	}
+
+	// The voters row is the once-per-user guard: its primary key makes a
+	// concurrent second vote by the same user fail here.
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO poll_voters (poll_id, user_id) VALUES ($1, $2) ON CONFLICT (poll_id, user_id) DO NOTHING`,
+		pollID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		return ErrAlreadyVoted
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO poll_votes (poll_id, option_id, user_id) SELECT $1, unnest($2::int[]), $3`,
+		pollID, pq.Array(optionIDs), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE poll_options SET votes_count = votes_count + 1 WHERE poll_id = $1 AND id = ANY($2)`,
+		pollID, pq.Array(optionIDs),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Checking the expiry as part of the update means a poll that closes
+	// while the vote is in flight rejects it.
+	result, err = tx.ExecContext(
+		ctx,
+		`UPDATE polls SET voters_count = voters_count + 1 WHERE id = $1 AND expires_at > NOW()`,
+		pollID,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrPollClosed
+	}
+
+	return tx.Commit()
+}
+
+func (p *Poll) resultsVisible() bool {
+	return p.Closed || p.HasVoted
+}
+
+// ValidatePoll checks the options and duration of a poll about to be created.
+// duration is the time between now and the poll closing.
+func ValidatePoll(v *validator.Validator, poll *Poll, duration time.Duration) {
+	texts := make([]string, len(poll.Options))
+	for i, option := range poll.Options {
+		texts[i] = strings.TrimSpace(option.Text)
+	}
+
+	v.Check(validator.Between(len(texts), PollMinOptions, PollMaxOptions), "poll.options", "must have between 2 and 4 options")
+	v.Check(validator.Unique(texts), "poll.options", "must not contain duplicate options")
+	for _, text := range texts {
+		v.Check(text != "", "poll.options", "must not contain empty options")
+		v.Check(len(text) <= pollOptionMaxLength, "poll.options", "must be no more than 80 bytes long each")
+	}
+
+	v.Check(validator.Between(duration, PollMinDuration, PollMaxDuration), "poll.duration_minutes", "must be between 5 minutes and 7 days")
+}
+
+// ValidateVote checks the option ids submitted for a vote.
+func ValidateVote(v *validator.Validator, optionIDs []int64) {
+	v.Check(len(optionIDs) > 0, "option_ids", "must be provided")
+	v.Check(len(optionIDs) <= PollMaxOptions, "option_ids", "must not contain more than 4 options")
+	v.Check(validator.Unique(optionIDs), "option_ids", "must not contain duplicate values")
+}
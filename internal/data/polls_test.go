@@ -0,0 +1,263 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pollWith(texts ...string) *Poll {
+	poll := &Poll{}
+	for _, text := range texts {
+		poll.Options = append(poll.Options, PollOption{Text: text})
+	}
+	return poll
+}
+
+func TestValidatePoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		poll     *Poll
+		duration time.Duration
+		wantKey  string // Empty when the poll is valid.
+	}{
+		{"two options", pollWith("Yes", "No"), time.Hour, ""},
+		{"four options", pollWith("A", "B", "C", "D"), time.Hour, ""},
+		{"shortest duration", pollWith("Yes", "No"), PollMinDuration, ""},
+		{"longest duration", pollWith("Yes", "No"), PollMaxDuration, ""},
+		{"longest option", pollWith(strings.Repeat("a", 80), "No"), time.Hour, ""},
+		{"one option", pollWith("Yes"), time.Hour, "poll.options"},
+		{"five options", pollWith("A", "B", "C", "D", "E"), time.Hour, "poll.options"},
+		{"duplicate options", pollWith("Yes", "No", "Yes"), time.Hour, "poll.options"},
+		{"duplicate once trimmed", pollWith("Yes", " Yes "), time.Hour, "poll.options"},
+		{"empty option", pollWith("Yes", "  "), time.Hour, "poll.options"},
+		{"option too long", pollWith(strings.Repeat("a", 81), "No"), time.Hour, "poll.options"},
+		{"too short", pollWith("Yes", "No"), PollMinDuration - time.Second, "poll.duration_minutes"},
+		{"too long", pollWith("Yes", "No"), PollMaxDuration + time.Second, "poll.duration_minutes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidatePoll(v, tt.poll, tt.duration)
+
+			if tt.wantKey == "" {
+				assert.True(t, v.Valid(), "errors: %v", v.Errors)
+				return
+			}
+			assert.Contains(t, v.Errors, tt.wantKey)
+		})
+	}
+}
+
+func TestValidateVote(t *testing.T) {
+	tests := []struct {
+		name      string
+		optionIDs []int64
+		valid     bool
+	}{
+		{"one option", []int64{1}, true},
+		{"several options", []int64{1, 2, 3, 4}, true},
+		{"no option", nil, false},
+		{"too many options", []int64{1, 2, 3, 4, 5}, false},
+		{"duplicate options", []int64{1, 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateVote(v, tt.optionIDs)
+			assert.Equal(t, tt.valid, v.Valid(), "errors: %v", v.Errors)
+		})
+	}
+}
+
+// createPoll inserts a post of userID carrying a poll with the given options
+// and returns the post.
+func createPoll(t *testing.T, db *sql.DB, userID int64, multipleChoice bool, expiresAt time.Time, texts ...string) *Post {
+	t.Helper()
+
+	poll := pollWith(texts...)
+	poll.MultipleChoice = multipleChoice
+	poll.ExpiresAt = expiresAt
+
+	post := &Post{UserID: userID, Content: "poll", Visibility: VisibilityPublic, Poll: poll}
+	require.NoError(t, PostModel{DB: db}.Insert(post))
+
+	return post
+}
+
+func TestPollVoteIntegration(t *testing.T) {
+	db := openTestDB(t)
+	polls := PollModel{DB: db}
+
+	author := createUser(t, db, "author")
+	voter := createUser(t, db, "voter")
+	bystander := createUser(t, db, "bystander")
+
+	post := createPoll(t, db, author, false, time.Now().Add(time.Hour), "Yes", "No")
+	yes, no := post.Poll.Options[0].ID, post.Poll.Options[1].ID
+
+	other := createPoll(t, db, author, false, time.Now().Add(time.Hour), "Up", "Down")
+	plain := createPost(t, db, author, VisibilityPublic)
+
+	// Results stay hidden until the viewer votes.
+	poll, err := polls.ForPost(post.ID, voter)
+	require.NoError(t, err)
+	assert.False(t, poll.HasVoted)
+	assert.Nil(t, poll.VotersCount)
+	assert.Nil(t, poll.Options[0].VotesCount)
+
+	assert.ErrorIs(t, polls.Vote(post.ID, voter, []int64{yes, no}), ErrSingleChoicePoll)
+	assert.ErrorIs(t, polls.Vote(post.ID, voter, []int64{other.Poll.Options[0].ID}), ErrInvalidPollOption)
+	assert.ErrorIs(t, polls.Vote(plain.ID, voter, []int64{yes}), ErrPollNotFound)
+
+	require.NoError(t, polls.Vote(post.ID, voter, []int64{yes}))
+	assert.ErrorIs(t, polls.Vote(post.ID, voter, []int64{no}), ErrAlreadyVoted)
+
+	poll, err = polls.ForPost(post.ID, voter)
+	require.NoError(t, err)
+	assert.True(t, poll.HasVoted)
+	assert.Equal(t, []int64{yes}, poll.Votes)
+	require.NotNil(t, poll.VotersCount)
+	assert.Equal(t, 1, *poll.VotersCount)
+	assert.Equal(t, 1, *poll.Options[0].VotesCount)
+	assert.Equal(t, 0, *poll.Options[1].VotesCount)
+
+	// The rejected attempts left no trace.
+	poll, err = polls.ForPost(post.ID, bystander)
+	require.NoError(t, err)
+	assert.Nil(t, poll.VotersCount)
+	assert.Empty(t, poll.Votes)
+}
+
+func TestPollVoteMultipleChoiceIntegration(t *testing.T) {
+	db := openTestDB(t)
+	polls := PollModel{DB: db}
+
+	author := createUser(t, db, "author")
+	first := createUser(t, db, "first")
+	second := createUser(t, db, "second")
+
+	post := createPoll(t, db, author, true, time.Now().Add(time.Hour), "A", "B", "C")
+	a, b, c := post.Poll.Options[0].ID, post.Poll.Options[1].ID, post.Poll.Options[2].ID
+
+	require.NoError(t, polls.Vote(post.ID, first, []int64{a, c}))
+	require.NoError(t, polls.Vote(post.ID, second, []int64{a, b}))
+	assert.ErrorIs(t, polls.Vote(post.ID, first, []int64{b}), ErrAlreadyVoted)
+
+	poll, err := polls.ForPost(post.ID, first)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{a, c}, poll.Votes)
+
+	// Voters are counted once however many options they picked.
+	assert.Equal(t, 2, *poll.VotersCount)
+	assert.Equal(t, 2, *poll.Options[0].VotesCount)
+	assert.Equal(t, 1, *poll.Options[1].VotesCount)
+	assert.Equal(t, 1, *poll.Options[2].VotesCount)
+}
+
+func TestPollVoteClosedIntegration(t *testing.T) {
+	db := openTestDB(t)
+	polls := PollModel{DB: db}
+
+	author := createUser(t, db, "author")
+	voter := createUser(t, db, "voter")
+
+	post := createPoll(t, db, author, false, time.Now().Add(-time.Minute), "Yes", "No")
+
+	assert.ErrorIs(t, polls.Vote(post.ID, voter, []int64{post.Poll.Options[0].ID}), ErrPollClosed)
+
+	// The rejected vote was rolled back, and closed polls show their results.
+	poll, err := polls.ForPost(post.ID, voter)
+	require.NoError(t, err)
+	assert.True(t, poll.Closed)
+	assert.False(t, poll.HasVoted)
+	require.NotNil(t, poll.VotersCount)
+	assert.Zero(t, *poll.VotersCount)
+	assert.Zero(t, *poll.Options[0].VotesCount)
+}
+
+func TestPollVoteConcurrentIntegration(t *testing.T) {
+	db := openTestDB(t)
+	polls := PollModel{DB: db}
+
+	author := createUser(t, db, "author")
+	post := createPoll(t, db, author, false, time.Now().Add(time.Hour), "Yes", "No")
+	yes, no := post.Poll.Options[0].ID, post.Poll.Options[1].ID
+
+	const voters = 20
+
+	var ids []int64
+	for i := range voters {
+		ids = append(ids, createUser(t, db, fmt.Sprintf("voter%d", i)))
+	}
+
+	// Every voter votes at once, half for each option.
+	var wg sync.WaitGroup
+	errs := make([]error, voters)
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			option := yes
+			if i%2 == 1 {
+				option = no
+			}
+			errs[i] = polls.Vote(post.ID, id, []int64{option})
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	poll, err := polls.ForPost(post.ID, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, voters, *poll.VotersCount)
+	assert.Equal(t, voters/2, *poll.Options[0].VotesCount)
+	assert.Equal(t, voters/2, *poll.Options[1].VotesCount)
+
+	// A single user voting many times at once is only counted once.
+	double := createUser(t, db, "double")
+
+	const attempts = 10
+
+	var (
+		mu        sync.Mutex
+		succeeded int
+	)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := polls.Vote(post.ID, double, []int64{yes})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ErrAlreadyVoted):
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+
+	poll, err = polls.ForPost(post.ID, double)
+	require.NoError(t, err)
+	assert.Equal(t, voters+1, *poll.VotersCount)
+	assert.Equal(t, voters/2+1, *poll.Options[0].VotesCount)
+}
@@ -5,61 +5,125 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	_ "github.com/bryryann/mantel/backend/internal/mapper"
+	"github.com/bryryann/mantel/backend/internal/outbox"
 	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/lib/pq"
 )
 
 var (
 	ErrPostNotFound = errors.New("post not found")
 )
 
+var (
+	// mentionRX matches @username mentions inside post content.
+	mentionRX = regexp.MustCompile(`@([A-Za-z0-9_]+)`)
+
+	// hashtagRX matches #hashtags inside post content.
+	hashtagRX = regexp.MustCompile(`#([A-Za-z0-9_]+)`)
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"-"`
-	Version   int       `json:"-"`
+	ID           int64            `json:"id"`
+	UserID       int64            `json:"user_id"`
+	Content      string           `json:"content"`
+	Visibility   PostVisibility   `json:"visibility"`
+	ReplyToID    *int64           `json:"reply_to_id,omitempty"`
+	Poll         *Poll            `json:"poll,omitempty"`
+	Reactions    *ReactionSummary `json:"reactions,omitempty"`
+	CloseFriends bool             `json:"close_friends,omitempty"` // Badges posts only the author's close friends can read.
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"-"`
+	Version      int              `json:"-"`
 }
 
 func (p Post) ToPublic() any {
 	return PostPublic{
-		ID:        p.ID,
-		UserID:    p.UserID,
-		Content:   p.Content,
-		CreatedAt: p.CreatedAt,
+		ID:           p.ID,
+		UserID:       p.UserID,
+		Content:      p.Content,
+		Visibility:   p.Visibility,
+		ReplyToID:    p.ReplyToID,
+		Poll:         p.Poll,
+		Reactions:    p.Reactions,
+		CloseFriends: p.CloseFriends,
+		CreatedAt:    p.CreatedAt,
 	}
 }
 
 type PostPublic struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           int64            `json:"id"`
+	UserID       int64            `json:"user_id"`
+	Content      string           `json:"content"`
+	Visibility   PostVisibility   `json:"visibility"`
+	ReplyToID    *int64           `json:"reply_to_id,omitempty"`
+	Poll         *Poll            `json:"poll,omitempty"`
+	Reactions    *ReactionSummary `json:"reactions,omitempty"`
+	Pinned       bool             `json:"pinned"`
+	CloseFriends bool             `json:"close_friends,omitempty"` // Badges posts only the author's close friends can read.
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// ParseMentions returns the distinct usernames @mentioned in content, in
+// order of first appearance.
+func ParseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionRX.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			usernames = append(usernames, match[1])
+		}
+	}
+
+	return usernames
+}
+
+// ParseHashtags returns the distinct, lowercased hashtags used in content,
+// without the leading '#'.
+func ParseHashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, match := range hashtagRX.FindAllStringSubmatch(content, -1) {
+		tag := strings.ToLower(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
 }
 
 type PostModel struct {
 	DB *sql.DB
 }
 
-func (m PostModel) Get(id int64) (*Post, error) {
-	query := `
-		SELECT user_id, content, created_at, updated_at, version
-		FROM posts
-		WHERE id = $1
-	`
+// Get retrieves a post by id, as long as viewerID is allowed to read it.
+// Posts hidden from the viewer are reported as ErrRecordNotFound.
+func (m PostModel) Get(id, viewerID int64) (*Post, error) {
+	query := fmt.Sprintf(`
+		SELECT p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at, p.updated_at, p.version
+		FROM posts p
+		WHERE p.id = $1 AND %s
+	`, visibleTo("p", "$2"))
 
 	post := Post{ID: id}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, viewerID).Scan(
 		&post.UserID,
 		&post.Content,
+		&post.Visibility,
+		&post.ReplyToID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Version,
@@ -76,107 +140,258 @@ func (m PostModel) Get(id int64) (*Post, error) {
 	return &post, nil
 }
 
+// Insert adds a new post, along with the users it mentions, the hashtags it
+// uses and its poll, if any, to the database, and records an
+// outbox.PostCreated event.
 func (m PostModel) Insert(post *Post) error {
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
+
 	query := `
-		INSERT INTO posts (user_id, content)
-		VALUES ($1, $2)
+		INSERT INTO posts (user_id, content, visibility, reply_to_id)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at`
 
-	args := []any{post.UserID, post.Content}
+	args := []any{post.UserID, post.Content, post.Visibility, post.ReplyToID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&post.ID, &post.CreatedAt)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&post.ID, &post.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = insertMentions(ctx, tx, post.ID, ParseMentions(post.Content))
+	if err != nil {
+		return err
+	}
+
+	err = insertHashtags(ctx, tx, post.ID, ParseHashtags(post.Content))
+	if err != nil {
+		return err
+	}
+
+	if post.Poll != nil {
+		err = insertPoll(ctx, tx, post.ID, post.Poll)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordEvent(ctx, tx, outbox.PostCreated, post.UserID, outbox.Post{
+		PostID:    post.ID,
+		AuthorID:  post.UserID,
+		ReplyToID: post.ReplyToID,
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (m PostModel) Delete(postID int64) error {
+// insertMentions records which existing users are mentioned in a post.
+// Unknown usernames are silently ignored.
+func insertMentions(ctx context.Context, tx *sql.Tx, postID int64, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, id FROM users
+		WHERE username = ANY($2) AND id <> (SELECT user_id FROM posts WHERE id = $1)
+		ON CONFLICT (post_id, user_id) DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(usernames))
+	return err
+}
+
+// insertHashtags records the hashtags used in a post.
+func insertHashtags(ctx context.Context, tx *sql.Tx, postID int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
 	query := `
-		DELETE FROM posts
-		WHERE id = $1`
+		INSERT INTO post_hashtags (post_id, tag)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (post_id, tag) DO NOTHING`
 
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(tags))
+	return err
+}
+
+// Delete removes a post, recording an outbox.PostDeleted event if there was
+// one.
+func (m PostModel) Delete(postID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, postID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err.Err()
+		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	var authorID int64
+	err = tx.QueryRowContext(ctx, `DELETE FROM posts WHERE id = $1 RETURNING user_id`, postID).Scan(&authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	err = recordEvent(ctx, tx, outbox.PostDeleted, authorID, outbox.Post{PostID: postID, AuthorID: authorID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// SelectAllFromUser lists the posts written by userID that viewerID is allowed
+// to read.
+//
+// With offset pagination pinned posts come first, in pinned order. With keyset
+// pagination pinned posts are left out, to be listed through
+// PinModel.ListPinned alongside the first page.
 func (m PostModel) SelectAllFromUser(
-	userID int64,
+	userID, viewerID int64,
 	pagination Pagination,
-) ([]PostPublic, error) {
-	var sortColumn string
+) ([]PostPublic, PageInfo, error) {
+	var desc bool
 	switch strings.ToLower(pagination.Sort) {
-	case "asc", "oldest", "old":
-		sortColumn = "created_at ASC"
 	case "desc", "newest", "new":
-		sortColumn = "created_at DESC"
-	default:
-		sortColumn = "created_at ASC"
+		desc = true
 	}
 
+	offsetOrder := "pp.position ASC NULLS LAST, p.created_at ASC"
+	if desc {
+		offsetOrder = "pp.position ASC NULLS LAST, p.created_at DESC"
+	}
+
+	pinned := "TRUE"
+	if !pagination.UsesOffset() {
+		pinned = "pp.post_id IS NULL"
+	}
+
+	args := []any{userID, viewerID}
+	where, orderBy, limit, args := pagination.clauses("p.created_at", "p.id", desc, offsetOrder, args)
+
 	query := fmt.Sprintf(`
-		SELECT id, user_id, content, created_at
-		FROM posts
-		WHERE user_id = $1
+		SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at,
+			pp.post_id IS NOT NULL AS pinned
+		FROM posts p
+		LEFT JOIN pinned_posts pp ON pp.post_id = p.id
+		WHERE p.user_id = $1 AND %s AND %s AND %s
 		ORDER BY %s
-		LIMIT $2 OFFSET $3
-	`, sortColumn)
+		%s
+	`, visibleTo("p", "$2"), pinned, where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{userID, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
-	var posts []PostPublic
+	var (
+		posts []PostPublic
+		keys  []Cursor
+	)
 	for rows.Next() {
 		var p PostPublic
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Content, &p.CreatedAt); err != nil {
-			return nil, err
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Content, &p.Visibility, &p.ReplyToID, &p.CreatedAt, &p.Pinned); err != nil {
+			return nil, PageInfo{}, err
 		}
 		posts = append(posts, p)
+		keys = append(keys, Cursor{CreatedAt: p.CreatedAt, ID: p.ID})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	return posts, nil
+	posts, info := paginate(posts, keys, pagination)
+	return posts, info, nil
 }
 
-func (m PostModel) FindByIDFromUser(postID, userID int64) (*Post, error) {
-	query := `
-		SELECT id, user_id, content, created_at, updated_at, version
-		FROM posts 
-		WHERE id = $1 AND user_id = $2
-	`
+// ListReplies lists the replies to postID that viewerID is allowed to read,
+// oldest first.
+func (m PostModel) ListReplies(postID, viewerID int64, pagination Pagination) ([]PostPublic, PageInfo, error) {
+	args := []any{postID, viewerID}
+	where, orderBy, limit, args := pagination.clauses("p.created_at", "p.id", false, "p.created_at ASC, p.id ASC", args)
+
+	query := fmt.Sprintf(`
+		SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at
+		FROM posts p
+		WHERE p.reply_to_id = $1 AND %s AND %s
+		ORDER BY %s
+		%s`, visibleTo("p", "$2"), where, orderBy, limit)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{postID, userID}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		replies []PostPublic
+		keys    []Cursor
+	)
+	for rows.Next() {
+		var p PostPublic
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Content, &p.Visibility, &p.ReplyToID, &p.CreatedAt); err != nil {
+			return nil, PageInfo{}, err
+		}
+		replies = append(replies, p)
+		keys = append(keys, Cursor{CreatedAt: p.CreatedAt, ID: p.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	replies, info := paginate(replies, keys, pagination)
+	return replies, info, nil
+}
+
+// FindByIDFromUser retrieves a post written by userID, as long as viewerID is
+// allowed to read it. Hidden posts are reported as sql.ErrNoRows.
+func (m PostModel) FindByIDFromUser(postID, userID, viewerID int64) (*Post, error) {
+	query := fmt.Sprintf(`
+		SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at, p.updated_at, p.version
+		FROM posts p
+		WHERE p.id = $1 AND p.user_id = $2 AND %s
+	`, visibleTo("p", "$3"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{postID, userID, viewerID}
 
 	var post Post
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&post.ID,
 		&post.UserID,
 		&post.Content,
+		&post.Visibility,
+		&post.ReplyToID,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		&post.Version,
@@ -188,10 +403,13 @@ func (m PostModel) FindByIDFromUser(postID, userID int64) (*Post, error) {
 	return &post, nil
 }
 
+// PatchPost updates the content and visibility of a post, refreshing the
+// users it mentions and the hashtags it uses. Posts made non-public are
+// unpinned.
 func (m PostModel) PatchPost(post *Post) (*Post, error) {
 	query := `
 		UPDATE posts
-		SET content = $3, updated_at = $4
+		SET content = $3, visibility = $4, updated_at = $5
 		WHERE id = $1 AND user_id = $2
 		RETURNING updated_at
 	`
@@ -200,6 +418,7 @@ func (m PostModel) PatchPost(post *Post) (*Post, error) {
 		post.ID,
 		post.UserID,
 		post.Content,
+		post.Visibility,
 		time.Now(),
 	}
 
@@ -207,11 +426,51 @@ func (m PostModel) PatchPost(post *Post) (*Post, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&patched.UpdatedAt)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&patched.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	// Only public posts can stay pinned.
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM pinned_posts WHERE post_id = $1 AND $2 <> 'public'`,
+		post.ID, post.Visibility,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertMentions(ctx, tx, post.ID, ParseMentions(post.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM post_hashtags WHERE post_id = $1`, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertHashtags(ctx, tx, post.ID, ParseHashtags(post.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	return &patched, nil
 }
 
@@ -257,7 +516,29 @@ func (m PostModel) Exists(postID int64) (bool, error) {
 	return true, nil
 }
 
+// IsVisibleTo reports whether the post exists and viewerID is allowed to read it.
+func (m PostModel) IsVisibleTo(postID, viewerID int64) (bool, error) {
+	query := fmt.Sprintf(`
+		SELECT EXISTS (
+			SELECT 1 FROM posts p
+			WHERE p.id = $1 AND %s
+		)
+	`, visibleTo("p", "$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var visible bool
+	err := m.DB.QueryRowContext(ctx, query, postID, viewerID).Scan(&visible)
+	if err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
 func ValidatePost(v *validator.Validator, post *Post) {
 	v.Check(post.Content != "", "content", "must be provided")
 	v.Check(len(post.Content) <= 500, "content", "must be no more than 500 bytes long")
+	v.Check(post.Visibility.IsValid(), "visibility", "must be one of public, followers, friends, close_friends or mentioned")
 }
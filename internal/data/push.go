@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+)
+
+// PushSubscription is a device subscribed to Web Push notifications on
+// behalf of a user.
+type PushSubscription struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"-"`
+	Auth      string    `json:"-"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PushSubscriptionModel struct {
+	DB *sql.DB
+}
+
+// Save stores sub. An endpoint belongs to a single device, so saving a known
+// endpoint updates its keys and moves it to sub.UserID.
+func (m PushSubscriptionModel) Save(sub *PushSubscription) error {
+	query := `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+			p256dh = EXCLUDED.p256dh,
+			auth = EXCLUDED.auth,
+			user_agent = EXCLUDED.user_agent
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent).
+		Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// ForUser returns the subscriptions of userID, newest first.
+func (m PushSubscriptionModel) ForUser(userID int64) ([]PushSubscription, error) {
+	query := `
+		SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// Delete deletes subscription id of userID. Returns ErrRecordNotFound if
+// userID has no such subscription.
+func (m PushSubscriptionModel) Delete(userID, id int64) error {
+	query := `
+		DELETE FROM push_subscriptions
+		WHERE id = $1 AND user_id = $2
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DeleteEndpoint deletes the subscription of endpoint, if any. Used to prune
+// subscriptions push services report gone.
+func (m PushSubscriptionModel) DeleteEndpoint(endpoint string) error {
+	query := `DELETE FROM push_subscriptions WHERE endpoint = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, endpoint)
+	return err
+}
+
+func ValidatePushSubscription(v *validator.Validator, sub *PushSubscription) {
+	u, err := url.Parse(sub.Endpoint)
+	v.Check(sub.Endpoint != "", "endpoint", "must be provided")
+	v.Check(err == nil && u.Scheme == "https" && u.Host != "", "endpoint", "must be an https URL")
+	v.Check(len(sub.Endpoint) <= 2048, "endpoint", "must be no more than 2048 characters long")
+	v.Check(sub.P256dh != "", "keys.p256dh", "must be provided")
+	v.Check(sub.Auth != "", "keys.auth", "must be provided")
+}
@@ -0,0 +1,296 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/lib/pq"
+)
+
+// LikeReaction is the reaction backing the legacy /likes endpoints.
+const LikeReaction = "👍"
+
+// DefaultReactions is the set of reactions allowed when none is configured.
+var DefaultReactions = []string{LikeReaction, "❤️", "😂", "😮", "😢", "😡"}
+
+type Reaction struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	PostID    int64     `json:"post_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReactionPublic struct {
+	UserID    int64     `json:"user_id"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary aggregates the reactions left on a post.
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	Mine   []string       `json:"mine,omitempty"` // Reactions left by the viewer.
+}
+
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+// React records userID reacting to postID. When exclusive is set, any other
+// reaction the user left on the post is replaced. A nil reaction is returned
+// if the user had already left this exact reaction.
+func (m ReactionModel) React(userID, postID int64, reaction string, exclusive bool) (*Reaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if exclusive {
+		// Serialize reactions of the same user on the same post, so two
+		// concurrent reactions can't both survive the replacement below.
+		_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1::int, $2::int)`, userID, postID)
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := tx.QueryContext(
+			ctx,
+			`DELETE FROM reactions WHERE user_id = $1 AND post_id = $2 AND reaction <> $3 RETURNING reaction`,
+			userID, postID, reaction,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		replaced, err := scanReactions(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		err = recordReactionEvents(ctx, tx, outbox.ReactionDeleted, userID, postID, replaced)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		INSERT INTO reactions (user_id, post_id, reaction)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, post_id, reaction) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	r := Reaction{
+		UserID:   userID,
+		PostID:   postID,
+		Reaction: reaction,
+	}
+	err = tx.QueryRowContext(ctx, query, userID, postID, reaction).Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, tx.Commit()
+		}
+		return nil, err
+	}
+
+	err = recordReactionEvents(ctx, tx, outbox.ReactionCreated, userID, postID, []string{reaction})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// Unreact removes userID's reaction from postID. An empty reaction removes
+// every reaction the user left on the post. Returns sql.ErrNoRows if there
+// was nothing to remove.
+func (m ReactionModel) Unreact(userID, postID int64, reaction string) error {
+	query := `
+		DELETE FROM reactions
+		WHERE user_id = $1 AND post_id = $2 AND ($3 = '' OR reaction = $3)
+		RETURNING reaction
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, userID, postID, reaction)
+	if err != nil {
+		return err
+	}
+
+	removed, err := scanReactions(rows)
+	if err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = recordReactionEvents(ctx, tx, outbox.ReactionDeleted, userID, postID, removed)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanReactions reads the reactions returned by rows, closing them.
+func scanReactions(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var reactions []string
+	for rows.Next() {
+		var reaction string
+		if err := rows.Scan(&reaction); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reactions, nil
+}
+
+// List returns who reacted to postID. An empty reaction lists every reaction.
+func (m ReactionModel) List(
+	postID int64,
+	reaction string,
+	pagination Pagination,
+) ([]ReactionPublic, PageInfo, error) {
+	desc := true
+	offsetOrder := "created_at DESC"
+	switch strings.ToLower(pagination.Sort) {
+	case "asc", "oldest", "old":
+		desc = false
+		offsetOrder = "created_at ASC"
+	}
+
+	args := []any{postID, reaction}
+	where, orderBy, limit, args := pagination.clauses("created_at", "id", desc, offsetOrder, args)
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, reaction, created_at
+		FROM reactions
+		WHERE post_id = $1 AND ($2 = '' OR reaction = $2) AND %s
+		ORDER BY %s
+		%s
+	`, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		reactions []ReactionPublic
+		keys      []Cursor
+	)
+	for rows.Next() {
+		var (
+			r  ReactionPublic
+			id int64
+		)
+		if err := rows.Scan(&id, &r.UserID, &r.Reaction, &r.CreatedAt); err != nil {
+			return nil, PageInfo{}, err
+		}
+		reactions = append(reactions, r)
+		keys = append(keys, Cursor{CreatedAt: r.CreatedAt, ID: id})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	reactions, info := paginate(reactions, keys, pagination)
+	return reactions, info, nil
+}
+
+// ForPosts aggregates the reactions of the given posts, keyed by post id.
+// Posts without reactions get an empty summary.
+func (m ReactionModel) ForPosts(postIDs []int64, viewerID int64) (map[int64]*ReactionSummary, error) {
+	summaries := make(map[int64]*ReactionSummary, len(postIDs))
+	for _, id := range postIDs {
+		summaries[id] = &ReactionSummary{Counts: map[string]int{}}
+	}
+
+	if len(postIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := `
+		SELECT post_id, reaction, COUNT(*), BOOL_OR(user_id = $2)
+		FROM reactions
+		WHERE post_id = ANY($1)
+		GROUP BY post_id, reaction
+		ORDER BY post_id, COUNT(*) DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			postID   int64
+			reaction string
+			count    int
+			mine     bool
+		)
+
+		if err := rows.Scan(&postID, &reaction, &count, &mine); err != nil {
+			return nil, err
+		}
+
+		summary := summaries[postID]
+		summary.Counts[reaction] = count
+		if mine {
+			summary.Mine = append(summary.Mine, reaction)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// ValidateReaction checks that reaction is one of the allowed reactions.
+func ValidateReaction(v *validator.Validator, reaction string, allowed []string) {
+	v.Check(reaction != "", "reaction", "must be provided")
+	v.Check(validator.In(reaction, allowed...), "reaction", "must be one of "+strings.Join(allowed, " "))
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/bryryann/mantel/backend/internal/outbox"
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReaction(t *testing.T) {
+	allowed := []string{LikeReaction, "🔥"}
+
+	tests := []struct {
+		name     string
+		reaction string
+		valid    bool
+	}{
+		{"like", LikeReaction, true},
+		{"other allowed", "🔥", true},
+		{"empty", "", false},
+		{"default but not allowed", "😂", false},
+		{"not an emoji", "like", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateReaction(v, tt.reaction, allowed)
+			assert.Equal(t, tt.valid, v.Valid(), "errors: %v", v.Errors)
+		})
+	}
+}
+
+// reactionEvents returns the type and reaction of the reaction events
+// recorded in the outbox.
+func reactionEvents(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT type || ' ' || (data->>'reaction')
+		FROM outbox_events
+		WHERE type IN ($1, $2)
+		ORDER BY id`,
+		outbox.ReactionCreated, outbox.ReactionDeleted,
+	)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var events []string
+	for rows.Next() {
+		var event string
+		require.NoError(t, rows.Scan(&event))
+		events = append(events, event)
+	}
+	require.NoError(t, rows.Err())
+
+	return events
+}
+
+func TestReactIntegration(t *testing.T) {
+	db := openTestDB(t)
+	reactions := ReactionModel{DB: db}
+
+	author := createUser(t, db, "author")
+	user := createUser(t, db, "user")
+	post := createPost(t, db, author, VisibilityPublic)
+
+	r, err := reactions.React(user, post.ID, "🔥", false)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "🔥", r.Reaction)
+
+	// Reacting twice the same way is a no-op.
+	r, err = reactions.React(user, post.ID, "🔥", false)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	// Without exclusivity, reactions add up.
+	_, err = reactions.React(user, post.ID, "❤️", false)
+	require.NoError(t, err)
+	_, err = reactions.React(author, post.ID, "🔥", false)
+	require.NoError(t, err)
+
+	summaries, err := reactions.ForPosts([]int64{post.ID}, user)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"🔥": 2, "❤️": 1}, summaries[post.ID].Counts)
+	assert.ElementsMatch(t, []string{"🔥", "❤️"}, summaries[post.ID].Mine)
+
+	list, _, err := reactions.List(post.ID, "🔥", Pagination{PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	for _, r := range list {
+		assert.Equal(t, "🔥", r.Reaction)
+	}
+
+	// An exclusive reaction replaces the others.
+	_, err = reactions.React(user, post.ID, "😂", true)
+	require.NoError(t, err)
+
+	summaries, err = reactions.ForPosts([]int64{post.ID}, user)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"🔥": 1, "😂": 1}, summaries[post.ID].Counts)
+	assert.Equal(t, []string{"😂"}, summaries[post.ID].Mine)
+
+	// Unreacting toggles a single reaction off, or every one when empty.
+	require.NoError(t, reactions.Unreact(author, post.ID, "🔥"))
+	assert.ErrorIs(t, reactions.Unreact(author, post.ID, "🔥"), sql.ErrNoRows)
+
+	_, err = reactions.React(user, post.ID, "❤️", false)
+	require.NoError(t, err)
+	require.NoError(t, reactions.Unreact(user, post.ID, ""))
+	assert.ErrorIs(t, reactions.Unreact(user, post.ID, ""), sql.ErrNoRows)
+
+	summaries, err = reactions.ForPosts([]int64{post.ID}, user)
+	require.NoError(t, err)
+	assert.Empty(t, summaries[post.ID].Counts)
+	assert.Empty(t, summaries[post.ID].Mine)
+
+	// Every change was recorded for the outbox consumers, no-ops aside.
+	assert.ElementsMatch(t, []string{
+		outbox.ReactionCreated + " 🔥",
+		outbox.ReactionCreated + " ❤️",
+		outbox.ReactionCreated + " 🔥",
+		outbox.ReactionDeleted + " 🔥",
+		outbox.ReactionDeleted + " ❤️",
+		outbox.ReactionCreated + " 😂",
+		outbox.ReactionDeleted + " 🔥",
+		outbox.ReactionCreated + " ❤️",
+		outbox.ReactionDeleted + " 😂",
+		outbox.ReactionDeleted + " ❤️",
+	}, reactionEvents(t, db))
+}
+
+func TestLikesAreReactionsIntegration(t *testing.T) {
+	db := openTestDB(t)
+	likes := &LikeModel{DB: db}
+	reactions := ReactionModel{DB: db}
+
+	author := createUser(t, db, "author")
+	user := createUser(t, db, "user")
+	post := createPost(t, db, author, VisibilityPublic)
+
+	like, err := likes.Like(user, post.ID, false)
+	require.NoError(t, err)
+	require.NotNil(t, like)
+
+	like, err = likes.Like(user, post.ID, false)
+	require.NoError(t, err)
+	assert.Nil(t, like, "liking twice")
+
+	// A like is the like reaction, and shows up as one.
+	summaries, err := reactions.ForPosts([]int64{post.ID}, user)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{LikeReaction: 1}, summaries[post.ID].Counts)
+
+	// Only like reactions count as likes.
+	_, err = reactions.React(author, post.ID, "🔥", false)
+	require.NoError(t, err)
+
+	count, err := likes.CountLikes(post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	list, _, err := likes.ListLikesFromPost(post.ID, Pagination{PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, user, list[0].UserID)
+
+	liked, err := likes.IsLikedBy(author, post.ID)
+	require.NoError(t, err)
+	assert.False(t, liked)
+
+	// Reacting with the like reaction is liking.
+	_, err = reactions.React(author, post.ID, LikeReaction, false)
+	require.NoError(t, err)
+
+	liked, err = likes.IsLikedBy(author, post.ID)
+	require.NoError(t, err)
+	assert.True(t, liked)
+
+	// An exclusive like replaces other reactions, and disliking only removes
+	// the like.
+	_, err = likes.Like(author, post.ID, true)
+	require.NoError(t, err)
+
+	summaries, err = reactions.ForPosts([]int64{post.ID}, author)
+	require.NoError(t, err)
+	assert.Equal(t, []string{LikeReaction}, summaries[post.ID].Mine)
+
+	_, err = reactions.React(user, post.ID, "🔥", false)
+	require.NoError(t, err)
+	require.NoError(t, likes.Dislike(user, post.ID))
+	assert.ErrorIs(t, likes.Dislike(user, post.ID), sql.ErrNoRows)
+
+	summaries, err = reactions.ForPosts([]int64{post.ID}, user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"🔥"}, summaries[post.ID].Mine)
+
+	count, err = likes.CountLikes(post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Mutuals is a sample of the users connecting a viewer to another user,
+// along with how many there are in total.
+type Mutuals struct {
+	Count  int          `json:"count"`
+	Sample []UserPublic `json:"sample"`
+}
+
+// Relationship summarizes how a viewer relates to another user.
+type Relationship struct {
+	UserID           int64   `json:"user_id"`
+	Following        bool    `json:"following"`   // The viewer follows the user.
+	FollowedBy       bool    `json:"followed_by"` // The user follows the viewer.
+	FriendshipStatus string  `json:"friendship_status"`
+	Blocking         bool    `json:"blocking"`   // The viewer blocked the user.
+	BlockedBy        bool    `json:"blocked_by"` // The user blocked the viewer.
+	Muting           bool    `json:"muting"`
+	MutualFollowers  Mutuals `json:"mutual_followers"` // Users the viewer follows who follow the user.
+	MutualFriends    Mutuals `json:"mutual_friends"`   // Friends of both the viewer and the user.
+}
+
+// RelationshipModel reads relationships across follows, friendships and
+// mutes.
+type RelationshipModel struct {
+	DB *sql.DB
+}
+
+// Get returns how viewerID relates to userID, with up to sample users of
+// each kind of mutual connection. Mutual connections are left empty when
+// either user blocked the other, and users involved in a block with the
+// viewer never appear in them.
+func (m RelationshipModel) Get(viewerID, userID int64, sample int) (*Relationship, error) {
+	rel := &Relationship{
+		UserID:          userID,
+		MutualFollowers: Mutuals{Sample: []UserPublic{}},
+		MutualFriends:   Mutuals{Sample: []UserPublic{}},
+	}
+
+	status, err := FriendshipModel{DB: m.DB}.GetFriendshipStatus(viewerID, userID)
+	if err != nil {
+		return nil, err
+	}
+	rel.FriendshipStatus = status
+
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM follows WHERE follower_id = $1 AND followee_id = $2),
+			EXISTS (SELECT 1 FROM follows WHERE follower_id = $2 AND followee_id = $1),
+			EXISTS (
+				SELECT 1 FROM friendships
+				WHERE status = 'blocked' AND receiver_id = $1 AND sender_id = $2
+			),
+			EXISTS (
+				SELECT 1 FROM friendships
+				WHERE status = 'blocked' AND receiver_id = $2 AND sender_id = $1
+			),
+			EXISTS (SELECT 1 FROM mutes WHERE user_id = $1 AND muted_id = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, viewerID, userID).Scan(
+		&rel.Following,
+		&rel.FollowedBy,
+		&rel.Blocking,
+		&rel.BlockedBy,
+		&rel.Muting,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if rel.Blocking || rel.BlockedBy {
+		return rel, nil
+	}
+
+	// Most recent followers of the user first.
+	rel.MutualFollowers, err = m.mutuals(ctx, fmt.Sprintf(`
+		SELECT u.id, u.username, theirs.created_at
+		FROM follows mine
+		JOIN follows theirs ON theirs.follower_id = mine.followee_id AND theirs.followee_id = $2
+		JOIN users u ON u.id = mine.followee_id
+		WHERE mine.follower_id = $1 AND %s`, notBlocked("u.id", "$1")),
+		"created_at DESC, id",
+		viewerID, userID, sample,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rel.MutualFriends, err = m.mutuals(ctx, `
+		SELECT u.id, u.username
+		FROM users u
+		WHERE u.id IN (
+				SELECT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END
+				FROM friendships
+				WHERE status = 'accepted' AND $1 IN (sender_id, receiver_id)
+			)
+			AND u.id IN (
+				SELECT CASE WHEN sender_id = $2 THEN receiver_id ELSE sender_id END
+				FROM friendships
+				WHERE status = 'accepted' AND $2 IN (sender_id, receiver_id)
+			)`,
+		"username, id",
+		viewerID, userID, sample,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rel, nil
+}
+
+// mutuals counts the mutual connections between viewerID and userID selected
+// by query, as its $1 and $2, and samples up to sample of them in the given
+// order. query selects at least their id and username.
+func (m RelationshipModel) mutuals(ctx context.Context, query, orderBy string, viewerID, userID int64, sample int) (Mutuals, error) {
+	mutuals := Mutuals{Sample: []UserPublic{}}
+
+	err := m.DB.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM (%s) mutual`, query), viewerID, userID).
+		Scan(&mutuals.Count)
+	if err != nil {
+		return Mutuals{}, err
+	}
+
+	if mutuals.Count == 0 || sample == 0 {
+		return mutuals, nil
+	}
+
+	rows, err := m.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, username
+		FROM (%s) mutual
+		ORDER BY %s
+		LIMIT $3`, query, orderBy),
+		viewerID, userID, sample,
+	)
+	if err != nil {
+		return Mutuals{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u UserPublic
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return Mutuals{}, err
+		}
+		mutuals.Sample = append(mutuals.Sample, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Mutuals{}, err
+	}
+
+	return mutuals, nil
+}
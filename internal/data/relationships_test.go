@@ -0,0 +1,124 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usernames returns the usernames of users, in order.
+func usernames(users []UserPublic) []string {
+	names := []string{}
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+func TestRelationshipIntegration(t *testing.T) {
+	db := openTestDB(t)
+	relationships := RelationshipModel{DB: db}
+
+	viewer := createUser(t, db, "viewer")
+	user := createUser(t, db, "user")
+
+	follow(t, db, viewer, user)
+	befriend(t, db, user, viewer, "pending")
+
+	// Followed by the viewer, and following the user in this order.
+	for i, name := range []string{"carol", "alice", "bob"} {
+		id := createUser(t, db, name)
+		follow(t, db, viewer, id)
+
+		_, err := db.Exec(`
+			INSERT INTO follows (follower_id, followee_id, created_at)
+			VALUES ($1, $2, NOW() - $3 * INTERVAL '1 minute')`,
+			id, user, 3-i,
+		)
+		require.NoError(t, err)
+	}
+
+	// Friends with both.
+	for _, name := range []string{"erin", "dave"} {
+		id := createUser(t, db, name)
+		befriend(t, db, viewer, id, "accepted")
+		befriend(t, db, id, user, "accepted")
+	}
+
+	// Not mutual: followed by the viewer only, or a friend request.
+	follow(t, db, viewer, createUser(t, db, "frank"))
+	grace := createUser(t, db, "grace")
+	befriend(t, db, viewer, grace, "accepted")
+	befriend(t, db, grace, user, "pending")
+
+	rel, err := relationships.Get(viewer, user, 2)
+	require.NoError(t, err)
+	assert.True(t, rel.Following)
+	assert.False(t, rel.FollowedBy)
+	assert.Equal(t, "pending", rel.FriendshipStatus)
+	assert.False(t, rel.Blocking)
+
+	assert.Equal(t, 3, rel.MutualFollowers.Count)
+	assert.Equal(t, []string{"bob", "alice"}, usernames(rel.MutualFollowers.Sample))
+	assert.Equal(t, 2, rel.MutualFriends.Count)
+	assert.Equal(t, []string{"dave", "erin"}, usernames(rel.MutualFriends.Sample))
+
+	// Counts don't depend on the sample size.
+	rel, err = relationships.Get(viewer, user, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, rel.MutualFollowers.Count)
+	assert.Empty(t, rel.MutualFollowers.Sample)
+	assert.Equal(t, 2, rel.MutualFriends.Count)
+	assert.Empty(t, rel.MutualFriends.Sample)
+
+	rel, err = relationships.Get(viewer, user, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "alice", "carol"}, usernames(rel.MutualFollowers.Sample))
+	assert.Equal(t, 3, rel.MutualFollowers.Count)
+
+	// The other way around.
+	rel, err = relationships.Get(user, viewer, 10)
+	require.NoError(t, err)
+	assert.False(t, rel.Following)
+	assert.True(t, rel.FollowedBy)
+	assert.Zero(t, rel.MutualFollowers.Count)
+	assert.Equal(t, 2, rel.MutualFriends.Count)
+}
+
+func TestRelationshipBlocksIntegration(t *testing.T) {
+	db := openTestDB(t)
+	relationships := RelationshipModel{DB: db}
+
+	viewer := createUser(t, db, "viewer")
+	user := createUser(t, db, "user")
+	blocker := createUser(t, db, "blocker")
+	mutual := createUser(t, db, "mutual")
+
+	for _, id := range []int64{blocker, mutual} {
+		follow(t, db, viewer, id)
+		follow(t, db, id, user)
+	}
+
+	// Users involved in a block with the viewer aren't mutuals.
+	befriend(t, db, blocker, viewer, "blocked")
+
+	rel, err := relationships.Get(viewer, user, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rel.MutualFollowers.Count)
+	assert.Equal(t, []string{"mutual"}, usernames(rel.MutualFollowers.Sample))
+
+	// Nor is anyone once the viewer and the user block each other.
+	befriend(t, db, viewer, user, "blocked")
+
+	rel, err = relationships.Get(viewer, user, 10)
+	require.NoError(t, err)
+	assert.True(t, rel.Blocking)
+	assert.Zero(t, rel.MutualFollowers.Count)
+	assert.Empty(t, rel.MutualFollowers.Sample)
+
+	rel, err = relationships.Get(user, viewer, 10)
+	require.NoError(t, err)
+	assert.True(t, rel.BlockedBy)
+	assert.Zero(t, rel.MutualFollowers.Count)
+}
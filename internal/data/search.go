@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrEmptySearchQuery = errors.New("search query must contain at least one word")
+)
+
+// searchTermRX splits a search query into "quoted phrases" and bare terms.
+var searchTermRX = regexp.MustCompile(`"([^"]*)"|(\S+)`)
+
+// PostSearchFilters narrows a full-text post search.
+type PostSearchFilters struct {
+	Query  string     // Raw user query; see ParseSearchQuery for the syntax.
+	Author string     // Username of the author, empty for any author.
+	Since  *time.Time // Only posts created at or after this instant.
+	Until  *time.Time // Only posts created strictly before this instant.
+}
+
+// PostSearchResult is a post matching a search, with its relevance and a
+// highlighted excerpt of the matching content.
+type PostSearchResult struct {
+	PostPublic
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// Hashtag is a hashtag along with how many readable posts use it.
+type Hashtag struct {
+	Tag        string `json:"tag"`
+	PostsCount int    `json:"posts_count"`
+}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// ParseSearchQuery converts a user supplied query into a to_tsquery
+// expression. Bare words are AND-ed together, "quoted phrases" must appear
+// in order and a trailing '*' turns a word into a prefix match (e.g. gopher*).
+// Any punctuation is stripped, so the result is always safe to hand to
+// to_tsquery. An empty string is returned if the query has no usable words.
+func ParseSearchQuery(q string) string {
+	var parts []string
+
+	for _, match := range searchTermRX.FindAllStringSubmatch(q, -1) {
+		if match[2] == "" {
+			// Quoted phrase.
+			if lexemes := searchLexemes(match[1]); len(lexemes) > 0 {
+				parts = append(parts, strings.Join(lexemes, " <-> "))
+			}
+			continue
+		}
+
+		term := match[2]
+		prefix := strings.HasSuffix(term, "*")
+
+		lexemes := searchLexemes(term)
+		if len(lexemes) == 0 {
+			continue
+		}
+
+		if prefix {
+			lexemes[len(lexemes)-1] += ":*"
+		}
+		parts = append(parts, strings.Join(lexemes, " <-> "))
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// searchLexemes splits s into lowercase runs of letters and digits.
+func searchLexemes(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchPosts runs a ranked full-text search over the posts viewerID is
+// allowed to read. Results are ordered by relevance, newest first on ties.
+func (m SearchModel) SearchPosts(
+	filters PostSearchFilters,
+	viewerID int64,
+	pagination Pagination,
+) ([]PostSearchResult, PageInfo, error) {
+	tsquery := ParseSearchQuery(filters.Query)
+	if tsquery == "" {
+		return nil, PageInfo{}, ErrEmptySearchQuery
+	}
+
+	args := []any{
+		tsquery,
+		filters.Author,
+		filters.Since,
+		filters.Until,
+		viewerID,
+	}
+	limit, args := pagination.rankedClauses(args)
+
+	query := fmt.Sprintf(`
+		WITH q AS (
+			SELECT to_tsquery('english', $1) AS query
+		),
+		ranked AS (
+			SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at,
+				ts_rank_cd(p.search_vector, q.query) AS rank
+			FROM posts p
+			JOIN users u ON u.id = p.user_id
+			CROSS JOIN q
+			WHERE p.search_vector @@ q.query
+				AND ($2::text = '' OR u.username = $2::text)
+				AND ($3::timestamptz IS NULL OR p.created_at >= $3::timestamptz)
+				AND ($4::timestamptz IS NULL OR p.created_at < $4::timestamptz)
+				AND %s
+			ORDER BY rank DESC, p.created_at DESC, p.id DESC
+			%s
+		)
+		SELECT r.id, r.user_id, r.content, r.visibility, r.reply_to_id, r.created_at, r.rank,
+			ts_headline(
+				'english', r.content, q.query,
+				'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2'
+			)
+		FROM ranked r
+		CROSS JOIN q
+		ORDER BY r.rank DESC, r.created_at DESC, r.id DESC
+	`, visibleTo("p", "$5"), limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var results []PostSearchResult
+	for rows.Next() {
+		var r PostSearchResult
+
+		err := rows.Scan(
+			&r.ID,
+			&r.UserID,
+			&r.Content,
+			&r.Visibility,
+			&r.ReplyToID,
+			&r.CreatedAt,
+			&r.Rank,
+			&r.Snippet,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	results, info := paginateRanked(results, pagination)
+	return results, info, nil
+}
+
+// SearchHashtags returns hashtags starting with prefix, most used first.
+// Only posts viewerID is allowed to read are counted.
+func (m SearchModel) SearchHashtags(prefix string, viewerID int64, limit int) ([]Hashtag, error) {
+	prefix = strings.ToLower(strings.TrimPrefix(prefix, "#"))
+
+	query := fmt.Sprintf(`
+		SELECT h.tag, COUNT(*) AS posts_count
+		FROM post_hashtags h
+		JOIN posts p ON p.id = h.post_id
+		WHERE h.tag LIKE replace(replace($1, '%%', ''), '_', '\_') || '%%'
+			AND %s
+		GROUP BY h.tag
+		ORDER BY posts_count DESC, h.tag
+		LIMIT $3
+	`, visibleTo("p", "$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, prefix, viewerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Hashtag
+	for rows.Next() {
+		var h Hashtag
+		if err := rows.Scan(&h.Tag, &h.PostsCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"single word", "gopher", "gopher"},
+		{"words are and-ed", "go gopher", "go & gopher"},
+		{"phrase", `"hello world"`, "hello <-> world"},
+		{"prefix", "goph*", "goph:*"},
+		{"mixed", `"new post" goph* Rust`, "new <-> post & goph:* & rust"},
+		{"punctuation is stripped", "it's & | !bad", "it <-> s & bad"},
+		{"empty", `  "" * `, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseSearchQuery(tt.query))
+		})
+	}
+}
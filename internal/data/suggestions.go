@@ -0,0 +1,286 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSuggestSelf = errors.New("cannot dismiss yourself as a suggestion")
+)
+
+// SuggestionOptions tunes how follow suggestions are computed.
+type SuggestionOptions struct {
+	Limit          int           // Suggestions kept per user.
+	ActivityWindow time.Duration // Period over which a candidate's posts count as recent activity.
+	ActivityWeight float64       // Weight of recent activity against mutual connections.
+}
+
+// Suggestion is a user suggested to follow.
+type Suggestion struct {
+	User        UserPublic `json:"user"`
+	MutualCount int        `json:"mutual_count"` // People the user follows or is friends with who are connected to the suggested user.
+	RecentPosts int        `json:"recent_posts"`
+	Score       float64    `json:"score"`
+}
+
+// SuggestionModel maintains the follow_suggestions cache.
+type SuggestionModel struct {
+	DB *sql.DB
+}
+
+// suggestible returns a SQL predicate that holds when the user given as the
+// SQL expression candidate can still be suggested to the user bound to $1:
+// $1 doesn't follow them, dismissed or muted them, and has no friendship with
+// them, be it pending, accepted or a block.
+func suggestible(candidate string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+				SELECT 1 FROM follows sf
+				WHERE sf.follower_id = $1 AND sf.followee_id = %[1]s
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM friendships sfs
+				WHERE LEAST(sfs.sender_id, sfs.receiver_id) = LEAST(%[1]s, $1)
+					AND GREATEST(sfs.sender_id, sfs.receiver_id) = GREATEST(%[1]s, $1)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM suggestion_dismissals sd
+				WHERE sd.user_id = $1 AND sd.suggested_id = %[1]s
+			)
+			AND %[2]s`, candidate, notMuted(candidate, "$1"))
+}
+
+// Refresh recomputes the follow suggestions of userID. Candidates are the
+// users followed by, or friends with, the people userID follows or is
+// friends with. They rank by how many of those connect them to userID, then
+// by how much they posted recently.
+//
+// Refreshes of the same user are serialized, as both requests and the
+// refresh job may start one.
+func (m SuggestionModel) Refresh(userID int64, opts SuggestionOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('follow_suggestions:' || $1))`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM follow_suggestions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		WITH network AS (
+			SELECT followee_id AS id
+			FROM follows
+			WHERE follower_id = $1
+
+			UNION
+
+			SELECT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END
+			FROM friendships
+			WHERE status = 'accepted' AND $1 IN (sender_id, receiver_id)
+		), second_degree AS (
+			SELECT f.followee_id AS candidate_id, n.id AS via
+			FROM network n
+			JOIN follows f ON f.follower_id = n.id
+
+			UNION
+
+			SELECT fs.receiver_id, n.id
+			FROM network n
+			JOIN friendships fs ON fs.sender_id = n.id AND fs.status = 'accepted'
+
+			UNION
+
+			SELECT fs.sender_id, n.id
+			FROM network n
+			JOIN friendships fs ON fs.receiver_id = n.id AND fs.status = 'accepted'
+		), candidates AS (
+			SELECT candidate_id, COUNT(*) AS mutual_count
+			FROM second_degree
+			WHERE candidate_id <> $1
+			GROUP BY candidate_id
+		)
+		INSERT INTO follow_suggestions (user_id, suggested_id, mutual_count, recent_posts, score)
+		SELECT $1, c.candidate_id, c.mutual_count, a.recent_posts,
+			c.mutual_count + $3 * LN(1 + a.recent_posts)
+		FROM candidates c
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS recent_posts
+			FROM posts p
+			WHERE p.user_id = c.candidate_id
+				AND p.created_at > NOW() - $2 * INTERVAL '1 second'
+		) a
+		WHERE %s
+		ORDER BY 5 DESC, c.candidate_id
+		LIMIT $4`, suggestible("c.candidate_id")),
+		userID,
+		int(opts.ActivityWindow.Seconds()),
+		opts.ActivityWeight,
+		opts.Limit,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO follow_suggestion_refreshes (user_id, computed_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET computed_at = EXCLUDED.computed_at`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Stale returns up to limit users who logged in during activeWithin and
+// whose suggestions are missing or older than maxAge, stalest first.
+func (m SuggestionModel) Stale(maxAge, activeWithin time.Duration, limit int) ([]int64, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		LEFT JOIN follow_suggestion_refreshes r ON r.user_id = u.id
+		WHERE u.last_login_at > NOW() - $2 * INTERVAL '1 second'
+			AND (r.computed_at IS NULL OR r.computed_at < NOW() - $1 * INTERVAL '1 second')
+		ORDER BY r.computed_at NULLS FIRST, u.id
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, int(maxAge.Seconds()), int(activeWithin.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ComputedAt returns when the suggestions of userID were last computed, or
+// nil if they never were.
+func (m SuggestionModel) ComputedAt(userID int64) (*time.Time, error) {
+	query := `SELECT computed_at FROM follow_suggestion_refreshes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var computedAt time.Time
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&computedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &computedAt, nil
+}
+
+// List returns the cached follow suggestions of userID, best first. Users
+// followed, befriended, dismissed or muted since the last refresh are left
+// out.
+func (m SuggestionModel) List(userID int64, pagination Pagination) ([]Suggestion, PageInfo, error) {
+	args := []any{userID}
+	limit, args := pagination.rankedClauses(args)
+
+	query := fmt.Sprintf(`
+		SELECT u.id, u.username, s.mutual_count, s.recent_posts, s.score
+		FROM follow_suggestions s
+		JOIN users u ON u.id = s.suggested_id
+		WHERE s.user_id = $1 AND %s
+		ORDER BY s.score DESC, s.suggested_id
+		%s`, suggestible("s.suggested_id"), limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var suggestions []Suggestion
+	for rows.Next() {
+		var s Suggestion
+		err := rows.Scan(&s.User.ID, &s.User.Username, &s.MutualCount, &s.RecentPosts, &s.Score)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	suggestions, info := paginateRanked(suggestions, pagination)
+	return suggestions, info, nil
+}
+
+// Dismiss stops suggesting suggestedID to userID. Dismissing twice is a
+// no-op.
+func (m SuggestionModel) Dismiss(userID, suggestedID int64) error {
+	if userID == suggestedID {
+		return ErrSuggestSelf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO suggestion_dismissals (user_id, suggested_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, suggested_id) DO NOTHING`,
+		userID, suggestedID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM follow_suggestions
+		WHERE user_id = $1 AND suggested_id = $2`,
+		userID, suggestedID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// suggestedUsers returns the usernames of userID's follow suggestions, best
+// first.
+func suggestedUsers(t *testing.T, suggestions SuggestionModel, userID int64) []string {
+	t.Helper()
+
+	list, _, err := suggestions.List(userID, Pagination{PageSize: 20})
+	require.NoError(t, err)
+
+	usernames := []string{}
+	for _, s := range list {
+		usernames = append(usernames, s.User.Username)
+	}
+	return usernames
+}
+
+func TestSuggestionExclusionsIntegration(t *testing.T) {
+	db := openTestDB(t)
+	suggestions := SuggestionModel{DB: db}
+	mutes := MuteModel{DB: db}
+
+	opts := SuggestionOptions{Limit: 10, ActivityWindow: 24 * time.Hour, ActivityWeight: 1}
+
+	user := createUser(t, db, "user")
+	hub := createUser(t, db, "hub")
+	follow(t, db, user, hub)
+
+	// Every candidate is followed by hub, so connected to user through them.
+	names := []string{"plain", "followed", "pending", "blocked", "dismissed", "muted"}
+	candidates := map[string]int64{}
+	for _, name := range names {
+		candidates[name] = createUser(t, db, name)
+		follow(t, db, hub, candidates[name])
+	}
+
+	require.NoError(t, suggestions.Refresh(user, opts))
+	assert.Equal(t, names, suggestedUsers(t, suggestions, user))
+
+	// Cached suggestions are filtered when listed.
+	follow(t, db, user, candidates["followed"])
+	befriend(t, db, user, candidates["pending"], "pending")
+	befriend(t, db, candidates["blocked"], user, "blocked")
+	require.NoError(t, suggestions.Dismiss(user, candidates["dismissed"]))
+	require.NoError(t, mutes.Mute(user, candidates["muted"]))
+
+	assert.Equal(t, []string{"plain"}, suggestedUsers(t, suggestions, user))
+
+	// And no longer cached once refreshed.
+	require.NoError(t, suggestions.Refresh(user, opts))
+
+	var cached []int64
+	rows, err := db.Query(`SELECT suggested_id FROM follow_suggestions WHERE user_id = $1`, user)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		require.NoError(t, rows.Scan(&id))
+		cached = append(cached, id)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []int64{candidates["plain"]}, cached)
+
+	// Dismissals only apply to the user who dismissed.
+	other := createUser(t, db, "other")
+	follow(t, db, other, hub)
+	require.NoError(t, suggestions.Refresh(other, opts))
+	assert.Contains(t, suggestedUsers(t, suggestions, other), "dismissed")
+
+	// Dismissing twice is a no-op.
+	require.NoError(t, suggestions.Dismiss(user, candidates["dismissed"]))
+	assert.ErrorIs(t, suggestions.Dismiss(user, user), ErrSuggestSelf)
+}
+
+func TestSuggestionRefreshConcurrentIntegration(t *testing.T) {
+	db := openTestDB(t)
+	suggestions := SuggestionModel{DB: db}
+
+	opts := SuggestionOptions{Limit: 10, ActivityWindow: 24 * time.Hour, ActivityWeight: 1}
+
+	user := createUser(t, db, "user")
+	hub := createUser(t, db, "hub")
+	follow(t, db, user, hub)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		follow(t, db, hub, createUser(t, db, name))
+	}
+
+	// Refreshes racing each other all succeed, and leave one set of
+	// suggestions.
+	const refreshes = 10
+
+	var wg sync.WaitGroup
+	errs := make([]error, refreshes)
+	for i := range refreshes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = suggestions.Refresh(user, opts)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"alice", "bob", "carol"}, suggestedUsers(t, suggestions, user))
+}
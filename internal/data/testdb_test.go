@@ -0,0 +1,183 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Tests whose name ends in Integration run against Postgres. They need a
+// database, given through DATA_TEST_DATABASE_URL, and are skipped otherwise:
+//
+//	DATA_TEST_DATABASE_URL=postgres://... go test ./internal/data -run Integration
+//
+// They share a schema of their own, migrated on first use and dropped once
+// the package's tests are done. Tables are emptied before each test.
+var testDB struct {
+	once   sync.Once
+	admin  *sql.DB
+	db     *sql.DB
+	schema string
+	err    error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	if testDB.admin != nil {
+		if testDB.db != nil {
+			testDB.db.Close()
+		}
+		testDB.admin.Exec("DROP SCHEMA IF EXISTS " + testDB.schema + " CASCADE")
+		testDB.admin.Close()
+	}
+
+	os.Exit(code)
+}
+
+// openTestDB returns a connection to the test schema, with every table
+// emptied.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("DATA_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATA_TEST_DATABASE_URL is not set")
+	}
+
+	testDB.once.Do(func() { testDB.err = setupTestDB(dsn) })
+	require.NoError(t, testDB.err)
+
+	var tables string
+	err := testDB.db.QueryRow(`
+		SELECT string_agg(quote_ident(tablename), ', ')
+		FROM pg_tables
+		WHERE schemaname = $1`,
+		testDB.schema,
+	).Scan(&tables)
+	require.NoError(t, err)
+
+	_, err = testDB.db.Exec("TRUNCATE " + tables + " RESTART IDENTITY CASCADE")
+	require.NoError(t, err)
+
+	return testDB.db
+}
+
+// setupTestDB creates the test schema and applies every migration to it.
+func setupTestDB(dsn string) error {
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	testDB.admin = admin
+
+	testDB.schema = fmt.Sprintf("data_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + testDB.schema); err != nil {
+		return err
+	}
+
+	// Extensions already installed in public stay reachable.
+	dsn, err = withSearchPath(dsn, testDB.schema+",public")
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	testDB.db = db
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(migrations)
+
+	for _, path := range migrations {
+		migration, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if _, err := db.Exec(string(migration)); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+
+	return nil
+}
+
+// withSearchPath sets the search_path of the connections opened with dsn.
+func withSearchPath(dsn, searchPath string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+
+		query := u.Query()
+		query.Set("search_path", searchPath)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	return dsn + " search_path=" + searchPath, nil
+}
+
+// createUser inserts a user named username and returns their id.
+func createUser(t *testing.T, db *sql.DB, username string) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO users (username, email, password_hash)
+		VALUES ($1, $1 || '@example.com', '\x00')
+		RETURNING id`,
+		username,
+	).Scan(&id)
+	require.NoError(t, err)
+
+	return id
+}
+
+// createPost inserts a post of userID with the given visibility and returns
+// it.
+func createPost(t *testing.T, db *sql.DB, userID int64, visibility PostVisibility) *Post {
+	t.Helper()
+
+	post := &Post{UserID: userID, Content: "hello", Visibility: visibility}
+	require.NoError(t, PostModel{DB: db}.Insert(post))
+
+	return post
+}
+
+// follow makes followerID follow followeeID.
+func follow(t *testing.T, db *sql.DB, followerID, followeeID int64) {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2)`, followerID, followeeID)
+	require.NoError(t, err)
+}
+
+// befriend records a friendship between senderID and receiverID with the
+// given status.
+func befriend(t *testing.T, db *sql.DB, senderID, receiverID int64, status string) {
+	t.Helper()
+
+	_, err := db.Exec(`
+		INSERT INTO friendships (sender_id, receiver_id, status)
+		VALUES ($1, $2, $3)`,
+		senderID, receiverID, status,
+	)
+	require.NoError(t, err)
+}
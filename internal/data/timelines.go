@@ -0,0 +1,332 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// audienceOf returns a SQL query listing the ids of the users whose home
+// timeline shows the posts of the author bound to the placeholder author:
+// the author, their followers and their accepted friends.
+func audienceOf(author string) string {
+	return fmt.Sprintf(`
+		SELECT %[1]s::int AS user_id
+
+		UNION
+
+		SELECT follower_id
+		FROM follows
+		WHERE followee_id = %[1]s
+
+		UNION
+
+		SELECT CASE WHEN sender_id = %[1]s THEN receiver_id ELSE sender_id END
+		FROM friendships
+		WHERE status = 'accepted' AND %[1]s IN (sender_id, receiver_id)`, author)
+}
+
+// inTimelineOf returns a SQL predicate that holds when the posts of the
+// author bound to the SQL expression author belong in the home timeline of
+// the user bound to user: they are the same user, or the user follows or is
+// friends with the author.
+func inTimelineOf(author, user string) string {
+	return fmt.Sprintf(`(
+				%[1]s = %[2]s
+				OR EXISTS (
+					SELECT 1 FROM follows tf
+					WHERE tf.follower_id = %[2]s AND tf.followee_id = %[1]s
+				)
+				OR EXISTS (
+					SELECT 1 FROM friendships tfs
+					WHERE tfs.status = 'accepted'
+						AND LEAST(tfs.sender_id, tfs.receiver_id) = LEAST(%[1]s::int, %[2]s::int)
+						AND GREATEST(tfs.sender_id, tfs.receiver_id) = GREATEST(%[1]s::int, %[2]s::int)
+				)
+			)`, author, user)
+}
+
+// TimelineModel materializes home timelines (fan-out-on-write). Every post is
+// pushed into the timeline rows of its author's audience when published, so
+// reading a feed is a single indexed range scan.
+//
+// Authors with a very large audience are not fanned out. They are recorded as
+// pull authors instead, and their posts are merged into their audience's
+// feeds on read, like FeedModel does for everyone.
+//
+// Timeline rows only record which posts a feed holds. Visibility and blocks
+// are checked on every read, so they never go stale.
+type TimelineModel struct {
+	DB *sql.DB
+}
+
+// Publish pushes post into the timelines of its author's audience. If the
+// audience has pullThreshold users or more, the author is switched to the
+// pull path and only their own timeline is written.
+//
+// backfill is the number of recent posts pushed to the audience when an
+// author drops back under the threshold, since their posts were not
+// materialized while on the pull path.
+func (m TimelineModel) Publish(post *Post, pullThreshold, backfill int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		audience int
+		pulled   bool
+	)
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT
+			(SELECT COUNT(*) FROM (%s) a),
+			EXISTS (SELECT 1 FROM timeline_pull_authors WHERE user_id = $1)`, audienceOf("$1")),
+		post.UserID,
+	).Scan(&audience, &pulled)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case audience >= pullThreshold:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO timeline_pull_authors (user_id)
+			VALUES ($1)
+			ON CONFLICT (user_id) DO NOTHING`,
+			post.UserID,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO timelines (user_id, post_id, author_id, created_at)
+			VALUES ($1, $2, $1, $3)
+			ON CONFLICT (user_id, post_id) DO NOTHING`,
+			post.UserID, post.ID, post.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+
+	case pulled:
+		_, err = tx.ExecContext(ctx, `DELETE FROM timeline_pull_authors WHERE user_id = $1`, post.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Materialize what the audience used to pull, the new post included.
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			INSERT INTO timelines (user_id, post_id, author_id, created_at)
+			SELECT a.user_id, p.id, p.user_id, p.created_at
+			FROM (%s) a
+			CROSS JOIN (
+				SELECT id, user_id, created_at
+				FROM posts
+				WHERE user_id = $1
+				ORDER BY created_at DESC, id DESC
+				LIMIT $2
+			) p
+			ON CONFLICT (user_id, post_id) DO NOTHING`, audienceOf("$1")),
+			post.UserID, backfill,
+		)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT a.user_id, $2, $1, $3
+		FROM (%s) a
+		ON CONFLICT (user_id, post_id) DO NOTHING`, audienceOf("$1")),
+		post.UserID, post.ID, post.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Backfill pushes the limit most recent posts of authorID into userID's
+// timeline, after userID starts following or befriends them. Pull authors
+// are skipped, as their posts are merged on read anyway. Nothing is pushed
+// unless userID still follows or is friends with the author, so a backfill
+// running after the relationship ended leaves no stale rows.
+func (m TimelineModel) Backfill(userID, authorID int64, limit int) error {
+	query := fmt.Sprintf(`
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT $1, p.id, p.user_id, p.created_at
+		FROM posts p
+		WHERE p.user_id = $2
+			AND NOT EXISTS (SELECT 1 FROM timeline_pull_authors WHERE user_id = $2)
+			AND %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+		ON CONFLICT (user_id, post_id) DO NOTHING`, inTimelineOf("$2", "$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, authorID, limit)
+	return err
+}
+
+// Remove drops authorID's posts from userID's timeline, after userID
+// unfollows or unfriends them. Nothing is removed while userID is still
+// connected to the author through the other relationship.
+func (m TimelineModel) Remove(userID, authorID int64) error {
+	query := fmt.Sprintf(`
+		DELETE FROM timelines
+		WHERE user_id = $1 AND author_id = $2 AND NOT %s`, inTimelineOf("$2", "$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, authorID)
+	return err
+}
+
+// Fetch reads userID's materialized timeline, merged with the posts of the
+// pull authors they follow or are friends with. Cursors are keyed like
+// FeedModel's, so both strategies page the same way.
+//
+// Timeline rows are only read while userID still follows or is friends with
+// their author, so rows left behind by a relationship that ended never show.
+func (m TimelineModel) Fetch(
+	userID int64,
+	pagination Pagination,
+) ([]PostPublic, PageInfo, error) {
+	args := []any{userID}
+
+	// Each side of the merge is cut down to the page before being merged.
+	pushedWhere, pushedOrderBy, pushedLimit, args := pagination.unionClauses("t.created_at", "t.post_id", true, args)
+	pulledWhere, pulledOrderBy, pulledLimit, args := pagination.unionClauses("p.created_at", "p.id", true, args)
+	where, orderBy, limit, args := pagination.clauses("e.created_at", "e.id", true, "e.created_at DESC, e.id DESC", args)
+
+	query := fmt.Sprintf(`
+		WITH entries AS (
+			(
+				SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at
+				FROM timelines t
+				JOIN posts p ON p.id = t.post_id
+				WHERE t.user_id = $1 AND %[1]s AND %[2]s AND %[3]s
+				ORDER BY %[4]s
+				%[5]s
+			)
+
+			UNION
+
+			(
+				SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at
+				FROM posts p
+				JOIN timeline_pull_authors pa ON pa.user_id = p.user_id
+				WHERE %[6]s AND %[2]s AND %[7]s
+				ORDER BY %[8]s
+				%[9]s
+			)
+		)
+		SELECT e.id, e.user_id, e.content, e.visibility, e.reply_to_id, e.created_at
+		FROM entries e
+		WHERE %[10]s
+		ORDER BY %[11]s
+		%[12]s`,
+		inTimelineOf("t.author_id", "$1"), visibleTo("p", "$1"), pushedWhere, pushedOrderBy, pushedLimit,
+		inTimelineOf("pa.user_id", "$1"), pulledWhere, pulledOrderBy, pulledLimit,
+		where, orderBy, limit,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		posts []PostPublic
+		keys  []Cursor
+	)
+	for rows.Next() {
+		var p PostPublic
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Content, &p.Visibility, &p.ReplyToID, &p.CreatedAt); err != nil {
+			return nil, PageInfo{}, err
+		}
+		posts = append(posts, p)
+		keys = append(keys, Cursor{CreatedAt: p.CreatedAt, ID: p.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	posts, info := paginate(posts, keys, pagination)
+	return posts, info, nil
+}
+
+// Sources returns the authors whose posts reach userID's home timeline:
+// userID themselves, the users they follow and their accepted friends, along
+// with the subset made of friends. Users involved in a block with userID are
+// left out.
+func (m TimelineModel) Sources(userID int64) (authors, friends []int64, err error) {
+	query := fmt.Sprintf(`
+		SELECT $1::int, FALSE
+
+		UNION
+
+		SELECT f.followee_id, FALSE
+		FROM follows f
+		WHERE f.follower_id = $1 AND %s
+
+		UNION
+
+		SELECT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END, TRUE
+		FROM friendships
+		WHERE status = 'accepted' AND $1 IN (sender_id, receiver_id)`, notBlocked("f.followee_id", "$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var (
+			id       int64
+			isFriend bool
+		)
+		if err := rows.Scan(&id, &isFriend); err != nil {
+			return nil, nil, err
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			authors = append(authors, id)
+		}
+		if isFriend {
+			friends = append(friends, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return authors, friends, nil
+}
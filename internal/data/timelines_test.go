@@ -0,0 +1,261 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postAt creates a public post of userID dated minutes ago and returns it.
+func postAt(t *testing.T, db *sql.DB, userID int64, minutes int) *Post {
+	t.Helper()
+
+	post := createPost(t, db, userID, VisibilityPublic)
+	err := db.QueryRow(`
+		UPDATE posts SET created_at = NOW() - $2 * INTERVAL '1 minute'
+		WHERE id = $1
+		RETURNING created_at`,
+		post.ID, minutes,
+	).Scan(&post.CreatedAt)
+	require.NoError(t, err)
+
+	return post
+}
+
+// timelineOf returns the IDs of the posts materialized in userID's timeline,
+// newest first.
+func timelineOf(t *testing.T, db *sql.DB, userID int64) []int64 {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT post_id FROM timelines
+		WHERE user_id = $1
+		ORDER BY created_at DESC, post_id DESC`,
+		userID,
+	)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		require.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+
+	return ids
+}
+
+// fetchAll pages through userID's timeline pageSize posts at a time and
+// returns the IDs of its posts, in order.
+func fetchAll(t *testing.T, timelines TimelineModel, userID int64, pageSize int) []int64 {
+	t.Helper()
+
+	pagination := Pagination{PageSize: pageSize}
+
+	ids := []int64{}
+	for {
+		page, info, err := timelines.Fetch(userID, pagination)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), pageSize)
+
+		for _, p := range page {
+			ids = append(ids, p.ID)
+		}
+
+		if info.Next == nil {
+			return ids
+		}
+		pagination.Cursor = info.Next
+	}
+}
+
+func TestTimelinePublishIntegration(t *testing.T) {
+	db := openTestDB(t)
+	timelines := TimelineModel{DB: db}
+
+	author := createUser(t, db, "author")
+	follower := createUser(t, db, "follower")
+	friend := createUser(t, db, "friend")
+	stranger := createUser(t, db, "stranger")
+
+	follow(t, db, follower, author)
+	befriend(t, db, friend, author, "accepted")
+
+	// Below the threshold, posts are pushed to the author and their audience.
+	pushed := postAt(t, db, author, 3)
+	require.NoError(t, timelines.Publish(pushed, 10, 10))
+
+	for _, id := range []int64{author, follower, friend} {
+		assert.Equal(t, []int64{pushed.ID}, timelineOf(t, db, id))
+	}
+	assert.Empty(t, timelineOf(t, db, stranger))
+
+	// Publishing twice is a no-op.
+	require.NoError(t, timelines.Publish(pushed, 10, 10))
+	assert.Equal(t, []int64{pushed.ID}, timelineOf(t, db, follower))
+
+	// At the threshold, the author's posts are pulled on read instead.
+	pulled := postAt(t, db, author, 2)
+	require.NoError(t, timelines.Publish(pulled, 3, 10))
+
+	assert.Equal(t, []int64{pulled.ID, pushed.ID}, timelineOf(t, db, author))
+	assert.Equal(t, []int64{pushed.ID}, timelineOf(t, db, follower))
+	assert.Equal(t, []int64{pulled.ID, pushed.ID}, fetchAll(t, timelines, follower, 10))
+	assert.Empty(t, fetchAll(t, timelines, stranger, 10))
+
+	// Back under it, what the audience pulled is materialized.
+	again := postAt(t, db, author, 1)
+	require.NoError(t, timelines.Publish(again, 10, 10))
+
+	for _, id := range []int64{author, follower, friend} {
+		assert.Equal(t, []int64{again.ID, pulled.ID, pushed.ID}, timelineOf(t, db, id))
+	}
+
+	var pulling bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM timeline_pull_authors WHERE user_id = $1)`, author).Scan(&pulling)
+	require.NoError(t, err)
+	assert.False(t, pulling)
+}
+
+func TestTimelineBackfillIntegration(t *testing.T) {
+	db := openTestDB(t)
+	timelines := TimelineModel{DB: db}
+
+	user := createUser(t, db, "user")
+	author := createUser(t, db, "author")
+
+	var posts []*Post
+	for i := range 3 {
+		posts = append(posts, postAt(t, db, author, 3-i))
+	}
+
+	// A backfill running after an unfollow pushes nothing.
+	require.NoError(t, timelines.Backfill(user, author, 10))
+	assert.Empty(t, timelineOf(t, db, user))
+
+	// Only the most recent posts are pushed, once.
+	follow(t, db, user, author)
+	for range 2 {
+		require.NoError(t, timelines.Backfill(user, author, 2))
+	}
+	assert.Equal(t, []int64{posts[2].ID, posts[1].ID}, timelineOf(t, db, user))
+
+	// Friends are backfilled both ways.
+	friend := createUser(t, db, "friend")
+	shared := postAt(t, db, friend, 0)
+	befriend(t, db, user, friend, "accepted")
+
+	require.NoError(t, timelines.Backfill(user, friend, 10))
+	require.NoError(t, timelines.Backfill(friend, author, 10))
+	assert.Equal(t, []int64{shared.ID, posts[2].ID, posts[1].ID}, timelineOf(t, db, user))
+	assert.Empty(t, timelineOf(t, db, friend), "friend doesn't follow author")
+
+	// Pull authors are merged on read, so never backfilled.
+	_, err := db.Exec(`INSERT INTO timeline_pull_authors (user_id) VALUES ($1)`, author)
+	require.NoError(t, err)
+
+	other := createUser(t, db, "other")
+	follow(t, db, other, author)
+	require.NoError(t, timelines.Backfill(other, author, 10))
+	assert.Empty(t, timelineOf(t, db, other))
+}
+
+func TestTimelineRemoveIntegration(t *testing.T) {
+	db := openTestDB(t)
+	timelines := TimelineModel{DB: db}
+
+	user := createUser(t, db, "user")
+	author := createUser(t, db, "author")
+	follow(t, db, user, author)
+	befriend(t, db, user, author, "accepted")
+
+	post := postAt(t, db, author, 0)
+	require.NoError(t, timelines.Publish(post, 10, 10))
+
+	// Unfollowing a friend keeps their posts.
+	_, err := db.Exec(`DELETE FROM follows WHERE follower_id = $1`, user)
+	require.NoError(t, err)
+	require.NoError(t, timelines.Remove(user, author))
+	assert.Equal(t, []int64{post.ID}, timelineOf(t, db, user))
+
+	// Unfriending them too drops them.
+	_, err = db.Exec(`DELETE FROM friendships WHERE sender_id = $1`, user)
+	require.NoError(t, err)
+	require.NoError(t, timelines.Remove(user, author))
+	assert.Empty(t, timelineOf(t, db, user))
+
+	// The author keeps their own posts.
+	assert.Equal(t, []int64{post.ID}, timelineOf(t, db, author))
+}
+
+func TestTimelineFetchIntegration(t *testing.T) {
+	db := openTestDB(t)
+	timelines := TimelineModel{DB: db}
+
+	user := createUser(t, db, "user")
+	pushAuthor := createUser(t, db, "push")
+	pullAuthor := createUser(t, db, "pull")
+	unfollowed := createUser(t, db, "unfollowed")
+	stranger := createUser(t, db, "stranger")
+
+	follow(t, db, user, pushAuthor)
+	follow(t, db, user, unfollowed)
+	befriend(t, db, pullAuthor, user, "accepted")
+
+	_, err := db.Exec(`INSERT INTO timeline_pull_authors (user_id) VALUES ($1), ($2)`, pullAuthor, stranger)
+	require.NoError(t, err)
+
+	// Pushed and pulled posts interleave in time.
+	var want []int64
+	for i := range 8 {
+		author := pushAuthor
+		if i%3 == 0 {
+			author = pullAuthor
+		}
+
+		post := postAt(t, db, author, 10-i)
+		if author == pushAuthor {
+			require.NoError(t, timelines.Publish(post, 10, 10))
+		}
+		want = append([]int64{post.ID}, want...)
+	}
+
+	// Neither unfollowed authors' leftover rows nor unrelated pull authors
+	// show up.
+	stale := postAt(t, db, unfollowed, 5)
+	require.NoError(t, timelines.Publish(stale, 10, 10))
+	_, err = db.Exec(`DELETE FROM follows WHERE followee_id = $1`, unfollowed)
+	require.NoError(t, err)
+	require.Contains(t, timelineOf(t, db, user), stale.ID)
+
+	postAt(t, db, stranger, 5)
+
+	for _, pageSize := range []int{1, 3, 20} {
+		assert.Equal(t, want, fetchAll(t, timelines, user, pageSize), "page size %d", pageSize)
+	}
+
+	// Walking back from the second page returns the first.
+	first, info, err := timelines.Fetch(user, Pagination{PageSize: 3})
+	require.NoError(t, err)
+	second, info, err := timelines.Fetch(user, Pagination{PageSize: 3, Cursor: info.Next})
+	require.NoError(t, err)
+	assert.Equal(t, want[3], second[0].ID)
+
+	back, _, err := timelines.Fetch(user, Pagination{PageSize: 3, Cursor: info.Prev})
+	require.NoError(t, err)
+	assert.Equal(t, first, back)
+
+	// The deprecated offset mode merges both sides too.
+	page, _, err := timelines.Fetch(user, Pagination{Page: 2, PageSize: 3})
+	require.NoError(t, err)
+
+	var ids []int64
+	for _, p := range page {
+		ids = append(ids, p.ID)
+	}
+	assert.Equal(t, want[3:6], ids)
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTrendingWindow = errors.New("invalid trending window")
+)
+
+// TrendingWindow is a period over which posts trend, such as "24h" or "7d".
+type TrendingWindow struct {
+	Name     string
+	Duration time.Duration
+}
+
+// ParseTrendingWindow parses a window name made of a positive number and a
+// unit: m (minutes), h (hours) or d (days).
+func ParseTrendingWindow(name string) (TrendingWindow, error) {
+	name = strings.TrimSpace(name)
+	if len(name) < 2 {
+		return TrendingWindow{}, ErrInvalidTrendingWindow
+	}
+
+	n, err := strconv.Atoi(name[:len(name)-1])
+	if err != nil || n < 1 {
+		return TrendingWindow{}, ErrInvalidTrendingWindow
+	}
+
+	var unit time.Duration
+	switch name[len(name)-1] {
+	case 'm':
+		unit = time.Minute
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	default:
+		return TrendingWindow{}, ErrInvalidTrendingWindow
+	}
+
+	return TrendingWindow{Name: name, Duration: time.Duration(n) * unit}, nil
+}
+
+// TrendingOptions tunes how trending scores are computed.
+type TrendingOptions struct {
+	HalfLife    time.Duration // Age at which an interaction counts half as much.
+	ReplyWeight float64       // Weight of a reply, relative to a reaction.
+	Limit       int           // Number of posts kept per window.
+}
+
+// TrendingPost is a post from the explore page along with its trending score.
+type TrendingPost struct {
+	PostPublic
+	Score float64 `json:"score"`
+}
+
+// TrendingModel maintains the trending_posts cache behind the explore page.
+type TrendingModel struct {
+	DB *sql.DB
+}
+
+// Refresh recomputes the trending posts of window and replaces its cached
+// ranking. Every reaction and reply received during the window counts towards
+// its post, decayed exponentially with its age. Only public posts trend.
+//
+// Refreshes of the same window are serialized, so concurrent ones replace
+// the ranking one after the other rather than fail on each other's rows.
+func (m TrendingModel) Refresh(window TrendingWindow, opts TrendingOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('trending_posts:' || $1))`, window.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM trending_posts WHERE window_name = $1`, window.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO trending_posts (window_name, post_id, score)
+		SELECT $1, s.post_id, s.score
+		FROM (
+			SELECT e.post_id,
+				SUM(e.weight * POWER(0.5, EXTRACT(EPOCH FROM NOW() - e.created_at) / $3)) AS score
+			FROM (
+				SELECT post_id, created_at, 1.0 AS weight
+				FROM reactions
+				WHERE created_at > NOW() - $2 * INTERVAL '1 second'
+
+				UNION ALL
+
+				SELECT reply_to_id, created_at, $4
+				FROM posts
+				WHERE reply_to_id IS NOT NULL
+					AND created_at > NOW() - $2 * INTERVAL '1 second'
+			) e
+			GROUP BY e.post_id
+		) s
+		JOIN posts p ON p.id = s.post_id
+		WHERE p.visibility = 'public'
+		ORDER BY s.score DESC, s.post_id DESC
+		LIMIT $5`,
+		window.Name,
+		int(window.Duration.Seconds()),
+		opts.HalfLife.Seconds(),
+		opts.ReplyWeight,
+		opts.Limit,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO trending_refreshes (window_name, computed_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (window_name) DO UPDATE SET computed_at = EXCLUDED.computed_at`,
+		window.Name,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List returns the cached trending posts of window, highest score first.
+// Posts viewerID can't read, or whose author they blocked, were blocked by or
+// muted, are left out.
+func (m TrendingModel) List(window string, viewerID int64, pagination Pagination) ([]TrendingPost, PageInfo, error) {
+	args := []any{window, viewerID}
+	limit, args := pagination.rankedClauses(args)
+
+	query := fmt.Sprintf(`
+		SELECT p.id, p.user_id, p.content, p.visibility, p.reply_to_id, p.created_at, t.score
+		FROM trending_posts t
+		JOIN posts p ON p.id = t.post_id
+		WHERE t.window_name = $1 AND %s AND %s
+		ORDER BY t.score DESC, t.post_id DESC
+		%s`, visibleTo("p", "$2"), notMuted("p.user_id", "$2"), limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var posts []TrendingPost
+	for rows.Next() {
+		var p TrendingPost
+
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Content,
+			&p.Visibility,
+			&p.ReplyToID,
+			&p.CreatedAt,
+			&p.Score,
+		)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	posts, info := paginateRanked(posts, pagination)
+	return posts, info, nil
+}
+
+// ComputedAt returns when window was last refreshed, or nil if it never was.
+func (m TrendingModel) ComputedAt(window string) (*time.Time, error) {
+	query := `SELECT computed_at FROM trending_refreshes WHERE window_name = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var computedAt time.Time
+	err := m.DB.QueryRowContext(ctx, query, window).Scan(&computedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &computedAt, nil
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrendingWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"24h", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0h", 0, true},
+		{"h", 0, true},
+		{"12w", 0, true},
+		{"1.5h", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := ParseTrendingWindow(tt.name)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTrendingWindow)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.name, window.Name)
+			assert.Equal(t, tt.want, window.Duration)
+		})
+	}
+}
+
+func TestTrendingRefreshIntegration(t *testing.T) {
+	db := openTestDB(t)
+	trending := TrendingModel{DB: db}
+
+	window := TrendingWindow{Name: "24h", Duration: 24 * time.Hour}
+	opts := TrendingOptions{HalfLife: time.Hour, ReplyWeight: 1, Limit: 10}
+
+	computedAt, err := trending.ComputedAt(window.Name)
+	require.NoError(t, err)
+	assert.Nil(t, computedAt)
+
+	// Refreshing a window where nothing trends still records it.
+	require.NoError(t, trending.Refresh(window, opts))
+
+	computedAt, err = trending.ComputedAt(window.Name)
+	require.NoError(t, err)
+	require.NotNil(t, computedAt)
+	assert.WithinDuration(t, time.Now(), *computedAt, time.Minute)
+
+	author := createUser(t, db, "author")
+	post := createPost(t, db, author, VisibilityPublic)
+	reply := &Post{UserID: author, Content: "reply", Visibility: VisibilityPublic, ReplyToID: &post.ID}
+	require.NoError(t, PostModel{DB: db}.Insert(reply))
+
+	// Concurrent refreshes of a window take turns.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = trending.Refresh(window, opts)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	posts, _, err := trending.List(window.Name, author, Pagination{PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, post.ID, posts[0].ID)
+}
@@ -45,6 +45,7 @@ func (u User) ToPublic() any {
 type UserData struct {
 	FollowData FollowData `json:"follows"`
 	Friends    int        `json:"friends"`
+	Posts      int        `json:"posts"`
 }
 
 // UserPublic contains no sensitive information about user. Safe for public exposure.
@@ -203,7 +204,10 @@ func (m UserModel) GetByUsername(username string) (*User, error) {
 func (m UserModel) SearchUsers(
 	search string,
 	pagination Pagination,
-) ([]UserPublic, error) {
+) ([]UserPublic, PageInfo, error) {
+	args := []any{search}
+	limit, args := pagination.rankedClauses(args)
+
 	query := `
 		SELECT id, username
 		FROM users
@@ -216,17 +220,14 @@ func (m UserModel) SearchUsers(
 			END,
 			similarity(username, $1) DESC,
 			username
-		LIMIT $2 OFFSET $3
-	`
+		` + limit
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{search, pagination.PageSize, pagination.Offset()}
-
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 	defer rows.Close()
 
@@ -234,17 +235,18 @@ func (m UserModel) SearchUsers(
 	for rows.Next() {
 		var u UserPublic
 		if err := rows.Scan(&u.ID, &u.Username); err != nil {
-			return nil, err
+			return nil, PageInfo{}, err
 		}
 
 		users = append(users, u)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
-	return users, nil
+	users, info := paginateRanked(users, pagination)
+	return users, info, nil
 }
 
 // Update modifies an existing user record in the database with new data.
@@ -309,6 +311,17 @@ func (m UserModel) Exists(id int64) (bool, error) {
 	return true, nil
 }
 
+// RecordLogin records that user id just logged in.
+func (m UserModel) RecordLogin(id int64) error {
+	query := `UPDATE users SET last_login_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
 // ValidateEmail checks whether the provided email string is valid,
 // using methods defined in the validator package.
 func ValidateEmail(v *validator.Validator, email string) {
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidPostVisibility = errors.New("given visibility is not valid for posts")
+)
+
+// PostVisibility defines who is allowed to read a post.
+type PostVisibility string
+
+const (
+	VisibilityPublic       PostVisibility = "public"        // Anyone, including anonymous users.
+	VisibilityFollowers    PostVisibility = "followers"     // Followers and accepted friends of the author.
+	VisibilityFriends      PostVisibility = "friends"       // Accepted friends of the author.
+	VisibilityCloseFriends PostVisibility = "close_friends" // Accepted friends the author marked as close friends.
+	VisibilityMentioned    PostVisibility = "mentioned"     // Only users @mentioned in the post content.
+)
+
+func (v PostVisibility) IsValid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityFollowers, VisibilityFriends, VisibilityCloseFriends, VisibilityMentioned:
+		return true
+	default:
+		return false
+	}
+}
+
+// notBlocked returns a SQL predicate that holds when neither of the users
+// given as SQL expressions a and b has blocked the other.
+func notBlocked(a, b string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+				SELECT 1 FROM friendships vb
+				WHERE vb.status = 'blocked'
+					AND LEAST(vb.sender_id, vb.receiver_id) = LEAST(%[1]s, %[2]s)
+					AND GREATEST(vb.sender_id, vb.receiver_id) = GREATEST(%[1]s, %[2]s)
+			)`, a, b)
+}
+
+// visibleTo returns a SQL predicate that holds when the post aliased as alias
+// can be read by the viewer bound to the placeholder viewer (e.g. "$2").
+//
+// The author can always read their own posts, while users involved in a block
+// never see each other's posts. Anonymous users have ID 0, which never matches
+// any relationship, so they only ever see public posts.
+func visibleTo(alias, viewer string) string {
+	return fmt.Sprintf(`(%[3]s AND (
+			%[1]s.user_id = %[2]s
+			OR %[1]s.visibility = 'public'
+			OR (
+				%[1]s.visibility = 'followers'
+				AND (
+					EXISTS (
+						SELECT 1 FROM follows vf
+						WHERE vf.follower_id = %[2]s AND vf.followee_id = %[1]s.user_id
+					)
+					OR EXISTS (
+						SELECT 1 FROM friendships vfs
+						WHERE vfs.status = 'accepted'
+							AND LEAST(vfs.sender_id, vfs.receiver_id) = LEAST(%[1]s.user_id, %[2]s)
+							AND GREATEST(vfs.sender_id, vfs.receiver_id) = GREATEST(%[1]s.user_id, %[2]s)
+					)
+				)
+			)
+			OR (
+				%[1]s.visibility = 'friends'
+				AND EXISTS (
+					SELECT 1 FROM friendships vfs
+					WHERE vfs.status = 'accepted'
+						AND LEAST(vfs.sender_id, vfs.receiver_id) = LEAST(%[1]s.user_id, %[2]s)
+						AND GREATEST(vfs.sender_id, vfs.receiver_id) = GREATEST(%[1]s.user_id, %[2]s)
+				)
+			)
+			OR (
+				%[1]s.visibility = 'close_friends'
+				AND EXISTS (
+					SELECT 1 FROM close_friends vcf
+					WHERE vcf.user_id = %[1]s.user_id AND vcf.friend_id = %[2]s
+				)
+			)
+			OR (
+				%[1]s.visibility = 'mentioned'
+				AND EXISTS (
+					SELECT 1 FROM post_mentions vpm
+					WHERE vpm.post_id = %[1]s.id AND vpm.user_id = %[2]s
+				)
+			)
+		))`, alias, viewer, notBlocked(alias+".user_id", viewer))
+}
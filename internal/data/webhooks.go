@@ -0,0 +1,558 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryryann/mantel/backend/internal/validator"
+	"github.com/bryryann/mantel/backend/internal/webhook"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookLimit = errors.New("webhook limit reached")
+)
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Given up on after too many attempts.
+)
+
+// Webhook is an HTTP endpoint a user registered to receive some events.
+type Webhook struct {
+	ID                  int64      `json:"id"`
+	UserID              int64      `json:"-"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"secret,omitempty"` // Only shown when the webhook is created.
+	Events              []string   `json:"events"`
+	Description         string     `json:"description"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"` // Set when the webhook was disabled for failing.
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is an event queued for a webhook.
+type WebhookDelivery struct {
+	ID             int64            `json:"id"`
+	WebhookID      int64            `json:"webhook_id"`
+	Event          string           `json:"event"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  *time.Time       `json:"next_attempt_at,omitempty"` // Only set while pending.
+	LastStatusCode *int             `json:"last_status_code"`
+	LastError      *string          `json:"last_error"`
+	DeliveredAt    *time.Time       `json:"delivered_at"`
+	RedeliveryOf   *int64           `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	Log            []WebhookAttempt `json:"log,omitempty"`
+}
+
+// WebhookAttempt is an entry of a delivery's log.
+type WebhookAttempt struct {
+	Attempt      int       `json:"attempt"`
+	StatusCode   *int      `json:"status_code"`
+	Error        *string   `json:"error"`
+	ResponseBody string    `json:"response_body"`
+	DurationMS   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewWebhookSecret returns a random secret to sign a webhook's deliveries
+// with.
+func NewWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+func ValidateWebhook(v *validator.Validator, w *Webhook) {
+	u, err := url.Parse(w.URL)
+	v.Check(w.URL != "", "url", "must be provided")
+	v.Check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "", "url", "must be an http or https URL")
+	v.Check(len(w.URL) <= 2048, "url", "must be no more than 2048 characters long")
+	v.Check(len(w.Events) > 0, "events", "must contain at least one event")
+	v.Check(validator.Unique(w.Events), "events", "must not contain duplicate values")
+	for _, event := range w.Events {
+		v.Check(webhook.ValidEvent(event), "events", fmt.Sprintf("%q is not a webhook event", event))
+	}
+	v.Check(utf8.RuneCountInString(w.Description) <= 280, "description", "must be no more than 280 characters long")
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+const webhookColumns = `id, user_id, url, events, description, active, consecutive_failures, disabled_at, created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }, w *Webhook) error {
+	return row.Scan(
+		&w.ID,
+		&w.UserID,
+		&w.URL,
+		pq.Array(&w.Events),
+		&w.Description,
+		&w.Active,
+		&w.ConsecutiveFailures,
+		&w.DisabledAt,
+		&w.CreatedAt,
+	)
+}
+
+// Insert stores w, unless its user already has max webhooks, in which case
+// it fails with ErrWebhookLimit.
+func (m WebhookModel) Insert(w *Webhook, max int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so concurrent registrations can't exceed max.
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM webhooks WHERE user_id = u.id)
+		FROM users u
+		WHERE u.id = $1
+		FOR UPDATE`, w.UserID,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count >= max {
+		return ErrWebhookLimit
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO webhooks (user_id, url, secret, events, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, active, consecutive_failures, created_at`,
+		w.UserID, w.URL, w.Secret, pq.Array(w.Events), w.Description,
+	).Scan(&w.ID, &w.Active, &w.ConsecutiveFailures, &w.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get returns webhook id of userID, without its secret.
+func (m WebhookModel) Get(id, userID int64) (*Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var w Webhook
+	err := scanWebhook(m.DB.QueryRowContext(ctx, query, id, userID), &w)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// ForUser returns the webhooks of userID, newest first.
+func (m WebhookModel) ForUser(userID int64) ([]Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Update saves the URL, events, description and active flag of w.
+// Reactivating a webhook resets its failure count, so it isn't disabled
+// again by its next failure.
+func (m WebhookModel) Update(w *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $3,
+			events = $4,
+			description = $5,
+			active = $6,
+			consecutive_failures = CASE WHEN $6 AND NOT active THEN 0 ELSE consecutive_failures END,
+			disabled_at = CASE WHEN $6 THEN NULL ELSE disabled_at END
+		WHERE id = $1 AND user_id = $2
+		RETURNING consecutive_failures, disabled_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, w.ID, w.UserID, w.URL, pq.Array(w.Events), w.Description, w.Active).
+		Scan(&w.ConsecutiveFailures, &w.DisabledAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes webhook id of userID along with its deliveries.
+func (m WebhookModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND user_id = $2
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Enqueue queues a delivery of event with payload to every active webhook
+// of userIDs subscribed to it. Returns how many deliveries were queued.
+func (m WebhookModel) Enqueue(userIDs []int64, event string, payload any) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE user_id = ANY($1) AND active AND $2 = ANY(events)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, pq.Array(userIDs), event, data)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+	CASE WHEN d.status = 'pending' THEN d.next_attempt_at END,
+	d.last_status_code, d.last_error, d.delivered_at, d.redelivery_of, d.created_at`
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }, d *WebhookDelivery) error {
+	return row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		(*[]byte)(&d.Payload),
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.DeliveredAt,
+		&d.RedeliveryOf,
+		&d.CreatedAt,
+	)
+}
+
+// Deliveries returns the deliveries of webhookID, newest first. A non-empty
+// status keeps only the deliveries with that status.
+func (m WebhookModel) Deliveries(webhookID int64, status string, pagination Pagination) ([]WebhookDelivery, PageInfo, error) {
+	args := []any{webhookID, status}
+	where, orderBy, limit, args := pagination.clauses("d.created_at", "d.id", true, "d.created_at DESC, d.id DESC", args)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM webhook_deliveries d
+		WHERE d.webhook_id = $1 AND ($2 = '' OR d.status = $2) AND %s
+		ORDER BY %s
+		%s`, webhookDeliveryColumns, where, orderBy, limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	var (
+		deliveries []WebhookDelivery
+		keys       []Cursor
+	)
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			return nil, PageInfo{}, err
+		}
+		deliveries = append(deliveries, d)
+		keys = append(keys, Cursor{CreatedAt: d.CreatedAt, ID: d.ID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	deliveries, info := paginate(deliveries, keys, pagination)
+	return deliveries, info, nil
+}
+
+// Delivery returns delivery id of webhookID along with its log of attempts.
+func (m WebhookModel) Delivery(webhookID, id int64) (*WebhookDelivery, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM webhook_deliveries d
+		WHERE d.id = $1 AND d.webhook_id = $2`, webhookDeliveryColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var d WebhookDelivery
+	err := scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id, webhookID), &d)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT attempt, status_code, error, response_body, duration_ms, created_at
+		FROM webhook_attempts
+		WHERE delivery_id = $1
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a WebhookAttempt
+		err := rows.Scan(&a.Attempt, &a.StatusCode, &a.Error, &a.ResponseBody, &a.DurationMS, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Log = append(d.Log, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Redeliver queues a new delivery of the event and payload of delivery id of
+// webhookID, whatever became of it, and returns it.
+func (m WebhookModel) Redeliver(webhookID, id int64) (*WebhookDelivery, error) {
+	query := fmt.Sprintf(`
+		WITH d AS (
+			INSERT INTO webhook_deliveries (webhook_id, event, payload, redelivery_of)
+			SELECT webhook_id, event, payload, id
+			FROM webhook_deliveries
+			WHERE id = $1 AND webhook_id = $2
+			RETURNING *
+		)
+		SELECT %s FROM d`, webhookDeliveryColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var d WebhookDelivery
+	err := scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id, webhookID), &d)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// Claim implements webhook.Store. Deliveries of disabled webhooks stay
+// pending until the webhook is reactivated.
+func (m WebhookModel) Claim(limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET locked_until = NOW() + $2 * INTERVAL '1 second'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+			AND d.id IN (
+				SELECT dd.id
+				FROM webhook_deliveries dd
+				JOIN webhooks dw ON dw.id = dd.webhook_id
+				WHERE dd.status = 'pending'
+					AND dd.next_attempt_at <= NOW()
+					AND (dd.locked_until IS NULL OR dd.locked_until <= NOW())
+					AND dw.active
+				ORDER BY dd.next_attempt_at
+				LIMIT $1
+				FOR UPDATE OF dd SKIP LOCKED
+			)
+		RETURNING d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.attempts, d.created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		err := rows.Scan(&d.ID, &d.EndpointID, &d.URL, &d.Secret, &d.Event, (*[]byte)(&d.Data), &d.Attempts, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Succeeded records a successful attempt at d and resets its webhook's
+// failure count.
+func (m WebhookModel) Succeeded(d webhook.Delivery, attempt webhook.Attempt) error {
+	return m.settle(d, attempt, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = 'delivered', delivered_at = NOW(), last_error = NULL
+			WHERE id = $1`, d.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1`, d.EndpointID)
+		return err
+	})
+}
+
+// Failed records a failed attempt at d, to be retried at retryAt or given
+// up on if it's nil. Webhooks failing disableAfter attempts in a row are
+// disabled; 0 never disables them.
+func (m WebhookModel) Failed(d webhook.Delivery, attempt webhook.Attempt, retryAt *time.Time, disableAfter int) error {
+	return m.settle(d, attempt, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+				next_attempt_at = COALESCE($2, next_attempt_at),
+				last_error = $3
+			WHERE id = $1`, d.ID, retryAt, attempt.Error)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE webhooks
+			SET consecutive_failures = consecutive_failures + 1,
+				active = active AND NOT ($2 > 0 AND consecutive_failures + 1 >= $2),
+				disabled_at = CASE
+					WHEN active AND $2 > 0 AND consecutive_failures + 1 >= $2 THEN NOW()
+					ELSE disabled_at
+				END
+			WHERE id = $1`, d.EndpointID, disableAfter)
+		return err
+	})
+}
+
+// settle logs attempt at d and releases its claim, along with the updates
+// made by fn, in a single transaction.
+func (m WebhookModel) settle(d webhook.Delivery, attempt webhook.Attempt, fn func(context.Context, *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		statusCode *int
+		errMessage *string
+	)
+	if attempt.StatusCode != 0 {
+		statusCode = &attempt.StatusCode
+	}
+	if attempt.Error != "" {
+		errMessage = &attempt.Error
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, response_body, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		d.ID, d.Attempts+1, statusCode, errMessage, attempt.ResponseBody, attempt.Duration.Milliseconds(),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, last_status_code = $2, locked_until = NULL
+		WHERE id = $1`, d.ID, statusCode)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,121 @@
+// Package digest renders the activity digests emailed to users who stopped
+// logging in, and signs the links they unsubscribe with.
+package digest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"errors"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+
+	"github.com/bryryann/mantel/backend/internal/data"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = map[string]any{
+	"truncate": truncate,
+}
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/digest.txt.tmpl"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/digest.html.tmpl"))
+)
+
+var ErrInvalidToken = errors.New("invalid unsubscribe token")
+
+// Digest is what a digest email tells its recipient about.
+type Digest struct {
+	Username           string
+	Frequency          data.DigestFrequency
+	Notifications      []data.NotificationGroup // Unread notifications, most recent first.
+	UnreadCount        int                      // Unread notifications in total.
+	FriendRequests     []data.UserPublic        // Users with a pending friend request, most recent first.
+	FriendRequestCount int                      // Pending friend requests in total.
+	TopPosts           []data.DigestPost
+	AppURL             string
+	UnsubscribeURL     string
+}
+
+// Empty reports whether there is nothing worth sending.
+func (d Digest) Empty() bool {
+	return len(d.Notifications) == 0 && len(d.FriendRequests) == 0 && len(d.TopPosts) == 0
+}
+
+// Subject returns the subject line of the email.
+func (d Digest) Subject() string {
+	if d.Frequency == data.DigestDaily {
+		return "Your daily Mantel digest"
+	}
+	return "Your weekly Mantel digest"
+}
+
+// Render renders d as plain-text and HTML email bodies.
+func Render(d Digest) (text, html string, err error) {
+	var textBuf, htmlBuf bytes.Buffer
+
+	if err := textTemplate.Execute(&textBuf, d); err != nil {
+		return "", "", err
+	}
+
+	if err := htmlTemplate.Execute(&htmlBuf, d); err != nil {
+		return "", "", err
+	}
+
+	return textBuf.String(), htmlBuf.String(), nil
+}
+
+// truncate shortens s to at most n characters, ending it with an ellipsis
+// when cut.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// UnsubscribeToken returns a token that unsubscribes userID from digests,
+// signed with secret. Tokens don't expire, so that links in old emails keep
+// working.
+func UnsubscribeToken(userID int64, secret []byte) string {
+	payload := strconv.FormatInt(userID, 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(payload, secret))
+}
+
+// ParseUnsubscribeToken verifies a token produced by UnsubscribeToken and
+// returns the user it unsubscribes.
+func ParseUnsubscribeToken(token string, secret []byte) (int64, error) {
+	payload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, sign(payload, secret)) {
+		return 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+// sign signs payload for unsubscribing, so that tokens can't be reused as
+// any other kind of signed value.
+func sign(payload string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("digest-unsubscribe:" + payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleDigest() Digest {
+	return Digest{
+		Username:  "alice",
+		Frequency: data.DigestWeekly,
+		Notifications: []data.NotificationGroup{
+			{Summary: "bob and 2 others reacted to your post"},
+		},
+		UnreadCount:        3,
+		FriendRequests:     []data.UserPublic{{ID: 2, Username: "carol"}},
+		FriendRequestCount: 1,
+		TopPosts: []data.DigestPost{
+			{ID: 7, Author: "dave", Content: "<b>hello</b> world", Reactions: 1, Replies: 4},
+		},
+		AppURL:         "https://mantel.example",
+		UnsubscribeURL: "https://api.mantel.example/v1/digest/unsubscribe?token=abc",
+	}
+}
+
+func TestRender(t *testing.T) {
+	text, html, err := Render(sampleDigest())
+	require.NoError(t, err)
+
+	for _, body := range []string{text, html} {
+		assert.Contains(t, body, "Hi alice")
+		assert.Contains(t, body, "this week")
+		assert.Contains(t, body, "3 unread notifications")
+		assert.Contains(t, body, "bob and 2 others reacted to your post")
+		assert.Contains(t, body, "1 person wants to be your friend")
+		assert.Contains(t, body, "carol")
+		assert.Contains(t, body, "1 reaction, 4 replies")
+		assert.Contains(t, body, "https://api.mantel.example/v1/digest/unsubscribe?token=abc")
+	}
+
+	assert.Contains(t, text, "dave: <b>hello</b> world")
+	assert.Contains(t, html, "&lt;b&gt;hello&lt;/b&gt; world")
+	assert.NotContains(t, html, "<b>hello</b>")
+}
+
+func TestRenderLeavesOutEmptySections(t *testing.T) {
+	d := sampleDigest()
+	d.Notifications, d.FriendRequests = nil, nil
+
+	text, html, err := Render(d)
+	require.NoError(t, err)
+
+	for _, body := range []string{text, html} {
+		assert.NotContains(t, body, "unread")
+		assert.NotContains(t, body, "to be your friend")
+		assert.Contains(t, body, "Popular in your network")
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	assert.False(t, sampleDigest().Empty())
+	assert.True(t, Digest{Username: "alice"}.Empty())
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "a b c", truncate("a\n b   c", 10))
+	assert.Equal(t, "héll…", truncate("héllo world", 5))
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	secret := []byte("secret")
+
+	token := UnsubscribeToken(42, secret)
+
+	userID, err := ParseUnsubscribeToken(token, secret)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), userID)
+
+	_, err = ParseUnsubscribeToken(token, []byte("other"))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, sig, _ := strings.Cut(token, ".")
+	_, err = ParseUnsubscribeToken("43."+sig, secret)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	for _, bad := range []string{"", "42", "42.", "x.y"} {
+		_, err = ParseUnsubscribeToken(bad, secret)
+		assert.ErrorIs(t, err, ErrInvalidToken, bad)
+	}
+}
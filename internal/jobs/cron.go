@@ -0,0 +1,190 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSchedule is returned when parsing a malformed schedule.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Schedule tells when a recurring job runs.
+type Schedule interface {
+	// Next returns the first run strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a schedule in one of these forms:
+//
+//   - a standard five field cron expression, "minute hour day-of-month month
+//     day-of-week", whose fields accept *, numbers, ranges (1-5), steps
+//     (*/15, 0-30/10) and lists of them (1,15). Sunday is 0 or 7. Times are
+//     evaluated in the location of the time given to Next.
+//   - @yearly (or @annually), @monthly, @weekly, @daily (or @midnight) and
+//     @hourly.
+//   - @every followed by a duration, e.g. "@every 5m". Runs are aligned on
+//     multiples of the duration since the zero time, so every worker agrees
+//     on them.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("%w: %q: @every needs a duration of at least 1s", ErrInvalidSchedule, spec)
+		}
+		return everySchedule(every), nil
+	}
+
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields, got %d", ErrInvalidSchedule, spec, len(fields))
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+	ranges := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&s.minutes, 0, 59},
+		{&s.hours, 0, 23},
+		{&s.days, 1, 31},
+		{&s.months, 1, 12},
+		{&s.weekdays, 0, 7},
+	}
+	for i, r := range ranges {
+		*r.set, err = parseField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidSchedule, spec, err)
+		}
+	}
+
+	// 7 is an alias of Sunday.
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays = s.weekdays&^(1<<7) | 1
+	}
+
+	// As in cron, when both days of the month and of the week are
+	// restricted, a day matching either runs the job.
+	s.anyDay = fields[2] == "*" || fields[4] == "*"
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of cron ranges into a bit set of
+// the values in [min, max] it covers.
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := min, max
+		if expr != "*" {
+			loStr, hiStr, isRange := strings.Cut(expr, "-")
+
+			var err error
+			lo, err = strconv.Atoi(loStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", loStr)
+			}
+
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiStr)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", hiStr)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+// cronSchedule is a parsed cron expression; each field is a bit set of the
+// values it matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay                                 bool
+}
+
+func (s cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Schedules such as "0 0 30 2 *" never match; give up after five years
+	// rather than loop forever.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+
+	if s.anyDay {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// everySchedule runs at every multiple of its duration.
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(s)).Add(time.Duration(s))
+}
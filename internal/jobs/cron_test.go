@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// A Friday.
+	from := time.Date(2026, time.March, 6, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, time.March, 6, 10, 15, 0, 0, time.UTC)},
+		{"7 10 * * *", time.Date(2026, time.March, 7, 10, 7, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, time.March, 9, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2026, time.April, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 12 1,15 6 *", time.Date(2026, time.June, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 0", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)}, // The 20th or a Sunday.
+		{"10-20/5 11 * * *", time.Date(2026, time.March, 6, 11, 10, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 6, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 5m", time.Date(2026, time.March, 6, 10, 10, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(from))
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 0s",
+		"@every soon",
+		"@fortnightly",
+	} {
+		_, err := ParseSchedule(spec)
+		assert.ErrorIs(t, err, ErrInvalidSchedule, "spec %q", spec)
+	}
+}
+
+func TestScheduleNextIsStrictlyAfter(t *testing.T) {
+	schedule, err := ParseSchedule("0 * * * *")
+	require.NoError(t, err)
+
+	at := time.Date(2026, time.March, 6, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, at.Add(time.Hour), schedule.Next(at))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Backoff(10*time.Second, time.Hour, 1))
+	assert.Equal(t, 40*time.Second, Backoff(10*time.Second, time.Hour, 3))
+	assert.Equal(t, time.Hour, Backoff(10*time.Second, time.Hour, 20))
+}
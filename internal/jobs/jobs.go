@@ -0,0 +1,171 @@
+// Package jobs runs work outside the request path through a queue kept in
+// Postgres.
+//
+// Jobs are enqueued, possibly as part of the transaction of the change that
+// calls for them, and run by Workers which claim them with
+// SELECT ... FOR UPDATE SKIP LOCKED, so that any number of workers can share
+// a queue without running a job twice at the same time. A failed job is
+// retried with exponential backoff until it runs out of attempts, when it is
+// moved to the dead state for an operator to inspect and retry. Workers also
+// enqueue jobs on cron schedules.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateJob is returned when enqueuing a job whose unique key another
+// job already has.
+var ErrDuplicateJob = errors.New("a job with this unique key already exists")
+
+const (
+	// DefaultQueue is the queue of jobs enqueued without one.
+	DefaultQueue = "default"
+
+	// DefaultMaxAttempts is the number of attempts of jobs enqueued without
+	// a limit.
+	DefaultMaxAttempts = 10
+)
+
+// State is where a job is in its lifecycle.
+type State string
+
+const (
+	StatePending   State = "pending"   // Waiting for its run_at, or for a worker.
+	StateRunning   State = "running"   // Claimed by a worker.
+	StateSucceeded State = "succeeded" // Ran successfully.
+	StateDead      State = "dead"      // Failed every attempt; only runs again if retried.
+)
+
+// IsValid reports whether s is a known state.
+func (s State) IsValid() bool {
+	switch s {
+	case StatePending, StateRunning, StateSucceeded, StateDead:
+		return true
+	}
+	return false
+}
+
+// Job is a unit of work in the queue.
+type Job struct {
+	ID          int64           `json:"id"`
+	Queue       string          `json:"queue"`
+	Kind        string          `json:"kind"` // Selects the handler running the job.
+	Payload     json.RawMessage `json:"payload"`
+	State       State           `json:"state"`
+	Attempts    int             `json:"attempts"` // Attempts started, including the current one.
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"` // Earliest time of the next attempt.
+	LastError   *string         `json:"last_error"`
+	UniqueKey   *string         `json:"unique_key,omitempty"`
+	LockedBy    *string         `json:"locked_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// Decode unmarshals the payload of j into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Querier runs queries. It is implemented by *sql.DB and *sql.Tx, so that
+// jobs can be enqueued as part of a transaction.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// EnqueueOptions configures an enqueued job. The zero value enqueues a job
+// on DefaultQueue, to run right away with DefaultMaxAttempts.
+type EnqueueOptions struct {
+	Queue       string
+	RunAt       time.Time // Zero to run right away.
+	MaxAttempts int
+	UniqueKey   string // When set, the job isn't enqueued if one with the same key exists.
+}
+
+// Enqueue adds a job of the given kind with payload, marshalled to JSON, to
+// the queue through q. If q is a transaction, the job becomes visible to
+// workers once it commits. It returns ErrDuplicateJob when opts.UniqueKey is
+// taken.
+func Enqueue(ctx context.Context, q Querier, kind string, payload any, opts EnqueueOptions) (*Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Queue == "" {
+		opts.Queue = DefaultQueue
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	var (
+		runAt     *time.Time
+		uniqueKey *string
+	)
+	if !opts.RunAt.IsZero() {
+		runAt = &opts.RunAt
+	}
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	}
+
+	query := `
+		INSERT INTO jobs (queue, kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, COALESCE($5, NOW()), $6)
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+		RETURNING ` + columns
+
+	job, err := scan(q.QueryRowContext(ctx, query, opts.Queue, kind, js, opts.MaxAttempts, runAt, uniqueKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDuplicateJob
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// columns lists the columns scan reads, in order.
+const columns = `id, queue, kind, payload, state, attempts, max_attempts, run_at, last_error,
+	unique_key, locked_by, created_at, started_at, finished_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (*Job, error) {
+	var j Job
+	err := row.Scan(
+		&j.ID, &j.Queue, &j.Kind, (*[]byte)(&j.Payload), &j.State, &j.Attempts, &j.MaxAttempts, &j.RunAt,
+		&j.LastError, &j.UniqueKey, &j.LockedBy, &j.CreatedAt, &j.StartedAt, &j.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Backoff returns the wait before retrying after the given number of failed
+// attempts: base, doubled for each attempt past the first, up to limit.
+func Backoff(base, limit time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if limit > 0 && wait >= limit {
+			return limit
+		}
+	}
+
+	if limit > 0 {
+		return min(wait, limit)
+	}
+	return wait
+}
@@ -0,0 +1,396 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDB connects to the database of JOBS_TEST_DATABASE_URL, in a schema
+// of its own holding a fresh jobs table, dropped when the test ends. Tests
+// using it are skipped when the variable isn't set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("JOBS_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("JOBS_TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+
+	schema := fmt.Sprintf("jobs_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(t, dsn, schema))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	migration, err := os.ReadFile("../../migrations/000030_create_jobs.up.sql")
+	require.NoError(t, err)
+
+	_, err = db.Exec(string(migration))
+	require.NoError(t, err)
+
+	return db
+}
+
+// withSearchPath sets the search_path of the connections opened with dsn.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		require.NoError(t, err)
+
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	return dsn + " search_path=" + schema
+}
+
+func getJob(t *testing.T, db *sql.DB, id int64) *Job {
+	t.Helper()
+
+	job, err := scan(db.QueryRow(`SELECT `+columns+` FROM jobs WHERE id = $1`, id))
+	require.NoError(t, err)
+	return job
+}
+
+func enqueue(t *testing.T, db *sql.DB, kind string, payload any, opts EnqueueOptions) *Job {
+	t.Helper()
+
+	job, err := Enqueue(context.Background(), db, kind, payload, opts)
+	require.NoError(t, err)
+	return job
+}
+
+func startWorker(t *testing.T, w *Worker) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+func testOptions() WorkerOptions {
+	return WorkerOptions{
+		Concurrency:  4,
+		Interval:     10 * time.Millisecond,
+		Lease:        time.Second,
+		Backoff:      50 * time.Millisecond,
+		Timeout:      5 * time.Second,
+		DrainTimeout: time.Second,
+	}
+}
+
+func TestEnqueueIntegration(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	job := enqueue(t, db, "email", map[string]any{"to": "someone"}, EnqueueOptions{})
+	assert.Equal(t, DefaultQueue, job.Queue)
+	assert.Equal(t, StatePending, job.State)
+	assert.Equal(t, DefaultMaxAttempts, job.MaxAttempts)
+	assert.Zero(t, job.Attempts)
+	assert.JSONEq(t, `{"to":"someone"}`, string(job.Payload))
+
+	later := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	job = enqueue(t, db, "email", nil, EnqueueOptions{Queue: "mail", RunAt: later, MaxAttempts: 3, UniqueKey: "welcome:1"})
+	assert.Equal(t, "mail", job.Queue)
+	assert.True(t, later.Equal(job.RunAt))
+	assert.Equal(t, 3, job.MaxAttempts)
+
+	_, err := Enqueue(ctx, db, "email", nil, EnqueueOptions{UniqueKey: "welcome:1"})
+	assert.ErrorIs(t, err, ErrDuplicateJob)
+
+	// Jobs enqueued in a transaction only exist if it commits.
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	rolledBack, err := Enqueue(ctx, tx, "email", nil, EnqueueOptions{})
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	err = db.QueryRow(`SELECT id FROM jobs WHERE id = $1`, rolledBack.ID).Scan(new(int64))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestWorkerRunsEachJobOnceIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	const n = 40
+
+	var (
+		mu   sync.Mutex
+		runs = make(map[int64]int)
+	)
+	handler := func(ctx context.Context, job *Job) error {
+		var payload struct{ N int }
+		if err := job.Decode(&payload); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		runs[job.ID]++
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+
+	var ids []int64
+	for i := range n {
+		ids = append(ids, enqueue(t, db, "count", map[string]int{"N": i}, EnqueueOptions{}).ID)
+	}
+
+	// Jobs of other kinds and queues are left alone.
+	other := enqueue(t, db, "unknown", nil, EnqueueOptions{})
+	elsewhere := enqueue(t, db, "count", nil, EnqueueOptions{Queue: "elsewhere"})
+
+	for range 3 {
+		w := NewWorker(db, testOptions(), slog.New(slog.DiscardHandler))
+		w.Handle("count", handler)
+		startWorker(t, w)
+	}
+
+	require.Eventually(t, func() bool {
+		var pending int
+		err := db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE kind = 'count' AND queue = 'default' AND state <> 'succeeded'`).Scan(&pending)
+		return err == nil && pending == 0
+	}, 10*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Len(t, runs, n)
+	for _, id := range ids {
+		assert.Equal(t, 1, runs[id], "job %d", id)
+
+		job := getJob(t, db, id)
+		assert.Equal(t, StateSucceeded, job.State)
+		assert.Equal(t, 1, job.Attempts)
+		assert.NotNil(t, job.FinishedAt)
+		assert.Nil(t, job.LockedBy)
+	}
+
+	assert.Equal(t, StatePending, getJob(t, db, other.ID).State)
+	assert.Equal(t, StatePending, getJob(t, db, elsewhere.ID).State)
+}
+
+func TestWorkerRetriesWithBackoffIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	var attempts atomic.Int32
+
+	w := NewWorker(db, testOptions(), slog.New(slog.DiscardHandler))
+	w.Handle("flaky", func(ctx context.Context, job *Job) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("temporarily unavailable")
+		}
+		return nil
+	})
+
+	job := enqueue(t, db, "flaky", nil, EnqueueOptions{MaxAttempts: 5})
+	start := time.Now()
+	startWorker(t, w)
+
+	require.Eventually(t, func() bool {
+		return getJob(t, db, job.ID).State == StateSucceeded
+	}, 10*time.Second, 20*time.Millisecond)
+
+	// 50ms after the first failure, then 100ms after the second.
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	job = getJob(t, db, job.ID)
+	assert.Equal(t, 3, job.Attempts)
+	assert.Nil(t, job.LastError)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestWorkerDeadLettersIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	var attempts atomic.Int32
+
+	w := NewWorker(db, testOptions(), slog.New(slog.DiscardHandler))
+	w.Handle("broken", func(ctx context.Context, job *Job) error {
+		if attempts.Add(1) == 2 {
+			panic("out of luck")
+		}
+		return errors.New("always failing")
+	})
+
+	job := enqueue(t, db, "broken", nil, EnqueueOptions{MaxAttempts: 3})
+	startWorker(t, w)
+
+	require.Eventually(t, func() bool {
+		return getJob(t, db, job.ID).State == StateDead
+	}, 10*time.Second, 20*time.Millisecond)
+
+	job = getJob(t, db, job.ID)
+	assert.Equal(t, 3, job.Attempts)
+	require.NotNil(t, job.LastError)
+	assert.Equal(t, "always failing", *job.LastError)
+	assert.NotNil(t, job.FinishedAt)
+
+	// Dead jobs aren't attempted again.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestWorkerRescuesAbandonedJobsIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	abandoned := enqueue(t, db, "rescued", nil, EnqueueOptions{MaxAttempts: 3})
+	lastAttempt := enqueue(t, db, "rescued", nil, EnqueueOptions{MaxAttempts: 1})
+
+	// As left by a worker which died while running them.
+	_, err := db.Exec(`
+		UPDATE jobs
+		SET state = 'running', attempts = 1, locked_by = 'gone', locked_until = NOW() - INTERVAL '1 minute'
+		WHERE id = ANY(ARRAY[$1, $2]::bigint[])`,
+		abandoned.ID, lastAttempt.ID,
+	)
+	require.NoError(t, err)
+
+	var ran atomic.Int32
+
+	w := NewWorker(db, testOptions(), slog.New(slog.DiscardHandler))
+	w.Handle("rescued", func(ctx context.Context, job *Job) error {
+		ran.Add(1)
+		return nil
+	})
+	startWorker(t, w)
+
+	require.Eventually(t, func() bool {
+		return getJob(t, db, abandoned.ID).State == StateSucceeded
+	}, 10*time.Second, 20*time.Millisecond)
+
+	assert.Equal(t, 2, getJob(t, db, abandoned.ID).Attempts)
+
+	dead := getJob(t, db, lastAttempt.ID)
+	assert.Equal(t, StateDead, dead.State)
+	require.NotNil(t, dead.LastError)
+	assert.Equal(t, "worker stopped responding", *dead.LastError)
+	assert.Equal(t, int32(1), ran.Load())
+}
+
+func TestWorkerDrainsOnShutdownIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	opts := testOptions()
+	opts.DrainTimeout = 300 * time.Millisecond
+
+	started := make(chan string, 2)
+
+	w := NewWorker(db, opts, slog.New(slog.DiscardHandler))
+	w.Handle("quick", func(ctx context.Context, job *Job) error {
+		started <- "quick"
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	w.Handle("slow", func(ctx context.Context, job *Job) error {
+		started <- "slow"
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	quick := enqueue(t, db, "quick", nil, EnqueueOptions{})
+	slow := enqueue(t, db, "slow", nil, EnqueueOptions{})
+
+	stop := startWorker(t, w)
+	<-started
+	<-started
+
+	begin := time.Now()
+	stop()
+	elapsed := time.Since(begin)
+
+	assert.GreaterOrEqual(t, elapsed, opts.DrainTimeout)
+	assert.Less(t, elapsed, 3*opts.DrainTimeout)
+
+	// The quick job finished within the drain timeout; the slow one was
+	// interrupted and put back without using up an attempt.
+	assert.Equal(t, StateSucceeded, getJob(t, db, quick.ID).State)
+
+	job := getJob(t, db, slow.ID)
+	assert.Equal(t, StatePending, job.State)
+	assert.Zero(t, job.Attempts)
+	assert.Nil(t, job.LockedBy)
+
+	// A job enqueued after shutdown isn't claimed.
+	late := enqueue(t, db, "quick", nil, EnqueueOptions{})
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StatePending, getJob(t, db, late.ID).State)
+}
+
+func TestWorkerSchedulesIntegration(t *testing.T) {
+	db := openTestDB(t)
+
+	var ran atomic.Int32
+
+	// Two workers declare the same schedule; each run is enqueued once.
+	for range 2 {
+		w := NewWorker(db, testOptions(), slog.New(slog.DiscardHandler))
+		w.Handle("tick", func(ctx context.Context, job *Job) error {
+			ran.Add(1)
+			return nil
+		})
+		require.NoError(t, w.Schedule("ticker", "@every 1s", "tick", map[string]string{"from": "cron"}, EnqueueOptions{}))
+		startWorker(t, w)
+	}
+
+	require.Eventually(t, func() bool { return ran.Load() >= 2 }, 5*time.Second, 20*time.Millisecond)
+
+	rows, err := db.Query(`SELECT unique_key, COUNT(*) FROM jobs WHERE kind = 'tick' GROUP BY unique_key`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var keys int
+	for rows.Next() {
+		var (
+			key   string
+			count int
+		)
+		require.NoError(t, rows.Scan(&key, &count))
+		assert.True(t, strings.HasPrefix(key, "cron:ticker:"), key)
+		assert.Equal(t, 1, count, key)
+		keys++
+	}
+	require.NoError(t, rows.Err())
+	assert.GreaterOrEqual(t, keys, 2)
+}
@@ -0,0 +1,469 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Handler runs a job. Returning an error fails the attempt. ctx is cancelled
+// when the job times out, or when the worker shuts down and the job didn't
+// finish in time; the job is then attempted again later.
+type Handler func(ctx context.Context, job *Job) error
+
+// WorkerOptions configures a Worker.
+type WorkerOptions struct {
+	Queues       []string      // Queues jobs are taken from; DefaultQueue when empty.
+	Concurrency  int           // Jobs run at the same time.
+	Interval     time.Duration // How often due jobs are looked for.
+	Lease        time.Duration // How long a claimed job stays hidden from other workers without a heartbeat.
+	Backoff      time.Duration // Wait before the first retry, doubled on each following one.
+	MaxBackoff   time.Duration // Longest wait between two attempts.
+	Timeout      time.Duration // Time limit of each attempt.
+	DrainTimeout time.Duration // Time running jobs get to finish on shutdown.
+}
+
+type cronEntry struct {
+	name     string
+	schedule Schedule
+	kind     string
+	payload  any
+	opts     EnqueueOptions
+}
+
+// Worker runs the jobs of a Postgres queue, and enqueues the jobs of its cron
+// schedules. Several workers, in one process or many, can share a queue.
+type Worker struct {
+	db       *sql.DB
+	opts     WorkerOptions
+	id       string // Identifies the jobs claimed by this worker.
+	handlers map[string]Handler
+	crons    []cronEntry
+	wake     chan struct{}
+	logger   *slog.Logger
+}
+
+func NewWorker(db *sql.DB, opts WorkerOptions, logger *slog.Logger) *Worker {
+	if len(opts.Queues) == 0 {
+		opts.Queues = []string{DefaultQueue}
+	}
+	opts.Concurrency = max(opts.Concurrency, 1)
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 10 * time.Second
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 30 * time.Second
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return &Worker{
+		db:       db,
+		opts:     opts,
+		id:       hex.EncodeToString(b),
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+		logger:   logger,
+	}
+}
+
+// Handle registers handler to run the jobs of the given kind. The worker
+// only claims jobs of kinds it has a handler for. Handlers must be
+// registered before Run is called.
+func (w *Worker) Handle(kind string, handler Handler) {
+	w.handlers[kind] = handler
+}
+
+// Schedule enqueues a job of the given kind with payload at every run of
+// spec, a schedule in a form accepted by ParseSchedule. name identifies the
+// schedule: workers sharing a queue may all declare it, and each run is
+// still only enqueued once. Schedules must be declared before Run is called.
+func (w *Worker) Schedule(name, spec, kind string, payload any, opts EnqueueOptions) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	w.crons = append(w.crons, cronEntry{
+		name:     name,
+		schedule: schedule,
+		kind:     kind,
+		payload:  payload,
+		opts:     opts,
+	})
+	return nil
+}
+
+// Notify makes the worker look for due jobs right away, e.g. after some were
+// enqueued. It never blocks.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs jobs until ctx is done. It then stops claiming jobs and waits up
+// to DrainTimeout for the running ones to finish. Those still running after
+// that have their context cancelled and are put back in the queue, without
+// counting the attempt.
+func (w *Worker) Run(ctx context.Context) {
+	// Jobs don't run under ctx, which only stops new ones from starting.
+	jobCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, w.opts.Concurrency)
+		freed = make(chan struct{}, 1)
+	)
+
+	heartbeatDone := make(chan struct{})
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		w.heartbeat(stopHeartbeat)
+		close(heartbeatDone)
+	}()
+
+	if len(w.crons) > 0 {
+		go w.schedule(ctx)
+	}
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		free := cap(slots) - len(slots)
+
+		var claimed []*Job
+		if free > 0 {
+			if err := w.rescue(); err != nil {
+				w.logger.Error("failed to rescue jobs", "error", err.Error())
+			}
+
+			var err error
+			claimed, err = w.claim(free)
+			if err != nil {
+				w.logger.Error("failed to claim jobs", "error", err.Error())
+			}
+		}
+
+		for _, job := range claimed {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-slots
+					wg.Done()
+					select {
+					case freed <- struct{}{}:
+					default:
+					}
+				}()
+				w.run(jobCtx, job)
+			}()
+		}
+
+		// Claim again right away while jobs keep coming and slots are
+		// free, so a backlog drains without waiting for the ticker.
+		if len(claimed) > 0 && len(claimed) == free && len(slots) < cap(slots) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		case <-w.wake:
+		case <-freed:
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(w.opts.DrainTimeout):
+		w.logger.Warn("jobs still running after drain timeout, cancelling them", "running", len(slots))
+		abort()
+		<-drained
+	}
+
+	close(stopHeartbeat)
+	<-heartbeatDone
+}
+
+func (w *Worker) kinds() []string {
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// claim marks up to limit due jobs as running on this worker, and returns
+// them.
+func (w *Worker) claim(limit int) ([]*Job, error) {
+	if len(w.handlers) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		UPDATE jobs
+		SET state = 'running',
+			attempts = attempts + 1,
+			locked_by = $1,
+			locked_until = NOW() + $2 * INTERVAL '1 second',
+			started_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM jobs
+			WHERE state = 'pending'
+				AND run_at <= NOW()
+				AND queue = ANY($3)
+				AND kind = ANY($4)
+			ORDER BY run_at, id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + columns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := w.db.QueryContext(ctx, query, w.id, w.opts.Lease.Seconds(), pq.Array(w.opts.Queues), pq.Array(w.kinds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// rescue puts back in the queue the running jobs whose worker stopped
+// sending heartbeats, e.g. because its process died. Jobs which were on
+// their last attempt are moved to the dead state.
+func (w *Worker) rescue() error {
+	query := `
+		UPDATE jobs
+		SET state = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+			run_at = NOW(),
+			last_error = 'worker stopped responding',
+			locked_by = NULL,
+			locked_until = NULL
+		WHERE state = 'running' AND locked_until < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, query)
+	return err
+}
+
+// heartbeat extends the lease of the jobs running on this worker until stop
+// is closed.
+func (w *Worker) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.opts.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		_, err := w.db.ExecContext(ctx, `
+			UPDATE jobs
+			SET locked_until = NOW() + $2 * INTERVAL '1 second'
+			WHERE state = 'running' AND locked_by = $1`,
+			w.id, w.opts.Lease.Seconds(),
+		)
+		cancel()
+		if err != nil {
+			w.logger.Error("failed to extend job leases", "error", err.Error())
+		}
+	}
+}
+
+// run runs job and records its outcome.
+func (w *Worker) run(jobCtx context.Context, job *Job) {
+	handler := w.handlers[job.Kind]
+
+	ctx, cancel := context.WithTimeout(jobCtx, w.opts.Timeout)
+	defer cancel()
+
+	err := call(ctx, handler, job)
+
+	switch {
+	case err == nil:
+		err = w.succeeded(job)
+	case jobCtx.Err() != nil:
+		err = w.release(job)
+	default:
+		err = w.failed(job, err)
+	}
+
+	if err != nil {
+		w.logger.Error("failed to record job outcome", "job_id", job.ID, "kind", job.Kind, "error", err.Error())
+	}
+}
+
+func call(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+func (w *Worker) succeeded(job *Job) error {
+	return w.settle(`
+		UPDATE jobs
+		SET state = 'succeeded', finished_at = NOW(), last_error = NULL, locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND locked_by = $2`,
+		job.ID, w.id,
+	)
+}
+
+// failed records a failed attempt at job, which is retried after a backoff
+// or moved to the dead state if it was the last one.
+func (w *Worker) failed(job *Job, cause error) error {
+	dead := job.Attempts >= job.MaxAttempts
+	wait := Backoff(w.opts.Backoff, w.opts.MaxBackoff, job.Attempts)
+
+	if dead {
+		w.logger.Error("job failed for the last time", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", cause.Error())
+	} else {
+		w.logger.Warn("job failed", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "retry_in", wait.String(), "error", cause.Error())
+	}
+
+	return w.settle(`
+		UPDATE jobs
+		SET state = CASE WHEN $3 THEN 'dead' ELSE 'pending' END,
+			finished_at = CASE WHEN $3 THEN NOW() END,
+			run_at = CASE WHEN $3 THEN run_at ELSE NOW() + $4 * INTERVAL '1 second' END,
+			last_error = $5,
+			locked_by = NULL,
+			locked_until = NULL
+		WHERE id = $1 AND locked_by = $2`,
+		job.ID, w.id, dead, wait.Seconds(), cause.Error(),
+	)
+}
+
+// release puts job back in the queue after it was interrupted by a shutdown,
+// giving back its attempt.
+func (w *Worker) release(job *Job) error {
+	return w.settle(`
+		UPDATE jobs
+		SET state = 'pending', attempts = attempts - 1, run_at = NOW(), locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND locked_by = $2`,
+		job.ID, w.id,
+	)
+}
+
+// settle runs query, which updates a job claimed by this worker. A job whose
+// lease was lost, and which was rescued by another worker, is left alone.
+func (w *Worker) settle(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := w.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// schedule enqueues the jobs of the worker's cron schedules when they are
+// due, until ctx is done. Each run is enqueued with a unique key made of the
+// schedule's name and time, so workers sharing the queue don't enqueue it
+// twice.
+func (w *Worker) schedule(ctx context.Context) {
+	next := make([]time.Time, len(w.crons))
+	for i, c := range w.crons {
+		next[i] = c.schedule.Next(time.Now())
+	}
+
+	for {
+		var earliest time.Time
+		for _, t := range next {
+			if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t
+			}
+		}
+		if earliest.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(earliest))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		for i, c := range w.crons {
+			if next[i].IsZero() || next[i].After(now) {
+				continue
+			}
+
+			opts := c.opts
+			opts.RunAt = next[i]
+			opts.UniqueKey = fmt.Sprintf("cron:%s:%d", c.name, next[i].Unix())
+
+			if err := w.enqueue(c.kind, c.payload, opts); err != nil && !errors.Is(err, ErrDuplicateJob) {
+				w.logger.Error("failed to enqueue scheduled job", "schedule", c.name, "error", err.Error())
+			}
+
+			next[i] = c.schedule.Next(now)
+		}
+
+		w.Notify()
+	}
+}
+
+func (w *Worker) enqueue(kind string, payload any, opts EnqueueOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := Enqueue(ctx, w.db, kind, payload, opts)
+	return err
+}
@@ -0,0 +1,165 @@
+// Package mailer sends emails, either through an SMTP server or, for
+// development and tests, by writing them to a local directory.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain-text body and an optional HTML
+// alternative.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // Extra headers, such as List-Unsubscribe.
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Format renders msg as an RFC 5322 message, with its bodies as a
+// multipart/alternative MIME entity.
+func Format(msg *Message, now time.Time) ([]byte, error) {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid From address: %w", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid To address: %w", err)
+	}
+
+	for k, v := range msg.Headers {
+		if strings.ContainsAny(k+v, "\r\n") {
+			return nil, fmt.Errorf("invalid %s header", k)
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	for k, v := range msg.Headers {
+		header(textproto.CanonicalMIMEHeaderKey(k), v)
+	}
+	header("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, part := range parts {
+		if part.body == "" {
+			continue
+		}
+
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DirMailer writes every message to its own .eml file in Dir instead of
+// sending it.
+type DirMailer struct {
+	Dir string
+}
+
+func (m DirMailer) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+
+	raw, err := Format(msg, now)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.Dir, name), raw, 0o644)
+}
+
+// SMTPMailer sends messages through an SMTP server, authenticating with
+// PLAIN auth when a username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	raw, err := Format(msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	from, _ := mail.ParseAddress(msg.From)
+	to, _ := mail.ParseAddress(msg.To)
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// net/smtp doesn't take a context, so the send only stops early when
+	// ctx is done before it starts.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Host, m.Port), auth, from.Address, []string{to.Address}, raw)
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirMailerWritesMessages(t *testing.T) {
+	dir := t.TempDir()
+	m := DirMailer{Dir: filepath.Join(dir, "outbox")}
+
+	msg := &Message{
+		From:    "Mantel <no-reply@mantel.example>",
+		To:      "alice@example.com",
+		Subject: "Your weekly digest ✨",
+		Text:    "Hello " + strings.Repeat("long line ", 20),
+		HTML:    "<p>Hello</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://mantel.example/unsubscribe>"},
+	}
+	require.NoError(t, m.Send(context.Background(), msg))
+	require.NoError(t, m.Send(context.Background(), msg))
+
+	files, err := filepath.Glob(filepath.Join(dir, "outbox", "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+
+	parsed, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+	assert.Equal(t, "<alice@example.com>", parsed.Header.Get("To"))
+	assert.Equal(t, "<https://mantel.example/unsubscribe>", parsed.Header.Get("List-Unsubscribe"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		// NextPart decodes quoted-printable itself, unless asked for raw parts.
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}
+
+	assert.Equal(t, []string{msg.Text, msg.HTML}, bodies)
+}
+
+func TestFormatRejectsInvalidMessages(t *testing.T) {
+	now := time.Now()
+
+	_, err := Format(&Message{From: "nope", To: "alice@example.com"}, now)
+	assert.Error(t, err)
+
+	_, err = Format(&Message{From: "a@example.com", To: "b@example.com", Headers: map[string]string{"X-Test": "a\r\nBcc: eve@example.com"}}, now)
+	assert.Error(t, err)
+}
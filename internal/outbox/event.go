@@ -0,0 +1,91 @@
+// Package outbox relays domain events to the in-process consumers interested
+// in them.
+//
+// Events are written to an outbox table in the same transaction as the
+// change they describe, so an event exists if and only if its change was
+// committed. A Relay then reads the outbox in order and hands each event to
+// every consumer, at least once: each consumer keeps its own offset, which
+// only moves past an event once the consumer handled it. Consumers must
+// therefore be idempotent or tolerate duplicates.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types.
+const (
+	FollowCreated     = "follow.created"
+	FollowDeleted     = "follow.deleted"
+	ReactionCreated   = "reaction.created"
+	ReactionDeleted   = "reaction.deleted"
+	PostCreated       = "post.created"
+	PostDeleted       = "post.deleted"
+	FriendshipChanged = "friendship.changed"
+)
+
+// Event is a domain event: something that happened, recorded alongside the
+// change it describes.
+type Event struct {
+	ID        int64           `json:"id"`
+	Position  Position        `json:"-"`
+	Type      string          `json:"type"`
+	ActorID   int64           `json:"actor_id"` // User whose action caused the event.
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Decode unmarshals the data of e into v.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Position is where an event sits in the outbox. Events are ordered by the
+// transaction that wrote them, then by id, which unlike ids alone is an
+// order they can't become visible out of.
+type Position struct {
+	TxID int64
+	ID   int64
+}
+
+// Before reports whether p comes before q.
+func (p Position) Before(q Position) bool {
+	if p.TxID != q.TxID {
+		return p.TxID < q.TxID
+	}
+	return p.ID < q.ID
+}
+
+// Follow is the data of FollowCreated and FollowDeleted events.
+type Follow struct {
+	FollowerID int64 `json:"follower_id"`
+	FolloweeID int64 `json:"followee_id"`
+}
+
+// Reaction is the data of ReactionCreated and ReactionDeleted events.
+type Reaction struct {
+	PostID       int64  `json:"post_id"`
+	PostAuthorID int64  `json:"post_author_id"`
+	UserID       int64  `json:"user_id"`
+	Reaction     string `json:"reaction"`
+}
+
+// Post is the data of PostCreated and PostDeleted events.
+type Post struct {
+	PostID    int64  `json:"post_id"`
+	AuthorID  int64  `json:"author_id"`
+	ReplyToID *int64 `json:"reply_to_id,omitempty"`
+}
+
+// Friendship is the data of FriendshipChanged events: the transition the
+// actor applied to their friendship with the other user, and the states it
+// went between as seen by the actor.
+type Friendship struct {
+	ActorID    int64           `json:"actor_id"`
+	OtherID    int64           `json:"other_id"`
+	Event      string          `json:"event"`
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Friendship json.RawMessage `json:"friendship"` // The friendship after the transition, or before it when it ended.
+}
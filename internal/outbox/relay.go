@@ -0,0 +1,264 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost is returned when committing the offset of a consumer whose
+// lease was taken over by another relay.
+var ErrLeaseLost = errors.New("outbox consumer lease lost")
+
+// Store is the outbox events are read from, and where the offsets of
+// consumers are kept.
+type Store interface {
+	// Acquire takes, or renews, owner's lease on consumer and returns the
+	// position of the last event the consumer handled. ok is false while
+	// another owner holds an unexpired lease. A consumer acquired for the
+	// first time starts with the events written from then on.
+	Acquire(consumer, owner string, lease time.Duration) (pos Position, ok bool, err error)
+
+	// Events returns up to limit events after pos, in order. Events written
+	// by transactions which may still be in progress are left out, so that
+	// no event can later appear before the last one returned.
+	Events(after Position, limit int) ([]Event, error)
+
+	// Commit records that consumer handled the events up to pos. It returns
+	// ErrLeaseLost if owner no longer holds the consumer's lease.
+	Commit(consumer, owner string, pos Position) error
+}
+
+// Handler handles an event. Returning an error makes the relay hand the
+// event over again later.
+type Handler func(ctx context.Context, e Event) error
+
+// RelayOptions configures a Relay.
+type RelayOptions struct {
+	Interval    time.Duration // How often new events are looked for.
+	Batch       int           // Events read at once.
+	Lease       time.Duration // How long a consumer stays with a relay after it last read events for it.
+	Backoff     time.Duration // Wait before handing a failed event over again, doubled on each following failure.
+	MaxBackoff  time.Duration // Longest wait between two attempts.
+	MaxAttempts int           // Attempts made at an event before skipping it; 0 retries forever.
+	Timeout     time.Duration // Time limit of each attempt.
+}
+
+type consumer struct {
+	name     string
+	types    map[string]bool // Types of events handled; every type when empty.
+	handle   Handler
+	wake     chan struct{}
+	failures int // Failed attempts at the event the consumer is stuck on.
+	retryAt  time.Time
+}
+
+func (c *consumer) accepts(typ string) bool {
+	return len(c.types) == 0 || c.types[typ]
+}
+
+// Relay hands the events of a Store over to the consumers registered on it.
+// Each consumer goes through the events at its own pace; one failing doesn't
+// hold up the others. When several relays share a Store, e.g. one per API
+// instance, each consumer runs on a single relay at a time.
+type Relay struct {
+	store     Store
+	opts      RelayOptions
+	owner     string
+	consumers []*consumer
+	logger    *slog.Logger
+}
+
+func NewRelay(store Store, opts RelayOptions, logger *slog.Logger) *Relay {
+	opts.Batch = max(opts.Batch, 1)
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 30 * time.Second
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = opts.Interval
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return &Relay{
+		store:  store,
+		opts:   opts,
+		owner:  hex.EncodeToString(b),
+		logger: logger,
+	}
+}
+
+// Register adds a consumer named name, handed the events of the given types,
+// or every event if none is given. The name identifies the consumer's offset
+// and must stay the same across restarts. Consumers must be registered
+// before Run is called.
+func (r *Relay) Register(name string, handle Handler, types ...string) {
+	c := &consumer{
+		name:   name,
+		types:  make(map[string]bool),
+		handle: handle,
+		wake:   make(chan struct{}, 1),
+	}
+	for _, typ := range types {
+		c.types[typ] = true
+	}
+
+	r.consumers = append(r.consumers, c)
+}
+
+// Notify makes the consumers look for new events right away, e.g. after some
+// were written. It never blocks.
+func (r *Relay) Notify() {
+	for _, c := range r.consumers {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run relays events until ctx is done. Events being handled when it stops
+// are finished.
+func (r *Relay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, c := range r.consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.run(ctx, c)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (r *Relay) run(ctx context.Context, c *consumer) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.poll(ctx, c); err != nil {
+			r.logger.Error("failed to relay outbox events", "consumer", c.name, "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// poll hands c the events written since its offset, until it runs out of
+// them or one fails.
+func (r *Relay) poll(ctx context.Context, c *consumer) error {
+	if time.Now().Before(c.retryAt) {
+		return nil
+	}
+
+	for ctx.Err() == nil {
+		// Acquiring before each batch renews the lease, so it only has to
+		// outlast a single batch.
+		pos, ok, err := r.store.Acquire(c.name, r.owner, r.opts.Lease)
+		if err != nil || !ok {
+			return err
+		}
+
+		events, err := r.store.Events(pos, r.opts.Batch)
+		if err != nil {
+			return err
+		}
+
+		handled, stuck := pos, false
+		for _, e := range events {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if c.accepts(e.Type) && !r.deliver(c, e) {
+				stuck = true
+				break
+			}
+			handled = e.Position
+		}
+
+		if handled != pos {
+			if err := r.store.Commit(c.name, r.owner, handled); err != nil {
+				return err
+			}
+		}
+
+		if stuck || len(events) < r.opts.Batch {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// deliver hands e to c, reporting whether c is done with it: either it
+// handled it, or it failed it too many times and it is skipped.
+func (r *Relay) deliver(c *consumer, e Event) bool {
+	err := r.handle(c, e)
+	if err == nil {
+		c.failures = 0
+		return true
+	}
+
+	c.failures++
+	if r.opts.MaxAttempts > 0 && c.failures >= r.opts.MaxAttempts {
+		r.logger.Error("giving up on outbox event", "consumer", c.name, "event_id", e.ID, "type", e.Type, "attempts", c.failures, "error", err.Error())
+		c.failures = 0
+		return true
+	}
+
+	wait := backoff(r.opts.Backoff, r.opts.MaxBackoff, c.failures)
+	c.retryAt = time.Now().Add(wait)
+
+	r.logger.Warn("outbox event failed", "consumer", c.name, "event_id", e.ID, "type", e.Type, "retry_in", wait.String(), "error", err.Error())
+	return false
+}
+
+func (r *Relay) handle(c *consumer, e Event) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("consumer panicked: %v", p)
+		}
+	}()
+
+	return c.handle(ctx, e)
+}
+
+// backoff returns the wait after the given number of failed attempts: base,
+// doubled for each attempt past the first, up to limit.
+func backoff(base, limit time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if limit > 0 && wait >= limit {
+			return limit
+		}
+	}
+
+	if limit > 0 {
+		return min(wait, limit)
+	}
+	return wait
+}
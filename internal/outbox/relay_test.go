@@ -0,0 +1,275 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is an in-memory Store.
+type memoryStore struct {
+	mu      sync.Mutex
+	events  []Event
+	offsets map[string]Position
+	owners  map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		offsets: make(map[string]Position),
+		owners:  make(map[string]string),
+	}
+}
+
+func (s *memoryStore) add(typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.events) + 1)
+	s.events = append(s.events, Event{ID: id, Position: Position{TxID: id, ID: id}, Type: typ})
+}
+
+func (s *memoryStore) Acquire(consumer, owner string, lease time.Duration) (Position, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if o, ok := s.owners[consumer]; ok && o != owner {
+		return Position{}, false, nil
+	}
+	s.owners[consumer] = owner
+	return s.offsets[consumer], true, nil
+}
+
+func (s *memoryStore) Events(after Position, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []Event
+	for _, e := range s.events {
+		if after.Before(e.Position) && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Commit(consumer, owner string, pos Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.owners[consumer] != owner {
+		return ErrLeaseLost
+	}
+	s.offsets[consumer] = pos
+	return nil
+}
+
+func (s *memoryStore) offset(consumer string) Position {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offsets[consumer]
+}
+
+// recorder records the ids of the events handed to a consumer.
+type recorder struct {
+	mu  sync.Mutex
+	ids []int64
+}
+
+func (r *recorder) handle(ctx context.Context, e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, e.ID)
+	return nil
+}
+
+func (r *recorder) handled() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.ids...)
+}
+
+func runRelay(t *testing.T, relay *Relay) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestPositionBefore(t *testing.T) {
+	assert.True(t, Position{TxID: 1, ID: 9}.Before(Position{TxID: 2, ID: 1}))
+	assert.True(t, Position{TxID: 2, ID: 1}.Before(Position{TxID: 2, ID: 2}))
+	assert.False(t, Position{TxID: 2, ID: 2}.Before(Position{TxID: 2, ID: 2}))
+	assert.False(t, Position{TxID: 3, ID: 1}.Before(Position{TxID: 2, ID: 5}))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(time.Second, time.Minute, 1))
+	assert.Equal(t, 4*time.Second, backoff(time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, backoff(time.Second, time.Minute, 10))
+	assert.Equal(t, time.Minute, backoff(2*time.Minute, time.Minute, 1))
+}
+
+func TestRelayDeliversInOrder(t *testing.T) {
+	store := newMemoryStore()
+	for range 7 {
+		store.add(FollowCreated)
+	}
+
+	relay := NewRelay(store, RelayOptions{Interval: 5 * time.Millisecond, Batch: 3}, slog.New(slog.DiscardHandler))
+
+	var rec recorder
+	relay.Register("test", rec.handle)
+	runRelay(t, relay)
+
+	require.Eventually(t, func() bool { return len(rec.handled()) == 7 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6, 7}, rec.handled())
+	assert.Equal(t, Position{TxID: 7, ID: 7}, store.offset("test"))
+
+	store.add(FollowDeleted)
+	relay.Notify()
+
+	require.Eventually(t, func() bool { return len(rec.handled()) == 8 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(8), rec.handled()[7])
+}
+
+func TestRelayFiltersTypes(t *testing.T) {
+	store := newMemoryStore()
+	store.add(FollowCreated)
+	store.add(ReactionCreated)
+	store.add(FollowDeleted)
+
+	relay := NewRelay(store, RelayOptions{Interval: 5 * time.Millisecond, Batch: 10}, slog.New(slog.DiscardHandler))
+
+	var rec recorder
+	relay.Register("follows", rec.handle, FollowCreated, FollowDeleted)
+	runRelay(t, relay)
+
+	// The offset moves past events of other types too.
+	require.Eventually(t, func() bool {
+		return store.offset("follows") == Position{TxID: 3, ID: 3}
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []int64{1, 3}, rec.handled())
+}
+
+func TestRelayRetriesFailedEvents(t *testing.T) {
+	store := newMemoryStore()
+	store.add(FollowCreated)
+	store.add(FollowCreated)
+
+	relay := NewRelay(store, RelayOptions{
+		Interval: 5 * time.Millisecond,
+		Batch:    10,
+		Backoff:  20 * time.Millisecond,
+	}, slog.New(slog.DiscardHandler))
+
+	var (
+		mu       sync.Mutex
+		attempts = map[int64]int{}
+		handled  []int64
+	)
+	relay.Register("flaky", func(ctx context.Context, e Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts[e.ID]++
+		if e.ID == 1 && attempts[e.ID] < 3 {
+			return errors.New("unavailable")
+		}
+		handled = append(handled, e.ID)
+		return nil
+	})
+
+	// A failing consumer doesn't hold up the others.
+	var rec recorder
+	relay.Register("healthy", rec.handle)
+
+	start := time.Now()
+	runRelay(t, relay)
+
+	require.Eventually(t, func() bool { return len(rec.handled()) == 2 }, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Empty(t, handled)
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// 20ms after the first failure, then 40ms after the second.
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int64{1, 2}, handled)
+	assert.Equal(t, map[int64]int{1: 3, 2: 1}, attempts)
+}
+
+func TestRelayGivesUp(t *testing.T) {
+	store := newMemoryStore()
+	store.add(ReactionCreated)
+	store.add(ReactionCreated)
+
+	relay := NewRelay(store, RelayOptions{
+		Interval:    time.Millisecond,
+		Batch:       10,
+		Backoff:     time.Millisecond,
+		MaxAttempts: 3,
+	}, slog.New(slog.DiscardHandler))
+
+	var rec recorder
+	relay.Register("poisoned", func(ctx context.Context, e Event) error {
+		if e.ID == 1 {
+			panic("bad event")
+		}
+		return rec.handle(ctx, e)
+	})
+	runRelay(t, relay)
+
+	require.Eventually(t, func() bool { return len(rec.handled()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []int64{2}, rec.handled())
+}
+
+func TestRelayLeases(t *testing.T) {
+	store := newMemoryStore()
+	for range 5 {
+		store.add(FollowCreated)
+	}
+
+	var first, second recorder
+
+	relay := NewRelay(store, RelayOptions{Interval: 5 * time.Millisecond}, slog.New(slog.DiscardHandler))
+	relay.Register("shared", first.handle)
+	runRelay(t, relay)
+
+	require.Eventually(t, func() bool { return len(first.handled()) == 5 }, time.Second, 5*time.Millisecond)
+
+	other := NewRelay(store, RelayOptions{Interval: 5 * time.Millisecond}, slog.New(slog.DiscardHandler))
+	other.Register("shared", second.handle)
+	runRelay(t, other)
+
+	store.add(FollowCreated)
+	relay.Notify()
+	other.Notify()
+
+	require.Eventually(t, func() bool { return len(first.handled()) == 6 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, second.handled())
+}
@@ -0,0 +1,126 @@
+// Package ranking orders feed candidates for the ranked "For You" feed.
+package ranking
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/data"
+)
+
+// Ranker orders feed candidates from most to least relevant.
+type Ranker interface {
+	Rank(candidates []data.FeedCandidate, now time.Time) []data.FeedCandidate
+}
+
+// Weights tunes how Scorer weighs each signal.
+type Weights struct {
+	HalfLife       time.Duration // Age at which a post's recency score is halved.
+	Velocity       float64       // Weight of the post's recent reactions per hour.
+	Affinity       float64       // Weight of how often the viewer reacts to the author.
+	FriendOfFriend float64       // Multiplier for posts from outside the viewer's audience.
+	AuthorSpacing  int           // Minimum number of posts between two posts of the same author.
+}
+
+var DefaultWeights = Weights{
+	HalfLife:       6 * time.Hour,
+	Velocity:       1.5,
+	Affinity:       1,
+	FriendOfFriend: 0.5,
+	AuthorSpacing:  2,
+}
+
+// Scorer is the default Ranker. A post's score decays exponentially with its
+// age and is boosted by engagement signals, which are log-scaled so a single
+// viral post or author can't take over the feed:
+//
+//	score = 2^(-age/HalfLife) * (1 + Velocity*ln(1+velocity) + Affinity*ln(1+affinity))
+//
+// Posts are then spread out so the same author doesn't show up more than once
+// in any AuthorSpacing+1 consecutive posts, when other authors are available.
+type Scorer struct {
+	Weights Weights
+}
+
+func NewScorer(w Weights) Scorer {
+	return Scorer{Weights: w}
+}
+
+// Score returns the relevance of c at the time now.
+func (s Scorer) Score(c data.FeedCandidate, now time.Time) float64 {
+	age := max(now.Sub(c.Post.CreatedAt), 0)
+	recency := math.Exp2(-age.Hours() / s.Weights.HalfLife.Hours())
+
+	engagement := 1 +
+		s.Weights.Velocity*math.Log1p(c.LikeVelocity) +
+		s.Weights.Affinity*math.Log1p(float64(c.Affinity))
+
+	score := recency * engagement
+	if c.FriendOfFriend {
+		score *= s.Weights.FriendOfFriend
+	}
+
+	return score
+}
+
+// Rank orders candidates by descending score, newest post first on ties, then
+// applies the author spacing.
+func (s Scorer) Rank(candidates []data.FeedCandidate, now time.Time) []data.FeedCandidate {
+	type scored struct {
+		data.FeedCandidate
+		score float64
+	}
+
+	ranked := make([]scored, len(candidates))
+	for i, c := range candidates {
+		ranked[i] = scored{FeedCandidate: c, score: s.Score(c, now)}
+	}
+
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Post.ID, a.Post.ID)
+	})
+
+	ordered := make([]data.FeedCandidate, len(ranked))
+	for i, r := range ranked {
+		ordered[i] = r.FeedCandidate
+	}
+
+	return spaceAuthors(ordered, s.Weights.AuthorSpacing)
+}
+
+// spaceAuthors reorders ranked so that each post is preceded by at least
+// spacing posts from other authors, picking the best ranked post that fits at
+// each position. When no post fits, the best ranked one is used anyway.
+func spaceAuthors(ranked []data.FeedCandidate, spacing int) []data.FeedCandidate {
+	if spacing < 1 {
+		return ranked
+	}
+
+	remaining := slices.Clone(ranked)
+	out := make([]data.FeedCandidate, 0, len(ranked))
+
+	for len(remaining) > 0 {
+		recent := out[max(len(out)-spacing, 0):]
+
+		pick := 0
+		for i, c := range remaining {
+			fits := !slices.ContainsFunc(recent, func(r data.FeedCandidate) bool {
+				return r.Post.UserID == c.Post.UserID
+			})
+			if fits {
+				pick = i
+				break
+			}
+		}
+
+		out = append(out, remaining[pick])
+		remaining = slices.Delete(remaining, pick, pick+1)
+	}
+
+	return out
+}
@@ -0,0 +1,105 @@
+package ranking
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bryryann/mantel/backend/internal/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixture struct {
+	Now        time.Time `json:"now"`
+	Candidates []struct {
+		PostID         int64   `json:"post_id"`
+		AuthorID       int64   `json:"author_id"`
+		AgeHours       float64 `json:"age_hours"`
+		LikeVelocity   float64 `json:"like_velocity"`
+		Affinity       int     `json:"affinity"`
+		FriendOfFriend bool    `json:"friend_of_friend"`
+	} `json:"candidates"`
+	Expected []int64 `json:"expected"`
+}
+
+func loadFixture(t *testing.T, name string) (fixture, []data.FeedCandidate) {
+	t.Helper()
+
+	raw, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+
+	var f fixture
+	require.NoError(t, json.Unmarshal(raw, &f))
+
+	var candidates []data.FeedCandidate
+	for _, c := range f.Candidates {
+		age := time.Duration(c.AgeHours * float64(time.Hour))
+		candidates = append(candidates, data.FeedCandidate{
+			Post: data.PostPublic{
+				ID:        c.PostID,
+				UserID:    c.AuthorID,
+				CreatedAt: f.Now.Add(-age),
+			},
+			LikeVelocity:   c.LikeVelocity,
+			Affinity:       c.Affinity,
+			FriendOfFriend: c.FriendOfFriend,
+		})
+	}
+
+	return f, candidates
+}
+
+func postIDs(candidates []data.FeedCandidate) []int64 {
+	ids := make([]int64, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.Post.ID
+	}
+	return ids
+}
+
+func TestScorerRank(t *testing.T) {
+	f, candidates := loadFixture(t, "candidates.json")
+
+	ranked := NewScorer(DefaultWeights).Rank(candidates, f.Now)
+
+	assert.Equal(t, f.Expected, postIDs(ranked))
+}
+
+func TestScorerRankIsDeterministic(t *testing.T) {
+	f, candidates := loadFixture(t, "candidates.json")
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for range 10 {
+		r.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		assert.Equal(t, f.Expected, postIDs(NewScorer(DefaultWeights).Rank(candidates, f.Now)))
+	}
+}
+
+func TestScorerRecencyDecay(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewScorer(DefaultWeights)
+
+	fresh := data.FeedCandidate{Post: data.PostPublic{CreatedAt: now}}
+	old := data.FeedCandidate{Post: data.PostPublic{CreatedAt: now.Add(-DefaultWeights.HalfLife)}}
+
+	assert.InDelta(t, 1, s.Score(fresh, now), 1e-9)
+	assert.InDelta(t, 0.5, s.Score(old, now), 1e-9)
+}
+
+func TestSpaceAuthors(t *testing.T) {
+	candidate := func(id, author int64) data.FeedCandidate {
+		return data.FeedCandidate{Post: data.PostPublic{ID: id, UserID: author}}
+	}
+
+	ranked := []data.FeedCandidate{
+		candidate(1, 1), candidate(2, 1), candidate(3, 1), candidate(4, 2), candidate(5, 3),
+	}
+
+	assert.Equal(t, []int64{1, 4, 5, 2, 3}, postIDs(spaceAuthors(ranked, 2)))
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, postIDs(spaceAuthors(ranked, 0)))
+}
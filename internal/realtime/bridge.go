@@ -0,0 +1,103 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres channel events are relayed on.
+const notifyChannel = "realtime_events"
+
+// maxPayload is the largest NOTIFY payload Postgres accepts, in bytes.
+const maxPayload = 8000
+
+var ErrEventTooLarge = errors.New("event too large to relay")
+
+// notification is an event as relayed through Postgres.
+type notification struct {
+	Topic string `json:"topic"`
+	Event Event  `json:"event"`
+}
+
+// Bridge is a Publisher that relays events through Postgres LISTEN/NOTIFY,
+// so that they reach the clients connected to every API instance. Each
+// instance runs its own Bridge, which hands the events it hears to its local
+// Hub, including the ones it published itself.
+type Bridge struct {
+	db     *sql.DB
+	dsn    string
+	hub    *Hub
+	logger *slog.Logger
+}
+
+func NewBridge(db *sql.DB, dsn string, hub *Hub, logger *slog.Logger) *Bridge {
+	return &Bridge{db: db, dsn: dsn, hub: hub, logger: logger}
+}
+
+// Publish notifies every instance listening on the bridge of e.
+func (b *Bridge) Publish(e Event) error {
+	payload, err := json.Marshal(notification{Topic: e.Topic, Event: e})
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxPayload {
+		return fmt.Errorf("%w: %d bytes", ErrEventTooLarge, len(payload))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	return err
+}
+
+// Listen relays the events notified by any instance to the local hub until
+// ctx is done. The listener reconnects by itself when the connection drops.
+func (b *Bridge) Listen(ctx context.Context) error {
+	listener := pq.NewListener(b.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			b.logger.Error("realtime listener error", "error", err.Error())
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established;
+			// anything sent while it was down is lost.
+			if n == nil {
+				continue
+			}
+
+			var msg notification
+			if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+				b.logger.Error("invalid realtime notification", "error", err.Error())
+				continue
+			}
+
+			msg.Event.Topic = msg.Topic
+			if err := b.hub.Publish(msg.Event); err != nil {
+				return err
+			}
+
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package realtime delivers live events to connected clients. A Hub fans
+// events out to the subscriptions of a single API instance, and a Bridge
+// relays them between instances through Postgres LISTEN/NOTIFY.
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSlowConsumer = errors.New("subscriber fell too far behind")
+	ErrHubClosed    = errors.New("hub closed")
+)
+
+// Event types delivered to clients.
+const (
+	EventFeedPost      = "feed.post"      // A post landed in the subscriber's home feed.
+	EventPostReaction  = "post.reaction"  // Someone reacted to one of the subscriber's posts.
+	EventFollow        = "follow"         // Someone started following the subscriber.
+	EventFriendRequest = "friend_request" // A friend request involving the subscriber changed.
+	EventNotification  = "notification"   // The subscriber received a notification.
+	EventMessage       = "message"        // A message was sent to one of the subscriber's conversations. Carries its ID only.
+	EventMessageRead   = "message.read"   // Another member read one of the subscriber's conversations.
+)
+
+// UserTopic carries the events addressed to userID personally.
+func UserTopic(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// AuthorTopic carries the posts of authorID that their followers and friends
+// may see.
+func AuthorTopic(authorID int64) string {
+	return fmt.Sprintf("author:%d", authorID)
+}
+
+// FriendsTopic carries the posts of authorID that only their friends may see.
+func FriendsTopic(authorID int64) string {
+	return fmt.Sprintf("friends:%d", authorID)
+}
+
+// Event is a message published on a topic.
+type Event struct {
+	Topic     string          `json:"-"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEvent builds an event of type typ for topic, with data encoded as JSON.
+func NewEvent(topic, typ string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Topic: topic, Type: typ, Data: raw, CreatedAt: time.Now()}, nil
+}
+
+// Publisher publishes events to every subscriber of their topic.
+type Publisher interface {
+	Publish(e Event) error
+}
+
+// Hub dispatches events to the subscriptions of this process.
+//
+// Publishing never blocks: each subscription buffers a fixed number of
+// events, and a subscription whose buffer is full when an event arrives is
+// dropped with ErrSlowConsumer rather than holding up every other subscriber.
+// Clients are expected to reconnect and refetch what they missed.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+	buffer int
+	closed bool
+}
+
+// NewHub returns a Hub whose subscriptions buffer up to buffer events.
+func NewHub(buffer int) *Hub {
+	return &Hub{
+		topics: make(map[string]map[*Subscription]struct{}),
+		buffer: max(buffer, 1),
+	}
+}
+
+// Subscribe returns a subscription receiving the events of topics. It must
+// be closed once the caller is done with it.
+func (h *Hub) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		topics: topics,
+		events: make(chan Event, h.buffer),
+		done:   make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		s.stop(ErrHubClosed)
+		return s
+	}
+
+	for _, topic := range topics {
+		subs, ok := h.topics[topic]
+		if !ok {
+			subs = make(map[*Subscription]struct{})
+			h.topics[topic] = subs
+		}
+		subs[s] = struct{}{}
+	}
+
+	return s
+}
+
+// Publish delivers e to the local subscribers of e.Topic.
+func (h *Hub) Publish(e Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.closed {
+		return ErrHubClosed
+	}
+
+	for s := range h.topics[e.Topic] {
+		select {
+		case <-s.done:
+		case s.events <- e:
+		default:
+			s.stop(ErrSlowConsumer)
+		}
+	}
+
+	return nil
+}
+
+// Close stops every subscription with ErrHubClosed. Later publishes fail.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for topic, subs := range h.topics {
+		for s := range subs {
+			s.stop(ErrHubClosed)
+		}
+		delete(h.topics, topic)
+	}
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range s.topics {
+		subs := h.topics[topic]
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Subscription receives the events of the topics it was created with.
+type Subscription struct {
+	hub    *Hub
+	topics []string
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// Events returns the channel events are delivered on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed once the subscription stops receiving events, because it
+// was closed, fell behind, or the hub shut down. Err tells which.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the subscription stopped, or nil while it is active or if
+// it was closed by its owner.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close unsubscribes from the hub. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.stop(nil)
+	s.hub.remove(s)
+}
+
+func (s *Subscription) stop(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
@@ -0,0 +1,84 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustEvent(t *testing.T, topic, typ string, data any) Event {
+	t.Helper()
+
+	e, err := NewEvent(topic, typ, data)
+	require.NoError(t, err)
+	return e
+}
+
+func TestHubDeliversToTopicSubscribers(t *testing.T) {
+	hub := NewHub(4)
+
+	alice := hub.Subscribe(UserTopic(1), AuthorTopic(2))
+	defer alice.Close()
+	bob := hub.Subscribe(UserTopic(3))
+	defer bob.Close()
+
+	require.NoError(t, hub.Publish(mustEvent(t, AuthorTopic(2), EventFeedPost, map[string]int{"id": 10})))
+
+	select {
+	case e := <-alice.Events():
+		assert.Equal(t, EventFeedPost, e.Type)
+		assert.JSONEq(t, `{"id":10}`, string(e.Data))
+	default:
+		t.Fatal("expected an event for the author topic subscriber")
+	}
+
+	assert.Empty(t, bob.Events())
+}
+
+func TestHubDropsSlowConsumers(t *testing.T) {
+	hub := NewHub(2)
+
+	slow := hub.Subscribe(UserTopic(1))
+	defer slow.Close()
+	fast := hub.Subscribe(UserTopic(1))
+	defer fast.Close()
+
+	for i := range 3 {
+		require.NoError(t, hub.Publish(mustEvent(t, UserTopic(1), EventFollow, i)))
+		if i < 2 {
+			<-fast.Events()
+		}
+	}
+
+	<-slow.Done()
+	assert.ErrorIs(t, slow.Err(), ErrSlowConsumer)
+	assert.NoError(t, fast.Err())
+	assert.Len(t, fast.Events(), 1)
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	hub := NewHub(1)
+
+	s := hub.Subscribe(UserTopic(1))
+	s.Close()
+	s.Close()
+
+	<-s.Done()
+	assert.NoError(t, s.Err())
+	assert.Empty(t, hub.topics)
+
+	require.NoError(t, hub.Publish(mustEvent(t, UserTopic(1), EventFollow, nil)))
+	assert.Empty(t, s.Events())
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(1)
+
+	s := hub.Subscribe(UserTopic(1))
+	hub.Close()
+
+	<-s.Done()
+	assert.ErrorIs(t, s.Err(), ErrHubClosed)
+	assert.ErrorIs(t, hub.Publish(mustEvent(t, UserTopic(1), EventFollow, nil)), ErrHubClosed)
+}
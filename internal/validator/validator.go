@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"cmp"
 	"regexp"
 	"slices"
 )
@@ -51,10 +52,15 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
-// Unique checks if all string values in a slice are distinct.
+// Between checks if a value lies within the inclusive range [min, max].
+func Between[T cmp.Ordered](value, min, max T) bool {
+	return value >= min && value <= max
+}
+
+// Unique checks if all values in a slice are distinct.
 // Returns true if all values are unique, false if there are duplicates.
-func Unique(values []string) bool {
-	uniqueValues := make(map[string]bool)
+func Unique[T comparable](values []T) bool {
+	uniqueValues := make(map[T]bool)
 
 	for _, value := range values {
 		uniqueValues[value] = true
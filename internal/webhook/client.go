@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when an endpoint resolves to a loopback,
+// private or otherwise non-public address, which deliveries may not reach
+// unless the client allows it.
+var ErrPrivateAddress = errors.New("webhook endpoint resolves to a non-public address")
+
+// maxResponseBody is how much of an endpoint's response is kept in delivery
+// logs.
+const maxResponseBody = 1024
+
+// StatusError is returned when an endpoint answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("endpoint responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Delivery is an event to send to an endpoint.
+type Delivery struct {
+	ID         int64
+	EndpointID int64
+	URL        string
+	Secret     string
+	Event      string
+	Data       json.RawMessage
+	Attempts   int // Attempts already made.
+	CreatedAt  time.Time
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Attempt describes one attempt at sending a delivery.
+type Attempt struct {
+	StatusCode   int // 0 when no response was received.
+	ResponseBody string
+	Error        string
+	Duration     time.Duration
+}
+
+// Client sends deliveries to endpoints.
+type Client struct {
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+// NewHTTPClient returns an HTTP client suited to deliveries: it doesn't
+// follow redirects and, unless allowPrivate is set, refuses to connect to
+// non-public addresses so that endpoints can't be used to reach internal
+// services.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !public(addrPort.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// Send posts d to its endpoint, signed with its secret. The returned attempt
+// is filled in whether it succeeded or not. Non-2xx responses fail with a
+// *StatusError.
+func (c *Client) Send(ctx context.Context, d Delivery) (Attempt, error) {
+	var attempt Attempt
+
+	body, err := json.Marshal(Payload{ID: d.ID, Event: d.Event, CreatedAt: d.CreatedAt, Data: d.Data})
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, time.Now(), body))
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	start := time.Now()
+	res, err := httpClient.Do(req)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+	defer res.Body.Close()
+
+	reply, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBody))
+	io.CopyN(io.Discard, res.Body, 64<<10)
+
+	attempt.StatusCode = res.StatusCode
+	attempt.ResponseBody = string(reply)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err := &StatusError{StatusCode: res.StatusCode, Body: string(reply)}
+		attempt.Error = err.Error()
+		return attempt, err
+	}
+
+	return attempt, nil
+}
@@ -0,0 +1,24 @@
+package webhook
+
+import "slices"
+
+// Events users can subscribe their endpoints to.
+const (
+	EventPostCreated        = "post.created"        // The user published a post.
+	EventLikeCreated        = "like.created"        // Someone liked one of the user's posts.
+	EventFollowCreated      = "follow.created"      // Someone followed the user.
+	EventFriendshipAccepted = "friendship.accepted" // The user and someone else became friends.
+)
+
+// Events lists every event, in documentation order.
+var Events = []string{
+	EventPostCreated,
+	EventLikeCreated,
+	EventFollowCreated,
+	EventFriendshipAccepted,
+}
+
+// ValidEvent reports whether event is one of Events.
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
@@ -0,0 +1,76 @@
+// Package webhook delivers events to the HTTP endpoints users register, with
+// signed payloads and retries with exponential backoff.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderEvent     = "Mantel-Event"
+	HeaderDelivery  = "Mantel-Delivery"
+	HeaderSignature = "Mantel-Signature"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header of body sent at t, in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256>". The HMAC covers the timestamp, a
+// dot and the body, so a captured delivery can't be replayed much later.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify checks that header is a valid signature of body made with secret
+// less than tolerance before now. Receivers can use it as a reference.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var (
+		ts         string
+		signatures [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
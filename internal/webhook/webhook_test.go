@@ -0,0 +1,335 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+
+	header := Sign("secret", now, body)
+	assert.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+
+	assert.NoError(t, Verify("secret", header, body, 5*time.Minute, now.Add(time.Minute)))
+	assert.ErrorIs(t, Verify("other", header, body, 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":2}`), 5*time.Minute, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, body, 5*time.Minute, now.Add(time.Hour)), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "v1=00", body, 5*time.Minute, now), ErrInvalidSignature)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, Backoff(time.Second, time.Minute, 1))
+	assert.Equal(t, 2*time.Second, Backoff(time.Second, time.Minute, 2))
+	assert.Equal(t, 8*time.Second, Backoff(time.Second, time.Minute, 4))
+	assert.Equal(t, time.Minute, Backoff(time.Second, time.Minute, 20))
+	assert.Equal(t, 16*time.Second, Backoff(time.Second, 0, 5))
+}
+
+func TestClientSend(t *testing.T) {
+	var received atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, EventPostCreated, r.Header.Get(HeaderEvent))
+		assert.Equal(t, "42", r.Header.Get(HeaderDelivery))
+		assert.NoError(t, Verify("s3cret", r.Header.Get(HeaderSignature), body, time.Minute, time.Now()))
+
+		var payload Payload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, int64(42), payload.ID)
+		assert.Equal(t, EventPostCreated, payload.Event)
+		assert.JSONEq(t, `{"post_id":7}`, string(payload.Data))
+
+		received.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: NewHTTPClient(time.Second, true)}
+
+	attempt, err := client.Send(context.Background(), Delivery{
+		ID:     42,
+		URL:    srv.URL,
+		Secret: "s3cret",
+		Event:  EventPostCreated,
+		Data:   json.RawMessage(`{"post_id":7}`),
+	})
+	require.NoError(t, err)
+	assert.True(t, received.Load())
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	assert.Empty(t, attempt.Error)
+}
+
+func TestClientSendStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: NewHTTPClient(time.Second, true)}
+
+	attempt, err := client.Send(context.Background(), Delivery{ID: 1, URL: srv.URL, Event: EventPostCreated, Data: json.RawMessage(`{}`)})
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+	assert.Equal(t, "boom\n", attempt.ResponseBody)
+	assert.NotEmpty(t, attempt.Error)
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	var received atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(true)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: NewHTTPClient(time.Second, false)}
+
+	attempt, err := client.Send(context.Background(), Delivery{ID: 1, URL: srv.URL, Event: EventPostCreated, Data: json.RawMessage(`{}`)})
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+	assert.Zero(t, attempt.StatusCode)
+	assert.False(t, received.Load())
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: NewHTTPClient(time.Second, true)}
+
+	attempt, err := client.Send(context.Background(), Delivery{ID: 1, URL: srv.URL, Event: EventPostCreated, Data: json.RawMessage(`{}`)})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusFound, attempt.StatusCode)
+}
+
+type result struct {
+	delivery int64
+	attempts int
+	status   int
+	retryAt  *time.Time
+	ok       bool
+}
+
+// memoryStore is an in-memory Store.
+type memoryStore struct {
+	mu      sync.Mutex
+	pending map[int64]Delivery
+	due     map[int64]time.Time
+	leased  map[int64]time.Time
+	results []result
+}
+
+func newMemoryStore(deliveries ...Delivery) *memoryStore {
+	s := &memoryStore{
+		pending: make(map[int64]Delivery),
+		due:     make(map[int64]time.Time),
+		leased:  make(map[int64]time.Time),
+	}
+	for _, d := range deliveries {
+		s.pending[d.ID] = d
+		s.due[d.ID] = time.Now()
+	}
+	return s
+}
+
+func (s *memoryStore) Claim(limit int, lease time.Duration) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var claimed []Delivery
+	for id, d := range s.pending {
+		if len(claimed) == limit {
+			break
+		}
+		if time.Now().Before(s.due[id]) || time.Now().Before(s.leased[id]) {
+			continue
+		}
+		s.leased[id] = time.Now().Add(lease)
+		claimed = append(claimed, d)
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) Succeeded(d Delivery, attempt Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pending, d.ID)
+	s.results = append(s.results, result{delivery: d.ID, attempts: d.Attempts + 1, status: attempt.StatusCode, ok: true})
+	return nil
+}
+
+func (s *memoryStore) Failed(d Delivery, attempt Attempt, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result{delivery: d.ID, attempts: d.Attempts + 1, status: attempt.StatusCode, retryAt: retryAt})
+	if retryAt == nil {
+		delete(s.pending, d.ID)
+		return nil
+	}
+
+	d.Attempts++
+	s.pending[d.ID] = d
+	s.due[d.ID] = *retryAt
+	delete(s.leased, d.ID)
+	return nil
+}
+
+func (s *memoryStore) snapshot() ([]result, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]result(nil), s.results...), len(s.pending)
+}
+
+func runWorker(t *testing.T, store Store, opts WorkerOptions) *Worker {
+	t.Helper()
+
+	worker := NewWorker(&Client{HTTPClient: NewHTTPClient(time.Second, true)}, store, opts, slog.New(slog.DiscardHandler))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return worker
+}
+
+func TestWorkerRetriesWithBackoff(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore(Delivery{ID: 1, URL: srv.URL, Secret: "s", Event: EventFollowCreated, Data: json.RawMessage(`{}`)})
+
+	start := time.Now()
+	runWorker(t, store, WorkerOptions{
+		Interval:    5 * time.Millisecond,
+		MaxAttempts: 5,
+		Backoff:     20 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	})
+
+	require.Eventually(t, func() bool {
+		_, pending := store.snapshot()
+		return pending == 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	results, _ := store.snapshot()
+	require.Len(t, results, 3)
+
+	assert.Equal(t, http.StatusServiceUnavailable, results[0].status)
+	require.NotNil(t, results[0].retryAt)
+	assert.WithinDuration(t, start.Add(20*time.Millisecond), *results[0].retryAt, 15*time.Millisecond)
+
+	assert.Equal(t, 2, results[1].attempts)
+	require.NotNil(t, results[1].retryAt)
+	assert.GreaterOrEqual(t, results[1].retryAt.Sub(*results[0].retryAt), 40*time.Millisecond)
+
+	assert.True(t, results[2].ok)
+	assert.Equal(t, 3, results[2].attempts)
+	assert.Equal(t, http.StatusOK, results[2].status)
+}
+
+func TestWorkerGivesUp(t *testing.T) {
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore(
+		Delivery{ID: 1, URL: srv.URL, Secret: "s", Event: EventLikeCreated, Data: json.RawMessage(`{}`)},
+		Delivery{ID: 2, URL: srv.URL, Secret: "s", Event: EventLikeCreated, Data: json.RawMessage(`{}`), Attempts: 1},
+	)
+
+	runWorker(t, store, WorkerOptions{
+		Interval:    5 * time.Millisecond,
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+	})
+
+	require.Eventually(t, func() bool {
+		_, pending := store.snapshot()
+		return pending == 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	results, _ := store.snapshot()
+
+	attempts := map[int64]int{}
+	for _, r := range results {
+		assert.False(t, r.ok)
+		attempts[r.delivery] = r.attempts
+		if r.attempts == 2 {
+			assert.Nil(t, r.retryAt, "delivery %d", r.delivery)
+		}
+	}
+
+	assert.Equal(t, map[int64]int{1: 2, 2: 2}, attempts)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestWorkerNotify(t *testing.T) {
+	received := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(HeaderDelivery)
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore()
+
+	worker := runWorker(t, store, WorkerOptions{Interval: time.Hour, MaxAttempts: 1})
+
+	store.mu.Lock()
+	store.pending[9] = Delivery{ID: 9, URL: srv.URL, Secret: "s", Event: EventFriendshipAccepted, Data: json.RawMessage(`{}`)}
+	store.mu.Unlock()
+
+	worker.Notify()
+
+	select {
+	case id := <-received:
+		assert.Equal(t, strconv.Itoa(9), id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("delivery not sent after Notify")
+	}
+}
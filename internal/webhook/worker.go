@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Store is the persistent queue deliveries are taken from.
+type Store interface {
+	// Claim returns up to limit deliveries due for an attempt, hiding them
+	// from other workers for lease. Deliveries whose lease ran out without
+	// being settled, e.g. because their worker stopped, are claimed again.
+	Claim(limit int, lease time.Duration) ([]Delivery, error)
+
+	// Succeeded records a successful attempt at d.
+	Succeeded(d Delivery, attempt Attempt) error
+
+	// Failed records a failed attempt at d, to be retried at retryAt. A nil
+	// retryAt means d was given up on.
+	Failed(d Delivery, attempt Attempt, retryAt *time.Time) error
+}
+
+// WorkerOptions configures a Worker.
+type WorkerOptions struct {
+	Interval    time.Duration // How often due deliveries are looked for.
+	Batch       int           // Deliveries claimed at once.
+	Concurrency int           // Deliveries sent at the same time.
+	MaxAttempts int           // Attempts made at a delivery before giving up on it.
+	Backoff     time.Duration // Wait before the first retry, doubled on each following one.
+	MaxBackoff  time.Duration // Longest wait between two attempts.
+	Timeout     time.Duration // Time limit of each attempt.
+}
+
+// Worker sends the deliveries of a Store, retrying failed ones with
+// exponential backoff.
+type Worker struct {
+	client *Client
+	store  Store
+	opts   WorkerOptions
+	wake   chan struct{}
+	logger *slog.Logger
+}
+
+func NewWorker(client *Client, store Store, opts WorkerOptions, logger *slog.Logger) *Worker {
+	opts.Batch = max(opts.Batch, 1)
+	opts.Concurrency = max(opts.Concurrency, 1)
+	opts.MaxAttempts = max(opts.MaxAttempts, 1)
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	return &Worker{
+		client: client,
+		store:  store,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		logger: logger,
+	}
+}
+
+// Notify makes the worker look for due deliveries right away, e.g. after new
+// ones were queued. It never blocks.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is done. Deliveries in progress when it
+// stops are finished.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back, so a backlog drains
+		// without waiting for the ticker.
+		for {
+			n, err := w.poll()
+			if err != nil {
+				w.logger.Error("failed to claim webhook deliveries", "error", err.Error())
+			}
+			if n < w.opts.Batch || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// poll claims a batch of due deliveries and sends them, returning how many
+// it claimed.
+func (w *Worker) poll() (int, error) {
+	// Claims outlive their attempt, so no other worker picks them up while
+	// the result is being recorded.
+	deliveries, err := w.store.Claim(w.opts.Batch, 2*w.opts.Timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, w.opts.Concurrency)
+
+	for _, d := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			w.deliver(d)
+		}()
+	}
+
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func (w *Worker) deliver(d Delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+
+	attempt, err := w.client.Send(ctx, d)
+	if err == nil {
+		if err := w.store.Succeeded(d, attempt); err != nil {
+			w.logger.Error("failed to record webhook delivery", "delivery_id", d.ID, "error", err.Error())
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if n := d.Attempts + 1; n < w.opts.MaxAttempts {
+		at := time.Now().Add(Backoff(w.opts.Backoff, w.opts.MaxBackoff, n))
+		retryAt = &at
+	}
+
+	if err := w.store.Failed(d, attempt, retryAt); err != nil {
+		w.logger.Error("failed to record webhook delivery", "delivery_id", d.ID, "error", err.Error())
+	}
+}
+
+// Backoff returns the wait before retrying after the given number of failed
+// attempts: base, doubled for each attempt past the first, up to limit.
+func Backoff(base, limit time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if limit > 0 && wait >= limit {
+			return limit
+		}
+	}
+
+	if limit > 0 {
+		return min(wait, limit)
+	}
+	return wait
+}
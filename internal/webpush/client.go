@@ -0,0 +1,157 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrGone is returned when the push service reports that a subscription
+	// expired or was unsubscribed. It should be deleted.
+	ErrGone = errors.New("push subscription is gone")
+
+	// ErrPrivateAddress is returned when an endpoint resolves to a loopback,
+	// private or otherwise non-public address, which messages may not reach
+	// unless the client allows it.
+	ErrPrivateAddress = errors.New("push endpoint resolves to a non-public address")
+)
+
+// StatusError is returned when the push service rejects a message.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("push service responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Temporary reports whether sending the message again later may succeed.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Urgency hints push services at how soon a message must reach a user agent
+// running on battery.
+type Urgency string
+
+const (
+	UrgencyVeryLow Urgency = "very-low"
+	UrgencyLow     Urgency = "low"
+	UrgencyNormal  Urgency = "normal"
+	UrgencyHigh    Urgency = "high"
+)
+
+// Message is a message to push to a subscription.
+type Message struct {
+	Payload []byte
+	Topic   string // Replaces a pending message with the same topic. At most 32 base64url characters.
+	Urgency Urgency
+}
+
+// Client sends messages to push services.
+type Client struct {
+	HTTPClient *http.Client
+	VAPID      *VAPID
+	TTL        time.Duration // How long push services keep undelivered messages.
+}
+
+// NewHTTPClient returns an HTTP client suited to push services: it doesn't
+// follow redirects and, unless allowPrivate is set, refuses to connect to
+// non-public addresses so that subscriptions can't be used to reach internal
+// services.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !public(addrPort.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
+
+// Send encrypts msg for sub and hands it to sub's push service. Returns
+// ErrGone if the subscription no longer exists, or a *StatusError for any
+// other rejection.
+func (c *Client) Send(ctx context.Context, sub Subscription, msg Message) error {
+	body, err := Encrypt(sub.Keys, msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := c.VAPID.authorization(sub.Endpoint, time.Now().Add(12*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(c.TTL.Seconds())))
+	if msg.Topic != "" {
+		req.Header.Set("Topic", msg.Topic)
+	}
+	if msg.Urgency != "" {
+		req.Header.Set("Urgency", string(msg.Urgency))
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+
+	reason, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return &StatusError{StatusCode: res.StatusCode, Body: string(reason)}
+}
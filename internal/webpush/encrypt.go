@@ -0,0 +1,159 @@
+// Package webpush sends Web Push messages (RFC 8030) to browser push
+// services, encrypted as RFC 8291 requires and authenticated with VAPID
+// (RFC 8292).
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// recordSize is the record size advertised in the aes128gcm header. Messages
+// always fit in a single record.
+const recordSize = 4096
+
+// headerSize is the size of the aes128gcm header of an encrypted message:
+// salt, record size, key id length and the sender's public key.
+const headerSize = 16 + 4 + 1 + 65
+
+// MaxPayload is the largest payload, in bytes, that keeps the encrypted
+// message within the 4096 bytes every push service must accept.
+const MaxPayload = 4096 - headerSize - 16 - 1
+
+var (
+	ErrPayloadTooLarge = errors.New("push payload too large")
+	ErrInvalidKeys     = errors.New("invalid push subscription keys")
+)
+
+// Keys are the keys a user agent generates for a push subscription, as the
+// base64url encoded strings found in PushSubscription.toJSON().
+type Keys struct {
+	P256dh string `json:"p256dh"` // The user agent's P-256 public key, uncompressed.
+	Auth   string `json:"auth"`   // The 16 bytes authentication secret.
+}
+
+// Subscription is where and how to deliver messages to a user agent.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     Keys   `json:"keys"`
+}
+
+// decodeBase64 decodes a base64url string, with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+// parse decodes and checks the keys.
+func (k Keys) parse() (*ecdh.PublicKey, []byte, error) {
+	rawPublic, err := decodeBase64(k.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: p256dh: %v", ErrInvalidKeys, err)
+	}
+
+	public, err := ecdh.P256().NewPublicKey(rawPublic)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: p256dh: %v", ErrInvalidKeys, err)
+	}
+
+	auth, err := decodeBase64(k.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, nil, fmt.Errorf("%w: auth must be 16 bytes", ErrInvalidKeys)
+	}
+
+	return public, auth, nil
+}
+
+// Validate reports whether the keys are well-formed.
+func (k Keys) Validate() error {
+	_, _, err := k.parse()
+	return err
+}
+
+// Encrypt encrypts payload for the user agent holding keys, as a single
+// aes128gcm record (RFC 8188) keyed as RFC 8291 describes.
+func Encrypt(keys Keys, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, len(payload))
+	}
+
+	uaPublic, auth, err := keys.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return encrypt(uaPublic, auth, asPrivate, salt, payload)
+}
+
+func encrypt(uaPublic *ecdh.PublicKey, auth []byte, asPrivate *ecdh.PrivateKey, salt, payload []byte) ([]byte, error) {
+	secret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// Mix the authentication secret in, then derive the content encryption
+	// key and nonce from the result and the salt.
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, secret, auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, headerSize+len(payload)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+
+	// 0x02 marks the last, and only, record.
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	return gcm.Seal(body, nonce, plaintext, nil), nil
+}
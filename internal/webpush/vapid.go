@@ -0,0 +1,112 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+var ErrInvalidVAPIDKey = errors.New("invalid VAPID private key")
+
+// VAPID identifies the application server to push services (RFC 8292).
+type VAPID struct {
+	key     *ecdsa.PrivateKey
+	subject string
+}
+
+// NewVAPID returns the VAPID identity made of the base64url encoded P-256
+// private key privateKey and subject, a mailto: or https: URL push services
+// may use to contact the operator.
+func NewVAPID(privateKey, subject string) (*VAPID, error) {
+	raw, err := decodeBase64(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVAPIDKey, err)
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVAPIDKey, err)
+	}
+
+	u, err := url.Parse(subject)
+	if err != nil || (u.Scheme != "mailto" && u.Scheme != "https") {
+		return nil, fmt.Errorf("VAPID subject must be a mailto: or https: URL, got %q", subject)
+	}
+
+	public := key.PublicKey().Bytes()
+
+	return &VAPID{
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(raw),
+		},
+		subject: subject,
+	}, nil
+}
+
+// GenerateVAPIDKey returns a new base64url encoded P-256 private key, along
+// with its public key.
+func GenerateVAPIDKey() (privateKey, publicKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		nil
+}
+
+// PublicKey returns the base64url encoded public key, which clients pass as
+// applicationServerKey when subscribing.
+func (v *VAPID) PublicKey() string {
+	public, _ := v.key.PublicKey.ECDH()
+	return base64.RawURLEncoding.EncodeToString(public.Bytes())
+}
+
+// authorization returns the Authorization header value for a request to
+// endpoint, valid until exp.
+func (v *VAPID) authorization(endpoint string, exp time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": exp.Unix(),
+		"sub": v.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, v.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS wants the raw r || s form of the signature rather than ASN.1.
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, enc.EncodeToString(signature), v.PublicKey()), nil
+}
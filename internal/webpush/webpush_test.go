@@ -0,0 +1,329 @@
+package webpush
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// userAgent holds the keys of a push subscription, as a browser would.
+type userAgent struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newUserAgent(t *testing.T) *userAgent {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	auth := make([]byte, 16)
+	_, err = rand.Read(auth)
+	require.NoError(t, err)
+
+	return &userAgent{key: key, auth: auth}
+}
+
+func (ua *userAgent) subscription(endpoint string) Subscription {
+	return Subscription{
+		Endpoint: endpoint,
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(ua.key.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(ua.auth),
+		},
+	}
+}
+
+// decrypt decrypts body the way the user agent does (RFC 8291, section 3.4).
+func (ua *userAgent) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	require.Greater(t, len(body), headerSize)
+	salt := body[:16]
+	assert.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(body[16:20]))
+	require.Equal(t, byte(65), body[20])
+
+	asPublic, err := ecdh.P256().NewPublicKey(body[21:86])
+	require.NoError(t, err)
+
+	secret, err := ua.key.ECDH(asPublic)
+	require.NoError(t, err)
+
+	keyInfo := "WebPush: info\x00" + string(ua.key.PublicKey().Bytes()) + string(asPublic.Bytes())
+	ikm, err := hkdf.Key(sha256.New, secret, ua.auth, keyInfo, 32)
+	require.NoError(t, err)
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	require.NoError(t, err)
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	require.NoError(t, err)
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	plaintext, err := gcm.Open(nil, nonce, body[headerSize:], nil)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, plaintext)
+	assert.Equal(t, byte(0x02), plaintext[len(plaintext)-1])
+	return plaintext[:len(plaintext)-1]
+}
+
+// verifyVAPID checks the Authorization header of a push request the way a
+// push service does, and returns the JWT claims.
+func verifyVAPID(t *testing.T, header string) map[string]any {
+	t.Helper()
+
+	require.True(t, strings.HasPrefix(header, "vapid "), header)
+
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[k] = v
+	}
+
+	rawKey, err := base64.RawURLEncoding.DecodeString(params["k"])
+	require.NoError(t, err)
+	require.Len(t, rawKey, 65)
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(rawKey[1:33]),
+		Y:     new(big.Int).SetBytes(rawKey[33:]),
+	}
+
+	parts := strings.Split(params["t"], ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.Len(t, signature, 64)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	require.True(t, ecdsa.Verify(key, digest[:], r, s), "invalid VAPID signature")
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(rawClaims, &claims))
+	return claims
+}
+
+// pushService is a fake push service answering each request with the next of
+// its statuses, then 201 once they run out.
+type pushService struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newPushService(t *testing.T, statuses ...int) *pushService {
+	t.Helper()
+
+	ps := &pushService{statuses: statuses}
+	ps.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		ps.mu.Lock()
+		ps.requests = append(ps.requests, r)
+		ps.bodies = append(ps.bodies, body)
+		status := http.StatusCreated
+		if len(ps.statuses) > 0 {
+			status, ps.statuses = ps.statuses[0], ps.statuses[1:]
+		}
+		ps.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ps.Close)
+
+	return ps
+}
+
+func (ps *pushService) count() int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.requests)
+}
+
+func newClient(t *testing.T) *Client {
+	t.Helper()
+
+	private, _, err := GenerateVAPIDKey()
+	require.NoError(t, err)
+
+	vapid, err := NewVAPID(private, "mailto:ops@example.com")
+	require.NoError(t, err)
+
+	return &Client{VAPID: vapid, TTL: time.Hour}
+}
+
+func TestClientSendsEncryptedMessage(t *testing.T) {
+	ps := newPushService(t)
+	ua := newUserAgent(t)
+	client := newClient(t)
+
+	payload := []byte(`{"type":"notification"}`)
+	err := client.Send(context.Background(), ua.subscription(ps.URL+"/push/abc"), Message{
+		Payload: payload,
+		Topic:   "follow",
+		Urgency: UrgencyHigh,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, ps.count())
+
+	req := ps.requests[0]
+	assert.Equal(t, "/push/abc", req.URL.Path)
+	assert.Equal(t, "aes128gcm", req.Header.Get("Content-Encoding"))
+	assert.Equal(t, "3600", req.Header.Get("TTL"))
+	assert.Equal(t, "follow", req.Header.Get("Topic"))
+	assert.Equal(t, "high", req.Header.Get("Urgency"))
+
+	claims := verifyVAPID(t, req.Header.Get("Authorization"))
+	assert.Equal(t, ps.URL, claims["aud"])
+	assert.Equal(t, "mailto:ops@example.com", claims["sub"])
+	assert.Greater(t, claims["exp"], float64(time.Now().Unix()))
+
+	assert.Equal(t, payload, ua.decrypt(t, ps.bodies[0]))
+}
+
+func TestClientReportsGoneSubscriptions(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		ps := newPushService(t, status)
+
+		err := newClient(t).Send(context.Background(), newUserAgent(t).subscription(ps.URL), Message{Payload: []byte("x")})
+		assert.ErrorIs(t, err, ErrGone)
+	}
+}
+
+func TestClientRejectsBadInput(t *testing.T) {
+	ps := newPushService(t)
+	client := newClient(t)
+	sub := newUserAgent(t).subscription(ps.URL)
+
+	err := client.Send(context.Background(), sub, Message{Payload: make([]byte, MaxPayload+1)})
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+
+	sub.Keys.Auth = "c2hvcnQ"
+	err = client.Send(context.Background(), sub, Message{Payload: []byte("x")})
+	assert.ErrorIs(t, err, ErrInvalidKeys)
+
+	assert.Zero(t, ps.count())
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	ps := newPushService(t)
+	client := newClient(t)
+	client.HTTPClient = NewHTTPClient(time.Second, false)
+
+	err := client.Send(context.Background(), newUserAgent(t).subscription(ps.URL), Message{Payload: []byte("x")})
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+	assert.False(t, retryable(err))
+	assert.Zero(t, ps.count())
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	ps := newPushService(t, http.StatusFound)
+	client := newClient(t)
+	client.HTTPClient = NewHTTPClient(time.Second, true)
+
+	err := client.Send(context.Background(), newUserAgent(t).subscription(ps.URL), Message{Payload: []byte("x")})
+
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusFound, statusErr.StatusCode)
+	assert.Equal(t, 1, ps.count())
+}
+
+func TestEncryptFitsMaxPayloadInSmallestMessage(t *testing.T) {
+	ua := newUserAgent(t)
+
+	body, err := Encrypt(ua.subscription("").Keys, make([]byte, MaxPayload))
+	require.NoError(t, err)
+	assert.Equal(t, 4096, len(body))
+}
+
+func TestWorkerRetriesTemporaryFailures(t *testing.T) {
+	ps := newPushService(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	ua := newUserAgent(t)
+
+	worker := NewWorker(newClient(t), WorkerOptions{Queue: 1, Retries: 2, Backoff: time.Millisecond}, slog.New(slog.DiscardHandler))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	require.True(t, worker.Enqueue(ua.subscription(ps.URL), Message{Payload: []byte("hello")}))
+
+	assert.Eventually(t, func() bool { return ps.count() == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, []byte("hello"), ua.decrypt(t, ps.bodies[2]))
+
+	cancel()
+	<-done
+}
+
+func TestWorkerPrunesGoneSubscriptions(t *testing.T) {
+	ps := newPushService(t, http.StatusGone)
+	sub := newUserAgent(t).subscription(ps.URL)
+
+	var gone atomic.Value
+	worker := NewWorker(newClient(t), WorkerOptions{
+		Queue:   1,
+		Retries: 3,
+		Backoff: time.Millisecond,
+		OnGone:  func(s Subscription) { gone.Store(s.Endpoint) },
+	}, slog.New(slog.DiscardHandler))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+
+	require.True(t, worker.Enqueue(sub, Message{Payload: []byte("x")}))
+
+	assert.Eventually(t, func() bool { return gone.Load() == sub.Endpoint }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, ps.count())
+}
+
+func TestWorkerDropsWhenQueueIsFull(t *testing.T) {
+	worker := NewWorker(newClient(t), WorkerOptions{Queue: 1}, slog.New(slog.DiscardHandler))
+	sub := newUserAgent(t).subscription("http://127.0.0.1")
+
+	assert.True(t, worker.Enqueue(sub, Message{}))
+	assert.False(t, worker.Enqueue(sub, Message{}))
+}
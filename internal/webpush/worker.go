@@ -0,0 +1,139 @@
+package webpush
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WorkerOptions configures a Worker.
+type WorkerOptions struct {
+	Queue       int           // Messages waiting to be sent before new ones are dropped.
+	Concurrency int           // Messages sent at the same time.
+	Retries     int           // Attempts made after a temporary failure.
+	Backoff     time.Duration // Wait before the first retry, doubled on each following one.
+	Timeout     time.Duration // Time limit of each attempt.
+
+	// OnGone is called with the subscriptions push services reported gone,
+	// so that they can be deleted.
+	OnGone func(Subscription)
+}
+
+type delivery struct {
+	sub Subscription
+	msg Message
+}
+
+// Worker delivers messages in the background, retrying temporary failures
+// with exponential backoff.
+type Worker struct {
+	client *Client
+	opts   WorkerOptions
+	queue  chan delivery
+	logger *slog.Logger
+}
+
+func NewWorker(client *Client, opts WorkerOptions, logger *slog.Logger) *Worker {
+	opts.Concurrency = max(opts.Concurrency, 1)
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	return &Worker{
+		client: client,
+		opts:   opts,
+		queue:  make(chan delivery, opts.Queue),
+		logger: logger,
+	}
+}
+
+// Enqueue queues msg for delivery to sub. It never blocks: it reports false
+// and drops the message when the queue is full.
+func (w *Worker) Enqueue(sub Subscription, msg Message) bool {
+	select {
+	case w.queue <- delivery{sub: sub, msg: msg}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run delivers queued messages until ctx is done, then waits for the
+// deliveries in progress to stop.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range w.opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-w.queue:
+					w.deliver(ctx, d)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) deliver(ctx context.Context, d delivery) {
+	backoff := w.opts.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := w.send(ctx, d)
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, ErrGone) {
+			if w.opts.OnGone != nil {
+				w.opts.OnGone(d.sub)
+			}
+			return
+		}
+
+		if !retryable(err) || attempt >= w.opts.Retries {
+			w.logger.Error("failed to deliver push message", "endpoint", d.sub.Endpoint, "attempts", attempt+1, "error", err.Error())
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (w *Worker) send(ctx context.Context, d delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+
+	return w.client.Send(ctx, d.sub, d.msg)
+}
+
+// retryable reports whether a failed delivery may succeed if attempted
+// again. Only malformed messages and subscriptions, endpoints at non-public
+// addresses, and rejections the push service doesn't call temporary, are
+// given up on right away.
+func retryable(err error) bool {
+	if errors.Is(err, ErrInvalidKeys) || errors.Is(err, ErrPayloadTooLarge) || errors.Is(err, ErrPrivateAddress) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+
+	return true
+}
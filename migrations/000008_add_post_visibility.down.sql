@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_post_mentions_user_id;
+
+DROP TABLE IF EXISTS post_mentions;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS visibility;
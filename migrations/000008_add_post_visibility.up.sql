@@ -0,0 +1,13 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+CHECK (visibility IN ('public', 'followers', 'friends', 'mentioned'));
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions(user_id);
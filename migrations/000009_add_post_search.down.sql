@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS post_hashtags_tag_idx;
+
+DROP TABLE IF EXISTS post_hashtags;
+
+DROP INDEX IF EXISTS posts_search_vector_idx;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,24 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS search_vector tsvector
+GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS posts_search_vector_idx
+ON posts
+USING gin (search_vector);
+
+CREATE TABLE IF NOT EXISTS post_hashtags (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL CHECK (tag = lower(tag)),
+
+    PRIMARY KEY (post_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS post_hashtags_tag_idx
+ON post_hashtags (tag text_pattern_ops);
+
+-- Backfill hashtags for posts created before this migration.
+INSERT INTO post_hashtags (post_id, tag)
+SELECT DISTINCT p.id, lower(m[1])
+FROM posts p,
+     regexp_matches(p.content, '#([A-Za-z0-9_]+)', 'g') AS m
+ON CONFLICT (post_id, tag) DO NOTHING;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS polls (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    post_id INTEGER NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    voters_count INTEGER NOT NULL DEFAULT 0 CHECK (voters_count >= 0),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL CHECK (position BETWEEN 0 AND 3),
+    text TEXT NOT NULL CHECK (length(trim(text)) > 0),
+    votes_count INTEGER NOT NULL DEFAULT 0 CHECK (votes_count >= 0),
+
+    CONSTRAINT poll_options_position_unique UNIQUE (poll_id, position)
+);
+
+-- One row per user who voted, guarding against voting twice.
+CREATE TABLE IF NOT EXISTS poll_voters (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (poll_id, user_id)
+);
+
+-- One row per chosen option; several per voter on multiple choice polls.
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    option_id INTEGER NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (poll_id, user_id, option_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_options_poll_id ON poll_options(poll_id);
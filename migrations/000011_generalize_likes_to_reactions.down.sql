@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_reactions_post_id_reaction;
+
+-- Only likes survive the rollback.
+DELETE FROM reactions WHERE reaction <> '👍';
+
+ALTER TABLE reactions
+DROP CONSTRAINT IF EXISTS unique_reaction;
+
+ALTER TABLE reactions
+DROP COLUMN IF EXISTS reaction;
+
+ALTER TABLE reactions
+ADD CONSTRAINT unique_like UNIQUE (user_id, post_id);
+
+ALTER INDEX IF EXISTS idx_reactions_user_id RENAME TO idx_likes_user_id;
+ALTER INDEX IF EXISTS idx_reactions_post_id RENAME TO idx_likes_post_id;
+
+ALTER TABLE reactions RENAME TO likes;
@@ -0,0 +1,20 @@
+-- Likes become the '👍' reaction of a more general reactions table.
+ALTER TABLE likes RENAME TO reactions;
+
+ALTER TABLE reactions
+ADD COLUMN IF NOT EXISTS reaction TEXT NOT NULL DEFAULT '👍'
+CHECK (length(reaction) BETWEEN 1 AND 32);
+
+ALTER TABLE reactions
+ALTER COLUMN reaction DROP DEFAULT;
+
+ALTER TABLE reactions
+DROP CONSTRAINT IF EXISTS unique_like;
+
+ALTER TABLE reactions
+ADD CONSTRAINT unique_reaction UNIQUE (user_id, post_id, reaction);
+
+ALTER INDEX IF EXISTS idx_likes_user_id RENAME TO idx_reactions_user_id;
+ALTER INDEX IF EXISTS idx_likes_post_id RENAME TO idx_reactions_post_id;
+
+CREATE INDEX IF NOT EXISTS idx_reactions_post_id_reaction ON reactions(post_id, reaction);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS timeline_pull_authors;
+DROP TABLE IF EXISTS timelines;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_created_at ON timelines(user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_timelines_user_id_author_id ON timelines(user_id, author_id);
+
+CREATE TABLE IF NOT EXISTS timeline_pull_authors (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Materialize the timelines of existing posts.
+INSERT INTO timelines (user_id, post_id, author_id, created_at)
+SELECT a.user_id, p.id, p.user_id, p.created_at
+FROM posts p
+JOIN (
+    SELECT id AS author_id, id AS user_id FROM users
+    UNION
+    SELECT followee_id, follower_id FROM follows
+    UNION
+    SELECT sender_id, receiver_id FROM friendships WHERE status = 'accepted'
+    UNION
+    SELECT receiver_id, sender_id FROM friendships WHERE status = 'accepted'
+) a ON a.author_id = p.user_id
+ON CONFLICT (user_id, post_id) DO NOTHING;
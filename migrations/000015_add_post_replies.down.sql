@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_posts_reply_to_id;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS reply_to_id;
@@ -0,0 +1,4 @@
+ALTER TABLE posts
+ADD COLUMN IF NOT EXISTS reply_to_id INTEGER REFERENCES posts(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_reply_to_id ON posts(reply_to_id, created_at) WHERE reply_to_id IS NOT NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    muted_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT unique_mute UNIQUE (user_id, muted_id),
+    CONSTRAINT no_self_mute CHECK (user_id <> muted_id)
+);
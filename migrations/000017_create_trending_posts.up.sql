@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS trending_posts (
+    window_name TEXT NOT NULL,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (window_name, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_posts_window_name_score ON trending_posts(window_name, score DESC);
+CREATE INDEX IF NOT EXISTS idx_reactions_created_at ON reactions(created_at);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('follow', 'reaction', 'reply', 'mention', 'friend_request', 'friend_accept')),
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
+    group_key TEXT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMP(0) WITH TIME ZONE,
+
+    CONSTRAINT no_self_notification CHECK (user_id <> actor_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_unique ON notifications(user_id, type, actor_id, (COALESCE(post_id, 0)));
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_group_key ON notifications(user_id, group_key);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+
+    PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,10 @@
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS target_id,
+    DROP COLUMN IF EXISTS kind;
+
+ALTER TABLE conversation_members
+    DROP COLUMN IF EXISTS role;
+
+ALTER TABLE conversations
+    DROP COLUMN IF EXISTS share_history,
+    DROP COLUMN IF EXISTS title;
@@ -0,0 +1,10 @@
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS title TEXT,
+    ADD COLUMN IF NOT EXISTS share_history BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE conversation_members
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member'));
+
+ALTER TABLE messages
+    ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'text' CHECK (kind IN ('text', 'system')),
+    ADD COLUMN IF NOT EXISTS target_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
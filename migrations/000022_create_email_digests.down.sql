@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS digest_settings;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS last_login_at;
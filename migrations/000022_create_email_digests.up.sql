@@ -0,0 +1,8 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS digest_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    frequency TEXT CHECK (frequency IN ('off', 'daily', 'weekly')), -- NULL for the configured default.
+    last_sent_at TIMESTAMP(0) WITH TIME ZONE
+);
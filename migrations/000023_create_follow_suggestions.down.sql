@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_last_login_at;
+DROP INDEX IF EXISTS idx_posts_user_id_created_at;
+DROP INDEX IF EXISTS idx_friendships_accepted_receiver_id;
+DROP INDEX IF EXISTS idx_friendships_accepted_sender_id;
+DROP TABLE IF EXISTS suggestion_dismissals;
+DROP TABLE IF EXISTS follow_suggestion_refreshes;
+DROP TABLE IF EXISTS follow_suggestions;
@@ -0,0 +1,40 @@
+-- Cached follow suggestions, recomputed periodically per user.
+CREATE TABLE IF NOT EXISTS follow_suggestions (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    suggested_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mutual_count INTEGER NOT NULL,
+    recent_posts INTEGER NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_suggestions_user_id_score ON follow_suggestions(user_id, score DESC, suggested_id);
+
+-- When each user's suggestions were last computed, including users who got
+-- none.
+CREATE TABLE IF NOT EXISTS follow_suggestion_refreshes (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_suggestion_refreshes_computed_at ON follow_suggestion_refreshes(computed_at);
+
+CREATE TABLE IF NOT EXISTS suggestion_dismissals (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    suggested_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    dismissed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+-- Walking the graph two steps away goes from each user to the people they
+-- follow, covered by the unique_follow index, and to their friends, in both
+-- directions of a friendship.
+CREATE INDEX IF NOT EXISTS idx_friendships_accepted_sender_id ON friendships(sender_id, receiver_id) WHERE status = 'accepted';
+CREATE INDEX IF NOT EXISTS idx_friendships_accepted_receiver_id ON friendships(receiver_id, sender_id) WHERE status = 'accepted';
+
+-- Counts the recent posts of candidates.
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts(user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users(last_login_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS follow_import_rows;
+DROP TABLE IF EXISTS follow_imports;
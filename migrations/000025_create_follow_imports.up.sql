@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS follow_imports (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checksum TEXT NOT NULL, -- SHA-256 of the imported usernames, so that uploading the same file twice is a no-op.
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    total INTEGER NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    heartbeat_at TIMESTAMP(0) WITH TIME ZONE,
+    completed_at TIMESTAMP(0) WITH TIME ZONE,
+
+    CONSTRAINT follow_imports_user_checksum_unique UNIQUE (user_id, checksum)
+);
+
+CREATE INDEX IF NOT EXISTS idx_follow_imports_user_id_created_at ON follow_imports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_follow_imports_unfinished ON follow_imports(id) WHERE status IN ('pending', 'running');
+
+CREATE TABLE IF NOT EXISTS follow_import_rows (
+    import_id INTEGER NOT NULL REFERENCES follow_imports(id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    result TEXT CHECK (result IN ('followed', 'already_following', 'not_found', 'blocked', 'self')),
+    followee_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+
+    PRIMARY KEY (import_id, row_number)
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS friendship_events;
+
+DROP INDEX IF EXISTS friendships_pair_unique;
+
+ALTER TABLE friendships
+ADD CONSTRAINT friendships_sender_receiver_unique
+UNIQUE (sender_id, receiver_id);
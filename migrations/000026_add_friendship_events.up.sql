@@ -0,0 +1,32 @@
+-- A pair of users has a single friendship row, whichever of them sent the
+-- request. Keep blocks first, then accepted friendships, then the oldest
+-- request.
+DELETE FROM friendships f
+USING friendships other
+WHERE LEAST(f.sender_id, f.receiver_id) = LEAST(other.sender_id, other.receiver_id)
+    AND GREATEST(f.sender_id, f.receiver_id) = GREATEST(other.sender_id, other.receiver_id)
+    AND f.id <> other.id
+    AND (CASE f.status WHEN 'blocked' THEN 3 WHEN 'accepted' THEN 2 ELSE 1 END, -f.id)
+        < (CASE other.status WHEN 'blocked' THEN 3 WHEN 'accepted' THEN 2 ELSE 1 END, -other.id);
+
+ALTER TABLE friendships DROP CONSTRAINT IF EXISTS friendships_sender_receiver_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS friendships_pair_unique
+ON friendships (LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id));
+
+CREATE TABLE IF NOT EXISTS friendship_events (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    friendship_id INTEGER, -- Friendships are deleted when they end, so this isn't a foreign key.
+    actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subject_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL CHECK (event IN ('request', 'accept', 'decline', 'cancel', 'unfriend', 'block', 'unblock')),
+    from_status TEXT NOT NULL CHECK (from_status IN ('none', 'pending', 'accepted', 'blocked')),
+    to_status TEXT NOT NULL CHECK (to_status IN ('none', 'pending', 'accepted', 'blocked')),
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_friendship_events_pair
+ON friendship_events (LEAST(actor_id, subject_id), GREATEST(actor_id, subject_id), created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_friendship_events_declines
+ON friendship_events (actor_id, subject_id, created_at DESC) WHERE event = 'decline';
@@ -0,0 +1,9 @@
+UPDATE posts SET visibility = 'friends' WHERE visibility = 'close_friends';
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_visibility_check;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_visibility_check
+CHECK (visibility IN ('public', 'followers', 'friends', 'mentioned'));
+
+DROP TABLE IF EXISTS close_friends;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS close_friends (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    friend_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    UNIQUE (user_id, friend_id),
+    CHECK (user_id <> friend_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_close_friends_friend_id ON close_friends(friend_id);
+
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_visibility_check;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_visibility_check
+CHECK (visibility IN ('public', 'followers', 'friends', 'close_friends', 'mentioned'));
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    -- Transaction which wrote the event. Events are read in (txid, id) order,
+    -- up to the oldest transaction still in progress.
+    txid BIGINT NOT NULL DEFAULT txid_current(),
+    type TEXT NOT NULL,
+    actor_id INTEGER NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_position ON outbox_events (txid, id);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_created_at ON outbox_events (created_at);
+
+CREATE TABLE IF NOT EXISTS outbox_offsets (
+    consumer TEXT PRIMARY KEY,
+    last_txid BIGINT NOT NULL,
+    last_id BIGINT NOT NULL,
+    owner TEXT NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    queue TEXT NOT NULL DEFAULT 'default',
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'running', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 10 CHECK (max_attempts > 0),
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    unique_key TEXT,
+    locked_by TEXT,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due
+ON jobs (queue, run_at, id) WHERE state = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_leases
+ON jobs (locked_until) WHERE state = 'running';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_key
+ON jobs (unique_key) WHERE unique_key IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_state_created_at
+ON jobs (state, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at
+ON jobs (created_at DESC, id DESC);
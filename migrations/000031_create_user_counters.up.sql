@@ -0,0 +1,20 @@
+-- Per user counts shown on profiles, kept up to date by the "counters"
+-- outbox consumer rather than counted on every read.
+CREATE TABLE IF NOT EXISTS user_counters (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    followers_count INTEGER NOT NULL DEFAULT 0,
+    following_count INTEGER NOT NULL DEFAULT 0,
+    friends_count INTEGER NOT NULL DEFAULT 0,
+    posts_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO user_counters (user_id, followers_count, following_count, friends_count, posts_count)
+SELECT
+    u.id,
+    (SELECT COUNT(*) FROM follows WHERE followee_id = u.id),
+    (SELECT COUNT(*) FROM follows WHERE follower_id = u.id),
+    (SELECT COUNT(*) FROM friendships WHERE status = 'accepted' AND u.id IN (sender_id, receiver_id)),
+    (SELECT COUNT(*) FROM posts WHERE user_id = u.id)
+FROM users u
+ON CONFLICT (user_id) DO NOTHING;
@@ -0,0 +1,12 @@
+-- When each trending window was last refreshed, including windows where no
+-- post qualified.
+CREATE TABLE IF NOT EXISTS trending_refreshes (
+    window_name TEXT PRIMARY KEY,
+    computed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO trending_refreshes (window_name, computed_at)
+SELECT window_name, MAX(computed_at)
+FROM trending_posts
+GROUP BY window_name
+ON CONFLICT (window_name) DO NOTHING;